@@ -15,6 +15,7 @@ import (
 	membercfgctrl "github.com/codeready-toolchain/member-operator/controllers/memberoperatorconfig"
 	"github.com/codeready-toolchain/member-operator/controllers/memberstatus"
 	"github.com/codeready-toolchain/member-operator/controllers/nstemplateset"
+	"github.com/codeready-toolchain/member-operator/controllers/resourceusage"
 	"github.com/codeready-toolchain/member-operator/controllers/useraccount"
 	"github.com/codeready-toolchain/member-operator/deploy"
 	"github.com/codeready-toolchain/member-operator/pkg/apis"
@@ -49,6 +50,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 	runtimecluster "sigs.k8s.io/controller-runtime/pkg/cluster"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	ctrllog "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	//+kubebuilder:scaffold:imports
 )
@@ -146,6 +148,11 @@ func main() {
 		setupLog.Error(err, "")
 		os.Exit(1)
 	}
+	// the warnings returned by the API server are logged, and collected when needed (e.g. about the existing pods which violate
+	// the tightened pod security level of a namespace)
+	cfg.WarningHandlerWithContext = nstemplateset.NewWarningHandler(ctrllog.NewKubeAPIWarningLogger(ctrllog.KubeAPIWarningLoggerOptions{
+		Deduplicate: true,
+	}))
 
 	namespace, err := commonconfig.GetWatchNamespace()
 	if err != nil {
@@ -192,6 +199,8 @@ func main() {
 	// resources (secrets, etc.).
 	allNamespacesCluster, err := runtimecluster.New(cfg, func(options *runtimecluster.Options) {
 		options.Scheme = scheme
+		// the PodMetrics cannot be watched either (see above)
+		options.Client = client.Options{Cache: &client.CacheOptions{DisableFor: []client.Object{&kmetrics.PodMetrics{}}}}
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start allNamespaceCluster")
@@ -265,29 +274,40 @@ func main() {
 		os.Exit(1)
 	}
 
+	nsTemplateSetReconciler := nstemplateset.NewReconciler(&nstemplateset.APIClient{
+		Client:               mgr.GetClient(),
+		AllNamespacesClient:  allNamespacesCluster.GetClient(),
+		Scheme:               mgr.GetScheme(),
+		GetHostClusterClient: hostClientInitializer.GetHostClient,
+	})
 	if err = (&memberstatus.Reconciler{
 		Client:              mgr.GetClient(),
 		Scheme:              mgr.GetScheme(),
 		GetHostCluster:      cluster.GetHostCluster,
 		AllNamespacesClient: allNamespacesCluster.GetClient(),
 		VersionCheckManager: status.VersionCheckManager{GetGithubClientFunc: commonclient.NewGitHubClient},
+		// the halt of the updates of the spaces is exposed in the MemberStatus
+		GetUpdateRolloutStatus: nsTemplateSetReconciler.UpdateRolloutStatus,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "MemberStatus")
 		os.Exit(1)
 	}
-	if err = (nstemplateset.NewReconciler(&nstemplateset.APIClient{
-		Client:               mgr.GetClient(),
-		AllNamespacesClient:  allNamespacesCluster.GetClient(),
-		Scheme:               mgr.GetScheme(),
-		GetHostClusterClient: hostClientInitializer.GetHostClient,
-	})).SetupWithManager(mgr, allNamespacesCluster, discoveryClient); err != nil {
+	if err = nsTemplateSetReconciler.SetupWithManager(mgr, allNamespacesCluster, discoveryClient); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "NSTemplateSet")
 		os.Exit(1)
 	}
+	if err = (&resourceusage.Reconciler{
+		Client:              mgr.GetClient(),
+		AllNamespacesClient: allNamespacesCluster.GetClient(),
+		RefreshPeriod:       resourceusage.DefaultRefreshPeriod,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ResourceUsage")
+		os.Exit(1)
+	}
 	if err = (&useraccount.Reconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	}).SetupWithManager(mgr, discoveryClient); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "UserAccount")
 		os.Exit(1)
 	}
@@ -0,0 +1,198 @@
+// The render-tiertemplate command prints the objects which the member operator would apply for a space,
+// given a TierTemplate (and optionally one of its TierTemplateRevisions), without the need to deploy the template to a cluster.
+//
+// Usage:
+//
+//	render-tiertemplate -f tiertemplate.yaml [-f tiertemplaterevision.yaml] -space johnsmith [-kind namespace] [-features feature-1,feature-2]
+//	render-tiertemplate -f tiertemplaterevision.yaml -type dev -space johnsmith [-pod-security-minimum-level baseline] [-vanilla-kubernetes]
+//	render-tiertemplate -f tiertemplate.yaml -kind spacerole -space johnsmith -username john -namespace johnsmith-dev [-param KEY=VALUE]
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/controllers/nstemplateset"
+	"github.com/codeready-toolchain/member-operator/pkg/apis"
+	"github.com/codeready-toolchain/toolchain-common/pkg/utils"
+	quotav1 "github.com/openshift/api/quota/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// multiFlag is a flag which can be set multiple times
+type multiFlag []string
+
+func (f *multiFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *multiFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, out io.Writer) error {
+	var files, params multiFlag
+	flags := flag.NewFlagSet("render-tiertemplate", flag.ContinueOnError)
+	flags.Var(&files, "f", "the YAML file containing the TierTemplate and/or the TierTemplateRevision to render (can be repeated)")
+	kind := flags.String("kind", "", "the kind of template: 'clusterresources', 'namespace' or 'spacerole' (defaults to 'clusterresources' or 'namespace', depending on the type of the TierTemplate)")
+	space := flags.String("space", "", "the name of the space (SPACE_NAME)")
+	username := flags.String("username", "", "the name of the user (USERNAME), for the space role templates")
+	namespace := flags.String("namespace", "", "the name of the namespace (NAMESPACE), for the space role templates")
+	features := flags.String("features", "", "the comma-separated list of the feature toggles enabled in the space")
+	operatorNamespace := flags.String("member-operator-namespace", "toolchain-member-operator", "the namespace of the member operator (MEMBER_OPERATOR_NAMESPACE)")
+	typeName := flags.String("type", "", "the type of the template (e.g. 'dev' or 'clusterresources'), when only a TierTemplateRevision without type label is provided")
+	podSecurityMinimumLevel := flags.String("pod-security-minimum-level", "", "the minimum pod security level of the namespaces in the cluster")
+	vanillaKubernetes := flags.Bool("vanilla-kubernetes", false, "render the objects for a vanilla Kubernetes cluster, without the OpenShift API groups")
+	namespaces := flags.String("namespaces", "", "the comma-separated list of the namespaces of the space, in which the quotas of the cluster resources templates are split on a vanilla Kubernetes cluster")
+	flags.Var(&params, "param", "an additional parameter of the space role templates, as KEY=VALUE (can be repeated)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no file provided")
+	}
+
+	s := runtime.NewScheme()
+	if err := scheme.AddToScheme(s); err != nil {
+		return err
+	}
+	if err := apis.AddToScheme(s); err != nil {
+		return err
+	}
+	tmpl, ttr, err := load(s, files, *typeName)
+	if err != nil {
+		return err
+	}
+
+	opts := nstemplateset.RenderOptions{
+		Kind:                    nstemplateset.RenderKind(*kind),
+		SpaceName:               *space,
+		Username:                *username,
+		Namespace:               *namespace,
+		Features:                utils.SplitCommaSeparatedList(*features),
+		Parameters:              map[string]string{},
+		OperatorNamespace:       *operatorNamespace,
+		PodSecurityMinimumLevel: *podSecurityMinimumLevel,
+		Namespaces:              utils.SplitCommaSeparatedList(*namespaces),
+	}
+	if !*vanillaKubernetes {
+		opts.AvailableAPIGroups = []metav1.APIGroup{
+			{
+				Name: quotav1.GroupName,
+				Versions: []metav1.GroupVersionForDiscovery{
+					{GroupVersion: quotav1.GroupVersion.String(), Version: quotav1.GroupVersion.Version},
+				},
+			},
+		}
+	}
+	if opts.Kind == "" {
+		opts.Kind = nstemplateset.RenderNamespace
+		if tmpl.Spec.Type == "clusterresources" {
+			opts.Kind = nstemplateset.RenderClusterResources
+		}
+	}
+	for _, param := range params {
+		name, value, found := strings.Cut(param, "=")
+		if !found {
+			return fmt.Errorf("invalid parameter '%s': expected KEY=VALUE", param)
+		}
+		opts.Parameters[name] = value
+	}
+	objs, err := nstemplateset.Render(s, tmpl, ttr, opts)
+	if err != nil {
+		return err
+	}
+	for i, obj := range objs {
+		content, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := fmt.Fprintln(out, "---"); err != nil {
+				return err
+			}
+		}
+		if _, err := out.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load returns the TierTemplate and the TierTemplateRevision (if any) contained in the given files.
+// If there is only a TierTemplateRevision, then the TierTemplate is derived from its labels, or from the given type (if any).
+func load(s *runtime.Scheme, files []string, typeName string) (*toolchainv1alpha1.TierTemplate, *toolchainv1alpha1.TierTemplateRevision, error) {
+	decoder := serializer.NewCodecFactory(s).UniversalDeserializer()
+	var tmpl *toolchainv1alpha1.TierTemplate
+	var ttr *toolchainv1alpha1.TierTemplateRevision
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(content), 4096)
+		for {
+			raw := runtime.RawExtension{}
+			if err := reader.Decode(&raw); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, nil, fmt.Errorf("unable to read '%s': %w", file, err)
+			}
+			if len(bytes.TrimSpace(raw.Raw)) == 0 {
+				continue
+			}
+			obj, _, err := decoder.Decode(raw.Raw, nil, nil)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to decode the content of '%s': %w", file, err)
+			}
+			switch o := obj.(type) {
+			case *toolchainv1alpha1.TierTemplate:
+				tmpl = o
+			case *toolchainv1alpha1.TierTemplateRevision:
+				ttr = o
+			default:
+				return nil, nil, fmt.Errorf("unexpected kind of object in '%s': %s", file, obj.GetObjectKind().GroupVersionKind().Kind)
+			}
+		}
+	}
+	switch {
+	case tmpl != nil:
+		return tmpl, ttr, nil
+	case ttr != nil:
+		if typeName == "" {
+			typeName = ttr.Labels[toolchainv1alpha1.TypeLabelKey]
+		}
+		if typeName == "" {
+			return nil, nil, fmt.Errorf("the type of the TierTemplateRevision '%s' is unknown: use the -type flag", ttr.Name)
+		}
+		return &toolchainv1alpha1.TierTemplate{
+			ObjectMeta: ttr.ObjectMeta,
+			Spec: toolchainv1alpha1.TierTemplateSpec{
+				TierName: ttr.Labels[toolchainv1alpha1.TierLabelKey],
+				Type:     typeName,
+			},
+		}, ttr, nil
+	default:
+		return nil, nil, errors.New("no TierTemplate nor TierTemplateRevision found")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/controllers/nstemplateset"
 	"github.com/codeready-toolchain/member-operator/version"
 	commonclient "github.com/codeready-toolchain/toolchain-common/pkg/client"
 	"github.com/codeready-toolchain/toolchain-common/pkg/cluster"
@@ -63,6 +64,8 @@ type Reconciler struct {
 	GetHostCluster      func() (*cluster.CachedToolchainCluster, bool)
 	AllNamespacesClient client.Client
 	VersionCheckManager status.VersionCheckManager
+	// GetUpdateRolloutStatus returns the status of the updates of the spaces to new templates (see nstemplateset.Reconciler.UpdateRolloutStatus)
+	GetUpdateRolloutStatus func(ctx context.Context, namespace string) (nstemplateset.UpdateRolloutStatus, error)
 }
 
 //+kubebuilder:rbac:groups=toolchain.dev.openshift.com,resources=memberstatuses,verbs=get;list;watch;create;update;patch;delete
@@ -136,11 +139,26 @@ func (r *Reconciler) aggregateAndUpdateStatus(ctx context.Context, memberStatus
 		}
 	}
 
+	// Expose the halt of the updates of the spaces to new templates, if any
+	var otherConditions []toolchainv1alpha1.Condition
+	if r.GetUpdateRolloutStatus != nil {
+		if rollout, err := r.GetUpdateRolloutStatus(ctx, memberStatus.Namespace); err != nil {
+			log.FromContext(ctx).Error(err, "unable to get the status of the updates of the spaces")
+		} else if rollout.Halted {
+			otherConditions = append(otherConditions, toolchainv1alpha1.Condition{
+				Type:    nstemplateset.TemplateUpdatesHaltedConditionType,
+				Status:  corev1.ConditionTrue,
+				Reason:  nstemplateset.NSTemplateSetUpdatesHaltedReason,
+				Message: rollout.Message,
+			})
+		}
+	}
+
 	// If any components were not ready then set the overall status to not ready
 	if len(unreadyComponents) > 0 {
-		return r.setStatusNotReady(ctx, memberStatus, fmt.Sprintf("components not ready: %v", unreadyComponents))
+		return r.setStatusNotReady(ctx, memberStatus, fmt.Sprintf("components not ready: %v", unreadyComponents), otherConditions...)
 	}
-	return r.setStatusReady(ctx, memberStatus)
+	return r.setStatusReady(ctx, memberStatus, otherConditions...)
 }
 
 // hostConnectionHandleStatus retrieves the host cluster object that represents the connection between this member cluster and the host cluster.
@@ -351,27 +369,31 @@ func (r *Reconciler) updateStatusConditions(ctx context.Context, memberStatus *t
 	return r.Client.Status().Update(ctx, memberStatus)
 }
 
-func (r *Reconciler) setStatusReady(ctx context.Context, memberStatus *toolchainv1alpha1.MemberStatus) error {
+func (r *Reconciler) setStatusReady(ctx context.Context, memberStatus *toolchainv1alpha1.MemberStatus, otherConditions ...toolchainv1alpha1.Condition) error {
 	return r.updateStatusConditions(
 		ctx,
 		memberStatus,
-		toolchainv1alpha1.Condition{
-			Type:   toolchainv1alpha1.ConditionReady,
-			Status: corev1.ConditionTrue,
-			Reason: toolchainv1alpha1.ToolchainStatusAllComponentsReadyReason,
-		})
+		append([]toolchainv1alpha1.Condition{
+			{
+				Type:   toolchainv1alpha1.ConditionReady,
+				Status: corev1.ConditionTrue,
+				Reason: toolchainv1alpha1.ToolchainStatusAllComponentsReadyReason,
+			},
+		}, otherConditions...)...)
 }
 
-func (r *Reconciler) setStatusNotReady(ctx context.Context, memberStatus *toolchainv1alpha1.MemberStatus, message string) error {
+func (r *Reconciler) setStatusNotReady(ctx context.Context, memberStatus *toolchainv1alpha1.MemberStatus, message string, otherConditions ...toolchainv1alpha1.Condition) error {
 	return r.updateStatusConditions(
 		ctx,
 		memberStatus,
-		toolchainv1alpha1.Condition{
-			Type:    toolchainv1alpha1.ConditionReady,
-			Status:  corev1.ConditionFalse,
-			Reason:  toolchainv1alpha1.ToolchainStatusComponentsNotReadyReason,
-			Message: message,
-		})
+		append([]toolchainv1alpha1.Condition{
+			{
+				Type:    toolchainv1alpha1.ConditionReady,
+				Status:  corev1.ConditionFalse,
+				Reason:  toolchainv1alpha1.ToolchainStatusComponentsNotReadyReason,
+				Message: message,
+			},
+		}, otherConditions...)...)
 }
 
 func (r *Reconciler) consoleURL(ctx context.Context, config membercfg.Configuration) (string, error) {
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/controllers/nstemplateset"
 	"github.com/codeready-toolchain/member-operator/pkg/apis"
 	. "github.com/codeready-toolchain/member-operator/test"
 	"github.com/codeready-toolchain/member-operator/version"
@@ -129,6 +130,34 @@ func TestOverallStatusCondition(t *testing.T) {
 			HasMemberOperatorRevisionCheckConditions(ConditionReady(toolchainv1alpha1.ToolchainStatusDeploymentUpToDateReason)).
 			HasRoutes("https://console.member-cluster/console/", routesAvailable())
 
+		t.Run("with the updates of the spaces halted", func(t *testing.T) {
+			// given
+			reconciler, req, fakeClient := prepareReconcile(t, requestName, getHostClusterFunc, allNamespacesCl, mockLastGitHubAPICall, test.MockGitHubClientForRepositoryCommits(buildCommitSHA, commitTimeStamp),
+				append(nodeAndMetrics, memberOperatorDeployment, newMemberStatus(), prodConfig, githubSecret)...)
+			reconciler.GetUpdateRolloutStatus = func(_ context.Context, namespace string) (nstemplateset.UpdateRolloutStatus, error) {
+				assert.Equal(t, test.MemberOperatorNs, namespace)
+				return nstemplateset.UpdateRolloutStatus{
+					Failed:    3,
+					Succeeded: 2,
+					Halted:    true,
+					Message:   "the updates of the spaces are halted: 3 of the last 5 updates failed (threshold: 0.5)",
+				}, nil
+			}
+
+			// when
+			_, err := reconciler.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatMemberStatus(t, req.Namespace, requestName, fakeClient).
+				HasConditions(ComponentsReady(), toolchainv1alpha1.Condition{
+					Type:    nstemplateset.TemplateUpdatesHaltedConditionType,
+					Status:  corev1.ConditionTrue,
+					Reason:  nstemplateset.NSTemplateSetUpdatesHaltedReason,
+					Message: "the updates of the spaces are halted: 3 of the last 5 updates failed (threshold: 0.5)",
+				})
+		})
+
 		t.Run("when node has multiple roles", func(t *testing.T) {
 			// given
 			nodeAndMetrics := newNodesAndNodeMetrics(
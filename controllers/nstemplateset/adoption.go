@@ -0,0 +1,98 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/constants"
+	"github.com/redhat-cop/operator-utils/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// AdoptIntoSpaceAnnotationKey is the annotation to set on a pre-existing namespace, with the name of the space as its value,
+	// to allow the space to adopt the namespace
+	AdoptIntoSpaceAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "adopt-into-space"
+	// AdoptNamespacesAnnotationKey is the annotation to set on an NSTemplateSet, with a comma-separated list of namespace names as its value,
+	// to allow the space to adopt the given pre-existing namespaces
+	AdoptNamespacesAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "adopt-namespaces"
+	// AdoptedIntoSpaceAnnotationKey is the annotation set on the namespaces which were adopted by a space, with the name of the space as its value
+	AdoptedIntoSpaceAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "adopted-into-space"
+)
+
+// checkAdoption verifies that the namespaces among the given template objects either don't exist yet, already belong to the space, or can be adopted by it.
+// A pre-existing namespace can be adopted only if it does not belong to any space and if the adoption was explicitly allowed, either via
+// the AdoptIntoSpaceAnnotationKey annotation on the namespace or via the AdoptNamespacesAnnotationKey annotation on the NSTemplateSet.
+// The namespaces which are controlled by another component, i.e. which have an owner or whose fields are applied by another
+// field manager (such as a GitOps controller), are never adopted, since the other component would keep reverting the changes
+// of the templates. The namespaces created or edited imperatively (e.g. with `kubectl create namespace`) can be adopted.
+// The template objects of the namespaces to adopt are marked with the AdoptedIntoSpaceAnnotationKey annotation, so that the adoption is recorded
+// once they are applied.
+func (r *namespacesManager) checkAdoption(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, objs []runtimeclient.Object) error {
+	for _, obj := range objs {
+		if obj.GetObjectKind().GroupVersionKind().Kind != "Namespace" {
+			continue
+		}
+		existing := &corev1.Namespace{}
+		if err := r.Client.Get(ctx, runtimeclient.ObjectKeyFromObject(obj), existing); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("unable to get the namespace '%s': %w", obj.GetName(), err)
+		}
+		owner, owned := existing.GetLabels()[toolchainv1alpha1.SpaceLabelKey]
+		switch {
+		case owner == nsTmplSet.GetName():
+			continue
+		case owned:
+			return fmt.Errorf("the namespace '%s' already exists and belongs to the space '%s'", existing.Name, owner)
+		case util.IsBeingDeleted(existing):
+			return fmt.Errorf("the namespace '%s' already exists and is being deleted", existing.Name)
+		case len(existing.GetOwnerReferences()) > 0:
+			ownerRef := existing.GetOwnerReferences()[0]
+			return fmt.Errorf("the namespace '%s' already exists and is owned by %s '%s'", existing.Name, ownerRef.Kind, ownerRef.Name)
+		case foreignApplyManager(existing) != "":
+			return fmt.Errorf("the namespace '%s' already exists and is managed by '%s'", existing.Name, foreignApplyManager(existing))
+		case !adoptionAllowed(nsTmplSet, existing):
+			return fmt.Errorf("the namespace '%s' already exists and does not belong to any space - set the '%s' annotation to '%s' on the namespace to adopt it",
+				existing.Name, AdoptIntoSpaceAnnotationKey, nsTmplSet.GetName())
+		}
+		log.FromContext(ctx).Info("adopting pre-existing namespace", "namespace", existing.Name)
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[AdoptedIntoSpaceAnnotationKey] = nsTmplSet.GetName()
+		obj.SetAnnotations(annotations)
+	}
+	return nil
+}
+
+func adoptionAllowed(nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespace *corev1.Namespace) bool {
+	if namespace.GetAnnotations()[AdoptIntoSpaceAnnotationKey] == nsTmplSet.GetName() {
+		return true
+	}
+	for _, name := range strings.Split(nsTmplSet.GetAnnotations()[AdoptNamespacesAnnotationKey], ",") {
+		if strings.TrimSpace(name) == namespace.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// foreignApplyManager returns the name of the first field manager, other than the member operator, which applies the fields
+// of the given namespace via server-side apply, or an empty string if there is none
+func foreignApplyManager(namespace *corev1.Namespace) string {
+	for _, managedFields := range namespace.GetManagedFields() {
+		if managedFields.Operation == metav1.ManagedFieldsOperationApply && managedFields.Manager != constants.MemberOperatorFieldManager {
+			return managedFields.Manager
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAdoptNamespace(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	newLegacyNamespace := func(labels, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        spacename + "-dev",
+				Labels:      labels,
+				Annotations: annotations,
+			},
+			Status: corev1.NamespaceStatus{Phase: corev1.NamespaceActive},
+		}
+	}
+
+	t.Run("adopted when allowed via the namespace annotation", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev"))
+		legacyNS := newLegacyNamespace(nil, map[string]string{AdoptIntoSpaceAnnotationKey: spacename})
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, legacyNS)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioning())
+		AssertThatNamespace(t, legacyNS.Name, fakeClient).
+			HasLabel(toolchainv1alpha1.SpaceLabelKey, spacename).
+			HasLabel(toolchainv1alpha1.TypeLabelKey, "dev").
+			HasAnnotation(AdoptedIntoSpaceAnnotationKey, spacename)
+
+		t.Run("template applied in the adopted namespace", func(t *testing.T) {
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNamespace(t, legacyNS.Name, fakeClient).
+				HasLabel(toolchainv1alpha1.TemplateRefLabelKey, "basic-dev-abcde11").
+				HasAnnotation(AdoptedIntoSpaceAnnotationKey, spacename)
+		})
+	})
+
+	t.Run("adopted when allowed via the NSTemplateSet annotation", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev"))
+		nsTmplSet.Annotations = map[string]string{AdoptNamespacesAnnotationKey: "johnsmith-stage, johnsmith-dev"}
+		legacyNS := newLegacyNamespace(nil, nil)
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, legacyNS)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNamespace(t, legacyNS.Name, fakeClient).
+			HasLabel(toolchainv1alpha1.SpaceLabelKey, spacename).
+			HasAnnotation(AdoptedIntoSpaceAnnotationKey, spacename)
+	})
+
+	t.Run("adopted when created imperatively", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev"))
+		legacyNS := withManagedFields(newLegacyNamespace(nil, map[string]string{AdoptIntoSpaceAnnotationKey: spacename}), "kubectl-create", metav1.ManagedFieldsOperationUpdate)
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, legacyNS)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNamespace(t, legacyNS.Name, fakeClient).
+			HasAnnotation(AdoptedIntoSpaceAnnotationKey, spacename)
+	})
+
+	t.Run("not adopted", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			namespace *corev1.Namespace
+			message   string
+		}{
+			"when not allowed": {
+				namespace: newLegacyNamespace(nil, nil),
+				message:   "the namespace 'johnsmith-dev' already exists and does not belong to any space - set the 'toolchain.dev.openshift.com/adopt-into-space' annotation to 'johnsmith' on the namespace to adopt it",
+			},
+			"when allowed for another space": {
+				namespace: newLegacyNamespace(nil, map[string]string{AdoptIntoSpaceAnnotationKey: "other"}),
+				message:   "the namespace 'johnsmith-dev' already exists and does not belong to any space - set the 'toolchain.dev.openshift.com/adopt-into-space' annotation to 'johnsmith' on the namespace to adopt it",
+			},
+			"when it belongs to another space": {
+				namespace: newLegacyNamespace(map[string]string{toolchainv1alpha1.SpaceLabelKey: "other"}, map[string]string{AdoptIntoSpaceAnnotationKey: spacename}),
+				message:   "the namespace 'johnsmith-dev' already exists and belongs to the space 'other'",
+			},
+			"when it has an owner": {
+				namespace: withOwnerReference(newLegacyNamespace(nil, map[string]string{AdoptIntoSpaceAnnotationKey: spacename})),
+				message:   "the namespace 'johnsmith-dev' already exists and is owned by Project 'johnsmith-dev'",
+			},
+			"when it is applied by another field manager": {
+				namespace: withManagedFields(newLegacyNamespace(nil, map[string]string{AdoptIntoSpaceAnnotationKey: spacename}), "argocd-controller", metav1.ManagedFieldsOperationApply),
+				message:   "the namespace 'johnsmith-dev' already exists and is managed by 'argocd-controller'",
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev"))
+				r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, tc.namespace)
+
+				// when
+				_, err := r.Reconcile(context.TODO(), req)
+
+				// then
+				require.EqualError(t, err, "unable to adopt the namespace with type 'dev': "+tc.message)
+				AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+					HasConditions(UnableToProvisionNamespace(tc.message))
+				AssertThatNamespace(t, tc.namespace.Name, fakeClient).
+					HasNoLabel(toolchainv1alpha1.TypeLabelKey).
+					HasNoAnnotation(AdoptedIntoSpaceAnnotationKey)
+			})
+		}
+	})
+}
+
+func withOwnerReference(namespace *corev1.Namespace) *corev1.Namespace {
+	namespace.OwnerReferences = []metav1.OwnerReference{{
+		APIVersion: "project.openshift.io/v1",
+		Kind:       "Project",
+		Name:       namespace.Name,
+		UID:        "a1b2c3",
+	}}
+	return namespace
+}
+
+func withManagedFields(namespace *corev1.Namespace, manager string, operation metav1.ManagedFieldsOperationType) *corev1.Namespace {
+	namespace.ManagedFields = []metav1.ManagedFieldsEntry{{
+		Manager:    manager,
+		Operation:  operation,
+		APIVersion: "v1",
+		FieldsType: "FieldsV1",
+		FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:team":{}}}}`)},
+	}}
+	return namespace
+}
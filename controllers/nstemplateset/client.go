@@ -2,16 +2,21 @@ package nstemplateset
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/constants"
 	"github.com/codeready-toolchain/member-operator/pkg/host"
 	applycl "github.com/codeready-toolchain/toolchain-common/pkg/client"
+	errs "github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -21,14 +26,26 @@ type APIClient struct {
 	Scheme               *runtime.Scheme
 	GetHostClusterClient host.ClientGetter
 	AvailableAPIGroups   []metav1.APIGroup
+	// kinds adds the watches for the kinds of the applied objects
+	kinds *kindWatcher
 }
 
 // ApplyToolchainObjects applies the given ToolchainObjects with the given labels.
 // If any object is marked as optional, then it checks if the API group is available - if not, then it skips the object.
-func (c APIClient) ApplyToolchainObjects(ctx context.Context, toolchainObjects []runtimeclient.Object, newLabels map[string]string) (bool, error) {
+// The same applies to the objects of the OpenShift API groups (e.g. `authorization.openshift.io`), so that the same templates
+// can be used on vanilla Kubernetes, where these API groups do not exist. Such objects are reported in the UnsupportedObjects
+// condition of the NSTemplateSet (see updateStatusFieldConflicts).
+//
+// The objects are applied server-side with the member operator field manager, so that the fields which are not part of the templates
+// and which are owned by other field managers are kept as-is. The fields owned by other field managers are overridden, unless
+// the kind of the object is among the given unforced kinds: in such a case, the object is not applied and the conflicts
+// are returned as a FieldConflictsError once all the other objects are applied. These conflicts are not fatal for the NSTemplateSet,
+// and are reported in its FieldConflicts condition (see updateStatusFieldConflicts).
+func (c APIClient) ApplyToolchainObjects(ctx context.Context, toolchainObjects []runtimeclient.Object, newLabels map[string]string, unforcedKinds []string) (bool, error) {
 	applyClient := applycl.NewApplyClient(c.Client)
 	anyApplied := false
 	logger := log.FromContext(ctx)
+	conflictsErr := &FieldConflictsError{}
 
 	for _, object := range toolchainObjects {
 		if _, exists := object.GetAnnotations()[toolchainv1alpha1.TierTemplateObjectOptionalResourceAnnotation]; exists {
@@ -37,6 +54,11 @@ func (c APIClient) ApplyToolchainObjects(ctx context.Context, toolchainObjects [
 				continue
 			}
 		}
+		if c.unsupportedObject(object) {
+			logger.Info("the object belongs to an OpenShift API group which is not present - skipping...", "gvk", object.GetObjectKind().GroupVersionKind().String(), "name", object.GetName())
+			continue
+		}
+		c.kinds.ensureWatched(ctx, object)
 		// Special handling of ServiceAccounts is required because if a ServiceAccount is reapplied when it already exists, it causes Kubernetes controllers to
 		// automatically create new Secrets for the ServiceAccounts. After enough time the number of Secrets created will hit the Secrets quota and then no new
 		// Secrets can be created. To prevent this from happening, we fetch the already existing SA, update labels and annotations only, and then call update using the same object (keeping the refs to secrets).
@@ -67,16 +89,107 @@ func (c APIClient) ApplyToolchainObjects(ctx context.Context, toolchainObjects [
 			continue
 		}
 		logger.Info("applying object", "object_namespace", object.GetNamespace(), "object_name", object.GetObjectKind().GroupVersionKind().Kind+"/"+object.GetName())
-		_, err := applyClient.Apply(ctx, []runtimeclient.Object{object}, newLabels)
-		if err != nil {
+		if err := c.applyObject(ctx, object, newLabels, unforcedKinds); err != nil {
+			// the server reports the conflicts only when the ownership of the fields is not forced
+			if conflicts := fieldConflicts(err); len(conflicts) > 0 {
+				logger.Info("the object has fields owned by other field managers - skipping...", "object_namespace", object.GetNamespace(),
+					"object_name", object.GetObjectKind().GroupVersionKind().Kind+"/"+object.GetName(), "conflicts", conflicts)
+				conflictsErr.add(object, conflicts)
+				continue
+			}
 			return anyApplied, err
 		}
 		anyApplied = true
 	}
-
+	if len(conflictsErr.Conflicts) > 0 {
+		return anyApplied, conflictsErr
+	}
 	return anyApplied, nil
 }
 
+// applyObject applies the given object server-side, with the given labels. The ownership of the fields is forced,
+// unless the kind of the object is among the given unforced kinds
+func (c APIClient) applyObject(ctx context.Context, object runtimeclient.Object, newLabels map[string]string, unforcedKinds []string) error {
+	// the apply patch must contain the apiVersion and kind of the object
+	gvk, err := apiutil.GVKForObject(object, c.Scheme)
+	if err != nil {
+		return err
+	}
+	object.GetObjectKind().SetGroupVersionKind(gvk)
+	applycl.MergeLabels(object, newLabels)
+	object.SetResourceVersion("")
+	object.SetManagedFields(nil)
+	opts := []runtimeclient.PatchOption{runtimeclient.FieldOwner(constants.MemberOperatorFieldManager)}
+	if !slices.Contains(unforcedKinds, gvk.Kind) {
+		opts = append(opts, runtimeclient.ForceOwnership)
+	}
+	if err := c.Client.Patch(ctx, object, runtimeclient.Apply, opts...); err != nil {
+		return errs.Wrapf(err, "unable to patch '%s' called '%s' in namespace '%s'", gvk, object.GetName(), object.GetNamespace())
+	}
+	return nil
+}
+
+// FieldConflictsError is returned when some template objects were not applied because some of their fields are owned
+// by other field managers (see ApplyToolchainObjects)
+type FieldConflictsError struct {
+	// Conflicts contains the comma-separated description of the conflicts, per object (see fieldConflictsObject)
+	Conflicts map[string]string
+}
+
+// fieldConflictsErrorPrefix is the prefix of the message of a FieldConflictsError
+const fieldConflictsErrorPrefix = "conflicts with other field managers: "
+
+func (e *FieldConflictsError) Error() string {
+	return objectEntries(e.Conflicts).message(fieldConflictsErrorPrefix)
+}
+
+func (e *FieldConflictsError) add(object runtimeclient.Object, conflicts []string) {
+	if e.Conflicts == nil {
+		e.Conflicts = map[string]string{}
+	}
+	e.Conflicts[fieldConflictsObject(object)] = strings.Join(conflicts, ", ")
+}
+
+// fieldConflictsObject returns the description of the given object in the conflicts of a FieldConflictsError, e.g. `Role 'john-dev/edit'`
+func fieldConflictsObject(object runtimeclient.Object) string {
+	name := object.GetName()
+	if object.GetNamespace() != "" {
+		name = object.GetNamespace() + "/" + name
+	}
+	return fmt.Sprintf("%s '%s'", object.GetObjectKind().GroupVersionKind().Kind, name)
+}
+
+// fieldConflicts returns the field conflicts reported by the server when an object could not be applied, e.g.
+// `conflict with "kubectl-edit" using v1: .spec.limits`
+func fieldConflicts(err error) []string {
+	var statusErr errors.APIStatus
+	if !errors.IsConflict(err) || !errs.As(err, &statusErr) || statusErr.Status().Details == nil {
+		return nil
+	}
+	var conflicts []string
+	for _, cause := range statusErr.Status().Details.Causes {
+		if cause.Type == metav1.CauseTypeFieldManagerConflict {
+			conflicts = append(conflicts, cause.Message)
+		}
+	}
+	return conflicts
+}
+
+// unsupportedObject returns true if the given object is not marked as optional but belongs to an OpenShift API group
+// which is not available in the cluster (e.g. on vanilla Kubernetes), in which case it cannot be applied
+func (c APIClient) unsupportedObject(object runtimeclient.Object) bool {
+	if _, optional := object.GetAnnotations()[toolchainv1alpha1.TierTemplateObjectOptionalResourceAnnotation]; optional {
+		return false
+	}
+	gvk := object.GetObjectKind().GroupVersionKind()
+	return isOpenShiftAPIGroup(gvk.Group) && !apiGroupIsPresent(c.AvailableAPIGroups, gvk)
+}
+
+// isOpenShiftAPIGroup returns true if the given API group is specific to OpenShift (e.g. `authorization.openshift.io` or `quota.openshift.io`)
+func isOpenShiftAPIGroup(group string) bool {
+	return strings.HasSuffix(group, ".openshift.io")
+}
+
 func apiGroupIsPresent(availableAPIGroups []metav1.APIGroup, gvk schema.GroupVersionKind) bool {
 	for _, group := range availableAPIGroups {
 		if group.Name == gvk.Group {
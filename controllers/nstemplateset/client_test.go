@@ -7,15 +7,22 @@ import (
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/member-operator/pkg/apis"
+	"github.com/codeready-toolchain/member-operator/pkg/constants"
 	. "github.com/codeready-toolchain/member-operator/test"
 	"github.com/codeready-toolchain/toolchain-common/pkg/client"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
 	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	quotav1 "github.com/openshift/api/quota/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -55,7 +62,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 		apiClient, fakeClient := prepareAPIClient(t)
 
 		// when
-		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role, devNs, sa), additionalLabel)
+		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role, devNs, sa), additionalLabel, nil)
 
 		// then
 		require.NoError(t, err)
@@ -70,7 +77,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 		require.NoError(t, err)
 
 		// when
-		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role, devNs, sa), additionalLabel)
+		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role, devNs, sa), additionalLabel, nil)
 
 		// then
 		require.NoError(t, err)
@@ -85,7 +92,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 		require.NoError(t, err)
 
 		// when
-		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(optionalDeployment), additionalLabel)
+		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(optionalDeployment), additionalLabel, nil)
 
 		// then
 		require.NoError(t, err)
@@ -102,7 +109,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 		require.NoError(t, err)
 
 		// when
-		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(optionalDeployment), additionalLabel)
+		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(optionalDeployment), additionalLabel, nil)
 
 		// then
 		require.NoError(t, err)
@@ -118,7 +125,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 		require.NoError(t, err)
 
 		// when
-		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(optionalDeployment), additionalLabel)
+		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(optionalDeployment), additionalLabel, nil)
 
 		// then
 		require.NoError(t, err)
@@ -126,6 +133,50 @@ func TestApplyToolchainObjects(t *testing.T) {
 		assertObjects(t, fakeClient, true)
 	})
 
+	t.Run("OpenShift objects", func(t *testing.T) {
+		quota := &quotav1.ClusterResourceQuota{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: quotav1.GroupVersion.String(),
+				Kind:       "ClusterResourceQuota",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "for-john",
+			},
+		}
+
+		t.Run("skipped when the OpenShift API group is not present", func(t *testing.T) {
+			// given
+			apiClient, fakeClient := prepareAPIClient(t)
+			apiClient.AvailableAPIGroups = newAPIGroups(
+				newAPIGroup("rbac.authorization.k8s.io", "v1"),
+				newAPIGroup("", "v1"))
+
+			// when
+			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(quota, role), additionalLabel, nil)
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, changed)
+			AssertThatCluster(t, fakeClient).
+				HasNoResource("for-john", &quotav1.ClusterResourceQuota{})
+			AssertThatRole(t, "john-dev", "edit-john", fakeClient).Exists()
+		})
+
+		t.Run("applied when the OpenShift API group is present", func(t *testing.T) {
+			// given
+			apiClient, fakeClient := prepareAPIClient(t)
+
+			// when
+			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(quota), additionalLabel, nil)
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, changed)
+			AssertThatCluster(t, fakeClient).
+				HasResource("for-john", &quotav1.ClusterResourceQuota{})
+		})
+	})
+
 	t.Run("update existing SA labels and annotations", func(t *testing.T) {
 		// given
 		// let's set a secret for the existing service account in order to check if it's preserved
@@ -169,7 +220,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 			}
 
 			// when
-			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(newSaObject), newlabels)
+			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(newSaObject), newlabels, nil)
 
 			// then
 			require.NoError(t, err)
@@ -208,7 +259,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 				}
 				return fakeClient.Client.Get(ctx, key, obj, opts...)
 			}
-			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(newSaObject), additionalLabel)
+			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(newSaObject), additionalLabel, nil)
 
 			// then
 			require.NoError(t, err)
@@ -238,7 +289,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 		require.NoError(t, err)
 
 		// when
-		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role, sa), additionalLabel)
+		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role, sa), additionalLabel, nil)
 
 		// then
 		require.NoError(t, err)
@@ -246,6 +297,85 @@ func TestApplyToolchainObjects(t *testing.T) {
 		assertObjects(t, fakeClient, false)
 	})
 
+	t.Run("server-side apply", func(t *testing.T) {
+		newConflict := func(obj runtimeclient.Object) error {
+			return apierrors.NewApplyConflict([]metav1.StatusCause{
+				{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: `conflict with "kubectl-edit" using rbac.authorization.k8s.io/v1: .rules`,
+					Field:   ".rules",
+				},
+			}, fmt.Sprintf("Apply failed with 1 conflict: conflict with \"kubectl-edit\" using rbac.authorization.k8s.io/v1: .rules on %s", obj.GetName()))
+		}
+
+		t.Run("fields owned by other field managers are overridden by default", func(t *testing.T) {
+			// given
+			apiClient, fakeClient := prepareAPIClient(t)
+			var patched []string
+			fakeClient.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+				patchOpts := &runtimeclient.PatchOptions{}
+				patchOpts.ApplyOptions(opts)
+				assert.Equal(t, types.ApplyPatchType, patch.Type())
+				assert.Equal(t, constants.MemberOperatorFieldManager, patchOpts.FieldManager)
+				require.NotNil(t, patchOpts.Force)
+				assert.True(t, *patchOpts.Force)
+				assert.Equal(t, "bar", obj.GetLabels()["foo"])
+				patched = append(patched, obj.GetObjectKind().GroupVersionKind().Kind+"/"+obj.GetName())
+				return nil
+			}
+
+			// when
+			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(devNs, role), additionalLabel, nil)
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.Equal(t, []string{"Namespace/john-dev", "Role/edit-john"}, patched)
+		})
+
+		t.Run("conflicts reported for the kinds which are not forced", func(t *testing.T) {
+			// given
+			apiClient, fakeClient := prepareAPIClient(t)
+			var patched []string
+			fakeClient.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+				patchOpts := &runtimeclient.PatchOptions{}
+				patchOpts.ApplyOptions(opts)
+				if obj.GetObjectKind().GroupVersionKind().Kind == "Role" {
+					assert.Nil(t, patchOpts.Force)
+					return newConflict(obj)
+				}
+				patched = append(patched, obj.GetObjectKind().GroupVersionKind().Kind+"/"+obj.GetName())
+				return nil
+			}
+
+			// when
+			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role, devNs), additionalLabel, []string{"Role"})
+
+			// then
+			require.EqualError(t, err, `conflicts with other field managers: Role 'john-dev/edit-john' (conflict with "kubectl-edit" using rbac.authorization.k8s.io/v1: .rules)`)
+			conflictsErr := &FieldConflictsError{}
+			require.ErrorAs(t, err, &conflictsErr)
+			assert.Len(t, conflictsErr.Conflicts, 1)
+			assert.True(t, changed)
+			assert.Equal(t, []string{"Namespace/john-dev"}, patched) // the other objects are still applied
+		})
+
+		t.Run("other failures are returned", func(t *testing.T) {
+			// given
+			apiClient, fakeClient := prepareAPIClient(t)
+			fakeClient.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+				return fmt.Errorf("some error")
+			}
+
+			// when
+			changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(role), additionalLabel, []string{"Role"})
+
+			// then
+			require.EqualError(t, err, "unable to patch 'rbac.authorization.k8s.io/v1, Kind=Role' called 'edit-john' in namespace 'john-dev': some error")
+			assert.False(t, changed)
+		})
+	})
+
 	t.Run("create SA when it doesn't exist yet", func(t *testing.T) {
 		// given
 		apiClient, fakeClient := prepareAPIClient(t)
@@ -261,7 +391,7 @@ func TestApplyToolchainObjects(t *testing.T) {
 		}
 
 		// when
-		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(sa), additionalLabel)
+		changed, err := apiClient.ApplyToolchainObjects(ctx, copyObjects(sa), additionalLabel, nil)
 
 		// then
 		require.NoError(t, err)
@@ -271,6 +401,189 @@ func TestApplyToolchainObjects(t *testing.T) {
 	})
 }
 
+func TestReconcileWithFieldConflicts(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev"))
+	devNS := newNamespace("", spacename, "dev") // NS exists but is missing its inner resources (since its revision is not set yet)
+	memberConfig := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+		UnforcedKinds: []string{"LimitRange", " RoleBinding"},
+	})
+	r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS, memberConfig)
+	fakeClient.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+		patchOpts := &runtimeclient.PatchOptions{}
+		patchOpts.ApplyOptions(opts)
+		if patchOpts.Force == nil {
+			return apierrors.NewApplyConflict([]metav1.StatusCause{
+				{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: `conflict with "kubectl-edit" using rbac.authorization.k8s.io/v1: .subjects`,
+					Field:   ".subjects",
+				},
+			}, "Apply failed with 1 conflict")
+		}
+		return nil
+	}
+
+	t.Run("conflicts reported without failing", func(t *testing.T) {
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		msg := `conflicts with other field managers: RoleBinding 'johnsmith-dev/crtadmin-pods' (conflict with "kubectl-edit" using rbac.authorization.k8s.io/v1: .subjects)`
+		nsTmplSet := getNSTemplateSet(t, fakeClient, req)
+		conflicts, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetFieldConflictsConditionType)
+		require.True(t, found)
+		assert.Equal(t, msg, conflicts.Message)
+		AssertThatNamespace(t, devNS.Name, fakeClient).
+			HasLabel(toolchainv1alpha1.TemplateRefLabelKey, "basic-dev-abcde11").
+			HasNoResource("crtadmin-pods", &rbacv1.RoleBinding{})
+
+		t.Run("ready with the conflicts", func(t *testing.T) {
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(Provisioned(), FieldConflicts(msg))
+		})
+	})
+}
+
+func TestUpdateStatusFieldConflicts(t *testing.T) {
+	// given
+	role := &rbacv1.Role{
+		TypeMeta:   metav1.TypeMeta{Kind: "Role"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "john-dev", Name: "edit"},
+	}
+	limitRange := &corev1.LimitRange{
+		TypeMeta:   metav1.TypeMeta{Kind: "LimitRange"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "john-dev", Name: "resource-limits"},
+	}
+	roleConflict := `Role 'john-dev/edit' (conflict with "kubectl-edit" using rbac.authorization.k8s.io/v1: .rules)`
+	limitRangeConflict := `LimitRange 'john-dev/resource-limits' (conflict with "kubectl-edit" using v1: .spec.limits)`
+	roleConflicts := map[string]string{"Role 'john-dev/edit'": `conflict with "kubectl-edit" using rbac.authorization.k8s.io/v1: .rules`}
+	limitRangeConflicts := map[string]string{"LimitRange 'john-dev/resource-limits'": `conflict with "kubectl-edit" using v1: .spec.limits`}
+	nsTmplSet := newNSTmplSet("toolchain-member", "john", "basic", withConditions(Provisioned()))
+	manager, fakeClient := prepareStatusManager(t, nsTmplSet)
+
+	t.Run("conflicts added", func(t *testing.T) {
+		// when
+		err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{role, limitRange},
+			&FieldConflictsError{Conflicts: roleConflicts})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+			HasConditions(Provisioned(), FieldConflicts("conflicts with other field managers: "+roleConflict)).
+			HasAnnotation(fieldConflictsAnnotationKey, `{"Role 'john-dev/edit'":"conflict with \"kubectl-edit\" using rbac.authorization.k8s.io/v1: .rules"}`)
+
+		t.Run("conflicts of the other objects kept when the message of the condition changed", func(t *testing.T) {
+			// given
+			nsTmplSet.Status.Conditions = []toolchainv1alpha1.Condition{Provisioned(), FieldConflicts("truncated; message")}
+			require.NoError(t, fakeClient.Status().Update(context.TODO(), nsTmplSet))
+
+			// when
+			err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{limitRange}, nil)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+				HasConditions(Provisioned(), FieldConflicts("conflicts with other field managers: "+roleConflict))
+		})
+
+		t.Run("conflicts of the other objects kept", func(t *testing.T) {
+			// when
+			err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{limitRange},
+				&FieldConflictsError{Conflicts: limitRangeConflicts})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+				HasConditions(Provisioned(), FieldConflicts("conflicts with other field managers: "+limitRangeConflict+"; "+roleConflict))
+
+			t.Run("resolved conflicts removed", func(t *testing.T) {
+				// when
+				err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{role}, nil)
+
+				// then
+				require.NoError(t, err)
+				AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+					HasConditions(Provisioned(), FieldConflicts("conflicts with other field managers: "+limitRangeConflict))
+
+				t.Run("condition removed without conflicts", func(t *testing.T) {
+					// when
+					err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{limitRange}, nil)
+
+					// then
+					require.NoError(t, err)
+					AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+						HasConditions(Provisioned()).
+						DoesNotHaveAnnotation(fieldConflictsAnnotationKey)
+				})
+			})
+		})
+	})
+
+	t.Run("other errors returned", func(t *testing.T) {
+		// when
+		err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{role}, fmt.Errorf("some error"))
+
+		// then
+		require.EqualError(t, err, "some error")
+	})
+
+	t.Run("unsupported objects", func(t *testing.T) {
+		// given
+		quota := &quotav1.ClusterResourceQuota{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "quota.openshift.io/v1", Kind: "ClusterResourceQuota"},
+			ObjectMeta: metav1.ObjectMeta{Name: "for-john"},
+		}
+		nsTmplSet := newNSTmplSet("toolchain-member", "john", "basic", withConditions(Provisioned()))
+		manager, fakeClient := prepareStatusManager(t, nsTmplSet)
+		manager.AvailableAPIGroups = newAPIGroups(
+			newAPIGroup("rbac.authorization.k8s.io", "v1"),
+			newAPIGroup("", "v1"))
+
+		// when
+		err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{role, quota}, nil)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+			HasConditions(Provisioned(), UnsupportedObjects("objects of API groups which are not available in the cluster: ClusterResourceQuota 'for-john' (quota.openshift.io/v1)"))
+
+		t.Run("kept when other objects are applied", func(t *testing.T) {
+			// when
+			err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{limitRange}, nil)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+				HasConditions(Provisioned(), UnsupportedObjects("objects of API groups which are not available in the cluster: ClusterResourceQuota 'for-john' (quota.openshift.io/v1)"))
+		})
+
+		t.Run("removed once the API group is available", func(t *testing.T) {
+			// given
+			manager.AvailableAPIGroups = append(manager.AvailableAPIGroups, newAPIGroup("quota.openshift.io", "v1"))
+
+			// when
+			err := manager.updateStatusFieldConflicts(context.TODO(), nsTmplSet, []runtimeclient.Object{quota}, nil)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, "toolchain-member", "john", fakeClient).
+				HasConditions(Provisioned()).
+				DoesNotHaveAnnotation(unsupportedObjectsAnnotationKey)
+		})
+	})
+}
+
 func copyObjects(objects ...runtimeclient.Object) []runtimeclient.Object {
 	var objs []runtimeclient.Object
 	for i := range objects {
@@ -374,6 +687,10 @@ func prepareAPIClient(t *testing.T, initObjs ...runtimeclient.Object) (*APIClien
 			newAPIGroup("rbac.authorization.k8s.io", "v1"),
 			newAPIGroup("toolchain.dev.openshift.com", "v1alpha1"),
 			newAPIGroup("", "v1")),
+		// the watches are only recorded in the tests
+		kinds: newKindWatcher(nil, func(*metav1.PartialObjectMetadata) error {
+			return nil
+		}),
 	}, fakeClient
 }
 
@@ -4,17 +4,30 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"strings"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 
 	commonclient "github.com/codeready-toolchain/toolchain-common/pkg/client"
+	"github.com/codeready-toolchain/toolchain-common/pkg/utils"
 	errs "github.com/pkg/errors"
 	"github.com/redhat-cop/operator-utils/pkg/util"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+const (
+	// sharedBySpacesAnnotationKey is set on the cluster-scoped resources that are declared by the templates of more than one space.
+	// It contains the sorted, comma-separated list of the names of all these spaces.
+	sharedBySpacesAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "shared-by-spaces"
+
+	// sharedResourcesRegisteredAnnotationKey is set on the NSTemplateSets and contains the templateRef of the last applied cluster resources
+	// for which the space was registered among the spaces sharing them (see registerSharedResources)
+	sharedResourcesRegisteredAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "shared-resources-registered"
+)
+
 type clusterResourcesManager struct {
 	*statusManager
 }
@@ -22,33 +35,51 @@ type clusterResourcesManager struct {
 // ensure ensures that the cluster resources exist.
 // Returns `true, nil` if something was changed, `false, nil` if nothing changed, `false, err` if an error occurred
 //
-// NOTE: This method makes 1 important assumption: all the cluster-scoped resources of the NSTemplateSet are uniquely
-// associated with it. I.e. the logic doesn't work correctly if 2 NSTemplateSets declare the very same cluster-scoped
-// resource. It is assumed that if a cluster-scoped resource should be common to more than 1 nstemplateset, it should
-// be deployed externally from Devsandbox, e.g. using ArgoCD.
-func (r *clusterResourcesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+// NOTE: A cluster-scoped resource may be declared by the templates of more than one NSTemplateSet. In such a case,
+// the names of all the spaces referencing the resource are kept in the `shared-by-spaces` annotation, while the space label
+// keeps pointing to a single one of them. The resource is deleted only when the last referencing space stops declaring it
+// (or is deleted). It is assumed that all the templates declaring a shared resource define it the same way, otherwise
+// the last applied definition wins. The annotation is only changed with patches which fail when the resource was modified in the meantime,
+// so that the concurrent changes of the list by other spaces are not lost.
+func (r *clusterResourcesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) error {
 	logger := log.FromContext(ctx, "spacename", nsTmplSet.GetName(), "tier", nsTmplSet.Spec.TierName)
 	logger.Info("ensuring cluster resources")
 	ctx = log.IntoContext(ctx, logger)
 
 	oldTemplateRef, newTemplateRef, changed := getOldAndNewTemplateRefsIfChanged(nsTmplSet)
 	if !changed {
-		return nil
+		if sharedResourcesRegistered(nsTmplSet) {
+			return nil
+		}
+		return r.registerSharedResources(ctx, nsTmplSet)
 	}
 
-	newTierTemplate, newObjs, err := r.processTierTemplate(ctx, nsTmplSet.Spec.ClusterResources, nsTmplSet.Name)
+	newTierTemplate, newObjs, err := r.processTierTemplate(ctx, nsTmplSet, nsTmplSet.Spec.ClusterResources)
 	if err != nil {
 		return r.wrapErrorWithStatusUpdateForClusterResourceFailure(ctx, nsTmplSet, err,
 			"failed to process the template for the to-be-applied cluster resources with the name '%s'", newTemplateRef)
 	}
 
-	_, curObjs, err := r.processTierTemplate(ctx, nsTmplSet.Status.ClusterResources, nsTmplSet.Name)
+	// the cluster resources template may only contain cluster-scoped objects
+	if newTierTemplate != nil {
+		if err := newObjectsValidator(nsTmplSet.GetName()).validate(newObjs); err != nil {
+			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusValidationFailed, err,
+				"invalid cluster resources in the template with the name '%s'", newTemplateRef)
+		}
+	}
+	// the quotas keep the recommended values which were applied (if any)
+	if err := r.withAppliedQuotaRecommendations(ctx, nsTmplSet, newObjs); err != nil {
+		return r.wrapErrorWithStatusUpdateForClusterResourceFailure(ctx, nsTmplSet, err,
+			"failed to set the recommended quotas in the cluster resources with the name '%s'", newTemplateRef)
+	}
+
+	_, curObjs, err := r.processTierTemplate(ctx, nsTmplSet, nsTmplSet.Status.ClusterResources)
 	if err != nil {
 		return r.wrapErrorWithStatusUpdateForClusterResourceFailure(ctx, nsTmplSet, err,
 			"failed to process the template for the last-applied cluster resources with the name '%s'", oldTemplateRef)
 	}
 
-	objectApplier := newObjectApplier(r, nsTmplSet, curObjs, newTierTemplate)
+	objectApplier := newObjectApplier(r, nsTmplSet, cfg.unforcedKinds, curObjs, newTierTemplate)
 
 	for _, newObj := range newObjs {
 		if err = objectApplier.Apply(ctx, newObj); err != nil {
@@ -72,7 +103,7 @@ func getOldAndNewTemplateRefsIfChanged(nstt *toolchainv1alpha1.NSTemplateSet) (o
 	return oldTemplateRef, newTemplateRef, changed
 }
 
-func (r *clusterResourcesManager) processTierTemplate(ctx context.Context, clusterResources *toolchainv1alpha1.NSTemplateSetClusterResources, spacename string) (*tierTemplate, []runtimeclient.Object, error) {
+func (r *clusterResourcesManager) processTierTemplate(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, clusterResources *toolchainv1alpha1.NSTemplateSetClusterResources) (*tierTemplate, []runtimeclient.Object, error) {
 	if clusterResources == nil {
 		return nil, nil, nil
 	}
@@ -81,28 +112,45 @@ func (r *clusterResourcesManager) processTierTemplate(ctx context.Context, clust
 	var objs []runtimeclient.Object
 	if clusterResources.TemplateRef != "" {
 		var err error
-		tierTemplate, err = getTierTemplate(ctx, r.GetHostClusterClient, clusterResources.TemplateRef)
+		tierTemplate, err = r.fetchTierTemplate(ctx, nsTmplSet, clusterResources.TemplateRef)
 		if err != nil {
 			return nil, nil, err
 		}
-		objs, err = tierTemplate.process(r.Scheme, map[string]string{SpaceName: spacename})
+		objs, err = tierTemplate.process(r.Scheme, map[string]string{SpaceName: nsTmplSet.GetName()})
 		if err != nil {
 			return nil, nil, err
 		}
+		objs = r.withoutUnsupportedClusterResourceQuotas(objs)
 	}
 
 	return tierTemplate, objs, nil
 }
 
-// apply creates or updates the given object with the set of toolchain labels. If the apply operation was successful, then it returns 'true, nil',
-// but if there was an error then it returns 'false, error'.
-func (r *clusterResourcesManager) apply(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, object runtimeclient.Object) (bool, error) {
-	labels := map[string]string{
-		toolchainv1alpha1.SpaceLabelKey:       nsTmplSet.GetName(),
-		toolchainv1alpha1.TypeLabelKey:        toolchainv1alpha1.ClusterResourcesTemplateType,
-		toolchainv1alpha1.TemplateRefLabelKey: tierTemplate.templateRef,
-		toolchainv1alpha1.TierLabelKey:        tierTemplate.tierName,
-		toolchainv1alpha1.ProviderLabelKey:    toolchainv1alpha1.ProviderLabelValue,
+// apply creates or updates the given object with the set of toolchain labels (see ApplyToolchainObjects for the unforced kinds).
+// If the apply operation was successful, then it returns 'true, nil', but if there was an error then it returns 'false, error'.
+func (r *clusterResourcesManager) apply(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, object runtimeclient.Object, unforcedKinds []string) (bool, error) {
+	labels := clusterResourceLabels(nsTmplSet, tierTemplate)
+	if r.unsupportedObject(object) {
+		// not applied, but reported in the status
+		return false, r.updateStatusFieldConflicts(ctx, nsTmplSet, []runtimeclient.Object{object}, nil)
+	}
+
+	// the resource may already exist because it is declared by the template of another space, in which case
+	// the resource becomes shared and keeps its current space label
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(object.GetObjectKind().GroupVersionKind())
+	if err := r.Client.Get(ctx, runtimeclient.ObjectKeyFromObject(object), existing); err != nil && !errors.IsNotFound(err) {
+		return false, errs.Wrapf(err, "failed to get the existing cluster resource")
+	} else if err == nil {
+		if spaces := sharingSpaces(existing); len(spaces) > 0 && !slices.Contains(spaces, nsTmplSet.GetName()) {
+			log.FromContext(ctx).Info("registering the space as sharing the cluster resource", "name", object.GetName(), "kind", object.GetObjectKind().GroupVersionKind().Kind, "spaces", spaces)
+			if err := r.patchSharingSpaces(ctx, existing, append(spaces, nsTmplSet.GetName())); err != nil {
+				return false, errs.Wrapf(err, "failed to register the space as sharing the cluster resource")
+			}
+		}
+		if owner := existing.GetLabels()[toolchainv1alpha1.SpaceLabelKey]; owner != "" && slices.Contains(sharingSpaces(existing), owner) {
+			labels[toolchainv1alpha1.SpaceLabelKey] = owner
+		}
 	}
 	// Note: we don't set an owner reference between the NSTemplateSet (namespaced resource) and the cluster-wide resources
 	// because a namespaced resource (NSTemplateSet) cannot be the owner of a cluster resource (the GC will delete the child resource, considering it is an orphan resource)
@@ -110,20 +158,32 @@ func (r *clusterResourcesManager) apply(ctx context.Context, nsTmplSet *toolchai
 	// see https://issues.redhat.com/browse/CRT-429
 
 	log.FromContext(ctx).Info("applying cluster resource", "object_name", object.GetObjectKind().GroupVersionKind().Kind+"/"+object.GetName())
-	createdOrModified, err := r.ApplyToolchainObjects(ctx, []runtimeclient.Object{object}, labels)
-	if err != nil {
+	createdOrModified, err := r.ApplyToolchainObjects(ctx, []runtimeclient.Object{object}, labels, unforcedKinds)
+	// the conflicts with other field managers are reported in the status, but don't prevent the other objects from being applied
+	if err := r.updateStatusFieldConflicts(ctx, nsTmplSet, []runtimeclient.Object{object}, err); err != nil {
 		return false, errs.Wrapf(err, "failed to apply cluster resource")
 	}
 	return createdOrModified, nil
 }
 
+// clusterResourceLabels returns the labels set on the cluster resources of the given space
+func clusterResourceLabels(nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate) map[string]string {
+	return map[string]string{
+		toolchainv1alpha1.SpaceLabelKey:       nsTmplSet.GetName(),
+		toolchainv1alpha1.TypeLabelKey:        toolchainv1alpha1.ClusterResourcesTemplateType,
+		toolchainv1alpha1.TemplateRefLabelKey: tierTemplate.templateRef,
+		toolchainv1alpha1.TierLabelKey:        tierTemplate.tierName,
+		toolchainv1alpha1.ProviderLabelKey:    toolchainv1alpha1.ProviderLabelValue,
+	}
+}
+
 // delete deletes all cluster-scoped resources referenced by the nstemplateset.
 func (r *clusterResourcesManager) delete(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
 	if nsTmplSet.Status.ClusterResources == nil {
 		return nil
 	}
 
-	_, currentObjects, err := r.processTierTemplate(ctx, nsTmplSet.Status.ClusterResources, nsTmplSet.Name)
+	_, currentObjects, err := r.processTierTemplate(ctx, nsTmplSet, nsTmplSet.Status.ClusterResources)
 	if err != nil {
 		return r.wrapErrorWithStatusUpdateForClusterResourceFailure(ctx, nsTmplSet, err,
 			"failed to process the existing cluster resources")
@@ -139,6 +199,13 @@ func (r *clusterResourcesManager) delete(ctx context.Context, nsTmplSet *toolcha
 		if errors.IsNotFound(err) || util.IsBeingDeleted(toDelete) {
 			continue
 		}
+		// do not delete the cluster resource if it's still needed by some other space
+		if shared, err := r.releaseIfShared(ctx, nsTmplSet.GetName(), toDelete); err != nil {
+			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusTerminatingFailed, err,
+				"failed to release the shared cluster resource '%s'", toDelete.GetName())
+		} else if shared {
+			continue
+		}
 
 		log.FromContext(ctx).Info("deleting cluster resource", "name", toDelete.GetName(), "kind", toDelete.GetObjectKind().GroupVersionKind().Kind)
 		if err = r.Client.Delete(ctx, toDelete); err != nil && errors.IsNotFound(err) {
@@ -152,6 +219,151 @@ func (r *clusterResourcesManager) delete(ctx context.Context, nsTmplSet *toolcha
 	return nil
 }
 
+// sharedResourcesRegistered returns true if the given space was registered among the spaces sharing its last applied cluster resources
+// (or if there is no such resource)
+func sharedResourcesRegistered(nsTmplSet *toolchainv1alpha1.NSTemplateSet) bool {
+	if nsTmplSet.Status.ClusterResources == nil {
+		return true
+	}
+	registered, found := nsTmplSet.GetAnnotations()[sharedResourcesRegisteredAnnotationKey]
+	return found && registered == nsTmplSet.Status.ClusterResources.TemplateRef
+}
+
+// registerSharedResources makes sure that the given space is listed among the spaces referencing the last applied cluster resources
+// which are labelled with another space, so that these resources are not deleted while the given space still declares them.
+// This also registers the spaces which were declaring such resources before their sharing was tracked. The templateRef of these
+// cluster resources is then recorded in the annotation of the NSTemplateSet, so that they are not registered again until they change.
+func (r *clusterResourcesManager) registerSharedResources(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+	_, curObjs, err := r.processTierTemplate(ctx, nsTmplSet, nsTmplSet.Status.ClusterResources)
+	if err != nil {
+		return r.wrapErrorWithStatusUpdateForClusterResourceFailure(ctx, nsTmplSet, err,
+			"failed to process the template for the last-applied cluster resources")
+	}
+	for _, obj := range curObjs {
+		if !shouldCreate(obj, nsTmplSet) {
+			continue
+		}
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+		if err := r.Client.Get(ctx, runtimeclient.ObjectKeyFromObject(obj), existing); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return errs.Wrapf(err, "failed to get the cluster resource '%s' (GVK '%s')", obj.GetName(), obj.GetObjectKind().GroupVersionKind())
+		}
+		spaces := sharingSpaces(existing)
+		if len(spaces) == 0 || slices.Contains(spaces, nsTmplSet.GetName()) {
+			continue
+		}
+		log.FromContext(ctx).Info("registering the space as sharing the cluster resource", "name", obj.GetName(), "kind", obj.GetObjectKind().GroupVersionKind().Kind, "spaces", spaces)
+		if err := r.patchSharingSpaces(ctx, existing, append(spaces, nsTmplSet.GetName())); err != nil {
+			return errs.Wrapf(err, "failed to register the space as sharing the cluster resource '%s'", obj.GetName())
+		}
+	}
+	patch := runtimeclient.MergeFrom(nsTmplSet.DeepCopy())
+	annotations := nsTmplSet.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[sharedResourcesRegisteredAnnotationKey] = nsTmplSet.Status.ClusterResources.TemplateRef
+	nsTmplSet.SetAnnotations(annotations)
+	if err := r.Client.Patch(ctx, nsTmplSet, patch); err != nil {
+		return errs.Wrap(err, "failed to record the registration of the shared cluster resources")
+	}
+	return nil
+}
+
+// releaseIfShared removes the given space from the list of spaces referencing the given cluster resource, which must have
+// been fetched from the cluster beforehand. Returns `true, nil` if the resource is still referenced by some other space
+// (and thus must not be deleted), including when its space label or annotation names another space without listing the given one,
+// or `false, nil` if the given space was the last one referencing it (or if the resource is not labelled with any space at all).
+func (r *clusterResourcesManager) releaseIfShared(ctx context.Context, spaceName string, obj runtimeclient.Object) (bool, error) {
+	spaces := sharingSpaces(obj)
+	remaining := slices.DeleteFunc(slices.Clone(spaces), func(space string) bool {
+		return space == spaceName
+	})
+	if len(remaining) == 0 {
+		return false, nil
+	}
+	if len(remaining) == len(spaces) {
+		// the resource belongs to some other space(s)
+		return true, nil
+	}
+	log.FromContext(ctx).Info("releasing shared cluster resource", "name", obj.GetName(), "kind", obj.GetObjectKind().GroupVersionKind().Kind, "remaining_spaces", remaining)
+	if err := r.patchSharingSpaces(ctx, obj, remaining); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// patchSharingSpaces records the given spaces on the given cluster resource (see setSharingSpaces) using a patch which fails
+// if the resource was modified in the meantime, so that concurrent changes of the list by other spaces are not lost
+func (r *clusterResourcesManager) patchSharingSpaces(ctx context.Context, obj runtimeclient.Object, spaces []string) error {
+	patch := runtimeclient.MergeFromWithOptions(obj.DeepCopyObject().(runtimeclient.Object), runtimeclient.MergeFromWithOptimisticLock{})
+	setSharingSpaces(obj, spaces)
+	return r.Client.Patch(ctx, obj, patch)
+}
+
+// releaseSharedObjects releases the given cluster resources that are still referenced by other spaces than the given one
+// and returns the remaining resources, i.e. those that can be deleted.
+func (r *clusterResourcesManager) releaseSharedObjects(ctx context.Context, spaceName string, objs []runtimeclient.Object) ([]runtimeclient.Object, error) {
+	toDelete := make([]runtimeclient.Object, 0, len(objs))
+	for _, obj := range objs {
+		existing := &unstructured.Unstructured{}
+		existing.SetGroupVersionKind(obj.GetObjectKind().GroupVersionKind())
+		if err := r.Client.Get(ctx, runtimeclient.ObjectKeyFromObject(obj), existing); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, errs.Wrapf(err, "failed to get the cluster resource '%s' (GVK '%s')", obj.GetName(), obj.GetObjectKind().GroupVersionKind())
+		}
+		shared, err := r.releaseIfShared(ctx, spaceName, existing)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to release the shared cluster resource '%s'", obj.GetName())
+		}
+		if !shared {
+			toDelete = append(toDelete, obj)
+		}
+	}
+	return toDelete, nil
+}
+
+// sharingSpaces returns the sorted names of the spaces referencing the given cluster resource. For resources that are not
+// shared, this is the value of the space label (if any).
+func sharingSpaces(obj runtimeclient.Object) []string {
+	spaces := utils.SplitCommaSeparatedList(obj.GetAnnotations()[sharedBySpacesAnnotationKey])
+	if len(spaces) == 0 {
+		if space := obj.GetLabels()[toolchainv1alpha1.SpaceLabelKey]; space != "" {
+			spaces = []string{space}
+		}
+	}
+	slices.Sort(spaces)
+	return slices.Compact(spaces)
+}
+
+// setSharingSpaces records the given spaces in the `shared-by-spaces` annotation of the given cluster resource (or removes
+// the annotation if there is a single space left) and makes sure that the space label points to one of them.
+func setSharingSpaces(obj runtimeclient.Object, spaces []string) {
+	slices.Sort(spaces)
+	spaces = slices.Compact(spaces)
+
+	annotations := obj.GetAnnotations()
+	if len(spaces) > 1 {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[sharedBySpacesAnnotationKey] = strings.Join(spaces, ",")
+	} else {
+		delete(annotations, sharedBySpacesAnnotationKey)
+	}
+	obj.SetAnnotations(annotations)
+
+	if labels := obj.GetLabels(); len(labels) > 0 && len(spaces) > 0 && !slices.Contains(spaces, labels[toolchainv1alpha1.SpaceLabelKey]) {
+		labels[toolchainv1alpha1.SpaceLabelKey] = spaces[0]
+		obj.SetLabels(labels)
+	}
+}
+
 // objectApplier is a helper to the clusterResourcesManager.ensure() method.
 // A new instance can be obtained using the newObjectApplier() function.
 //
@@ -164,11 +376,12 @@ type objectApplier struct {
 	firstDeployment     bool
 	failureStatusReason statusUpdater
 	nstt                *toolchainv1alpha1.NSTemplateSet
+	unforcedKinds       []string
 	currentObjects      []runtimeclient.Object
 	newTierTemplate     *tierTemplate
 }
 
-func newObjectApplier(r *clusterResourcesManager, nstt *toolchainv1alpha1.NSTemplateSet, currentObjects []runtimeclient.Object, newTierTemplate *tierTemplate) *objectApplier {
+func newObjectApplier(r *clusterResourcesManager, nstt *toolchainv1alpha1.NSTemplateSet, unforcedKinds []string, currentObjects []runtimeclient.Object, newTierTemplate *tierTemplate) *objectApplier {
 	// if there's no clusterresources templateref mentioned in the tiertemplate's status, it was never deployed before.
 	firstDeployment := nstt.Status.ClusterResources == nil || nstt.Status.ClusterResources.TemplateRef == ""
 	var failureStatusReason statusUpdater
@@ -185,6 +398,7 @@ func newObjectApplier(r *clusterResourcesManager, nstt *toolchainv1alpha1.NSTemp
 		firstDeployment:     firstDeployment,
 		failureStatusReason: failureStatusReason,
 		nstt:                nstt,
+		unforcedKinds:       unforcedKinds,
 		currentObjects:      currentObjects,
 		newTierTemplate:     newTierTemplate,
 	}
@@ -225,9 +439,9 @@ func (oa *objectApplier) Apply(ctx context.Context, obj runtimeclient.Object) er
 	}
 
 	// create or update the resource
-	if _, err := oa.r.apply(ctx, oa.nstt, oa.newTierTemplate, obj); err != nil {
+	if _, err := oa.r.apply(ctx, oa.nstt, oa.newTierTemplate, obj, oa.unforcedKinds); err != nil {
 		err := fmt.Errorf("failed to apply changes to the cluster resource %s, %s: %w", obj.GetName(), obj.GetObjectKind().GroupVersionKind().String(), err)
-		return oa.r.wrapErrorWithStatusUpdate(ctx, oa.nstt, oa.failureStatusReason, err, "failure while syncing cluster resources")
+		return oa.r.wrapErrorWithStatusUpdate(ctx, oa.nstt, oa.r.setStatusFeatureToggleFailed(featureOf(obj), oa.failureStatusReason), err, "failure while syncing cluster resources")
 	}
 
 	return nil
@@ -243,8 +457,12 @@ func (oa *objectApplier) Cleanup(ctx context.Context) error {
 	}
 
 	// what we're left with here is the list of currently existing objects that are no longer present in the template.
-	// we need to delete them
-	if err := deleteObsoleteObjects(ctx, oa.r.Client, oa.currentObjects, nil); err != nil {
+	// we need to delete them, unless they are still referenced by some other space
+	toDelete, err := oa.r.releaseSharedObjects(ctx, oa.nstt.GetName(), oa.currentObjects)
+	if err != nil {
+		return oa.r.wrapErrorWithStatusUpdate(ctx, oa.nstt, oa.failureStatusReason, err, "failure while syncing cluster resources")
+	}
+	if err := deleteObsoleteObjects(ctx, oa.r.Client, toDelete, nil); err != nil {
 		return oa.r.wrapErrorWithStatusUpdate(ctx, oa.nstt, oa.failureStatusReason, err, "failure while syncing cluster resources")
 	}
 
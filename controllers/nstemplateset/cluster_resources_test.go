@@ -43,7 +43,7 @@ func TestEnsureClusterResourcesOK(t *testing.T) {
 		manager, failingClient := prepareClusterResourcesManager(t, nsTmplSet)
 
 		// when
-		err := manager.ensure(ctx, nsTmplSet)
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.NoError(t, err)
@@ -103,7 +103,7 @@ func TestEnsureClusterResourcesOK(t *testing.T) {
 				manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet)
 
 				// when
-				err := manager.ensure(ctx, nsTmplSet)
+				err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 				// then
 				require.NoError(t, err)
@@ -146,7 +146,7 @@ func TestEnsureClusterResourcesOK(t *testing.T) {
 			manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, crq, crb, idlerDev, idlerStage)
 
 			// when
-			err := manager.ensure(ctx, nsTmplSet)
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -165,7 +165,7 @@ func TestEnsureClusterResourcesOK(t *testing.T) {
 			manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet)
 
 			// when
-			err := manager.ensure(ctx, nsTmplSet)
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -189,7 +189,7 @@ func TestEnsureClusterResourcesOK(t *testing.T) {
 		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, crq)
 
 		// when
-		err := manager.ensure(ctx, nsTmplSet)
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.NoError(t, err)
@@ -202,6 +202,161 @@ func TestEnsureClusterResourcesOK(t *testing.T) {
 			HasResource(spacename+"-dev", &toolchainv1alpha1.Idler{}).
 			HasResource(spacename+"-stage", &toolchainv1alpha1.Idler{})
 	})
+
+	t.Run("should share the cluster resource already declared by another space", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = "janedoe"
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+
+		// when
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		AssertThatCluster(t, fakeClient).
+			HasResource("for-"+spacename, &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.SpaceLabelKey, spacename),
+				WithoutAnnotation(sharedBySpacesAnnotationKey)).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+				WithAnnotation(sharedBySpacesAnnotationKey, "janedoe,johnsmith"))
+	})
+
+	t.Run("should not change the list of spaces sharing the cluster resource when applying it again", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = "janedoe"
+		emptyCrq.Annotations[sharedBySpacesAnnotationKey] = "janedoe,johnsmith"
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+
+		// when
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		AssertThatCluster(t, fakeClient).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+				WithAnnotation(sharedBySpacesAnnotationKey, "janedoe,johnsmith"))
+	})
+
+	t.Run("should register the space sharing the cluster resource even when the templates did not change", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq",
+			withNamespaces("abcde11", "dev"),
+			withClusterResources("abcde11"),
+			withStatusClusterResources("abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = "janedoe"
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+
+		// when
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		AssertThatCluster(t, fakeClient).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+				WithAnnotation(sharedBySpacesAnnotationKey, "janedoe,johnsmith"))
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasAnnotation(sharedResourcesRegisteredAnnotationKey, "withemptycrq-clusterresources-abcde11")
+	})
+
+	t.Run("should not register the space sharing the cluster resource again when the templates did not change", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq",
+			withNamespaces("abcde11", "dev"),
+			withClusterResources("abcde11"),
+			withStatusClusterResources("abcde11"))
+		nsTmplSet.Annotations = map[string]string{sharedResourcesRegisteredAnnotationKey: "withemptycrq-clusterresources-abcde11"}
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = "janedoe"
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+		fakeClient.MockGet = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if key.Name == "for-empty" {
+				return fmt.Errorf("should not be called")
+			}
+			return fakeClient.Client.Get(ctx, key, obj, opts...)
+		}
+
+		// when
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		fakeClient.MockGet = nil
+		AssertThatCluster(t, fakeClient).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+				WithoutAnnotation(sharedBySpacesAnnotationKey))
+	})
+
+	t.Run("should not lose the space concurrently registered on the shared cluster resource", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = "janedoe"
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+		concurrentlyRegistered := false
+		fakeClient.MockGet = func(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if err := fakeClient.Client.Get(ctx, key, obj, opts...); err != nil || key.Name != "for-empty" || concurrentlyRegistered {
+				return err
+			}
+			// another space registers itself once the resource was read
+			concurrent := obj.DeepCopyObject().(client.Object)
+			concurrent.SetAnnotations(map[string]string{sharedBySpacesAnnotationKey: "alice,janedoe"})
+			concurrentlyRegistered = true
+			return fakeClient.Client.Update(ctx, concurrent)
+		}
+
+		// when
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.Error(t, err)
+		AssertThatCluster(t, fakeClient).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithAnnotation(sharedBySpacesAnnotationKey, "alice,janedoe"))
+
+		t.Run("registered when retried", func(t *testing.T) {
+			// when
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatCluster(t, fakeClient).
+				HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+					WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+					WithAnnotation(sharedBySpacesAnnotationKey, "alice,janedoe,johnsmith"))
+		})
+	})
+
+	t.Run("should only release shared cluster resource no longer declared in the template", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced",
+			withNamespaces("abcde11", "dev"),
+			withClusterResources("abcde11"),
+			withStatusClusterResourcesInTier("withemptycrq", "abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = spacename
+		emptyCrq.Annotations[sharedBySpacesAnnotationKey] = "janedoe,johnsmith"
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+
+		// when
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		AssertThatCluster(t, fakeClient).
+			HasResource("for-"+spacename, &quotav1.ClusterResourceQuota{}).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+				WithoutAnnotation(sharedBySpacesAnnotationKey))
+	})
 }
 
 func TestEnsureClusterResourcesFail(t *testing.T) {
@@ -222,7 +377,7 @@ func TestEnsureClusterResourcesFail(t *testing.T) {
 		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet)
 
 		// when
-		err := manager.ensure(ctx, nsTmplSet)
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
@@ -241,7 +396,7 @@ func TestEnsureClusterResourcesFail(t *testing.T) {
 		}
 
 		// when
-		err := manager.ensure(ctx, nsTmplSet)
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
@@ -249,10 +404,81 @@ func TestEnsureClusterResourcesFail(t *testing.T) {
 		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
 			HasFinalizer().
 			HasConditions(UnableToProvisionClusterResources(
-				"failed to apply changes to the cluster resource for-johnsmith-space, quota.openshift.io/v1, Kind=ClusterResourceQuota: failed to apply cluster resource: unable to create resource of kind: ClusterResourceQuota, version: v1: unable to create resource of kind: ClusterResourceQuota, version: v1: some error"))
+				"failed to apply changes to the cluster resource for-johnsmith-space, quota.openshift.io/v1, Kind=ClusterResourceQuota: failed to apply cluster resource: unable to patch 'quota.openshift.io/v1, Kind=ClusterResourceQuota' called 'for-johnsmith-space' in namespace '': some error"))
+	})
+
+	t.Run("fail to create cluster resources of a feature", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"),
+			withNSTemplateSetFeatureAnnotation("feature-1"))
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet)
+		create := fakeClient.MockCreate
+		fakeClient.MockCreate = func(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+			if obj.GetName() == "feature-1-for-"+spacename {
+				return fmt.Errorf("some error")
+			}
+			return create(ctx, obj, opts...)
+		}
+
+		// when
+		err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.Error(t, err)
+		msg := "failed to apply changes to the cluster resource feature-1-for-johnsmith-space, quota.openshift.io/v1, Kind=ClusterResourceQuota: failed to apply cluster resource: unable to patch 'quota.openshift.io/v1, Kind=ClusterResourceQuota' called 'feature-1-for-johnsmith-space' in namespace '': some error"
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasFinalizer().
+			HasConditions(UnableToProvisionClusterResources(msg), FeatureToggleFailed("feature-1", msg))
 	})
 }
 
+func TestEnsureInvalidClusterResources(t *testing.T) {
+	// given
+	logger := zap.New(zap.UseDevMode(true))
+	log.SetLogger(logger)
+	ctx := log.IntoContext(context.TODO(), logger)
+	spaceName := "johnsmith-space"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+
+	var clusterAdminRb test.TemplateObject = `
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: ClusterRoleBinding
+  metadata:
+    name: ${SPACE_NAME}-cluster-admin
+  roleRef:
+    apiGroup: rbac.authorization.k8s.io
+    kind: ClusterRole
+    name: cluster-admin
+  subjects:
+  - kind: User
+    name: ${SPACE_NAME}`
+	invalidTierTemplate, err := createTierTemplate(scheme.Codecs.UniversalDeserializer(),
+		test.CreateTemplate(
+			test.WithObjects(advancedCrq, clusterAdminRb),
+			test.WithParams(spacename),
+		), "invalid", "clusterresources", "abcde11")
+	require.NoError(t, err)
+	nsTmplSet := newNSTmplSet(namespaceName, spaceName, "invalid", withClusterResources("abcde11"))
+	manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, invalidTierTemplate)
+
+	// when
+	err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+	// then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid cluster resources in the template with the name 'invalid-clusterresources-abcde11'")
+	AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+		HasFinalizer().
+		HasConditions(ValidationFailed(
+			"invalid template objects: ClusterRoleBinding 'johnsmith-space-cluster-admin': binding to the ClusterRole 'cluster-admin' is forbidden"))
+	// none of the objects was applied
+	AssertThatCluster(t, fakeClient).
+		HasNoResource("for-"+spaceName, &quotav1.ClusterResourceQuota{}).
+		HasNoResource(spaceName+"-cluster-admin", &rbacv1.ClusterRoleBinding{})
+}
+
 func TestDeleteClusterResources(t *testing.T) {
 	// given
 	logger := zap.New(zap.UseDevMode(true))
@@ -300,6 +526,77 @@ func TestDeleteClusterResources(t *testing.T) {
 			HasNoResource(emptyCrq.Name, &quotav1.ClusterResourceQuota{})
 	})
 
+	t.Run("shared cluster resource", func(t *testing.T) {
+		// given
+		johnNsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq", withNamespaces("abcde11", "dev"), withDeletionTs(), withClusterResources("abcde11"), withStatusClusterResources("abcde11"))
+		janeNsTmplSet := newNSTmplSet(namespaceName, "janedoe", "withemptycrq", withNamespaces("abcde11", "dev"), withDeletionTs(), withClusterResources("abcde11"), withStatusClusterResources("abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = spacename
+		emptyCrq.Annotations[sharedBySpacesAnnotationKey] = "janedoe,johnsmith"
+		manager, cl := prepareClusterResourcesManager(t, johnNsTmplSet, janeNsTmplSet, emptyCrq)
+
+		t.Run("is kept while another space still references it", func(t *testing.T) {
+			// when
+			err := manager.delete(ctx, johnNsTmplSet)
+
+			// then
+			require.NoError(t, err)
+			AssertThatCluster(t, cl).
+				HasNoResource("for-"+spacename, &quotav1.ClusterResourceQuota{}).
+				HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+					WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+					WithoutAnnotation(sharedBySpacesAnnotationKey))
+		})
+
+		t.Run("is deleted when the last referencing space is deleted", func(t *testing.T) {
+			// when
+			err := manager.delete(ctx, janeNsTmplSet)
+
+			// then
+			require.NoError(t, err)
+			AssertThatCluster(t, cl).
+				HasNoResource("for-empty", &quotav1.ClusterResourceQuota{})
+		})
+	})
+
+	t.Run("cluster resource labelled with another space is kept", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq", withNamespaces("abcde11", "dev"), withDeletionTs(), withClusterResources("abcde11"), withStatusClusterResources("abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Labels[toolchainv1alpha1.SpaceLabelKey] = "janedoe"
+		manager, cl := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+
+		// when
+		err := manager.delete(ctx, nsTmplSet)
+
+		// then
+		require.NoError(t, err)
+		AssertThatCluster(t, cl).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.SpaceLabelKey, "janedoe"),
+				WithoutAnnotation(sharedBySpacesAnnotationKey))
+	})
+
+	t.Run("failed to release shared cluster resource", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "withemptycrq", withNamespaces("abcde11", "dev"), withDeletionTs(), withClusterResources("abcde11"), withStatusClusterResources("abcde11"))
+		emptyCrq := newClusterResourceQuota("empty", "withemptycrq")
+		emptyCrq.Annotations[sharedBySpacesAnnotationKey] = "janedoe,johnsmith"
+		manager, cl := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq)
+		cl.MockPatch = func(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			return fmt.Errorf("mock error")
+		}
+
+		// when
+		err := manager.delete(ctx, nsTmplSet)
+
+		// then
+		require.EqualError(t, err, "failed to release the shared cluster resource 'for-empty': mock error")
+		AssertThatCluster(t, cl).
+			HasResource("for-empty", &quotav1.ClusterResourceQuota{},
+				WithAnnotation(sharedBySpacesAnnotationKey, "janedoe,johnsmith"))
+	})
+
 	t.Run("delete ClusterResourceQuota for enabled feature", func(t *testing.T) {
 		// given
 		nsTmplSet := newNSTmplSet(namespaceName,
@@ -388,7 +685,7 @@ func TestPromoteClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crq, crb, codeNs, previousTierTemplate, emptyCrq)
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -422,7 +719,7 @@ func TestPromoteClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, emptyCrq, crq, crb, previousTierTemplate)
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -450,7 +747,7 @@ func TestPromoteClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crq, previousTierTemplate)
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -482,7 +779,7 @@ func TestPromoteClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crq, devNs, previousTierTemplate)
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -514,7 +811,7 @@ func TestPromoteClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crq, devNs, previousTierTemplate)
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -543,7 +840,7 @@ func TestPromoteClusterResources(t *testing.T) {
 				manager, cl := prepareClusterResourcesManager(t, anotherNsTmplSet, anotherCRQ, nsTmplSet, advancedCRQ, anotherCrb, crb, idlerDev, idlerStage, anotherIdlerDev, anotherIdlerStage)
 
 				// when
-				err := manager.ensure(ctx, nsTmplSet)
+				err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 				// then
 				require.NoError(t, err)
@@ -572,7 +869,7 @@ func TestPromoteClusterResources(t *testing.T) {
 				nsTmplSet := newNSTmplSet(namespaceName, spaceName, "advanced", withConditions(Provisioned()), withStatusClusterResources("previousrevision"))
 				manager, cl := prepareClusterResourcesManager(t, anotherNsTmplSet, anotherCRQ, nsTmplSet, advancedCRQ, anotherCrb, crb, previousTierTemplate)
 
-				err = manager.ensure(ctx, nsTmplSet)
+				err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 				// then
 				require.NoError(t, err)
@@ -610,13 +907,13 @@ func TestPromoteClusterResources(t *testing.T) {
 			}
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
 			AssertThatNSTemplateSet(t, namespaceName, spaceName, cl).
 				HasFinalizer().
-				HasConditions(UpdateFailed("failed to apply changes to the cluster resource johnsmith-dev, toolchain.dev.openshift.com/v1alpha1, Kind=Idler: failed to apply cluster resource: unable to create resource of kind: Idler, version: v1alpha1: unable to create resource of kind: Idler, version: v1alpha1: some error"))
+				HasConditions(UpdateFailed("failed to apply changes to the cluster resource johnsmith-dev, toolchain.dev.openshift.com/v1alpha1, Kind=Idler: failed to apply cluster resource: unable to patch 'toolchain.dev.openshift.com/v1alpha1, Kind=Idler' called 'johnsmith-dev' in namespace '': some error"))
 			AssertThatCluster(t, cl).
 				HasResource("for-"+spaceName, &quotav1.ClusterResourceQuota{}).
 				HasResource(spaceName+"-tekton-view", &rbacv1.ClusterRoleBinding{})
@@ -638,7 +935,7 @@ func TestPromoteClusterResources(t *testing.T) {
 			}
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
@@ -674,7 +971,7 @@ func TestUpdateClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crq, crb, codeNs)
 
 			// when
-			err := manager.ensure(ctx, nsTmplSet)
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -698,7 +995,7 @@ func TestUpdateClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crqFeatured, codeNs)
 
 			// when
-			err := manager.ensure(ctx, nsTmplSet)
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -725,7 +1022,7 @@ func TestUpdateClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crqFeatured, codeNs)
 
 			// when
-			err := manager.ensure(ctx, nsTmplSet)
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -742,7 +1039,7 @@ func TestUpdateClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crq)
 
 			// when
-			err := manager.ensure(ctx, nsTmplSet)
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -769,13 +1066,13 @@ func TestUpdateClusterResources(t *testing.T) {
 			}
 
 			// when
-			err = manager.ensure(ctx, nsTmplSet)
+			err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
 			AssertThatNSTemplateSet(t, namespaceName, spaceName, cl).
 				HasFinalizer().
-				HasConditions(UpdateFailed("failed to apply changes to the cluster resource johnsmith-tekton-view, rbac.authorization.k8s.io/v1, Kind=ClusterRoleBinding: failed to apply cluster resource: unable to create resource of kind: ClusterRoleBinding, version: v1: unable to create resource of kind: ClusterRoleBinding, version: v1: some error"))
+				HasConditions(UpdateFailed("failed to apply changes to the cluster resource johnsmith-tekton-view, rbac.authorization.k8s.io/v1, Kind=ClusterRoleBinding: failed to apply cluster resource: unable to patch 'rbac.authorization.k8s.io/v1, Kind=ClusterRoleBinding' called 'johnsmith-tekton-view' in namespace '': some error"))
 			AssertThatCluster(t, cl).
 				HasResource("for-"+spaceName, &quotav1.ClusterResourceQuota{},
 					WithLabel("toolchain.dev.openshift.com/templateref", "advanced-clusterresources-abcde11")).
@@ -788,7 +1085,7 @@ func TestUpdateClusterResources(t *testing.T) {
 			manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crq, crb)
 
 			// when
-			err := manager.ensure(ctx, nsTmplSet)
+			err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
@@ -835,7 +1132,7 @@ func TestDeleteFeatureFromNSTemplateSet(t *testing.T) {
 	manager, cl := prepareClusterResourcesManager(t, nsTmplSet, crqFeatured, codeNs, previousTierTemplate)
 
 	// when
-	err = manager.ensure(ctx, nsTmplSet)
+	err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 	// then
 	require.NoError(t, err)
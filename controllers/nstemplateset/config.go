@@ -0,0 +1,368 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	errs "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+// The settings of the NSTemplateSet controller are not part of the MemberOperatorConfig spec (which is defined in the api module) yet,
+// so they are read from the NSTemplateSetConfigAnnotationKey annotation of the MemberOperatorConfig named "config" in the operator namespace,
+// which contains an NSTemplateSetConfig document in JSON, e.g. `{"deletionTimeout": "2m", "unforcedKinds": ["LimitRange"]}`.
+// The document is shaped like the section of the spec that it is meant to become. A document which can't be decoded is reported as an error,
+// while a missing or invalid value falls back to the default one. Both are also reported as Warning Events of the MemberOperatorConfig
+// (with the NSTemplateSetInvalidConfigReason), since the annotation is not validated by the API server.
+//
+// The settings are cached by the controller, and reloaded when the MemberOperatorConfig changes (see configCache).
+const (
+	memberOperatorConfigName = "config"
+
+	// NSTemplateSetConfigAnnotationKey is the annotation of the MemberOperatorConfig containing the NSTemplateSetConfig document
+	NSTemplateSetConfigAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "nstemplateset-config"
+
+	// NSTemplateSetInvalidConfigReason is the reason of the Events of the MemberOperatorConfig reporting that the NSTemplateSetConfig document
+	// can't be decoded or contains invalid values
+	NSTemplateSetInvalidConfigReason = "InvalidNSTemplateSetConfig"
+
+	quotaRecommendationRecommend = "recommend"
+	quotaRecommendationApply     = "apply"
+
+	defaultDeletionTimeout             = 60 * time.Second
+	defaultFinalizerRemovalGracePeriod = 10 * time.Minute
+	defaultRollbackThreshold           = 3
+	defaultUpdateFailureMinOutcomes    = 5
+	defaultExportRetryTimeout          = 10 * time.Minute
+	defaultSpaceQuotaRebalancePeriod   = 30 * time.Minute
+)
+
+// NSTemplateSetConfig contains the settings of the NSTemplateSet controller
+type NSTemplateSetConfig struct {
+	// DeletionTimeout is the max duration of the deletion of an NSTemplateSet before an error is reported (default: 1m)
+	// +optional
+	DeletionTimeout *metav1.Duration `json:"deletionTimeout,omitempty"`
+
+	// Export configures the export of the namespaced resources of the spaces before their deletion
+	// +optional
+	Export NSTemplateSetExportConfig `json:"export,omitempty"`
+
+	// FinalizerRemoval configures the removal of the finalizers blocking the termination of the namespaces of the spaces
+	// +optional
+	FinalizerRemoval NSTemplateSetFinalizerRemovalConfig `json:"finalizerRemoval,omitempty"`
+
+	// RollbackThreshold is the number of failed attempts to update an NSTemplateSet after which the space is rolled back
+	// to its last applied templates (default: 3). The rollback is disabled when the value is 0.
+	// +optional
+	RollbackThreshold *int `json:"rollbackThreshold,omitempty"`
+
+	// UnforcedKinds are the kinds (e.g. "LimitRange") of the template objects whose fields are not overridden when they are owned
+	// by other field managers. Such conflicts are reported in the FieldConflicts condition of the NSTemplateSet instead, without
+	// preventing it from being ready. They are evaluated again whenever the objects are applied again.
+	// +optional
+	UnforcedKinds []string `json:"unforcedKinds,omitempty"`
+
+	// Suspended suspends all the spaces: their resources are neither applied nor deleted until the value is removed
+	// (see also SuspendedAnnotationKey to suspend a single space)
+	// +optional
+	Suspended *bool `json:"suspended,omitempty"`
+
+	// MaxConcurrentUpdates is the max number of spaces which are updated to new templates concurrently. The other updates
+	// are deferred until some of the updates in progress complete. The limit is disabled when the value is 0.
+	// +optional
+	MaxConcurrentUpdates *int `json:"maxConcurrentUpdates,omitempty"`
+
+	// UpdateFailureThresholdPercent is the percentage (from 0 to 100) of failed updates of the spaces to new templates during the last hour
+	// above which the updates that are not started yet are halted (see updateRolloutTracker). The halt is disabled when the value is 0.
+	// +optional
+	UpdateFailureThresholdPercent *int `json:"updateFailureThresholdPercent,omitempty"`
+
+	// UpdateFailureMinOutcomes is the min number of updates of the spaces which completed or failed during the last hour before
+	// the updates can be halted by the UpdateFailureThresholdPercent, so that a single failure does not halt all the updates (default: 5)
+	// +optional
+	UpdateFailureMinOutcomes *int `json:"updateFailureMinOutcomes,omitempty"`
+
+	// QuotaRecommendation enables the recommendation of the quotas of the spaces based on their usage (see QuotaMinAnnotationKey):
+	// either "recommend" to store the recommended values in a ConfigMap referred to by the status of the NSTemplateSets, or "apply" to also apply them.
+	// The recommendation is disabled when the value is empty.
+	// +optional
+	QuotaRecommendation *string `json:"quotaRecommendation,omitempty"`
+
+	// PodSecurityMinimumLevel is the minimum pod security level (i.e. "baseline" or "restricted") of the namespaces of the spaces
+	// (see PodSecurityProfileAnnotationKey). There is no minimum level when the value is empty.
+	// +optional
+	PodSecurityMinimumLevel *string `json:"podSecurityMinimumLevel,omitempty"`
+
+	// SpaceQuotaRebalancePeriod is the period after which the quotas of a space are split again between its namespaces, based on their usage,
+	// when they are enforced with ResourceQuotas (see ensureSpaceQuotas). The quotas are still split again whenever the space is reconciled,
+	// but not periodically when the value is 0 (default: 30m).
+	// +optional
+	SpaceQuotaRebalancePeriod *metav1.Duration `json:"spaceQuotaRebalancePeriod,omitempty"`
+}
+
+// NSTemplateSetExportConfig configures the export of the namespaced resources of the spaces before their deletion
+type NSTemplateSetExportConfig struct {
+	// Target is the `https://` URL of an object-storage-compatible endpoint accepting (chunked) PUT requests, to which the resources
+	// of the spaces are exported. The export is disabled when the value is empty.
+	// +optional
+	Target *string `json:"target,omitempty"`
+
+	// ExcludeSecrets excludes the Secrets from the export, so that the credentials of the users are not copied to the target (default: true)
+	// +optional
+	ExcludeSecrets *bool `json:"excludeSecrets,omitempty"`
+
+	// AuthorizationSecret is the name of the Secret (in the operator namespace) whose `authorization` key contains
+	// the value of the Authorization header sent to the export endpoint
+	// +optional
+	AuthorizationSecret *string `json:"authorizationSecret,omitempty"`
+
+	// RetryTimeout is the max duration (since the deletion of the space) during which a failed export is retried. After that,
+	// the space is deleted without being exported (default: 10m).
+	// +optional
+	RetryTimeout *metav1.Duration `json:"retryTimeout,omitempty"`
+}
+
+// NSTemplateSetFinalizerRemovalConfig configures the removal of the finalizers blocking the termination of the namespaces of the spaces
+type NSTemplateSetFinalizerRemovalConfig struct {
+	// SafeFinalizers are the finalizers that can be removed from the resources blocking the termination of a user namespace.
+	// The removal is disabled when the list is empty.
+	// +optional
+	SafeFinalizers []string `json:"safeFinalizers,omitempty"`
+
+	// GracePeriod is the duration of the termination of a user namespace after which the safe finalizers are removed (default: 10m)
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+type nstemplatesetConfig struct {
+	deletionTimeout        time.Duration
+	export                 exportConfig
+	finalizers             finalizerRemovalConfig
+	rollbackThreshold      int
+	unforcedKinds          []string
+	suspended              bool
+	maxConcurrentUpdates   int
+	updateFailureThreshold float64
+	// updateFailureMinOutcomes is the min number of recent outcomes of the updates before they can be halted
+	updateFailureMinOutcomes int
+	// quotaRecommendation is either empty (disabled), quotaRecommendationRecommend or quotaRecommendationApply
+	quotaRecommendation string
+	// podSecurityMinimumLevel is either empty (no minimum) or one of the podSecurityLevels
+	podSecurityMinimumLevel   string
+	spaceQuotaRebalancePeriod time.Duration
+	// invalidValues are the messages about the invalid values of the document, which were replaced by the default ones
+	invalidValues []string
+}
+
+type exportConfig struct {
+	target              string
+	excludeSecrets      bool
+	authorizationSecret string
+	retryTimeout        time.Duration
+}
+
+func (c exportConfig) enabled() bool {
+	return c.target != ""
+}
+
+type finalizerRemovalConfig struct {
+	safeFinalizers []string
+	gracePeriod    time.Duration
+}
+
+func (c finalizerRemovalConfig) enabled() bool {
+	return len(c.safeFinalizers) > 0
+}
+
+// loadConfig returns the settings of the NSTemplateSet controller, read from the MemberOperatorConfig in the given (operator) namespace.
+// The problems of the document are reported as Events of the MemberOperatorConfig with the given recorder (if any).
+func loadConfig(ctx context.Context, cl runtimeclient.Client, namespace string, recorder record.EventRecorder) (nstemplatesetConfig, error) {
+	memberConfig := &toolchainv1alpha1.MemberOperatorConfig{}
+	if err := cl.Get(ctx, types.NamespacedName{Namespace: namespace, Name: memberOperatorConfigName}, memberConfig); err != nil {
+		if errors.IsNotFound(err) {
+			return newConfig(ctx, NSTemplateSetConfig{}), nil
+		}
+		return nstemplatesetConfig{}, err
+	}
+	doc := NSTemplateSetConfig{}
+	if value, found := memberConfig.GetAnnotations()[NSTemplateSetConfigAnnotationKey]; found {
+		if err := yaml.UnmarshalStrict([]byte(value), &doc); err != nil {
+			err = errs.Wrapf(err, "invalid '%s' annotation in the MemberOperatorConfig", NSTemplateSetConfigAnnotationKey)
+			if recorder != nil {
+				recorder.Event(memberConfig, corev1.EventTypeWarning, NSTemplateSetInvalidConfigReason, err.Error())
+			}
+			return nstemplatesetConfig{}, err
+		}
+	}
+	cfg := newConfig(ctx, doc)
+	if recorder != nil {
+		for _, message := range cfg.invalidValues {
+			recorder.Event(memberConfig, corev1.EventTypeWarning, NSTemplateSetInvalidConfigReason, message)
+		}
+	}
+	return cfg, nil
+}
+
+// newConfig returns the settings of the NSTemplateSet controller from the given document, with the default values
+// in place of the missing or invalid ones
+func newConfig(ctx context.Context, doc NSTemplateSetConfig) nstemplatesetConfig {
+	logger := log.FromContext(ctx)
+	var cfg nstemplatesetConfig
+	invalid := func(setting string, value any, fallback string) {
+		message := fmt.Sprintf("invalid value of the '%s' setting of the NSTemplateSet controller: %v - %s", setting, value, fallback)
+		logger.Info(message)
+		cfg.invalidValues = append(cfg.invalidValues, message)
+	}
+	usingDefault := func(value any) string {
+		return fmt.Sprintf("using the default one (%v)", value)
+	}
+	cfg = nstemplatesetConfig{
+		deletionTimeout: defaultDeletionTimeout,
+		export: exportConfig{
+			target:              ptr.Deref(doc.Export.Target, ""),
+			excludeSecrets:      ptr.Deref(doc.Export.ExcludeSecrets, true),
+			authorizationSecret: ptr.Deref(doc.Export.AuthorizationSecret, ""),
+			retryTimeout:        defaultExportRetryTimeout,
+		},
+		finalizers: finalizerRemovalConfig{
+			safeFinalizers: nonEmpty(doc.FinalizerRemoval.SafeFinalizers),
+			gracePeriod:    defaultFinalizerRemovalGracePeriod,
+		},
+		rollbackThreshold:         defaultRollbackThreshold,
+		updateFailureMinOutcomes:  defaultUpdateFailureMinOutcomes,
+		unforcedKinds:             nonEmpty(doc.UnforcedKinds),
+		suspended:                 ptr.Deref(doc.Suspended, false),
+		spaceQuotaRebalancePeriod: defaultSpaceQuotaRebalancePeriod,
+	}
+	if doc.DeletionTimeout != nil {
+		if doc.DeletionTimeout.Duration <= 0 {
+			invalid("deletionTimeout", doc.DeletionTimeout.Duration, usingDefault(defaultDeletionTimeout))
+		} else {
+			cfg.deletionTimeout = doc.DeletionTimeout.Duration
+		}
+	}
+	if doc.Export.RetryTimeout != nil {
+		if doc.Export.RetryTimeout.Duration < 0 {
+			invalid("export.retryTimeout", doc.Export.RetryTimeout.Duration, usingDefault(defaultExportRetryTimeout))
+		} else {
+			cfg.export.retryTimeout = doc.Export.RetryTimeout.Duration
+		}
+	}
+	if doc.FinalizerRemoval.GracePeriod != nil {
+		if doc.FinalizerRemoval.GracePeriod.Duration < 0 {
+			invalid("finalizerRemoval.gracePeriod", doc.FinalizerRemoval.GracePeriod.Duration, usingDefault(defaultFinalizerRemovalGracePeriod))
+		} else {
+			cfg.finalizers.gracePeriod = doc.FinalizerRemoval.GracePeriod.Duration
+		}
+	}
+	if doc.RollbackThreshold != nil {
+		if *doc.RollbackThreshold < 0 {
+			invalid("rollbackThreshold", *doc.RollbackThreshold, usingDefault(defaultRollbackThreshold))
+		} else {
+			cfg.rollbackThreshold = *doc.RollbackThreshold
+		}
+	}
+	if doc.MaxConcurrentUpdates != nil {
+		if *doc.MaxConcurrentUpdates < 0 {
+			invalid("maxConcurrentUpdates", *doc.MaxConcurrentUpdates, "ignoring it")
+		} else {
+			cfg.maxConcurrentUpdates = *doc.MaxConcurrentUpdates
+		}
+	}
+	if doc.UpdateFailureThresholdPercent != nil {
+		if percent := *doc.UpdateFailureThresholdPercent; percent < 0 || percent > 100 {
+			invalid("updateFailureThresholdPercent", percent, "ignoring it")
+		} else {
+			cfg.updateFailureThreshold = float64(percent) / 100
+		}
+	}
+	if doc.UpdateFailureMinOutcomes != nil {
+		if *doc.UpdateFailureMinOutcomes < 1 {
+			invalid("updateFailureMinOutcomes", *doc.UpdateFailureMinOutcomes, usingDefault(defaultUpdateFailureMinOutcomes))
+		} else {
+			cfg.updateFailureMinOutcomes = *doc.UpdateFailureMinOutcomes
+		}
+	}
+	switch value := ptr.Deref(doc.QuotaRecommendation, ""); value {
+	case "", quotaRecommendationRecommend, quotaRecommendationApply:
+		cfg.quotaRecommendation = value
+	default:
+		invalid("quotaRecommendation", value, "ignoring it")
+	}
+	if value := ptr.Deref(doc.PodSecurityMinimumLevel, ""); value == "" || slices.Contains(podSecurityLevels, value) {
+		cfg.podSecurityMinimumLevel = value
+	} else {
+		invalid("podSecurityMinimumLevel", value, "ignoring it")
+	}
+	if doc.SpaceQuotaRebalancePeriod != nil {
+		if doc.SpaceQuotaRebalancePeriod.Duration < 0 {
+			invalid("spaceQuotaRebalancePeriod", doc.SpaceQuotaRebalancePeriod.Duration, usingDefault(defaultSpaceQuotaRebalancePeriod))
+		} else {
+			cfg.spaceQuotaRebalancePeriod = doc.SpaceQuotaRebalancePeriod.Duration
+		}
+	}
+	return cfg
+}
+
+// nonEmpty returns the trimmed values of the given list, without the empty ones
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// configCache keeps the settings of the NSTemplateSet controller, so that the MemberOperatorConfig is not read and decoded
+// on every reconcile. The settings are reloaded after the cache is invalidated, i.e. when the MemberOperatorConfig changes.
+type configCache struct {
+	mu         sync.RWMutex
+	cfg        *nstemplatesetConfig
+	generation uint64
+	// recorder reports the problems of the settings when they are loaded (see SetupWithManager)
+	recorder record.EventRecorder
+}
+
+// get returns the cached settings, or loads them from the MemberOperatorConfig in the given (operator) namespace
+func (c *configCache) get(ctx context.Context, cl runtimeclient.Client, namespace string) (nstemplatesetConfig, error) {
+	c.mu.RLock()
+	cfg, generation := c.cfg, c.generation
+	c.mu.RUnlock()
+	if cfg != nil {
+		return *cfg, nil
+	}
+	loaded, err := loadConfig(ctx, cl, namespace, c.recorder)
+	if err != nil {
+		return loaded, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the settings are not cached if the cache was invalidated in the meantime, since they may be outdated
+	if c.generation == generation {
+		c.cfg = &loaded
+	}
+	return loaded, nil
+}
+
+// invalidate discards the cached settings, so that they are reloaded on the next call to get
+func (c *configCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cfg = nil
+	c.generation++
+}
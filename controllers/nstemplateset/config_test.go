@@ -0,0 +1,181 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestLoadConfig(t *testing.T) {
+	// given
+	namespaceName := "toolchain-member"
+
+	t.Run("default values without MemberOperatorConfig", func(t *testing.T) {
+		// given
+		manager, _ := prepareNamespacesManager(t)
+
+		// when
+		cfg, err := loadConfig(context.TODO(), manager.Client, namespaceName, nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, defaultDeletionTimeout, cfg.deletionTimeout)
+		assert.Equal(t, defaultExportRetryTimeout, cfg.export.retryTimeout)
+		assert.Equal(t, defaultFinalizerRemovalGracePeriod, cfg.finalizers.gracePeriod)
+		assert.Equal(t, defaultRollbackThreshold, cfg.rollbackThreshold)
+		assert.Equal(t, defaultSpaceQuotaRebalancePeriod, cfg.spaceQuotaRebalancePeriod)
+		assert.False(t, cfg.export.enabled())
+		assert.True(t, cfg.export.excludeSecrets)
+		assert.False(t, cfg.finalizers.enabled())
+	})
+
+	t.Run("values of the document", func(t *testing.T) {
+		// given
+		manager, _ := prepareNamespacesManager(t, newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			DeletionTimeout: &metav1.Duration{Duration: 2 * time.Minute},
+			Export: NSTemplateSetExportConfig{
+				Target:              ptr.To("https://backups"),
+				ExcludeSecrets:      ptr.To(false),
+				AuthorizationSecret: ptr.To("export-auth"),
+				RetryTimeout:        &metav1.Duration{Duration: time.Hour},
+			},
+			FinalizerRemoval: NSTemplateSetFinalizerRemovalConfig{
+				SafeFinalizers: []string{"example.com/finalizer"},
+				GracePeriod:    &metav1.Duration{Duration: time.Minute},
+			},
+			RollbackThreshold:         ptr.To(5),
+			SpaceQuotaRebalancePeriod: &metav1.Duration{Duration: 0},
+		}))
+
+		// when
+		cfg, err := loadConfig(context.TODO(), manager.Client, namespaceName, nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Minute, cfg.deletionTimeout)
+		assert.Equal(t, exportConfig{
+			target:              "https://backups",
+			excludeSecrets:      false,
+			authorizationSecret: "export-auth",
+			retryTimeout:        time.Hour,
+		}, cfg.export)
+		assert.Equal(t, finalizerRemovalConfig{
+			safeFinalizers: []string{"example.com/finalizer"},
+			gracePeriod:    time.Minute,
+		}, cfg.finalizers)
+		assert.Equal(t, 5, cfg.rollbackThreshold)
+		assert.Zero(t, cfg.spaceQuotaRebalancePeriod)
+	})
+
+	t.Run("invalid values fall back to the default ones", func(t *testing.T) {
+		// given
+		manager, _ := prepareNamespacesManager(t, newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			DeletionTimeout:           &metav1.Duration{Duration: -time.Minute},
+			RollbackThreshold:         ptr.To(-1),
+			SpaceQuotaRebalancePeriod: &metav1.Duration{Duration: -time.Minute},
+			QuotaRecommendation:       ptr.To("always"),
+		}))
+		recorder := record.NewFakeRecorder(10)
+
+		// when
+		cfg, err := loadConfig(context.TODO(), manager.Client, namespaceName, recorder)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, defaultDeletionTimeout, cfg.deletionTimeout)
+		assert.Equal(t, defaultRollbackThreshold, cfg.rollbackThreshold)
+		assert.Equal(t, defaultSpaceQuotaRebalancePeriod, cfg.spaceQuotaRebalancePeriod)
+		assert.Empty(t, cfg.quotaRecommendation)
+		// the invalid values are reported as events of the MemberOperatorConfig
+		require.Len(t, recorder.Events, 4)
+		assert.Equal(t, "Warning InvalidNSTemplateSetConfig invalid value of the 'deletionTimeout' setting of the NSTemplateSet controller: -1m0s - using the default one (1m0s)", <-recorder.Events)
+		assert.Equal(t, "Warning InvalidNSTemplateSetConfig invalid value of the 'rollbackThreshold' setting of the NSTemplateSet controller: -1 - using the default one (3)", <-recorder.Events)
+		assert.Equal(t, "Warning InvalidNSTemplateSetConfig invalid value of the 'quotaRecommendation' setting of the NSTemplateSet controller: always - ignoring it", <-recorder.Events)
+		assert.Equal(t, "Warning InvalidNSTemplateSetConfig invalid value of the 'spaceQuotaRebalancePeriod' setting of the NSTemplateSet controller: -1m0s - using the default one (30m0s)", <-recorder.Events)
+	})
+
+	t.Run("invalid document", func(t *testing.T) {
+		for name, doc := range map[string]string{
+			"malformed":     `{"deletionTimeout": `,
+			"unknown field": `{"deletion-timeout": "2m"}`,
+			"invalid type":  `{"rollbackThreshold": "3"}`,
+		} {
+			t.Run(name, func(t *testing.T) {
+				// given
+				memberConfig := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{})
+				memberConfig.Annotations[NSTemplateSetConfigAnnotationKey] = doc
+				manager, _ := prepareNamespacesManager(t, memberConfig)
+				recorder := record.NewFakeRecorder(10)
+
+				// when
+				_, err := loadConfig(context.TODO(), manager.Client, namespaceName, recorder)
+
+				// then
+				require.ErrorContains(t, err, "invalid 'toolchain.dev.openshift.com/nstemplateset-config' annotation in the MemberOperatorConfig")
+				require.Len(t, recorder.Events, 1)
+				assert.Equal(t, "Warning InvalidNSTemplateSetConfig "+err.Error(), <-recorder.Events)
+			})
+		}
+	})
+}
+
+func TestConfigCache(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	memberConfig := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+		RollbackThreshold: ptr.To(1),
+	})
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic")
+	r, fakeClient := prepareController(t, nsTmplSet, memberConfig)
+	cfg, err := r.config.get(context.TODO(), r.Client, namespaceName)
+	require.NoError(t, err)
+	require.Equal(t, 1, cfg.rollbackThreshold)
+	updated := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+		RollbackThreshold: ptr.To(2),
+	})
+	memberConfig.Annotations = updated.Annotations
+	require.NoError(t, fakeClient.Update(context.TODO(), memberConfig))
+
+	t.Run("cached until the MemberOperatorConfig changes", func(t *testing.T) {
+		// when
+		cfg, err := r.config.get(context.TODO(), r.Client, namespaceName)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 1, cfg.rollbackThreshold)
+	})
+
+	t.Run("reloaded and applied to all the spaces when the MemberOperatorConfig changes", func(t *testing.T) {
+		// when
+		requests := r.mapMemberOperatorConfigToNSTemplateSets(context.TODO(), memberConfig)
+
+		// then
+		assert.Equal(t, []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: namespaceName, Name: spacename}}}, requests)
+		cfg, err := r.config.get(context.TODO(), r.Client, namespaceName)
+		require.NoError(t, err)
+		assert.Equal(t, 2, cfg.rollbackThreshold)
+	})
+
+	t.Run("other MemberOperatorConfigs are ignored", func(t *testing.T) {
+		// given
+		other := &toolchainv1alpha1.MemberOperatorConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespaceName, Name: "other"},
+		}
+
+		// when
+		requests := r.mapMemberOperatorConfigToNSTemplateSets(context.TODO(), other)
+
+		// then
+		assert.Empty(t, requests)
+	})
+}
@@ -0,0 +1,342 @@
+package nstemplateset
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	errs "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// NSTemplateSetExportedConditionType is the type of the condition set once the namespaced resources of the space were exported
+	// before the deletion of its namespaces. The message of the condition contains the location of the export.
+	NSTemplateSetExportedConditionType toolchainv1alpha1.ConditionType = "Exported"
+
+	// NSTemplateSetExportedReason is the reason of the condition set once the namespaced resources of the space were exported
+	NSTemplateSetExportedReason = "Exported"
+
+	// NSTemplateSetExportFailedReason is the reason of the condition set when the export of the namespaced resources of the space
+	// was given up after the retry timeout, so that the space could be deleted without being exported
+	NSTemplateSetExportFailedReason = "ExportFailed"
+
+	// exportAuthorizationKey is the key of the export authorization Secret containing the value of the Authorization header
+	exportAuthorizationKey = "authorization"
+
+	// exportTimeout is the max duration of each attempt to upload an export
+	exportTimeout = 2 * time.Minute
+
+	// exportPollPeriod is the period after which a space whose export is being uploaded is reconciled again,
+	// in case the completion of the upload could not be notified
+	exportPollPeriod = 10 * time.Second
+)
+
+// exportedKinds are the kinds of the namespaced resources that are exported before the namespaces of a space are deleted.
+// The kinds which are not available in the cluster are ignored.
+var exportedKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "ConfigMap"},
+	{Version: "v1", Kind: "Secret"},
+	{Version: "v1", Kind: "Service"},
+	{Version: "v1", Kind: "ServiceAccount"},
+	{Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+	{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Group: "batch", Version: "v1", Kind: "CronJob"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"},
+	{Group: "route.openshift.io", Version: "v1", Kind: "Route"},
+}
+
+// ensureExported exports the namespaced resources of the space as a tarball of manifests to the configured target,
+// and records the location of the export in the status of the NSTemplateSet. Nothing is done if the export is disabled
+// or if the resources were already exported. The export is uploaded in the background (see exportTracker), and `true` is
+// returned while the upload is pending. A failed export is retried until the retry timeout of the configuration
+// has elapsed since the deletion of the space: after that, the export is given up so that the space can be deleted.
+func (r *namespacesManager) ensureExported(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg exportConfig) (pending bool, err error) {
+	if !cfg.enabled() {
+		return false, nil
+	}
+	if _, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetExportedConditionType); found {
+		// the resources were already exported, or the export was given up
+		return false, nil
+	}
+	logger := log.FromContext(ctx)
+	userNamespaces, err := fetchNamespacesByOwner(ctx, r.Client, nsTmplSet.Name)
+	if err != nil {
+		return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusTerminatingFailed, err, "failed to list namespaces with label owner '%s'", nsTmplSet.Name)
+	}
+	if len(userNamespaces) == 0 {
+		return false, nil
+	}
+
+	// the NSTemplateSet is copied since it is still updated by the reconcile during the upload
+	exported := nsTmplSet.DeepCopy()
+	completed, location, err := r.exports.upload(ctx, nsTmplSet, func(ctx context.Context) (string, error) {
+		logger.Info("exporting the resources of the space before its deletion", "target", cfg.target)
+		return r.export(ctx, exported, userNamespaces, cfg)
+	})
+	if !completed {
+		return true, nil
+	}
+	if err != nil {
+		if time.Since(deletionTime(nsTmplSet)) < cfg.retryTimeout {
+			return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusTerminatingFailed, err, "failed to export the resources of the space '%s'", nsTmplSet.Name)
+		}
+		logger.Error(err, "giving up the export of the resources of the space", "retry_timeout", cfg.retryTimeout)
+		return false, r.updateStatusConditions(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+			Type:    NSTemplateSetExportedConditionType,
+			Status:  corev1.ConditionFalse,
+			Reason:  NSTemplateSetExportFailedReason,
+			Message: fmt.Sprintf("the export was given up after %s: %s", cfg.retryTimeout, err.Error()),
+		})
+	}
+	logger.Info("exported the resources of the space", "location", location)
+
+	return false, r.updateStatusConditions(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+		Type:    NSTemplateSetExportedConditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  NSTemplateSetExportedReason,
+		Message: location,
+	})
+}
+
+// export streams the archive of the resources of the given namespaces to the configured target, so that the whole archive
+// is never kept in memory, and returns the location of the export
+func (r *namespacesManager) export(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespaces []corev1.Namespace, cfg exportConfig) (string, error) {
+	sink, err := r.newExportSink(ctx, nsTmplSet.Namespace, cfg)
+	if err != nil {
+		return "", err
+	}
+	reader, writer := io.Pipe()
+	archived := make(chan error, 1)
+	go func() {
+		err := r.archiveNamespaces(ctx, writer, namespaces, cfg.excludeSecrets, deletionTime(nsTmplSet))
+		writer.CloseWithError(err) // the reader gets an EOF when there is no error
+		archived <- err
+	}()
+	location, err := sink.write(ctx, exportFileName(nsTmplSet), reader)
+	// unblock the archiving if the upload stopped before the whole archive was read
+	reader.Close()
+	archiveErr := <-archived
+	switch {
+	case archiveErr != nil && !errors.Is(archiveErr, io.ErrClosedPipe):
+		return "", archiveErr
+	case err != nil:
+		return "", err
+	case archiveErr != nil:
+		return "", fmt.Errorf("the export endpoint responded before the whole archive was uploaded")
+	}
+	return location, nil
+}
+
+// archiveNamespaces writes a gzipped tarball containing the manifests of the resources of the given namespaces,
+// as `<namespace>/<kind>/<name>.yaml` entries
+func (r *namespacesManager) archiveNamespaces(ctx context.Context, w io.Writer, namespaces []corev1.Namespace, excludeSecrets bool, modTime time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, ns := range namespaces {
+		for _, gvk := range exportedKinds {
+			if excludeSecrets && gvk.Group == "" && gvk.Kind == "Secret" {
+				continue
+			}
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			if err := r.Client.List(ctx, list, runtimeclient.InNamespace(ns.Name)); err != nil {
+				if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+					continue // the kind is not available in this cluster
+				}
+				return errs.Wrapf(err, "failed to list the resources of kind '%s' in namespace '%s'", gvk.Kind, ns.Name)
+			}
+			for i := range list.Items {
+				manifest, err := exportedManifest(&list.Items[i])
+				if err != nil {
+					return err
+				}
+				header := &tar.Header{
+					Name:    fmt.Sprintf("%s/%s/%s.yaml", ns.Name, strings.ToLower(gvk.Kind), list.Items[i].GetName()),
+					Mode:    0o600,
+					Size:    int64(len(manifest)),
+					ModTime: modTime,
+				}
+				if err := tw.WriteHeader(header); err != nil {
+					return err
+				}
+				if _, err := tw.Write(manifest); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// exportedManifest returns the YAML manifest of the given object, without the fields that are specific to the current cluster
+func exportedManifest(obj *unstructured.Unstructured) ([]byte, error) {
+	content := obj.DeepCopy().Object
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "creationTimestamp", "generation", "selfLink"} {
+		unstructured.RemoveNestedField(content, "metadata", field)
+	}
+	unstructured.RemoveNestedField(content, "status")
+	manifest, err := yaml.Marshal(content)
+	if err != nil {
+		return nil, errs.Wrapf(err, "failed to marshal the resource '%s' of kind '%s'", obj.GetName(), obj.GetKind())
+	}
+	return manifest, nil
+}
+
+// deletionTime returns the time at which the deletion of the NSTemplateSet was requested, which is used to name the export
+// so that the same export is overwritten if it is retried
+func deletionTime(nsTmplSet *toolchainv1alpha1.NSTemplateSet) time.Time {
+	if nsTmplSet.DeletionTimestamp != nil {
+		return nsTmplSet.DeletionTimestamp.UTC()
+	}
+	return time.Now().UTC()
+}
+
+func exportFileName(nsTmplSet *toolchainv1alpha1.NSTemplateSet) string {
+	return fmt.Sprintf("%s-%s.tar.gz", nsTmplSet.Name, deletionTime(nsTmplSet).Format("20060102T150405Z"))
+}
+
+// exportTracker runs the uploads of the exports in the background, so that the reconciles are not blocked while the resources
+// of the spaces are uploaded. The result of an upload is kept until its space is reconciled again. It is not persisted: when the
+// operator restarts, the pending uploads are started again as soon as their spaces are reconciled.
+type exportTracker struct {
+	mu      sync.Mutex
+	uploads map[types.NamespacedName]*exportUpload
+	client  *http.Client
+	// done receives the NSTemplateSets whose upload completed, so that they are reconciled again (see SetupWithManager)
+	done chan event.GenericEvent
+}
+
+// exportUpload is an upload of an export, along with its result once it completed
+type exportUpload struct {
+	completed bool
+	location  string
+	err       error
+}
+
+func newExportTracker() *exportTracker {
+	return &exportTracker{
+		uploads: map[types.NamespacedName]*exportUpload{},
+		client:  &http.Client{Timeout: exportTimeout},
+		done:    make(chan event.GenericEvent, 100),
+	}
+}
+
+// upload starts the given upload of the export of the NSTemplateSet in the background, unless it is already in progress,
+// and returns its result once it completed. The result is then discarded, so that a failed upload can be started again.
+func (t *exportTracker) upload(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, upload func(context.Context) (string, error)) (completed bool, location string, err error) {
+	key := runtimeclient.ObjectKeyFromObject(nsTmplSet)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if current, found := t.uploads[key]; found {
+		if !current.completed {
+			return false, "", nil
+		}
+		delete(t.uploads, key)
+		return true, current.location, current.err
+	}
+	current := &exportUpload{}
+	t.uploads[key] = current
+	// the upload is not canceled at the end of the reconcile, but it keeps its logger
+	uploadCtx := log.IntoContext(context.Background(), log.FromContext(ctx))
+	go func() {
+		location, err := upload(uploadCtx)
+		t.mu.Lock()
+		current.completed, current.location, current.err = true, location, err
+		t.mu.Unlock()
+		completed := &toolchainv1alpha1.NSTemplateSet{}
+		completed.SetNamespace(key.Namespace)
+		completed.SetName(key.Name)
+		select {
+		case t.done <- event.GenericEvent{Object: completed}:
+		default:
+			// the NSTemplateSet is reconciled again after the exportPollPeriod
+		}
+	}()
+	return false, "", nil
+}
+
+// exportSink stores the exports and returns their location
+type exportSink interface {
+	write(ctx context.Context, name string, content io.Reader) (string, error)
+}
+
+func (r *namespacesManager) newExportSink(ctx context.Context, namespace string, cfg exportConfig) (exportSink, error) {
+	target, err := url.Parse(cfg.target)
+	if err != nil {
+		return nil, errs.Wrapf(err, "invalid export target '%s'", cfg.target)
+	}
+	// the exports contain the resources of the users, which must not be sent in clear text
+	if target.Scheme != "https" {
+		return nil, fmt.Errorf("invalid export target '%s': unsupported scheme '%s' (only https is supported)", cfg.target, target.Scheme)
+	}
+	sink := &httpSink{
+		endpoint: strings.TrimSuffix(cfg.target, "/"),
+		client:   r.exports.client,
+	}
+	if cfg.authorizationSecret != "" {
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: cfg.authorizationSecret}, secret); err != nil {
+			return nil, errs.Wrapf(err, "failed to get the export authorization secret '%s'", cfg.authorizationSecret)
+		}
+		sink.authorization = string(secret.Data[exportAuthorizationKey])
+	}
+	return sink, nil
+}
+
+// httpSink uploads the exports to an object-storage-compatible endpoint with (chunked) PUT requests
+type httpSink struct {
+	endpoint      string
+	authorization string
+	client        *http.Client
+}
+
+func (s *httpSink) write(ctx context.Context, name string, content io.Reader) (string, error) {
+	location := s.endpoint + "/" + url.PathEscape(name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location, content)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("unexpected response from the export endpoint: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return location, nil
+}
@@ -0,0 +1,365 @@
+package nstemplateset
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestEnsureExported(t *testing.T) {
+	// given
+	logger := zap.New(zap.UseDevMode(true))
+	log.SetLogger(logger)
+	ctx := log.IntoContext(context.TODO(), logger)
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	deletionTs := metav1.NewTime(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	newDeletedNSTmplSet := func(options ...nsTmplSetOption) *toolchainv1alpha1.NSTemplateSet {
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", append(options, withNamespaces("abcde11", "dev"))...)
+		nsTmplSet.SetDeletionTimestamp(&deletionTs)
+		return nsTmplSet
+	}
+	devNS := newNamespace("basic", spacename, "dev")
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devNS.Name, Name: "settings"},
+		Data:       map[string]string{"color": "blue"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: devNS.Name, Name: "credentials"},
+		Data:       map[string][]byte{"password": []byte("secret")},
+	}
+
+	t.Run("export to an HTTP endpoint", func(t *testing.T) {
+		// given
+		var uploaded []byte
+		var authorization string
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPut, r.Method)
+			assert.Equal(t, "/backups/johnsmith-20260102T030405Z.tar.gz", r.URL.Path)
+			authorization = r.Header.Get("Authorization")
+			uploaded, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		authSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespaceName, Name: "export-auth"},
+			Data:       map[string][]byte{"authorization": []byte("Bearer some-token")},
+		}
+		nsTmplSet := newDeletedNSTmplSet()
+		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, cm, secret, authSecret)
+		manager.exports.client = server.Client()
+
+		// when
+		err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: server.URL + "/backups/", authorizationSecret: "export-auth"})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Exported(server.URL + "/backups/johnsmith-20260102T030405Z.tar.gz"))
+		assert.Equal(t, "Bearer some-token", authorization)
+		entries := readArchive(t, uploaded)
+		assert.Contains(t, entries, "johnsmith-dev/secret/credentials.yaml")
+		require.Contains(t, entries, "johnsmith-dev/configmap/settings.yaml")
+		assert.Contains(t, entries["johnsmith-dev/configmap/settings.yaml"], "color: blue")
+		assert.NotContains(t, entries["johnsmith-dev/configmap/settings.yaml"], "resourceVersion")
+
+		t.Run("not exported again", func(t *testing.T) {
+			// given
+			uploaded = nil
+
+			// when
+			err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: server.URL + "/backups/", authorizationSecret: "export-auth"})
+
+			// then
+			require.NoError(t, err)
+			assert.Nil(t, uploaded)
+		})
+	})
+
+	t.Run("export without secrets", func(t *testing.T) {
+		// given
+		var uploaded []byte
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uploaded, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		nsTmplSet := newDeletedNSTmplSet()
+		manager, _ := prepareNamespacesManager(t, nsTmplSet, devNS, cm, secret)
+		manager.exports.client = server.Client()
+
+		// when
+		err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: server.URL, excludeSecrets: true})
+
+		// then
+		require.NoError(t, err)
+		entries := readArchive(t, uploaded)
+		assert.Contains(t, entries, "johnsmith-dev/configmap/settings.yaml")
+		assert.NotContains(t, entries, "johnsmith-dev/secret/credentials.yaml")
+	})
+
+	t.Run("secrets excluded by default", func(t *testing.T) {
+		// given
+		var uploaded []byte
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uploaded, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		nsTmplSet := newDeletedNSTmplSet()
+		manager, _ := prepareNamespacesManager(t, nsTmplSet, devNS, cm, secret)
+		manager.exports.client = server.Client()
+
+		// when
+		err := exportAndWait(ctx, t, manager, nsTmplSet, newConfig(ctx, NSTemplateSetConfig{
+			Export: NSTemplateSetExportConfig{Target: ptr.To(server.URL)},
+		}).export)
+
+		// then
+		require.NoError(t, err)
+		entries := readArchive(t, uploaded)
+		assert.Contains(t, entries, "johnsmith-dev/configmap/settings.yaml")
+		assert.NotContains(t, entries, "johnsmith-dev/secret/credentials.yaml")
+	})
+
+	t.Run("reconcile not blocked during the upload", func(t *testing.T) {
+		// given
+		release := make(chan struct{})
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.ReadAll(r.Body)
+			<-release
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		nsTmplSet := newDeletedNSTmplSet()
+		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, cm)
+		manager.exports.client = server.Client()
+		cfg := exportConfig{target: server.URL}
+
+		// when
+		pending, err := manager.ensureExported(ctx, nsTmplSet, cfg)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, pending)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasNoConditions()
+
+		t.Run("still pending", func(t *testing.T) {
+			// when
+			pending, err := manager.ensureExported(ctx, nsTmplSet, cfg)
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, pending)
+		})
+
+		t.Run("exported once the upload completed", func(t *testing.T) {
+			// given
+			close(release)
+
+			// when
+			err := exportAndWait(ctx, t, manager, nsTmplSet, cfg)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(Exported(server.URL + "/johnsmith-20260102T030405Z.tar.gz"))
+		})
+	})
+
+	t.Run("nothing to export", func(t *testing.T) {
+		t.Run("when disabled", func(t *testing.T) {
+			// given
+			nsTmplSet := newDeletedNSTmplSet()
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, cm)
+
+			// when
+			err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasNoConditions()
+		})
+
+		t.Run("when there is no namespace", func(t *testing.T) {
+			// given
+			nsTmplSet := newDeletedNSTmplSet()
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet)
+
+			// when
+			err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: "https://unreachable"})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasNoConditions()
+		})
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			http.Error(w, "access denied", http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		t.Run("endpoint returns an error", func(t *testing.T) {
+			// given
+			nsTmplSet := newDeletedNSTmplSet()
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, cm)
+			manager.exports.client = server.Client()
+
+			// when
+			err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: server.URL, retryTimeout: time.Since(deletionTs.Time) + time.Hour})
+
+			// then
+			require.EqualError(t, err, "failed to export the resources of the space 'johnsmith': unexpected response from the export endpoint: 403 Forbidden access denied")
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(UnableToTerminate("unexpected response from the export endpoint: 403 Forbidden access denied"))
+		})
+
+		t.Run("export is given up after the retry timeout", func(t *testing.T) {
+			// given
+			nsTmplSet := newDeletedNSTmplSet()
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, cm)
+			manager.exports.client = server.Client()
+
+			// when
+			err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: server.URL, retryTimeout: 10 * time.Minute})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(ExportFailed("the export was given up after 10m0s: unexpected response from the export endpoint: 403 Forbidden access denied"))
+
+			t.Run("not retried", func(t *testing.T) {
+				// given
+				require.NoError(t, fakeClient.Get(ctx, runtimeclient.ObjectKeyFromObject(nsTmplSet), nsTmplSet))
+
+				// when
+				err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: server.URL, retryTimeout: time.Since(deletionTs.Time) + time.Hour})
+
+				// then
+				require.NoError(t, err)
+			})
+		})
+
+		t.Run("unsupported target", func(t *testing.T) {
+			for _, target := range []string{"file:///backups", "http://backups.example.com"} {
+				t.Run(target, func(t *testing.T) {
+					// given
+					nsTmplSet := newDeletedNSTmplSet()
+					manager, _ := prepareNamespacesManager(t, nsTmplSet, devNS, cm)
+
+					// when
+					err := exportAndWait(ctx, t, manager, nsTmplSet, exportConfig{target: target, retryTimeout: time.Since(deletionTs.Time) + time.Hour})
+
+					// then
+					scheme, _, _ := strings.Cut(target, ":")
+					require.EqualError(t, err, fmt.Sprintf("failed to export the resources of the space 'johnsmith': invalid export target '%s': unsupported scheme '%s' (only https is supported)", target, scheme))
+				})
+			}
+		})
+	})
+}
+
+func TestDeleteNSTemplateSetWithExport(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withDeletionTs())
+	devNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+	memberConfig := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+		Export: NSTemplateSetExportConfig{
+			Target: ptr.To(server.URL),
+		},
+	})
+	r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS, memberConfig)
+	r.namespaces.exports.client = server.Client()
+
+	// when
+	result, err := r.Reconcile(context.TODO(), req)
+
+	// then
+	require.NoError(t, err)
+	// nothing is deleted while the export is being uploaded
+	assert.Equal(t, exportPollPeriod, result.RequeueAfter)
+	AssertThatNamespace(t, devNS.Name, fakeClient).HasNoDeletionTimestamp()
+	waitForExport(t, r.namespaces)
+
+	// when
+	_, err = r.Reconcile(context.TODO(), req)
+
+	// then
+	require.NoError(t, err)
+	// the location of the export is recorded before the namespace is deleted
+	updated := &toolchainv1alpha1.NSTemplateSet{}
+	require.NoError(t, fakeClient.Get(context.TODO(), req.NamespacedName, updated))
+	exported, found := condition.FindConditionByType(updated.Status.Conditions, NSTemplateSetExportedConditionType)
+	require.True(t, found)
+	assert.True(t, strings.HasPrefix(exported.Message, server.URL+"/johnsmith-"))
+	AssertThatNamespace(t, devNS.Name, fakeClient).DoesNotExist()
+}
+
+// exportAndWait calls ensureExported until the upload of the export (if any) completed
+func exportAndWait(ctx context.Context, t *testing.T, manager *namespacesManager, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg exportConfig) error {
+	pending, err := manager.ensureExported(ctx, nsTmplSet, cfg)
+	if err != nil || !pending {
+		return err
+	}
+	waitForExport(t, manager)
+	pending, err = manager.ensureExported(ctx, nsTmplSet, cfg)
+	require.False(t, pending)
+	return err
+}
+
+func waitForExport(t *testing.T, manager *namespacesManager) {
+	select {
+	case <-manager.exports.done:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "the upload of the export did not complete")
+	}
+}
+
+func readArchive(t *testing.T, content []byte) map[string]string {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	entries := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[header.Name] = string(data)
+	}
+	return entries
+}
@@ -1,12 +1,45 @@
 package nstemplateset
 
 import (
+	"slices"
+	"strings"
+
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/toolchain-common/pkg/utils"
-	"k8s.io/utils/strings/slices"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Feature toggles are enabled for a space by the host cluster, which selects the "winning" features (e.g. according to their
+// weight, for a progressive rollout) and lists them in the feature annotation of the NSTemplateSet. On the member side,
+// the objects of the templates which are annotated with a feature are created only when this feature is enabled, and deleted
+// as soon as it is disabled. When the Namespace object of a namespace template is annotated with a feature, the whole
+// namespace type is provisioned (or deprovisioned) along with the feature.
+//
+// The status of each enabled feature which is referenced by the cluster resources or namespace templates of the space is reported
+// in a dedicated condition of the NSTemplateSet. The features are read from the raw objects of the templates, so the name of a feature
+// must not depend on the parameters of a template.
+
+const (
+	// FeatureToggleConditionTypePrefix is the prefix of the type of the condition reporting the status of a feature toggle,
+	// followed by the name of the feature
+	FeatureToggleConditionTypePrefix = "FeatureToggle."
+
+	// FeatureToggleEnabledReason is the reason of the condition of a feature which is enabled but not applied yet
+	FeatureToggleEnabledReason = "Enabled"
+	// FeatureToggleAppliedReason is the reason of the condition of a feature whose objects were all applied
+	FeatureToggleAppliedReason = "Applied"
+	// FeatureToggleFailedReason is the reason of the condition of a feature whose objects could not be applied
+	FeatureToggleFailedReason = "Failed"
+
+	// appliedFeaturesAnnotationKey is set on the namespaces and contains the sorted, comma-separated list of the enabled features
+	// whose objects were applied in the namespace
+	appliedFeaturesAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "applied-features"
+)
+
 // shouldCreate checks if the object has a feature toggle annotation. If it does then check if the corresponding
 // feature is referenced in the NSTemplateSet feature annotation. Returns true if yes. It means this feature
 // should be enabled and the object should be created. It also returns true if the object doesn't have a feature annotation at all
@@ -30,3 +63,134 @@ func featuresChanged(nsTmplSet *toolchainv1alpha1.NSTemplateSet) bool {
 	changed, _ := featureAnnotationNeedsUpdate(nsTmplSet)
 	return changed
 }
+
+// enabledFeatures returns the sorted and deduplicated list of the features enabled in the NSTemplateSet
+func enabledFeatures(nsTmplSet *toolchainv1alpha1.NSTemplateSet) []string {
+	features := utils.SplitCommaSeparatedList(nsTmplSet.GetAnnotations()[toolchainv1alpha1.FeatureToggleNameAnnotationKey])
+	slices.Sort(features)
+	return slices.Compact(features)
+}
+
+// featureOf returns the name of the feature the given object belongs to, or an empty string if the object is not managed by a feature toggle
+func featureOf(obj runtimeclient.Object) string {
+	return obj.GetAnnotations()[toolchainv1alpha1.FeatureToggleNameAnnotationKey]
+}
+
+// featuresToApply returns the sorted list of the features enabled in the NSTemplateSet which are referenced by the given objects
+func featuresToApply(nsTmplSet *toolchainv1alpha1.NSTemplateSet, objs []runtimeclient.Object) []string {
+	var features []string
+	for _, obj := range objs {
+		if feature := featureOf(obj); feature != "" && shouldCreate(obj, nsTmplSet) {
+			features = append(features, feature)
+		}
+	}
+	slices.Sort(features)
+	return slices.Compact(features)
+}
+
+// enabledAmong returns the sorted list of the given features which are enabled in the NSTemplateSet
+func enabledAmong(nsTmplSet *toolchainv1alpha1.NSTemplateSet, features []string) []string {
+	enabled := enabledFeatures(nsTmplSet)
+	result := slices.DeleteFunc(slices.Clone(features), func(feature string) bool {
+		return !slices.Contains(enabled, feature)
+	})
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+// templateFeatures returns the sorted lists of the features referenced by the Namespace objects of the given template
+// and by its other objects. The features are read from the raw objects, hence the template doesn't need to be processed
+// (and the parsed objects of the TierTemplateRevisions are taken from the cache). The objects which can't be read before
+// being processed are ignored, since their processing (with filters) fails anyway.
+func templateFeatures(tmpl *tierTemplate) (namespaceFeatures []string, objectFeatures []string) {
+	for _, obj := range rawTemplateObjects(tmpl) {
+		feature := featureOf(obj)
+		if feature == "" {
+			continue
+		}
+		if obj.GetKind() == "Namespace" {
+			namespaceFeatures = append(namespaceFeatures, feature)
+		} else {
+			objectFeatures = append(objectFeatures, feature)
+		}
+	}
+	slices.Sort(namespaceFeatures)
+	slices.Sort(objectFeatures)
+	return slices.Compact(namespaceFeatures), slices.Compact(objectFeatures)
+}
+
+// rawTemplateObjects returns the raw objects of the given template, i.e. before it is processed. The parsed objects
+// of the TierTemplateRevisions are taken from the cache, and the objects which can't be read before being processed are ignored.
+func rawTemplateObjects(tmpl *tierTemplate) []*unstructured.Unstructured {
+	var raws []runtime.RawExtension
+	if tmpl.ttr != nil {
+		for _, parsed := range parsedTemplates.get(tmpl.ttr) {
+			if parsed.unmarshalErr == nil {
+				raws = append(raws, parsed.raw)
+			}
+		}
+	} else {
+		raws = tmpl.template.Objects
+	}
+	objs := make([]*unstructured.Unstructured, 0, len(raws))
+	for _, raw := range raws {
+		if obj, err := rawToUnstructured(raw); err == nil {
+			objs = append(objs, obj)
+		}
+	}
+	return objs
+}
+
+// rawToUnstructured returns the content of the given raw object of a template
+func rawToUnstructured(raw runtime.RawExtension) (*unstructured.Unstructured, error) {
+	switch obj := raw.Object.(type) {
+	case *unstructured.Unstructured:
+		return obj, nil
+	case nil:
+		result := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal(raw.Raw, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	default:
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		return &unstructured.Unstructured{Object: content}, nil
+	}
+}
+
+// appliedFeatures returns the features whose objects were applied in the given namespace
+func appliedFeatures(ns *corev1.Namespace) []string {
+	features := utils.SplitCommaSeparatedList(ns.GetAnnotations()[appliedFeaturesAnnotationKey])
+	slices.Sort(features)
+	return slices.Compact(features)
+}
+
+// setAppliedFeatures records the given features in the annotation of the namespace (or removes the annotation if there is no feature)
+func setAppliedFeatures(ns *corev1.Namespace, features []string) {
+	if len(features) == 0 {
+		delete(ns.Annotations, appliedFeaturesAnnotationKey)
+		return
+	}
+	if ns.Annotations == nil {
+		ns.Annotations = map[string]string{}
+	}
+	ns.Annotations[appliedFeaturesAnnotationKey] = strings.Join(features, ",")
+}
+
+// featureToggleConditionType returns the type of the condition reporting the status of the given feature
+func featureToggleConditionType(feature string) toolchainv1alpha1.ConditionType {
+	return toolchainv1alpha1.ConditionType(FeatureToggleConditionTypePrefix + feature)
+}
+
+// withoutDisabledFeatureToggleConditions returns the given conditions without the ones of the features which are not enabled anymore,
+// along with a flag indicating whether some condition was removed
+func withoutDisabledFeatureToggleConditions(conditions []toolchainv1alpha1.Condition, enabled []string) ([]toolchainv1alpha1.Condition, bool) {
+	result := slices.DeleteFunc(slices.Clone(conditions), func(c toolchainv1alpha1.Condition) bool {
+		feature, isFeature := strings.CutPrefix(string(c.Type), FeatureToggleConditionTypePrefix)
+		return isFeature && !slices.Contains(enabled, feature)
+	})
+	return result, len(result) != len(conditions)
+}
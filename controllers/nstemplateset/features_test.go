@@ -157,6 +157,39 @@ func TestFeaturesChanged(t *testing.T) {
 	}
 }
 
+func TestFeaturesToApply(t *testing.T) {
+	// given
+	objs := []runtimeclient.Object{
+		objectWithFeature(nil),
+		objectWithFeature(p("feature-2")),
+		objectWithFeature(p("feature-1")),
+		objectWithFeature(p("feature-2")),
+		objectWithFeature(p("feature-3")),
+	}
+
+	t.Run("should return the enabled features referenced by the objects", func(t *testing.T) {
+		// given
+		nsts := newNSTmplSet("default", "ns", "base", withNSTemplateSetFeatureAnnotation("feature-4,feature-2,feature-1"))
+
+		// when
+		features := featuresToApply(nsts, objs)
+
+		// then
+		assert.Equal(t, []string{"feature-1", "feature-2"}, features)
+	})
+
+	t.Run("should return no feature when none is enabled", func(t *testing.T) {
+		// given
+		nsts := newNSTmplSet("default", "ns", "base")
+
+		// when
+		features := featuresToApply(nsts, objs)
+
+		// then
+		assert.Empty(t, features)
+	})
+}
+
 func p(s string) *string {
 	return &s
 }
@@ -0,0 +1,193 @@
+package nstemplateset
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	commonpredicates "github.com/codeready-toolchain/toolchain-common/pkg/predicate"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// kindWatcher adds the watches for the kinds of the objects created from the templates, as soon as they are applied for the first time.
+// This way, the objects which are modified or deleted by the users are restored in a matter of seconds, instead of
+// waiting for the next periodic resync of the NSTemplateSets (see manager.Options.Cache.SyncPeriod).
+//
+// The watches are metadata-only and limited to the objects with the space label, so that the memory usage stays reasonable
+// even for kinds with a lot of instances in the cluster (such as ConfigMaps or Secrets).
+type kindWatcher struct {
+	lock    sync.Mutex
+	watched map[schema.GroupVersionKind]bool
+	watch   func(obj *metav1.PartialObjectMetadata) error
+	// cache contains the metadata of the objects with the space label, for the watched kinds (if any)
+	cache runtimeclient.Reader
+}
+
+// staticallyWatchedKinds are the kinds watched regardless of the templates (see SetupWithManager)
+var staticallyWatchedKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "Namespace"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"},
+}
+
+func newKindWatcher(cache runtimeclient.Reader, watch func(obj *metav1.PartialObjectMetadata) error) *kindWatcher {
+	watched := map[schema.GroupVersionKind]bool{}
+	for _, gvk := range staticallyWatchedKinds {
+		watched[gvk] = true
+	}
+	return &kindWatcher{
+		watched: watched,
+		watch:   watch,
+		cache:   cache,
+	}
+}
+
+// newControllerKindWatcher returns a kindWatcher which adds the watches to the given controller. The objects are retrieved via a dedicated cache,
+// which contains only the objects with the space label and which is started along with the manager.
+func newControllerKindWatcher(mgr manager.Manager, ctrl controller.Controller, eventHandler handler.EventHandler) (*kindWatcher, error) {
+	spaceLabelExists, err := labels.NewRequirement(toolchainv1alpha1.SpaceLabelKey, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	watchCache, err := cache.New(mgr.GetConfig(), cache.Options{
+		HTTPClient:           mgr.GetHTTPClient(),
+		Scheme:               mgr.GetScheme(),
+		Mapper:               mgr.GetRESTMapper(),
+		DefaultLabelSelector: labels.NewSelector().Add(*spaceLabelExists),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := mgr.Add(watchCache); err != nil {
+		return nil, err
+	}
+	operatorNamespace, err := configuration.GetWatchNamespace()
+	if err != nil {
+		return nil, err
+	}
+	return newKindWatcher(watchCache, func(obj *metav1.PartialObjectMetadata) error {
+		return ctrl.Watch(source.Kind[runtimeclient.Object](watchCache, obj, eventHandler, kindWatchPredicate(obj.GroupVersionKind(), operatorNamespace)))
+	}), nil
+}
+
+// dataKinds are the kinds whose content is not reflected by their generation, since they have no spec
+var dataKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "ConfigMap"},
+	{Version: "v1", Kind: "Secret"},
+}
+
+// kindWatchPredicate returns the predicate of the watch of the given kind: the changes of the labels and of the generation
+// trigger a reconcile, as well as any change of the objects which have no generation but data (e.g. ConfigMaps).
+// The objects in the namespace of the operator (e.g. the ConfigMaps of the last applied space roles) are ignored, since they are
+// owned by the NSTemplateSets and thus already watched as such.
+func kindWatchPredicate(gvk schema.GroupVersionKind, operatorNamespace string) predicate.Predicate {
+	notInOperatorNamespace := predicate.NewPredicateFuncs(func(obj runtimeclient.Object) bool {
+		return obj.GetNamespace() != operatorNamespace
+	})
+	if slices.Contains(dataKinds, gvk) {
+		return predicate.And[runtimeclient.Object](notInOperatorNamespace, predicate.ResourceVersionChangedPredicate{})
+	}
+	return predicate.And[runtimeclient.Object](notInOperatorNamespace, commonpredicates.LabelsAndGenerationPredicate{})
+}
+
+// ensureWatched adds a watch for the kind of the given object, unless the kind is already watched.
+// A failure is only logged, since the object is still restored by the periodic resync - the watch is then retried with the next object of the same kind.
+func (w *kindWatcher) ensureWatched(ctx context.Context, object runtimeclient.Object) {
+	w.ensureKindWatched(ctx, object.GetObjectKind().GroupVersionKind())
+}
+
+// ensureKindWatched adds a watch for the given kind, unless it is already watched (see ensureWatched)
+func (w *kindWatcher) ensureKindWatched(ctx context.Context, gvk schema.GroupVersionKind) {
+	if w == nil || gvk.Empty() {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.watched[gvk] {
+		return
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(gvk)
+	if err := w.watch(obj); err != nil {
+		log.FromContext(ctx).Error(err, "unable to watch the kind of objects", "gvk", gvk.String())
+		return
+	}
+	log.FromContext(ctx).Info("watching a new kind of objects", "gvk", gvk.String())
+	w.watched[gvk] = true
+}
+
+// exists returns false if the given object is known not to exist, i.e. if its kind is watched and the object is not in the cache
+// of the watches. Returns true otherwise (including when the existence of the object can't be checked), so that the callers
+// behave as if there was no cache.
+func (w *kindWatcher) exists(ctx context.Context, object runtimeclient.Object) bool {
+	if w == nil || w.cache == nil {
+		return true
+	}
+	gvk := object.GetObjectKind().GroupVersionKind()
+	w.ensureKindWatched(ctx, gvk)
+	w.lock.Lock()
+	watched := w.watched[gvk]
+	w.lock.Unlock()
+	if !watched {
+		return true
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(gvk)
+	err := w.cache.Get(ctx, runtimeclient.ObjectKeyFromObject(object), obj)
+	return !apierrors.IsNotFound(err)
+}
+
+// existingObjects returns the given objects, except the ones which are known not to exist (see kindWatcher.exists),
+// so that no request is sent to the API server to delete the objects which are already gone
+func (c APIClient) existingObjects(ctx context.Context, objs []runtimeclient.Object) []runtimeclient.Object {
+	return slices.DeleteFunc(slices.Clone(objs), func(obj runtimeclient.Object) bool {
+		return !c.kinds.exists(ctx, obj)
+	})
+}
+
+// watchTemplateKinds adds the watches for the kinds of the objects of the templates referenced by the NSTemplateSets (including the
+// last applied ones), so that the objects which were applied before the operator started are watched right away, instead of waiting
+// for another object of the same kind to be applied. The templates which can't be fetched are skipped.
+func (r *Reconciler) watchTemplateKinds(ctx context.Context) error {
+	namespace, err := getNamespaceName(reconcile.Request{})
+	if err != nil {
+		return err
+	}
+	nsTmplSets := &toolchainv1alpha1.NSTemplateSetList{}
+	if err := r.Client.List(ctx, nsTmplSets, runtimeclient.InNamespace(namespace)); err != nil {
+		return err
+	}
+	fetched := map[string]bool{}
+	for i := range nsTmplSets.Items {
+		for _, templateRef := range templateRefsInUse(&nsTmplSets.Items[i]) {
+			if templateRef == "" || fetched[templateRef] {
+				continue
+			}
+			fetched[templateRef] = true
+			tmpl, err := r.fetchTierTemplate(ctx, &nsTmplSets.Items[i], templateRef)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "unable to watch the kinds of the objects of the template", "template_ref", templateRef)
+				continue
+			}
+			for _, obj := range rawTemplateObjects(tmpl) {
+				r.kinds.ensureKindWatched(ctx, obj.GroupVersionKind())
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	quotav1 "github.com/openshift/api/quota/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+func TestKindWatcher(t *testing.T) {
+	networkPolicyGVK := schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"}
+	resourceQuotaGVK := schema.GroupVersionKind{Version: "v1", Kind: "ResourceQuota"}
+	newObject := func(gvk schema.GroupVersionKind, name string) runtimeclient.Object {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(gvk)
+		obj.SetName(name)
+		return obj
+	}
+	newRecordingKindWatcher := func(watchErr error) (*kindWatcher, *[]schema.GroupVersionKind) {
+		var watched []schema.GroupVersionKind
+		return newKindWatcher(nil, func(obj *metav1.PartialObjectMetadata) error {
+			watched = append(watched, obj.GroupVersionKind())
+			return watchErr
+		}), &watched
+	}
+
+	t.Run("watches each kind only once", func(t *testing.T) {
+		// given
+		watcher, watched := newRecordingKindWatcher(nil)
+
+		// when
+		watcher.ensureWatched(context.TODO(), newObject(networkPolicyGVK, "allow-same-namespace"))
+		watcher.ensureWatched(context.TODO(), newObject(resourceQuotaGVK, "compute"))
+		watcher.ensureWatched(context.TODO(), newObject(networkPolicyGVK, "allow-from-openshift-ingress"))
+
+		// then
+		assert.Equal(t, []schema.GroupVersionKind{networkPolicyGVK, resourceQuotaGVK}, *watched)
+	})
+
+	t.Run("existence of the objects checked in the cache of the watches", func(t *testing.T) {
+		// given
+		existing := &networkingv1.NetworkPolicy{ObjectMeta: metav1.ObjectMeta{Namespace: "johnsmith-dev", Name: "allow-from-same-space"}}
+		fakeClient := test.NewFakeClient(t, existing)
+		watcher := newKindWatcher(fakeClient, func(*metav1.PartialObjectMetadata) error { return nil })
+		existingObj := newObject(networkPolicyGVK, "allow-from-same-space")
+		existingObj.SetNamespace("johnsmith-dev")
+		missingObj := newObject(networkPolicyGVK, "allow-from-feature")
+		missingObj.SetNamespace("johnsmith-dev")
+
+		// when
+		result := (APIClient{kinds: watcher}).existingObjects(context.TODO(), []runtimeclient.Object{existingObj, missingObj})
+
+		// then
+		assert.Equal(t, []runtimeclient.Object{existingObj}, result)
+	})
+
+	t.Run("objects considered as existing when the kind can't be watched", func(t *testing.T) {
+		// given
+		watcher := newKindWatcher(test.NewFakeClient(t), func(*metav1.PartialObjectMetadata) error { return fmt.Errorf("no such kind") })
+		obj := newObject(networkPolicyGVK, "allow-from-feature")
+		obj.SetNamespace("johnsmith-dev")
+
+		// when
+		exists := watcher.exists(context.TODO(), obj)
+
+		// then
+		assert.True(t, exists)
+	})
+
+	t.Run("statically watched kinds are skipped", func(t *testing.T) {
+		// given
+		watcher, watched := newRecordingKindWatcher(nil)
+
+		// when
+		for _, gvk := range staticallyWatchedKinds {
+			watcher.ensureWatched(context.TODO(), newObject(gvk, "johnsmith-dev"))
+		}
+
+		// then
+		assert.Empty(t, *watched)
+	})
+
+	t.Run("objects without kind are skipped", func(t *testing.T) {
+		// given
+		watcher, watched := newRecordingKindWatcher(nil)
+
+		// when
+		watcher.ensureWatched(context.TODO(), &networkingv1.NetworkPolicy{})
+
+		// then
+		assert.Empty(t, *watched)
+	})
+
+	t.Run("failed watch is retried", func(t *testing.T) {
+		// given
+		watcher, watched := newRecordingKindWatcher(fmt.Errorf("mock error"))
+
+		// when
+		watcher.ensureWatched(context.TODO(), newObject(networkPolicyGVK, "allow-same-namespace"))
+		watcher.watch = func(obj *metav1.PartialObjectMetadata) error {
+			*watched = append(*watched, obj.GroupVersionKind())
+			return nil
+		}
+		watcher.ensureWatched(context.TODO(), newObject(networkPolicyGVK, "allow-same-namespace"))
+		watcher.ensureWatched(context.TODO(), newObject(networkPolicyGVK, "allow-same-namespace"))
+
+		// then
+		assert.Equal(t, []schema.GroupVersionKind{networkPolicyGVK, networkPolicyGVK}, *watched)
+	})
+
+	t.Run("kinds of the applied objects are watched", func(t *testing.T) {
+		// given
+		apiClient, _ := prepareAPIClient(t)
+		watcher, watched := newRecordingKindWatcher(nil)
+		apiClient.kinds = watcher
+		quota := &corev1.ResourceQuota{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ResourceQuota"},
+			ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: "johnsmith-dev"},
+		}
+
+		// when
+		_, err := apiClient.ApplyToolchainObjects(context.TODO(), []runtimeclient.Object{quota}, map[string]string{}, nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []schema.GroupVersionKind{resourceQuotaGVK}, *watched)
+	})
+
+	t.Run("kinds of the objects applied by the controller are watched", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet("toolchain-member", "johnsmith", "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		r, req, _ := prepareReconcile(t, "toolchain-member", "johnsmith", nsTmplSet)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, r.kinds.watched[quotav1.GroupVersion.WithKind("ClusterResourceQuota")])
+	})
+
+	t.Run("kinds of the objects of the templates in use are watched at startup", func(t *testing.T) {
+		// given
+		restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "toolchain-member")
+		t.Cleanup(restore)
+		nsTmplSet := newNSTmplSet("toolchain-member", "johnsmith", "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		otherNSTmplSet := newNSTmplSet("toolchain-member", "janedoe", "unknown", withNamespaces("abcde11", "dev"))
+		r, _, _ := prepareReconcile(t, "toolchain-member", "johnsmith", nsTmplSet, otherNSTmplSet)
+		watcher, watched := newRecordingKindWatcher(nil)
+		r.kinds = watcher
+
+		// when
+		err := r.watchTemplateKinds(context.TODO())
+
+		// then
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []schema.GroupVersionKind{
+			quotav1.GroupVersion.WithKind("ClusterResourceQuota"),
+			rbacv1.SchemeGroupVersion.WithKind("ClusterRoleBinding"),
+			toolchainv1alpha1.GroupVersion.WithKind("Idler"),
+		}, *watched)
+	})
+
+	t.Run("predicates", func(t *testing.T) {
+		// given
+		dataChanged := func(gvk schema.GroupVersionKind, namespace string) event.UpdateEvent {
+			oldObj := newObject(gvk, "config")
+			oldObj.SetNamespace(namespace)
+			oldObj.SetResourceVersion("1")
+			newObj := newObject(gvk, "config")
+			newObj.SetNamespace(namespace)
+			newObj.SetResourceVersion("2")
+			return event.UpdateEvent{ObjectOld: oldObj, ObjectNew: newObj}
+		}
+
+		t.Run("data changes of the ConfigMaps and Secrets are watched", func(t *testing.T) {
+			assert.True(t, kindWatchPredicate(corev1.SchemeGroupVersion.WithKind("ConfigMap"), "toolchain-member").Update(dataChanged(corev1.SchemeGroupVersion.WithKind("ConfigMap"), "johnsmith-dev")))
+			assert.True(t, kindWatchPredicate(corev1.SchemeGroupVersion.WithKind("Secret"), "toolchain-member").Update(dataChanged(corev1.SchemeGroupVersion.WithKind("Secret"), "johnsmith-dev")))
+			assert.False(t, kindWatchPredicate(networkPolicyGVK, "toolchain-member").Update(dataChanged(networkPolicyGVK, "johnsmith-dev")))
+		})
+
+		t.Run("objects in the namespace of the operator are ignored", func(t *testing.T) {
+			cmGVK := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+			obj := newObject(cmGVK, "johnsmith-dev-last-applied-space-roles")
+			obj.SetNamespace("toolchain-member")
+
+			assert.False(t, kindWatchPredicate(cmGVK, "toolchain-member").Update(dataChanged(cmGVK, "toolchain-member")))
+			assert.False(t, kindWatchPredicate(cmGVK, "toolchain-member").Create(event.CreateEvent{Object: obj}))
+			assert.False(t, kindWatchPredicate(cmGVK, "toolchain-member").Delete(event.DeleteEvent{Object: obj}))
+		})
+	})
+}
@@ -0,0 +1,243 @@
+package nstemplateset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/constants"
+	"github.com/codeready-toolchain/toolchain-common/pkg/template"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The labels and annotations of the Namespace object of a template which the member operator does not apply anymore (e.g. a pod-security level
+// which was dropped from the template) are found in the managed fields of the member operator, and they are removed by the API server when
+// the namespace is applied server-side again. This does not apply to the namespaces which were provisioned before the templates were applied
+// server-side, since their labels and annotations were set with updates, and are thus still co-owned by the legacy managed fields entry of
+// the operator: the labels and annotations applied from the template such a namespace was provisioned with (see its templateref label),
+// but which are not in the current template anymore, are removed once, along with the legacy managed fields entry, right after the namespace
+// is applied server-side.
+
+// legacyMemberOperatorFieldManager is the field manager of the updates of the member operator before the templates were applied server-side,
+// i.e. the default field manager of the client (the name of the binary of the operator)
+const legacyMemberOperatorFieldManager = "member-operator"
+
+// operatorManagedNamespaceKeys are the keys of the labels and annotations of the namespaces which are set by the operator itself,
+// and which are never removed as obsolete template metadata
+var operatorManagedNamespaceKeys = []string{
+	toolchainv1alpha1.SpaceLabelKey,
+	toolchainv1alpha1.TypeLabelKey,
+	toolchainv1alpha1.ProviderLabelKey,
+	toolchainv1alpha1.TemplateRefLabelKey,
+	toolchainv1alpha1.TierLabelKey,
+	appliedFeaturesAnnotationKey,
+}
+
+// templateKeys are the keys of the labels and annotations of a Namespace object from a template
+type templateKeys struct {
+	labels      []string
+	annotations []string
+}
+
+func (k templateKeys) isEmpty() bool {
+	return len(k.labels) == 0 && len(k.annotations) == 0
+}
+
+// with returns the sorted union of these keys and the given keys of labels and annotations
+func (k templateKeys) with(labels, annotations []string) templateKeys {
+	union := func(keys, others []string) []string {
+		keys = append(slices.Clone(keys), others...)
+		slices.Sort(keys)
+		return slices.Compact(keys)
+	}
+	return templateKeys{
+		labels:      union(k.labels, labels),
+		annotations: union(k.annotations, annotations),
+	}
+}
+
+// templateKeysOf returns the sorted keys of the labels and annotations of the given Namespace object from a template
+func templateKeysOf(tmplObj runtimeclient.Object) templateKeys {
+	return templateKeys{
+		labels:      slices.Sorted(maps.Keys(tmplObj.GetLabels())),
+		annotations: slices.Sorted(maps.Keys(tmplObj.GetAnnotations())),
+	}
+}
+
+// appliedServerSide returns true if the member operator already applied the given namespace server-side
+func appliedServerSide(userNamespace *corev1.Namespace) bool {
+	return slices.ContainsFunc(userNamespace.GetManagedFields(), isMemberOperatorApply)
+}
+
+func isMemberOperatorApply(managedFields metav1.ManagedFieldsEntry) bool {
+	return managedFields.Operation == metav1.ManagedFieldsOperationApply && managedFields.Manager == constants.MemberOperatorFieldManager
+}
+
+// isMemberOperatorUpdate returns true if the given managed fields entry was created by the updates of the member operator,
+// either before the templates were applied server-side or by the removal of the obsolete template metadata
+func isMemberOperatorUpdate(managedFields metav1.ManagedFieldsEntry) bool {
+	return managedFields.Operation == metav1.ManagedFieldsOperationUpdate && isMemberOperatorManager(managedFields)
+}
+
+func isMemberOperatorManager(managedFields metav1.ManagedFieldsEntry) bool {
+	return managedFields.Manager == constants.MemberOperatorFieldManager || managedFields.Manager == legacyMemberOperatorFieldManager
+}
+
+// templateMetadataMigrated returns true if the given namespace was applied server-side and if none of its labels and annotations
+// is still co-owned by the updates of the member operator
+func templateMetadataMigrated(userNamespace *corev1.Namespace) bool {
+	return appliedServerSide(userNamespace) && !slices.ContainsFunc(userNamespace.GetManagedFields(), isMemberOperatorUpdate)
+}
+
+// metadataKeysOf returns the keys of the labels or annotations (i.e. the given field of the metadata) in the given managed fields
+func metadataKeysOf(managedFields metav1.ManagedFieldsEntry, field string) []string {
+	fields := map[string]map[string]map[string]any{}
+	if managedFields.FieldsV1 == nil || json.Unmarshal(managedFields.FieldsV1.Raw, &fields) != nil {
+		return nil
+	}
+	var keys []string
+	for key := range fields["f:metadata"]["f:"+field] {
+		if name, found := strings.CutPrefix(key, "f:"); found {
+			keys = append(keys, name)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// setByOtherManager returns true if the given label or annotation (i.e. the given field of the metadata) of the namespace is owned
+// by another field manager than the member operator (including its legacy field manager), e.g. because the platform rewrote its value
+func setByOtherManager(userNamespace *corev1.Namespace, field, key string) bool {
+	return slices.ContainsFunc(userNamespace.GetManagedFields(), func(managedFields metav1.ManagedFieldsEntry) bool {
+		return !isMemberOperatorManager(managedFields) && slices.Contains(metadataKeysOf(managedFields, field), key)
+	})
+}
+
+// hasTemplateMetadata checks that the given labels or annotations (i.e. the given field of the metadata) of the namespace contain
+// the expected ones from the template. A value which differs from the template is ignored when it was rewritten by another field manager,
+// otherwise the namespace would be applied again at each reconcile, without ever being up-to-date.
+func hasTemplateMetadata(userNamespace *corev1.Namespace, field string, actual, expected map[string]string) bool {
+	for key, value := range expected {
+		actualValue, found := actual[key]
+		if !found || (actualValue != value && !setByOtherManager(userNamespace, field, key)) {
+			return false
+		}
+	}
+	return true
+}
+
+// namespaceObjectFromTemplate returns the Namespace object of the given template which matches the given namespace, with its pod security labels
+func (r *namespacesManager) namespaceObjectFromTemplate(tierTemplate *tierTemplate, userNamespace *corev1.Namespace, podSecurityMinimumLevel string) (runtimeclient.Object, error) {
+	objs, err := tierTemplate.process(r.Scheme, map[string]string{
+		SpaceName: userNamespace.GetLabels()[toolchainv1alpha1.SpaceLabelKey],
+	}, template.RetainNamespaces)
+	if err != nil {
+		return nil, err
+	}
+	for _, object := range objs {
+		if object.GetName() == userNamespace.Name {
+			// an invalid pod security level is reported when the namespace is applied (see ensureNamespaceResource)
+			_ = setPodSecurityLabels(object, podSecurityMinimumLevel)
+			return object, nil
+		}
+	}
+	return nil, fmt.Errorf("no matching template object found for namespace %s", userNamespace.Name)
+}
+
+// appliedTemplateKeys returns the keys of the labels and annotations which were applied from the template on the given namespace:
+// the ones applied server-side or updated by the member operator and, if the namespace was not applied server-side yet, the ones
+// of the template the namespace was provisioned with
+func (r *namespacesManager) appliedTemplateKeys(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, userNamespace *corev1.Namespace, podSecurityMinimumLevel string) (templateKeys, error) {
+	applied := templateKeys{}
+	for _, managedFields := range userNamespace.GetManagedFields() {
+		if isMemberOperatorApply(managedFields) || isMemberOperatorUpdate(managedFields) {
+			applied = applied.with(metadataKeysOf(managedFields, "labels"), metadataKeysOf(managedFields, "annotations"))
+		}
+	}
+	templateRef := userNamespace.GetLabels()[toolchainv1alpha1.TemplateRefLabelKey]
+	if appliedServerSide(userNamespace) || templateRef == "" {
+		return applied, nil
+	}
+	appliedTierTemplate, err := r.fetchTierTemplate(ctx, nsTmplSet, templateRef)
+	if err != nil {
+		// such a failure is reported when the obsolete objects of the namespace are deleted (see ensureInnerNamespaceResources)
+		log.FromContext(ctx).Info("unable to retrieve the TierTemplate applied on the namespace - ignoring its labels and annotations",
+			"namespace", userNamespace.Name, "templateRef", templateRef, "cause", err.Error())
+		return applied, nil
+	}
+	tmplObj, err := r.namespaceObjectFromTemplate(appliedTierTemplate, userNamespace, podSecurityMinimumLevel)
+	if err != nil {
+		return templateKeys{}, err
+	}
+	tmplKeys := templateKeysOf(tmplObj)
+	return applied.with(tmplKeys.labels, tmplKeys.annotations), nil
+}
+
+// obsoleteTemplateKeys returns the keys of the labels and annotations which were applied from the template on the given namespace,
+// which are not in the given Namespace object from the current template anymore, and which are still set on the namespace
+func (r *namespacesManager) obsoleteTemplateKeys(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, userNamespace *corev1.Namespace, tmplObj runtimeclient.Object, podSecurityMinimumLevel string) (templateKeys, error) {
+	applied, err := r.appliedTemplateKeys(ctx, nsTmplSet, userNamespace, podSecurityMinimumLevel)
+	if err != nil {
+		return templateKeys{}, err
+	}
+	current := templateKeysOf(tmplObj)
+	obsolete := func(appliedKeys, currentKeys []string, actual map[string]string) []string {
+		var keys []string
+		for _, key := range appliedKeys {
+			if _, set := actual[key]; set && !slices.Contains(currentKeys, key) && !slices.Contains(operatorManagedNamespaceKeys, key) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+	return templateKeys{
+		labels:      obsolete(applied.labels, current.labels, userNamespace.GetLabels()),
+		annotations: obsolete(applied.annotations, current.annotations, userNamespace.GetAnnotations()),
+	}, nil
+}
+
+// obsoleteTemplateMetadata returns the labels and annotations which were applied from the template on the given namespace, but which are
+// not in the Namespace object from the current template anymore, as long as the template metadata of the namespace was not migrated
+// (see migrateTemplateMetadata). Once migrated, the API server removes them when the namespace is applied.
+func (r *namespacesManager) obsoleteTemplateMetadata(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, userNamespace *corev1.Namespace, tmplObj runtimeclient.Object, podSecurityMinimumLevel string) (templateKeys, error) {
+	if templateMetadataMigrated(userNamespace) {
+		return templateKeys{}, nil
+	}
+	return r.obsoleteTemplateKeys(ctx, nsTmplSet, userNamespace, tmplObj, podSecurityMinimumLevel)
+}
+
+// migrateTemplateMetadata removes the given obsolete labels and annotations of the given namespace, which was just applied server-side,
+// along with the managed fields entries of the updates of the member operator, so that the labels and annotations of the template are only
+// owned by the server-side apply of the member operator from now on (and thus removed by the API server when they are dropped from the template).
+// The managed fields entries are removed only once the namespace has been applied, since an empty list would not change the managed fields.
+func (r *namespacesManager) migrateTemplateMetadata(ctx context.Context, appliedNamespace runtimeclient.Object, obsolete templateKeys) error {
+	managedFields := slices.DeleteFunc(slices.Clone(appliedNamespace.GetManagedFields()), isMemberOperatorUpdate)
+	updateManagedFields := len(managedFields) > 0 && len(managedFields) < len(appliedNamespace.GetManagedFields())
+	if appliedNamespace.GetResourceVersion() == "" || (obsolete.isEmpty() && !updateManagedFields) {
+		// not applied (e.g. because of field conflicts), or nothing to migrate
+		return nil
+	}
+	log.FromContext(ctx).Info("removing the labels and annotations which were removed from the template", "namespace", appliedNamespace.GetName(),
+		"labels", obsolete.labels, "annotations", obsolete.annotations)
+	labels := appliedNamespace.GetLabels()
+	for _, key := range obsolete.labels {
+		delete(labels, key)
+	}
+	appliedNamespace.SetLabels(labels)
+	annotations := appliedNamespace.GetAnnotations()
+	for _, key := range obsolete.annotations {
+		delete(annotations, key)
+	}
+	appliedNamespace.SetAnnotations(annotations)
+	if updateManagedFields {
+		appliedNamespace.SetManagedFields(managedFields)
+	}
+	return r.Client.Update(ctx, appliedNamespace, runtimeclient.FieldOwner(constants.MemberOperatorFieldManager))
+}
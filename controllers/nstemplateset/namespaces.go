@@ -2,7 +2,9 @@ package nstemplateset
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"sort"
 
 	rbac "k8s.io/api/rbac/v1"
@@ -20,11 +22,12 @@ import (
 
 type namespacesManager struct {
 	*statusManager
+	exports *exportTracker
 }
 
 // ensure ensures that all expected namespaces exists and they contain all the expected resources
 // return `true, nil` when something changed, `false, nil` or `false, err` otherwise
-func (r *namespacesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) (createdOrUpdated bool, err error) {
+func (r *namespacesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) (createdOrUpdated bool, err error) {
 	logger := log.FromContext(ctx)
 	logger.Info("ensuring namespaces", "tier", nsTmplSet.Spec.TierName)
 	spacename := nsTmplSet.GetName()
@@ -38,6 +41,8 @@ func (r *namespacesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1al
 		return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err,
 			"failed to get TierTemplates for tier '%s'", nsTmplSet.Spec.TierName)
 	}
+	// the namespaces whose type is disabled by a feature toggle are deprovisioned as if their type was removed from the tier
+	tierTemplatesByType = withoutDisabledNamespaceTypes(nsTmplSet, tierTemplatesByType)
 	toDeprovision, found := nextNamespaceToDeprovision(tierTemplatesByType, userNamespaces)
 	if found {
 		if err := r.setStatusUpdatingIfNotProvisioning(ctx, nsTmplSet); err != nil {
@@ -47,6 +52,9 @@ func (r *namespacesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1al
 			return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to delete namespace %s", toDeprovision.Name)
 		}
 		logger.Info("deleted namespace as part of NSTemplateSet update", "namespace", toDeprovision.Name)
+		if err := deleteLastAppliedSpaceRoles(ctx, r.Client, nsTmplSet, toDeprovision.Name); err != nil {
+			return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to clean up after the deletion of namespace %s", toDeprovision.Name)
+		}
 		return true, nil // we deleted the namespace - wait for another reconcile
 	}
 
@@ -56,8 +64,12 @@ func (r *namespacesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1al
 		return false, err
 	}
 	if !found {
-		logger.Info("no more namespaces to create", "spacename", nsTmplSet.GetName())
-		return false, nil
+		// the namespaces are up-to-date, but the features enabled in some of them may have changed
+		tierTemplate, userNamespace, found = nextNamespaceWithChangedFeatures(nsTmplSet, tierTemplatesByType, userNamespaces)
+		if !found {
+			logger.Info("no more namespaces to create", "spacename", nsTmplSet.GetName())
+			return false, nil
+		}
 	}
 
 	if len(userNamespaces) > 0 {
@@ -70,11 +82,11 @@ func (r *namespacesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1al
 		}
 	}
 	// create namespace resource
-	return true, r.ensureNamespace(ctx, nsTmplSet, tierTemplate, userNamespace)
+	return true, r.ensureNamespace(ctx, nsTmplSet, cfg, tierTemplate, userNamespace)
 }
 
 // ensureNamespace ensures that the namespace exists and that it contains all the expected resources
-func (r *namespacesManager) ensureNamespace(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, userNamespace *corev1.Namespace) error {
+func (r *namespacesManager) ensureNamespace(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig, tierTemplate *tierTemplate, userNamespace *corev1.Namespace) error {
 	logger := log.FromContext(ctx)
 	logger.Info("ensuring namespace", "namespace", tierTemplate.typeName, "tier", nsTmplSet.Spec.TierName)
 
@@ -85,7 +97,7 @@ func (r *namespacesManager) ensureNamespace(ctx context.Context, nsTmplSet *tool
 		logger.Info("namespace needs to be created")
 	} else {
 		// userNamespace exists, check if the namespace needs to be updated
-		upToDate, err := r.namespaceHasExpectedLabelsFromTemplate(tierTemplate, userNamespace)
+		upToDate, err := r.namespaceHasExpectedMetadataFromTemplate(ctx, nsTmplSet, tierTemplate, userNamespace, cfg.podSecurityMinimumLevel)
 		if err != nil {
 			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to get namespace object from template for namespace type '%s'", tierTemplate.typeName)
 		}
@@ -95,98 +107,106 @@ func (r *namespacesManager) ensureNamespace(ctx context.Context, nsTmplSet *tool
 
 	// create namespace before creating inner resources because creating the namespace may take some time
 	if createOrUpdateNamespace {
-		return r.ensureNamespaceResource(ctx, nsTmplSet, tierTemplate)
+		return r.ensureNamespaceResource(ctx, nsTmplSet, cfg, tierTemplate, userNamespace)
 	}
-	return r.ensureInnerNamespaceResources(ctx, nsTmplSet, tierTemplate, userNamespace)
+	return r.ensureInnerNamespaceResources(ctx, nsTmplSet, cfg, tierTemplate, userNamespace)
 }
 
-// namespaceHasExpectedLabelsFromTemplate checks if the namespace has the expected labels from the template object
-// note: checks only if the namespace has labels that match the provided template, it does not check whether any labels could have been removed
-func (r *namespacesManager) namespaceHasExpectedLabelsFromTemplate(tierTemplate *tierTemplate, userNamespace *corev1.Namespace) (bool, error) {
-	objs, err := tierTemplate.process(r.Scheme, map[string]string{
-		SpaceName: userNamespace.GetLabels()[toolchainv1alpha1.SpaceLabelKey],
-	}, template.RetainNamespaces)
+// namespaceHasExpectedMetadataFromTemplate checks if the namespace has the expected labels and annotations from the template object,
+// and none of the labels and annotations which were applied from a previous template but were removed from the current one since then
+func (r *namespacesManager) namespaceHasExpectedMetadataFromTemplate(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, userNamespace *corev1.Namespace, podSecurityMinimumLevel string) (bool, error) {
+	tmplObj, err := r.namespaceObjectFromTemplate(tierTemplate, userNamespace, podSecurityMinimumLevel)
 	if err != nil {
 		return false, err
 	}
 
-	var tmplObj runtimeclient.Object
-	for _, object := range objs {
-		if object.GetName() == userNamespace.Name {
-			tmplObj = object
-		}
-	}
-
-	if tmplObj == nil {
-		return false, fmt.Errorf("no matching template object found for namespace %s", userNamespace.Name)
-	}
-
-	if !mapContains(userNamespace.GetLabels(), tmplObj.GetLabels()) {
+	if !hasTemplateMetadata(userNamespace, "labels", userNamespace.GetLabels(), tmplObj.GetLabels()) ||
+		!hasTemplateMetadata(userNamespace, "annotations", userNamespace.GetAnnotations(), tmplObj.GetAnnotations()) {
 		return false, nil
 	}
 
-	return true, nil
-}
-
-func mapContains(actual, contains map[string]string) bool {
-	if contains == nil {
-		return true // contains has no values
-	} else if actual == nil {
-		return false // actual has no values and contains has values
-	}
-
-	for containsKey, containsValue := range contains {
-		v, ok := actual[containsKey]
-		if !ok {
-			return false
-		}
-		if v != containsValue {
-			return false
-		}
+	obsolete, err := r.obsoleteTemplateKeys(ctx, nsTmplSet, userNamespace, tmplObj, podSecurityMinimumLevel)
+	if err != nil {
+		return false, err
 	}
-	return true
+	return obsolete.isEmpty(), nil
 }
 
-// ensureNamespaceResource ensures that the namespace exists.
-func (r *namespacesManager) ensureNamespaceResource(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate) error {
+// ensureNamespaceResource ensures that the namespace exists with the labels and annotations from the template.
+// The given userNamespace is nil if the namespace does not exist yet.
+func (r *namespacesManager) ensureNamespaceResource(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig, tierTemplate *tierTemplate, userNamespace *corev1.Namespace) error {
 	logger := log.FromContext(ctx)
 	logger.Info("creating namespace", "spacename", nsTmplSet.GetName(), "tier", nsTmplSet.Spec.TierName, "type", tierTemplate.typeName)
-	objs, err := tierTemplate.process(r.Scheme, map[string]string{
-		SpaceName: nsTmplSet.GetName(),
-	}, template.RetainNamespaces)
+	objs, err := namespaceObjects(r.Scheme, nsTmplSet, tierTemplate, cfg.podSecurityMinimumLevel)
 	if err != nil {
-		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to process template for namespace type '%s'", tierTemplate.typeName)
+		return r.wrapTemplateObjectsError(ctx, nsTmplSet, err, "namespace type '%s'", tierTemplate.typeName)
 	}
-
 	labels := map[string]string{
 		toolchainv1alpha1.SpaceLabelKey:    nsTmplSet.GetName(),
 		toolchainv1alpha1.TypeLabelKey:     tierTemplate.typeName,
 		toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
 	}
+	if err := r.checkAdoption(ctx, nsTmplSet, objs); err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "unable to adopt the namespace with type '%s'", tierTemplate.typeName)
+	}
+	var levelChanged bool
+	var newLevel string
+	var namespaceObj runtimeclient.Object
+	var obsolete templateKeys
+	for _, obj := range objs {
+		if userNamespace != nil && obj.GetName() == userNamespace.Name {
+			namespaceObj = obj
+			levelChanged = podSecurityLevelChanged(userNamespace, obj)
+			newLevel = obj.GetLabels()[podSecurityEnforceLabelKey]
+			if obsolete, err = r.obsoleteTemplateMetadata(ctx, nsTmplSet, userNamespace, obj, cfg.podSecurityMinimumLevel); err != nil {
+				return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err,
+					"failed to remove the obsolete labels and annotations of the namespace with type '%s'", tierTemplate.typeName)
+			}
+		}
+	}
 
 	// Note: we don't see an owner reference between the NSTemplateSet (namespaced resource) and the namespace (cluster-wide resource)
 	// because a namespaced resource cannot be the owner of a cluster resource (the GC will delete the child resource, considering it is an orphan resource)
 	// As a consequence, when the NSTemplateSet is deleted, we explicitly delete the associated namespaces that belong to the same user.
 	// see https://issues.redhat.com/browse/CRT-429
 
-	_, err = r.ApplyToolchainObjects(ctx, objs, labels)
-	if err != nil {
+	// the API server returns warnings when the pod security level of the namespace is tightened while some existing pods violate it
+	applyCtx, warnings := withWarningsCollector(ctx)
+	_, err = r.ApplyToolchainObjects(applyCtx, objs, labels, cfg.unforcedKinds)
+	if err := r.updateStatusFieldConflicts(ctx, nsTmplSet, objs, err); err != nil {
 		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to create namespace with type '%s'", tierTemplate.typeName)
 	}
+	if namespaceObj != nil && !templateMetadataMigrated(userNamespace) {
+		if err := r.migrateTemplateMetadata(ctx, namespaceObj, obsolete); err != nil {
+			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err,
+				"failed to remove the obsolete labels and annotations of the namespace with type '%s'", tierTemplate.typeName)
+		}
+	}
+	if levelChanged {
+		if err := r.ensurePodSecurityWarnings(ctx, nsTmplSet, userNamespace.Name, newLevel, warnings.get()); err != nil {
+			return err
+		}
+	}
 	logger.Info("namespace provisioned", "namespace", tierTemplate)
 	return nil
 }
 
 // ensureInnerNamespaceResources ensure that the namespace has the expected resources.
-func (r *namespacesManager) ensureInnerNamespaceResources(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, namespace *corev1.Namespace) error {
+func (r *namespacesManager) ensureInnerNamespaceResources(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig, tierTemplate *tierTemplate, namespace *corev1.Namespace) error {
 	logger := log.FromContext(ctx)
 	logger.Info("ensuring namespace resources", "spacename", nsTmplSet.GetName(), "tier", nsTmplSet.Spec.TierName, "type", tierTemplate.typeName)
 	nsName := namespace.GetName()
-	newObjs, err := tierTemplate.process(r.Scheme, map[string]string{
-		SpaceName: nsTmplSet.GetName(),
-	}, template.RetainAllButNamespaces)
+	newObjs, err := innerNamespaceObjects(r.Scheme, nsTmplSet, tierTemplate, namespace)
 	if err != nil {
-		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to process template for namespace '%s'", nsName)
+		return r.wrapTemplateObjectsError(ctx, nsTmplSet, err, "namespace '%s'", nsName)
+	}
+	var labels = map[string]string{
+		toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
+		toolchainv1alpha1.SpaceLabelKey:    nsTmplSet.GetName(),
+	}
+	// the quotas keep the recommended values which were applied (if any)
+	if err := r.withAppliedQuotaRecommendations(ctx, nsTmplSet, newObjs.all); err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to set the recommended quotas in namespace '%s'", nsName)
 	}
 
 	if currentRef, exists := namespace.Labels[toolchainv1alpha1.TemplateRefLabelKey]; exists && currentRef != "" && currentRef != tierTemplate.templateRef {
@@ -194,7 +214,7 @@ func (r *namespacesManager) ensureInnerNamespaceResources(ctx context.Context, n
 		if err := r.setStatusUpdatingIfNotProvisioning(ctx, nsTmplSet); err != nil {
 			return err
 		}
-		currentTierTemplate, err := getTierTemplate(ctx, r.GetHostClusterClient, currentRef)
+		currentTierTemplate, err := r.fetchTierTemplate(ctx, nsTmplSet, currentRef)
 		if err != nil {
 			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to retrieve current TierTemplate with name '%s'", currentRef)
 		}
@@ -204,18 +224,27 @@ func (r *namespacesManager) ensureInnerNamespaceResources(ctx context.Context, n
 		if err != nil {
 			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to process template for TierTemplate with name '%s'", currentRef)
 		}
-		if err := deleteObsoleteObjects(ctx, r.Client, currentObjs, newObjs); err != nil {
+		if err := deleteObsoleteObjects(ctx, r.Client, currentObjs, newObjs.all); err != nil {
 			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to delete redundant objects in namespace '%s'", nsName)
 		}
 	}
 
-	var labels = map[string]string{
-		toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
-		toolchainv1alpha1.SpaceLabelKey:    nsTmplSet.GetName(),
+	// the objects which are not applied are deleted only if they still exist, since they are checked with every reconcile
+	if err := deleteObsoleteObjects(ctx, r.Client, r.existingObjects(ctx, newObjs.disabled), nil); err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to delete the objects of the disabled features in namespace '%s'", nsName)
 	}
-	if _, err = r.ApplyToolchainObjects(ctx, newObjs, labels); err != nil {
+
+	_, err = r.ApplyToolchainObjects(ctx, newObjs.regular, labels, cfg.unforcedKinds)
+	if err := r.updateStatusFieldConflicts(ctx, nsTmplSet, newObjs.regular, err); err != nil {
 		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to provision namespace '%s' with required resources", nsName)
 	}
+	for _, feature := range newObjs.features {
+		_, err = r.ApplyToolchainObjects(ctx, newObjs.byFeature[feature], labels, cfg.unforcedKinds)
+		if err := r.updateStatusFieldConflicts(ctx, nsTmplSet, newObjs.byFeature[feature], err); err != nil {
+			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusFeatureToggleFailed(feature, r.setStatusNamespaceProvisionFailed), err,
+				"failed to provision namespace '%s' with the resources of the feature '%s'", nsName, feature)
+		}
+	}
 
 	if namespace.Labels == nil {
 		namespace.Labels = make(map[string]string)
@@ -224,16 +253,30 @@ func (r *namespacesManager) ensureInnerNamespaceResources(ctx context.Context, n
 	// Adding label indicating that the namespace is up-to-date with TierTemplate
 	namespace.Labels[toolchainv1alpha1.TemplateRefLabelKey] = tierTemplate.templateRef
 	namespace.Labels[toolchainv1alpha1.TierLabelKey] = tierTemplate.tierName
+	// and keep track of the features that were applied, so that the namespace is updated again when they change
+	setAppliedFeatures(namespace, newObjs.features)
 	if err := r.Client.Update(ctx, namespace); err != nil {
 		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to update namespace '%s'", nsName)
 	}
 
 	logger.Info("namespace provisioned with all required resources", "templateRef", tierTemplate.templateRef)
-
-	// TODO add validation for other objects
 	return nil // nothing changed, no error occurred
 }
 
+// wrapTemplateObjectsError reports the given error of namespaceObjects or innerNamespaceObjects in the status of the NSTemplateSet,
+// and wraps it with the step which failed and the given description of the namespace
+func (r *namespacesManager) wrapTemplateObjectsError(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, err error, format string, args ...interface{}) error {
+	objsErr := templateObjectsError{}
+	if !errors.As(err, &objsErr) {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, format, args...)
+	}
+	updateStatus := r.setStatusNamespaceProvisionFailed
+	if objsErr.invalid {
+		updateStatus = r.setStatusValidationFailed
+	}
+	return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, updateStatus, objsErr.error, objsErr.step+" for "+format, args...)
+}
+
 // ensureDeleted ensures that the namespaces that are owned by the space (based on the label) are deleted.
 // The method deletes only one namespace in one call.
 // It returns true if all the namespaces are gone and returns false if we should re-try:
@@ -271,7 +314,7 @@ func (r *namespacesManager) ensureDeleted(ctx context.Context, nsTmplSet *toolch
 func (r *namespacesManager) getTierTemplatesForAllNamespaces(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) ([]*tierTemplate, error) {
 	var tmpls []*tierTemplate
 	for _, ns := range nsTmplSet.Spec.Namespaces {
-		nsTmpl, err := getTierTemplate(ctx, r.GetHostClusterClient, ns.TemplateRef)
+		nsTmpl, err := r.fetchTierTemplate(ctx, nsTmplSet, ns.TemplateRef)
 		if err != nil {
 			return nil, err
 		}
@@ -280,6 +323,35 @@ func (r *namespacesManager) getTierTemplatesForAllNamespaces(ctx context.Context
 	return tmpls, nil
 }
 
+// withoutDisabledNamespaceTypes returns the given TierTemplates without the ones whose Namespace object is annotated with a feature
+// which is not enabled in the NSTemplateSet
+func withoutDisabledNamespaceTypes(nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplatesByType []*tierTemplate) []*tierTemplate {
+	enabled := make([]*tierTemplate, 0, len(tierTemplatesByType))
+	for _, nsTemplate := range tierTemplatesByType {
+		namespaceFeatures, _ := templateFeatures(nsTemplate)
+		if len(enabledAmong(nsTmplSet, namespaceFeatures)) == len(namespaceFeatures) {
+			enabled = append(enabled, nsTemplate)
+		}
+	}
+	return enabled
+}
+
+// nextNamespaceWithChangedFeatures returns the first namespace (from the given namespaces) whose applied features differ
+// from the features enabled in the NSTemplateSet (considering only the features referenced by the namespace's template)
+func nextNamespaceWithChangedFeatures(nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplatesByType []*tierTemplate, namespaces []corev1.Namespace) (*tierTemplate, *corev1.Namespace, bool) {
+	for _, nsTemplate := range tierTemplatesByType {
+		namespace, found := findNamespace(namespaces, nsTemplate.typeName)
+		if !found || namespace.Status.Phase != corev1.NamespaceActive {
+			continue
+		}
+		_, objectFeatures := templateFeatures(nsTemplate)
+		if !slices.Equal(enabledAmong(nsTmplSet, objectFeatures), appliedFeatures(&namespace)) {
+			return nsTemplate, &namespace, true
+		}
+	}
+	return nil, nil, false
+}
+
 // fetchNamespacesByOwner returns all current namespaces belonging to the given space
 // i.e., labeled with `"toolchain.dev.openshift.com/owner":<spacename>`
 func fetchNamespacesByOwner(ctx context.Context, cl runtimeclient.Client, spacename string) ([]corev1.Namespace, error) {
@@ -369,6 +441,10 @@ func (r *namespacesManager) isUpToDateAndProvisioned(ctx context.Context, ns *co
 		processedRoles := []runtimeclient.Object{}
 		processedRoleBindings := []runtimeclient.Object{}
 		for _, obj := range newObjs {
+			if featureOf(obj) != "" {
+				// the objects of the features are tracked separately (see nextNamespaceWithChangedFeatures)
+				continue
+			}
 			switch obj.GetObjectKind().GroupVersionKind().Kind {
 			case "Role":
 				processedRoles = append(processedRoles, obj)
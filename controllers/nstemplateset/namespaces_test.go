@@ -11,13 +11,16 @@ import (
 	. "github.com/codeready-toolchain/member-operator/test"
 	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
 
+	"github.com/codeready-toolchain/member-operator/pkg/constants"
 	"github.com/codeready-toolchain/toolchain-common/pkg/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -404,7 +407,7 @@ func TestEnsureNamespacesOK(t *testing.T) {
 		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet)
 
 		// when
-		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet)
+		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.NoError(t, err)
@@ -432,7 +435,7 @@ func TestEnsureNamespacesOK(t *testing.T) {
 		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, rb)
 
 		// when
-		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet)
+		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.NoError(t, err)
@@ -458,7 +461,7 @@ func TestEnsureNamespacesOK(t *testing.T) {
 		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS)
 
 		// when
-		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet)
+		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.NoError(t, err)
@@ -487,7 +490,7 @@ func TestEnsureNamespacesOK(t *testing.T) {
 		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, codeNS, rb)
 
 		// when
-		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet)
+		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.NoError(t, err)
@@ -528,14 +531,14 @@ func TestEnsureNamespacesFail(t *testing.T) {
 		}
 
 		// when
-		_, err := manager.ensure(ctx, nsTmplSet)
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
 		assert.Contains(t, err.Error(), "unable to create namespace")
 		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
 			HasFinalizer().
-			HasConditions(UnableToProvisionNamespace("unable to create resource of kind: Namespace, version: v1: unable to create resource of kind: Namespace, version: v1: unable to create namespace"))
+			HasConditions(UnableToProvisionNamespace("unable to patch '/v1, Kind=Namespace' called 'johnsmith-dev' in namespace '': unable to create namespace"))
 		AssertThatNamespace(t, spacename+"-dev", fakeClient).DoesNotExist()
 		AssertThatNamespace(t, spacename+"-stage", fakeClient).DoesNotExist()
 	})
@@ -549,7 +552,7 @@ func TestEnsureNamespacesFail(t *testing.T) {
 		}
 
 		// when
-		_, err := manager.ensure(ctx, nsTmplSet)
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
@@ -571,7 +574,7 @@ func TestEnsureNamespacesFail(t *testing.T) {
 		}
 
 		// when
-		_, err := manager.ensure(ctx, nsTmplSet)
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
@@ -579,7 +582,7 @@ func TestEnsureNamespacesFail(t *testing.T) {
 		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
 			HasFinalizer().
 			HasConditions(UnableToProvisionNamespace(
-				"unable to create resource of kind: RoleBinding, version: v1: unable to create resource of kind: RoleBinding, version: v1: unable to create some object"))
+				"unable to patch 'rbac.authorization.k8s.io/v1, Kind=RoleBinding' called 'crtadmin-pods' in namespace 'johnsmith-dev': unable to create some object"))
 		AssertThatNamespace(t, spacename+"-dev", fakeClient).
 			HasNoResource("crtadmin-pods", &rbacv1.RoleBinding{})
 	})
@@ -594,7 +597,7 @@ func TestEnsureNamespacesFail(t *testing.T) {
 		}
 
 		// when
-		_, err := manager.ensure(ctx, nsTmplSet)
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
@@ -610,7 +613,7 @@ func TestEnsureNamespacesFail(t *testing.T) {
 		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet)
 
 		// when
-		_, err := manager.ensure(ctx, nsTmplSet)
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
@@ -628,7 +631,7 @@ func TestEnsureNamespacesFail(t *testing.T) {
 		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, failNS)
 
 		// when
-		_, err := manager.ensure(ctx, nsTmplSet)
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 		// then
 		require.Error(t, err)
@@ -651,7 +654,7 @@ func TestEnsureNamespacesFail(t *testing.T) {
 			return fakeClient.Client.List(ctx, list, opts...)
 		}
 		// when
-		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet)
+		createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 		//then
 		require.Error(t, err)
 		assert.False(t, createdOrUpdated)
@@ -659,6 +662,220 @@ func TestEnsureNamespacesFail(t *testing.T) {
 
 }
 
+func TestEnsureInvalidNamespaces(t *testing.T) {
+	// given
+	logger := zap.New(zap.UseDevMode(true))
+	log.SetLogger(logger)
+	ctx := log.IntoContext(context.TODO(), logger)
+	spaceName := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+
+	var foreignRb test.TemplateObject = `
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: crtadmin-pods
+    namespace: janedoe-dev
+  roleRef:
+    apiGroup: rbac.authorization.k8s.io
+    kind: ClusterRole
+    name: edit
+  subjects:
+  - kind: User
+    name: ${SPACE_NAME}`
+	invalidTierTemplate, err := createTierTemplate(scheme.Codecs.UniversalDeserializer(),
+		test.CreateTemplate(
+			test.WithObjects(ns, foreignRb),
+			test.WithParams(spacename),
+		), "invalid", "dev", "abcde11")
+	require.NoError(t, err)
+	nsTmplSet := newNSTmplSet(namespaceName, spaceName, "invalid", withNamespaces("abcde11", "dev"))
+	devNS := newNamespace("", spaceName, "dev") // NS exists but is missing its inner resources (since its revision is not set yet)
+	janeDevNS := newNamespace("", "janedoe", "dev")
+	manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, janeDevNS, invalidTierTemplate)
+
+	// when
+	_, err = manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+	// then
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid template for namespace 'johnsmith-dev'")
+	AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+		HasFinalizer().
+		HasConditions(ValidationFailed(
+			"invalid template objects: RoleBinding 'crtadmin-pods': namespace 'janedoe-dev' does not belong to the space 'johnsmith'"))
+	AssertThatNamespace(t, "janedoe-dev", fakeClient).
+		HasNoResource("crtadmin-pods", &rbacv1.RoleBinding{})
+}
+
+func TestEnsureNamespacesWithFeatureToggles(t *testing.T) {
+	// given
+	logger := zap.New(zap.UseDevMode(true))
+	log.SetLogger(logger)
+	ctx := log.IntoContext(context.TODO(), logger)
+	spaceName := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+
+	var featureNs test.TemplateObject = `
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: ${SPACE_NAME}-NSTYPE
+    annotations:
+      toolchain.dev.openshift.com/feature: feature-ns`
+	var featureRb test.TemplateObject = `
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: feature-1-rb
+    namespace: ${SPACE_NAME}-NSTYPE
+    annotations:
+      toolchain.dev.openshift.com/feature: feature-1
+  roleRef:
+    apiGroup: rbac.authorization.k8s.io
+    kind: ClusterRole
+    name: view
+  subjects:
+  - kind: User
+    name: ${SPACE_NAME}`
+	devTierTemplate, err := createTierTemplate(scheme.Codecs.UniversalDeserializer(),
+		test.CreateTemplate(test.WithObjects(ns, crtAdminRb, execPodsRole, featureRb), test.WithParams(spacename)),
+		"featured", "dev", "abcde11")
+	require.NoError(t, err)
+	extraTierTemplate, err := createTierTemplate(scheme.Codecs.UniversalDeserializer(),
+		test.CreateTemplate(test.WithObjects(featureNs), test.WithParams(spacename)),
+		"featured", "extra", "abcde11")
+	require.NoError(t, err)
+
+	t.Run("namespace type", func(t *testing.T) {
+		t.Run("provisioned when the feature is enabled", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "featured", withNamespaces("abcde11", "extra"), withNSTemplateSetFeatureAnnotation("feature-ns"))
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devTierTemplate, extraTierTemplate)
+
+			// when
+			createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			AssertThatNamespace(t, spaceName+"-extra", fakeClient).
+				HasLabel(toolchainv1alpha1.TypeLabelKey, "extra")
+		})
+
+		t.Run("not provisioned when the feature is not enabled", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "featured", withNamespaces("abcde11", "extra"))
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devTierTemplate, extraTierTemplate)
+
+			// when
+			createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.False(t, createdOrUpdated)
+			AssertThatNamespace(t, spaceName+"-extra", fakeClient).DoesNotExist()
+		})
+
+		t.Run("deprovisioned when the feature is disabled", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "featured", withNamespaces("abcde11", "extra"))
+			extraNS := newNamespace("featured", spaceName, "extra")
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, extraNS, devTierTemplate, extraTierTemplate)
+
+			// when
+			createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			AssertThatNamespace(t, spaceName+"-extra", fakeClient).DoesNotExist()
+		})
+	})
+
+	t.Run("inner resources", func(t *testing.T) {
+		t.Run("applied when the feature is enabled", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "featured", withNamespaces("abcde11", "dev"), withNSTemplateSetFeatureAnnotation("feature-1"))
+			devNS := newNamespace("featured", spaceName, "dev") // up-to-date, but without the resources of the feature
+			role := newRole(devNS.Name, "exec-pods", spaceName)
+			rb := newRoleBinding(devNS.Name, "crtadmin-pods", spaceName)
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, role, rb, devTierTemplate, extraTierTemplate)
+
+			// when
+			createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			AssertThatNamespace(t, devNS.Name, fakeClient).
+				HasResource("feature-1-rb", &rbacv1.RoleBinding{}).
+				HasAnnotation("toolchain.dev.openshift.com/applied-features", "feature-1")
+
+			t.Run("nothing to do when the features did not change", func(t *testing.T) {
+				// when
+				createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				assert.False(t, createdOrUpdated)
+			})
+		})
+
+		t.Run("deleted when the feature is disabled", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "featured", withNamespaces("abcde11", "dev"))
+			devNS := newNamespace("featured", spaceName, "dev", withAppliedFeatures("feature-1"))
+			role := newRole(devNS.Name, "exec-pods", spaceName)
+			rb := newRoleBinding(devNS.Name, "crtadmin-pods", spaceName)
+			featureRb := newRoleBinding(devNS.Name, "feature-1-rb", spaceName)
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, role, rb, featureRb, devTierTemplate, extraTierTemplate)
+
+			// when
+			createdOrUpdated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			AssertThatNamespace(t, devNS.Name, fakeClient).
+				HasNoResource("feature-1-rb", &rbacv1.RoleBinding{}).
+				HasResource("crtadmin-pods", &rbacv1.RoleBinding{}).
+				HasNoAnnotation("toolchain.dev.openshift.com/applied-features")
+		})
+
+		t.Run("failure reported in the status of the feature", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "featured", withNamespaces("abcde11", "dev"), withNSTemplateSetFeatureAnnotation("feature-1"))
+			devNS := newNamespace("featured", spaceName, "dev")
+			role := newRole(devNS.Name, "exec-pods", spaceName)
+			rb := newRoleBinding(devNS.Name, "crtadmin-pods", spaceName)
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, role, rb, devTierTemplate, extraTierTemplate)
+			create := fakeClient.MockCreate
+			fakeClient.MockCreate = func(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+				if obj.GetName() == "feature-1-rb" {
+					return errors.New("some error")
+				}
+				return create(ctx, obj, opts...)
+			}
+
+			// when
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.ErrorContains(t, err, "failed to provision namespace 'johnsmith-dev' with the resources of the feature 'feature-1'")
+			msg := "unable to patch 'rbac.authorization.k8s.io/v1, Kind=RoleBinding' called 'feature-1-rb' in namespace 'johnsmith-dev': some error"
+			AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+				HasConditions(UnableToProvisionNamespace(msg), FeatureToggleFailed("feature-1", msg))
+			AssertThatNamespace(t, devNS.Name, fakeClient).
+				HasNoAnnotation("toolchain.dev.openshift.com/applied-features")
+		})
+	})
+}
+
 func TestDeleteNamespace(t *testing.T) {
 	// given
 	logger := zap.New(zap.UseDevMode(true))
@@ -815,7 +1032,7 @@ func TestPromoteNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, ro, rb)
 
 			// when
-			updated, err := manager.ensure(ctx, nsTmplSet)
+			updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -845,7 +1062,7 @@ func TestPromoteNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, ro, rb)
 
 			// when
-			updated, err := manager.ensure(ctx, nsTmplSet)
+			updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -875,7 +1092,7 @@ func TestPromoteNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, rb, rb2, ro)
 
 			// when
-			updated, err := manager.ensure(ctx, nsTmplSet)
+			updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -901,10 +1118,12 @@ func TestPromoteNamespaces(t *testing.T) {
 			nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"))
 			devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
 			codeNS := newNamespace("basic", spacename, "stage", withTemplateRefUsingRevision("abcde11"))
-			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, codeNS) // current user has also a 'stage' NS
+			devLastApplied := newLastAppliedSpaceRoles(nsTmplSet, devNS.Name)
+			codeLastApplied := newLastAppliedSpaceRoles(nsTmplSet, codeNS.Name)
+			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, codeNS, devLastApplied, codeLastApplied) // current user has also a 'stage' NS
 
 			// when - should delete the stage namespace
-			updated, err := manager.ensure(ctx, nsTmplSet)
+			updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -914,6 +1133,10 @@ func TestPromoteNamespaces(t *testing.T) {
 				HasConditions(Updating())
 			AssertThatNamespace(t, codeNS.Name, cl).
 				DoesNotExist() // namespace was deleted
+			// the last applied space roles are deleted along with the namespace
+			err = cl.Get(ctx, client.ObjectKeyFromObject(codeLastApplied), &corev1.ConfigMap{})
+			require.True(t, apierrors.IsNotFound(err))
+			require.NoError(t, cl.Get(ctx, client.ObjectKeyFromObject(devLastApplied), &corev1.ConfigMap{}))
 			AssertThatNamespace(t, devNS.Name, cl).
 				HasNoOwnerReference().
 				HasLabel(toolchainv1alpha1.SpaceLabelKey, spacename).
@@ -925,7 +1148,7 @@ func TestPromoteNamespaces(t *testing.T) {
 			t.Run("uprade dev namespace when there is no other namespace to be deleted", func(t *testing.T) {
 
 				// when - should upgrade the -dev namespace
-				updated, err := manager.ensure(ctx, nsTmplSet)
+				updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 				// then
 				require.NoError(t, err)
@@ -956,7 +1179,7 @@ func TestPromoteNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
 
 			// when
-			_, err := manager.ensure(ctx, nsTmplSet)
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
@@ -984,7 +1207,7 @@ func TestPromoteNamespaces(t *testing.T) {
 			}
 
 			// when - should delete the stage namespace
-			_, err := manager.ensure(ctx, nsTmplSet)
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
@@ -1033,7 +1256,7 @@ func TestUpdateNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, ro, rb, rbacRb)
 
 			// when
-			updated, err := manager.ensure(ctx, nsTmplSet)
+			updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -1063,7 +1286,7 @@ func TestUpdateNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, rb, ro)
 
 			// when
-			updated, err := manager.ensure(ctx, nsTmplSet)
+			updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -1091,7 +1314,7 @@ func TestUpdateNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS, codeNS) // current user has also a 'stage' NS
 
 			// when - should delete the stage namespace
-			updated, err := manager.ensure(ctx, nsTmplSet)
+			updated, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -1117,7 +1340,7 @@ func TestUpdateNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
 
 			// when
-			_, err := manager.ensure(ctx, nsTmplSet)
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -1133,7 +1356,7 @@ func TestUpdateNamespaces(t *testing.T) {
 
 			t.Run("next reconcile sets templateref and tier labels", func(t *testing.T) {
 				// when
-				_, err := manager.ensure(ctx, nsTmplSet)
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 				// then
 				require.NoError(t, err)
 				AssertThatNSTemplateSet(t, namespaceName, spacename, cl).
@@ -1158,7 +1381,7 @@ func TestUpdateNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
 
 			// when
-			_, err := manager.ensure(ctx, nsTmplSet)
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -1174,7 +1397,7 @@ func TestUpdateNamespaces(t *testing.T) {
 
 			t.Run("next reconcile sets templateref and tier labels", func(t *testing.T) {
 				// when
-				_, err := manager.ensure(ctx, nsTmplSet)
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 				// then
 				require.NoError(t, err)
 				AssertThatNSTemplateSet(t, namespaceName, spacename, cl).
@@ -1190,6 +1413,190 @@ func TestUpdateNamespaces(t *testing.T) {
 					HasLabel("argocd.argoproj.io/managed-by", "gitops-service-argocd")
 			})
 		})
+
+		t.Run("update that removes a namespace label", func(t *testing.T) {
+			t.Run("label taken from the template applied on the namespace", func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde12", "dev"))
+				devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde13"),
+					withLabels(map[string]string{"argocd.argoproj.io/managed-by": "gitops-service-argocd"}))
+				manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
+
+				// when
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				AssertThatNSTemplateSet(t, namespaceName, spacename, cl).
+					HasFinalizer().
+					HasConditions(Updating())
+				AssertThatNamespace(t, spacename+"-dev", cl).
+					HasLabel(toolchainv1alpha1.SpaceLabelKey, spacename).
+					HasLabel(toolchainv1alpha1.TypeLabelKey, "dev").
+					HasNoLabel("argocd.argoproj.io/managed-by")
+
+				t.Run("next reconcile sets templateref and tier labels", func(t *testing.T) {
+					// when
+					_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+					// then
+					require.NoError(t, err)
+					AssertThatNamespace(t, spacename+"-dev", cl).
+						HasLabel(toolchainv1alpha1.TemplateRefLabelKey, "basic-dev-abcde12").
+						HasLabel(toolchainv1alpha1.TierLabelKey, "basic").
+						HasNoLabel("argocd.argoproj.io/managed-by")
+				})
+			})
+
+			t.Run("namespace applied again when it was applied server-side", func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde12", "dev"))
+				devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde11"),
+					withLabels(map[string]string{"argocd.argoproj.io/managed-by": "gitops-service-argocd"}))
+				devNS.ManagedFields = []metav1.ManagedFieldsEntry{{
+					Manager:    constants.MemberOperatorFieldManager,
+					Operation:  metav1.ManagedFieldsOperationApply,
+					APIVersion: "v1",
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:argocd.argoproj.io/managed-by":{}}}}`)},
+				}}
+				manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
+
+				// when
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				// the label is not removed by the operator, but by the API server when the namespace is applied again
+				// (before its inner resources, hence the templateref label is not updated yet)
+				AssertThatNamespace(t, spacename+"-dev", cl).
+					HasLabel(toolchainv1alpha1.TemplateRefLabelKey, "basic-dev-abcde11").
+					HasLabel("argocd.argoproj.io/managed-by", "gitops-service-argocd")
+			})
+
+			t.Run("namespace not applied again when the platform rewrote a label", func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde13", "dev"))
+				devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde11"),
+					withLabels(map[string]string{"argocd.argoproj.io/managed-by": "rewritten"}))
+				devNS.ManagedFields = []metav1.ManagedFieldsEntry{{
+					Manager:    "platform-controller",
+					Operation:  metav1.ManagedFieldsOperationUpdate,
+					APIVersion: "v1",
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:argocd.argoproj.io/managed-by":{}}}}`)},
+				}}
+				manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
+
+				// when
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				AssertThatNamespace(t, spacename+"-dev", cl).
+					HasLabel(toolchainv1alpha1.TemplateRefLabelKey, "basic-dev-abcde13").
+					HasLabel("argocd.argoproj.io/managed-by", "rewritten")
+			})
+
+			t.Run("legacy managed fields entry of the operator removed with the label", func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde12", "dev"))
+				devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde13"),
+					withLabels(map[string]string{"argocd.argoproj.io/managed-by": "gitops-service-argocd"}))
+				devNS.ManagedFields = []metav1.ManagedFieldsEntry{
+					{
+						Manager:    constants.MemberOperatorFieldManager,
+						Operation:  metav1.ManagedFieldsOperationApply,
+						APIVersion: "v1",
+						FieldsType: "FieldsV1",
+						FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:toolchain.dev.openshift.com/type":{}}}}`)},
+					},
+					{
+						Manager:    "member-operator",
+						Operation:  metav1.ManagedFieldsOperationUpdate,
+						APIVersion: "v1",
+						FieldsType: "FieldsV1",
+						FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:argocd.argoproj.io/managed-by":{}}}}`)},
+					},
+				}
+				manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
+
+				// when
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				AssertThatNamespace(t, spacename+"-dev", cl).
+					HasNoLabel("argocd.argoproj.io/managed-by")
+				assertNoLegacyManagedFields(t, cl, spacename+"-dev")
+
+				t.Run("label dropped again is left to the API server", func(t *testing.T) {
+					// given the label applied again from a later template
+					ns := &corev1.Namespace{}
+					require.NoError(t, cl.Get(ctx, types.NamespacedName{Name: spacename + "-dev"}, ns))
+					ns.Labels["argocd.argoproj.io/managed-by"] = "gitops-service-argocd"
+					ns.Labels[toolchainv1alpha1.TemplateRefLabelKey] = "basic-dev-abcde13"
+					ns.ManagedFields = []metav1.ManagedFieldsEntry{{
+						Manager:    constants.MemberOperatorFieldManager,
+						Operation:  metav1.ManagedFieldsOperationApply,
+						APIVersion: "v1",
+						FieldsType: "FieldsV1",
+						FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:argocd.argoproj.io/managed-by":{}}}}`)},
+					}}
+					require.NoError(t, cl.Update(ctx, ns))
+
+					// when
+					_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+					// then
+					require.NoError(t, err)
+					// the namespace is migrated already, so the label is pruned by the API server when the namespace is applied again
+					AssertThatNamespace(t, spacename+"-dev", cl).
+						HasLabel("argocd.argoproj.io/managed-by", "gitops-service-argocd")
+					assertNoLegacyManagedFields(t, cl, spacename+"-dev")
+				})
+			})
+
+			t.Run("namespace applied again when the legacy manager of the operator rewrote a label", func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde13", "dev"))
+				devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde11"),
+					withLabels(map[string]string{"argocd.argoproj.io/managed-by": "rewritten"}))
+				devNS.ManagedFields = []metav1.ManagedFieldsEntry{{
+					Manager:    "member-operator",
+					Operation:  metav1.ManagedFieldsOperationUpdate,
+					APIVersion: "v1",
+					FieldsType: "FieldsV1",
+					FieldsV1:   &metav1.FieldsV1{Raw: []byte(`{"f:metadata":{"f:labels":{"f:argocd.argoproj.io/managed-by":{}}}}`)},
+				}}
+				manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
+
+				// when
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				AssertThatNamespace(t, spacename+"-dev", cl).
+					HasLabel("argocd.argoproj.io/managed-by", "gitops-service-argocd")
+			})
+
+			t.Run("labels not applied from the template are kept", func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde12", "dev"))
+				devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde11"),
+					withLabels(map[string]string{"argocd.argoproj.io/managed-by": "gitops-service-argocd"}))
+				manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
+
+				// when
+				_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				AssertThatNamespace(t, spacename+"-dev", cl).
+					HasLabel(toolchainv1alpha1.TemplateRefLabelKey, "basic-dev-abcde12").
+					HasLabel("argocd.argoproj.io/managed-by", "gitops-service-argocd")
+			})
+		})
 	})
 
 	t.Run("failure", func(t *testing.T) {
@@ -1201,7 +1608,7 @@ func TestUpdateNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
 
 			// when
-			_, err := manager.ensure(ctx, nsTmplSet)
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
@@ -1225,7 +1632,7 @@ func TestUpdateNamespaces(t *testing.T) {
 			manager, cl := prepareNamespacesManager(t, nsTmplSet, devNS)
 
 			// when
-			_, err := manager.ensure(ctx, nsTmplSet)
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.Error(t, err)
@@ -1397,3 +1804,11 @@ func TestIsUpToDateAndProvisioned(t *testing.T) {
 		require.False(t, found)
 	})
 }
+
+func assertNoLegacyManagedFields(t *testing.T, cl client.Client, name string) {
+	ns := &corev1.Namespace{}
+	require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: name}, ns))
+	for _, managedFields := range ns.ManagedFields {
+		assert.NotEqual(t, "member-operator", managedFields.Manager)
+	}
+}
@@ -0,0 +1,66 @@
+package nstemplateset
+
+import (
+	"slices"
+	"strconv"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SameSpaceNetworkPolicyName is the name of the NetworkPolicy generated in each namespace of a space, which allows the ingress traffic
+// from all the namespaces of the same space (i.e. labeled with the same SpaceLabelKey). Since the NetworkPolicy selects the namespaces
+// by label, it does not need to be updated when the namespaces are added to or removed from the space.
+//
+// In order not to isolate the namespaces which are not isolated yet, the NetworkPolicy is generated only in the namespaces
+// whose template already defines NetworkPolicies. It is applied along with the other objects of the template.
+const SameSpaceNetworkPolicyName = "allow-from-same-space"
+
+// SameSpaceNetworkPolicyAnnotationKey disables the generation of the SameSpaceNetworkPolicyName NetworkPolicy in a namespace
+// when set to "false" on the Namespace object of its template
+const SameSpaceNetworkPolicyAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "same-space-network-policy"
+
+// sameSpaceNetworkPolicy returns the NetworkPolicy allowing the traffic between the namespaces of the space in the given namespace,
+// and whether it must exist, given the objects of the template which are applied in the namespace
+func sameSpaceNetworkPolicy(nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespace metav1.Object, templateObjs []runtimeclient.Object) (*netv1.NetworkPolicy, bool) {
+	policy := newSameSpaceNetworkPolicy(nsTmplSet.GetName(), namespace.GetName())
+	if enabled, err := strconv.ParseBool(namespace.GetAnnotations()[SameSpaceNetworkPolicyAnnotationKey]); err == nil && !enabled {
+		return policy, false
+	}
+	isolated := slices.ContainsFunc(templateObjs, func(obj runtimeclient.Object) bool {
+		return obj.GetObjectKind().GroupVersionKind().Kind == "NetworkPolicy"
+	})
+	return policy, isolated
+}
+
+func newSameSpaceNetworkPolicy(spacename, namespace string) *netv1.NetworkPolicy {
+	return &netv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: netv1.SchemeGroupVersion.String(),
+			Kind:       "NetworkPolicy",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      SameSpaceNetworkPolicyName,
+		},
+		Spec: netv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			Ingress: []netv1.NetworkPolicyIngressRule{
+				{
+					From: []netv1.NetworkPolicyPeer{
+						{
+							NamespaceSelector: &metav1.LabelSelector{
+								MatchLabels: map[string]string{
+									toolchainv1alpha1.SpaceLabelKey: spacename,
+								},
+							},
+						},
+					},
+				},
+			},
+			PolicyTypes: []netv1.PolicyType{netv1.PolicyTypeIngress},
+		},
+	}
+}
@@ -0,0 +1,156 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestSameSpaceNetworkPolicies(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	reconcileUntilProvisioned := func(t *testing.T, r *Reconciler, req reconcile.Request, fakeClient *test.FakeClient) {
+		for i := 0; i < 5; i++ {
+			_, err := r.Reconcile(context.TODO(), req)
+			require.NoError(t, err)
+		}
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned())
+	}
+	updateTemplateRef := func(t *testing.T, fakeClient *test.FakeClient, req reconcile.Request, revision string) {
+		nsTmplSet := &toolchainv1alpha1.NSTemplateSet{}
+		require.NoError(t, fakeClient.Get(context.TODO(), req.NamespacedName, nsTmplSet))
+		nsTmplSet.Spec.Namespaces[0].TemplateRef = NewTierTemplateName("isolated", "dev", revision)
+		require.NoError(t, fakeClient.Update(context.TODO(), nsTmplSet))
+	}
+
+	t.Run("created in the namespaces isolated by the template", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "isolated", withNamespaces("abcde11", "dev"))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+
+		// when
+		reconcileUntilProvisioned(t, r, req, fakeClient)
+
+		// then
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).
+			HasResource("allow-same-namespace", &netv1.NetworkPolicy{}).
+			HasResource(SameSpaceNetworkPolicyName, &netv1.NetworkPolicy{}).
+			ResourceHasSpaceLabel(SameSpaceNetworkPolicyName, &netv1.NetworkPolicy{}, spacename)
+		policy := &netv1.NetworkPolicy{}
+		require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: spacename + "-dev", Name: SameSpaceNetworkPolicyName}, policy))
+		require.Len(t, policy.Spec.Ingress, 1)
+		require.Len(t, policy.Spec.Ingress[0].From, 1)
+		assert.Equal(t, map[string]string{toolchainv1alpha1.SpaceLabelKey: spacename}, policy.Spec.Ingress[0].From[0].NamespaceSelector.MatchLabels)
+		assert.Equal(t, []netv1.PolicyType{netv1.PolicyTypeIngress}, policy.Spec.PolicyTypes)
+
+		t.Run("deleted when disabled in the template", func(t *testing.T) {
+			// given
+			updateTemplateRef(t, fakeClient, req, "abcde12")
+
+			// when
+			reconcileUntilProvisioned(t, r, req, fakeClient)
+
+			// then
+			AssertThatNamespace(t, spacename+"-dev", fakeClient).
+				HasResource("allow-same-namespace", &netv1.NetworkPolicy{}).
+				HasNoResource(SameSpaceNetworkPolicyName, &netv1.NetworkPolicy{})
+		})
+	})
+
+	t.Run("deleted when the namespace is not isolated by the template anymore", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "isolated", withNamespaces("abcde11", "dev"))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+		reconcileUntilProvisioned(t, r, req, fakeClient)
+		updateTemplateRef(t, fakeClient, req, "abcde13")
+
+		// when
+		reconcileUntilProvisioned(t, r, req, fakeClient)
+
+		// then
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).
+			HasNoResource("allow-same-namespace", &netv1.NetworkPolicy{}).
+			HasNoResource(SameSpaceNetworkPolicyName, &netv1.NetworkPolicy{})
+	})
+
+	t.Run("not created in the namespaces which are not isolated", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev"))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+
+		// when
+		reconcileUntilProvisioned(t, r, req, fakeClient)
+
+		// then
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).
+			HasNoResource(SameSpaceNetworkPolicyName, &netv1.NetworkPolicy{})
+	})
+}
+
+func TestSameSpaceNetworkPolicy(t *testing.T) {
+	// given
+	nsTmplSet := newNSTmplSet("toolchain-member", "johnsmith", "isolated")
+	templatePolicy := &netv1.NetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "johnsmith-dev", Name: "allow-same-namespace"},
+	}
+	role := &rbacv1.Role{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "rbac.authorization.k8s.io/v1", Kind: "Role"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "johnsmith-dev", Name: "exec-pods"},
+	}
+	newNamespaceWithAnnotations := func(annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "johnsmith-dev", Annotations: annotations}}
+	}
+
+	for name, tc := range map[string]struct {
+		namespace    *corev1.Namespace
+		templateObjs []runtimeclient.Object
+		required     bool
+	}{
+		"isolated": {
+			namespace:    newNamespaceWithAnnotations(nil),
+			templateObjs: []runtimeclient.Object{role, templatePolicy},
+			required:     true,
+		},
+		"not isolated": {
+			namespace:    newNamespaceWithAnnotations(nil),
+			templateObjs: []runtimeclient.Object{role},
+		},
+		"disabled": {
+			namespace:    newNamespaceWithAnnotations(map[string]string{SameSpaceNetworkPolicyAnnotationKey: "false"}),
+			templateObjs: []runtimeclient.Object{role, templatePolicy},
+		},
+		"explicitly enabled": {
+			namespace:    newNamespaceWithAnnotations(map[string]string{SameSpaceNetworkPolicyAnnotationKey: "true"}),
+			templateObjs: []runtimeclient.Object{role, templatePolicy},
+			required:     true,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// when
+			policy, required := sameSpaceNetworkPolicy(nsTmplSet, tc.namespace, tc.templateObjs)
+
+			// then
+			assert.Equal(t, tc.required, required)
+			assert.Equal(t, "johnsmith-dev", policy.Namespace)
+			assert.Equal(t, SameSpaceNetworkPolicyName, policy.Name)
+		})
+	}
+}
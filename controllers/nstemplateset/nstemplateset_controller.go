@@ -17,6 +17,7 @@ import (
 	rbac "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -34,10 +35,14 @@ func NewReconciler(apiClient *APIClient) *Reconciler {
 		APIClient: apiClient,
 	}
 	return &Reconciler{
-		APIClient: apiClient,
-		status:    status,
+		APIClient:      apiClient,
+		config:         &configCache{},
+		status:         status,
+		updateFailures: newUpdateFailureTracker(),
+		updateRollout:  newUpdateRolloutTracker(),
 		namespaces: &namespacesManager{
 			statusManager: status,
+			exports:       newExportTracker(),
 		},
 		clusterResources: &clusterResourcesManager{
 			statusManager: status,
@@ -59,32 +64,75 @@ func (r *Reconciler) SetupWithManager(mgr manager.Manager, allNamespaceCluster r
 	build := ctrl.NewControllerManagedBy(mgr).
 		For(&toolchainv1alpha1.NSTemplateSet{}, builder.WithPredicates(predicate.Or[runtimeclient.Object](predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
 		Watches(&corev1.Namespace{}, mapToOwnerByLabel).
+		// the ConfigMaps containing the last applied space roles of the namespaces
+		Owns(&corev1.ConfigMap{}).
 		// we're watching the roles and role bindings explicitly so that the users that accidentally lose access to their namespaces
 		// can get it restored as quickly as possible.
 		//
-		// We intentionally do not watch any other resources potentially created by the templates (including cluster-scoped resources).
-		// Instead, we rely on controller-runtime's/ periodic resync/reconcile of NSTemplateSets as configured via manager.Options.Cache.SyncPeriod.
-		//
-		// This is a reasonable thing to do because the users either don't have the write access to the resources that are part of the template at all (i.e.
-		// the users don't have write access to any cluster-scoped resources) or there is the assumption that there is not much potential harm
-		// when the users modify the (namespaced) resources from the template. As mentioned above, the notable exception are roles and bindings that can
-		// cause the user to lose the access to the namespace and therefore we DO watch those to reapply the template and restore the access as soon as possible.
+		// The other kinds of resources created by the templates (including cluster-scoped resources) are watched as soon as
+		// they are applied for the first time (see kindWatcher), with metadata-only watches limited to the objects with the space label.
 		WatchesRawSource(source.Kind[runtimeclient.Object](allNamespaceCluster.GetCache(), &rbac.Role{}, mapToOwnerByLabel, commonpredicates.LabelsAndGenerationPredicate{})).
-		WatchesRawSource(source.Kind[runtimeclient.Object](allNamespaceCluster.GetCache(), &rbac.RoleBinding{}, mapToOwnerByLabel, commonpredicates.LabelsAndGenerationPredicate{}))
+		WatchesRawSource(source.Kind[runtimeclient.Object](allNamespaceCluster.GetCache(), &rbac.RoleBinding{}, mapToOwnerByLabel, commonpredicates.LabelsAndGenerationPredicate{})).
+		// the settings of the controller are reloaded when the MemberOperatorConfig changes, and applied to all the spaces
+		Watches(&toolchainv1alpha1.MemberOperatorConfig{}, handler.EnqueueRequestsFromMapFunc(r.mapMemberOperatorConfigToNSTemplateSets),
+			builder.WithPredicates(predicate.AnnotationChangedPredicate{})).
+		// the deferred updates are resumed as soon as other updates complete
+		WatchesRawSource(source.Channel(r.updateRollout.resume, &handler.EnqueueRequestForObject{})).
+		// the deletion of the spaces resumes as soon as the upload of their export completes
+		WatchesRawSource(source.Channel(r.namespaces.exports.done, &handler.EnqueueRequestForObject{}))
 
 	r.AllNamespacesClient = allNamespaceCluster.GetClient()
 	r.AvailableAPIGroups = apiGroupList.Groups
+	r.recorder = mgr.GetEventRecorderFor("nstemplateset-controller")
+	r.config.recorder = r.recorder
+
+	nsTmplSetController, err := build.Build(r)
+	if err != nil {
+		return err
+	}
+	if r.kinds, err = newControllerKindWatcher(mgr, nsTmplSetController, mapToOwnerByLabel); err != nil {
+		return err
+	}
+	// the kinds of the objects of the templates in use are watched as soon as the caches are started, so that the objects
+	// applied before a restart of the operator are restored without waiting for the next reconcile of their space
+	if err := mgr.Add(manager.RunnableFunc(r.watchTemplateKinds)); err != nil {
+		return err
+	}
+	return mgr.Add(manager.RunnableFunc(r.runTierTemplateCopiesCleanup))
+}
 
-	return build.Complete(r)
+// mapMemberOperatorConfigToNSTemplateSets invalidates the cached settings of the controller and returns the requests to reconcile
+// all the NSTemplateSets in the namespace of the MemberOperatorConfig, so that the new settings are applied to all the spaces
+func (r *Reconciler) mapMemberOperatorConfigToNSTemplateSets(ctx context.Context, obj runtimeclient.Object) []reconcile.Request {
+	if obj.GetName() != memberOperatorConfigName {
+		return nil
+	}
+	r.config.invalidate()
+	nsTmplSets := &toolchainv1alpha1.NSTemplateSetList{}
+	if err := r.Client.List(ctx, nsTmplSets, runtimeclient.InNamespace(obj.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list the NSTemplateSets to apply the configuration to")
+		return nil
+	}
+	requests := make([]reconcile.Request, len(nsTmplSets.Items))
+	for i, nsTmplSet := range nsTmplSets.Items {
+		requests[i] = reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: nsTmplSet.Namespace, Name: nsTmplSet.Name},
+		}
+	}
+	return requests
 }
 
 // Reconciler the NSTemplateSet reconciler
 type Reconciler struct {
 	*APIClient
+	config           *configCache
 	namespaces       *namespacesManager
 	clusterResources *clusterResourcesManager
 	spaceRoles       *spaceRolesManager
 	status           *statusManager
+	updateFailures   *updateFailureTracker
+	updateRollout    *updateRolloutTracker
+	recorder         record.EventRecorder
 }
 
 //+kubebuilder:rbac:groups=toolchain.dev.openshift.com,resources=nstemplatesets,verbs=get;list;watch;create;update;patch;delete
@@ -96,7 +144,18 @@ type Reconciler struct {
 //+kubebuilder:rbac:groups=rbac.authorization.k8s.io;authorization.openshift.io,resources=rolebindings;roles;clusterroles;clusterrolebindings,verbs=*
 //+kubebuilder:rbac:groups=quota.openshift.io,resources=clusterresourcequotas,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch;create;update;patch;delete
-//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=environments,verbs=get;list;watch;create;update;delete
+//+kubebuilder:rbac:groups=metrics.k8s.io,resources=pods,verbs=get;list
+//+kubebuilder:rbac:groups=user.openshift.io,resources=groups,verbs=get;list;watch
+//+kubebuilder:rbac:groups=appstudio.redhat.com,resources=environments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+// the namespaced resources which are exported before the deletion of a space (see exportedKinds)
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets;services;serviceaccounts;persistentvolumeclaims,verbs=get;list
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;list
+//+kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list
 
 // Reconcile reads that state of the cluster for a NSTemplateSet object and makes changes based on the state read
 // and what is in the NSTemplateSet.Spec
@@ -117,6 +176,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Info("NSTemplateSet not found")
+			r.updateRollout.done(request.NamespacedName)
 			return reconcile.Result{}, nil
 		}
 		logger.Error(err, "failed to get NSTemplateSet")
@@ -129,6 +189,32 @@ func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.
 	if err := r.addFinalizer(ctx, nsTmplSet); err != nil {
 		return reconcile.Result{}, err
 	}
+	cfg, err := r.config.get(ctx, r.Client, nsTmplSet.Namespace)
+	if err != nil {
+		return reconcile.Result{}, errs.Wrap(err, "failed to load the configuration")
+	}
+	// nothing is applied while the space is suspended
+	if suspended, err := r.ensureSuspension(ctx, nsTmplSet, cfg); err != nil {
+		return reconcile.Result{}, err
+	} else if suspended {
+		return reconcile.Result{RequeueAfter: suspensionRecheckPeriod}, nil
+	}
+	// the update is not retried once the space was rolled back to its last applied templates, until the NSTemplateSet changes again,
+	// but these templates are still applied
+	if r.isRolledBack(nsTmplSet) {
+		logger.Info("NSTemplateSet was rolled back to its last applied templates - applying them")
+		return reconcile.Result{}, r.ensureRolledBack(ctx, nsTmplSet, cfg)
+	}
+	// the space was rolled back for an older generation of the NSTemplateSet (or before the operator restarted)
+	if err := r.removeRolledBackCondition(ctx, nsTmplSet); err != nil {
+		return reconcile.Result{}, err
+	}
+	// the updates to new templates are rolled out gradually across the spaces (if configured)
+	if deferred, err := r.ensureUpdateRollout(ctx, nsTmplSet, cfg); err != nil {
+		return reconcile.Result{}, err
+	} else if deferred {
+		return reconcile.Result{RequeueAfter: updateDeferralPeriod}, nil
+	}
 
 	// we proceed with the cluster-scoped resources template, then all namespaces and finally space roles
 	// as we want to be sure that cluster-scoped resources such as quotas are set
@@ -136,23 +222,35 @@ func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.
 	// NOTE: the cluster resources are applied ALL AT ONCE, unlike the namespaces.
 	// This is a work-in-progress change to unify how we apply cluster resources and namespaces.
 	// In the end, everything will be applied in one go.
-	if err := r.clusterResources.ensure(ctx, nsTmplSet); err != nil {
+	if err := r.clusterResources.ensure(ctx, nsTmplSet, cfg); err != nil {
 		logger.Error(err, "failed to either provision or update cluster resources")
-		return reconcile.Result{}, err
+		return reconcile.Result{}, r.handleUpdateFailure(ctx, nsTmplSet, cfg, err)
 	}
 	if err := r.status.updateStatusClusterResourcesRevisions(ctx, nsTmplSet); err != nil {
 		return reconcile.Result{}, err
 	}
 
-	if createdOrUpdated, err := r.namespaces.ensure(ctx, nsTmplSet); err != nil {
+	if createdOrUpdated, err := r.namespaces.ensure(ctx, nsTmplSet, cfg); err != nil {
 		logger.Error(err, "failed to either provision or update user namespaces")
-		return reconcile.Result{}, err
+		return reconcile.Result{}, r.handleUpdateFailure(ctx, nsTmplSet, cfg, err)
 	} else if createdOrUpdated {
 		return reconcile.Result{}, nil
 	}
 	if err := r.status.updateStatusNamespacesRevisions(ctx, nsTmplSet); err != nil {
 		return reconcile.Result{}, err
 	}
+	// enforce the quotas of the space with ResourceQuotas in its namespaces when the ClusterResourceQuotas are not supported
+	rebalanceQuotas, err := r.clusterResources.ensureSpaceQuotas(ctx, nsTmplSet, cfg)
+	if err != nil {
+		logger.Error(err, "failed to ensure the quotas of the space")
+		return reconcile.Result{}, err
+	}
+	// recommend (or apply) the quotas of the space based on its usage (if enabled)
+	observeUsageAfter, err := r.ensureQuotaRecommendations(ctx, nsTmplSet, cfg)
+	if err != nil {
+		logger.Error(err, "failed to recommend the quotas of the space")
+		return reconcile.Result{}, err
+	}
 
 	// update provisioned namespace list
 	if err := r.namespaces.setProvisionedNamespaceList(ctx, nsTmplSet); err != nil {
@@ -160,7 +258,7 @@ func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.
 		return reconcile.Result{}, err
 	}
 
-	if createdOrUpdated, err := r.spaceRoles.ensure(ctx, nsTmplSet); err != nil {
+	if createdOrUpdated, err := r.spaceRoles.ensure(ctx, nsTmplSet, cfg); err != nil {
 		logger.Error(err, "failed to either provision or update roles in space")
 		return reconcile.Result{}, err
 	} else if createdOrUpdated {
@@ -170,7 +268,27 @@ func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.
 		return reconcile.Result{}, err
 	}
 
-	return reconcile.Result{}, r.status.setStatusReady(ctx, nsTmplSet)
+	if err := r.clearUpdateFailures(ctx, nsTmplSet); err != nil {
+		return reconcile.Result{}, err
+	}
+	r.recordUpdateSucceeded(nsTmplSet)
+	if err := r.status.setStatusReady(ctx, nsTmplSet); err != nil {
+		return reconcile.Result{}, err
+	}
+	result := reconcile.Result{}
+	// reconcile again when the space role of a user expires, so that its objects are removed on time
+	if after, found := nextSpaceRoleExpiry(nsTmplSet, time.Now()); found {
+		result.RequeueAfter = after
+	}
+	// and periodically rebalance the quotas of the space between its namespaces, based on their usage
+	if rebalanceQuotas && cfg.spaceQuotaRebalancePeriod > 0 && (result.RequeueAfter == 0 || result.RequeueAfter > cfg.spaceQuotaRebalancePeriod) {
+		result.RequeueAfter = cfg.spaceQuotaRebalancePeriod
+	}
+	// and observe the usage of the space again to update the recommended quotas
+	if observeUsageAfter > 0 && (result.RequeueAfter == 0 || result.RequeueAfter > observeUsageAfter) {
+		result.RequeueAfter = observeUsageAfter
+	}
+	return result, nil
 }
 
 // addFinalizer sets the finalizers for NSTemplateSet
@@ -193,6 +311,17 @@ func (r *Reconciler) deleteNSTemplateSet(ctx context.Context, nsTmplSet *toolcha
 		return reconcile.Result{}, nil
 	}
 	logger.Info("NSTemplateSet resource is being deleted")
+	cfg, err := r.config.get(ctx, r.Client, nsTmplSet.Namespace)
+	if err != nil {
+		return reconcile.Result{}, r.status.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.status.setStatusTerminatingFailed, err,
+			"failed to load the configuration")
+	}
+	// nothing is deleted while the space is suspended: the finalizer is kept until the space is resumed
+	if suspended, err := r.ensureSuspension(ctx, nsTmplSet, cfg); err != nil {
+		return reconcile.Result{}, err
+	} else if suspended {
+		return reconcile.Result{RequeueAfter: suspensionRecheckPeriod}, nil
+	}
 	// since the NSTmplSet resource is being deleted, we must set its status to `ready=false/reason=terminating`
 	if err := r.status.setStatusTerminating(ctx, nsTmplSet); err != nil {
 		return reconcile.Result{}, r.status.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.status.setStatusTerminatingFailed, err,
@@ -200,8 +329,15 @@ func (r *Reconciler) deleteNSTemplateSet(ctx context.Context, nsTmplSet *toolcha
 	}
 	spacename := nsTmplSet.GetName()
 
+	// export the resources of the space (if configured) before anything gets deleted
+	if pending, err := r.namespaces.ensureExported(ctx, nsTmplSet, cfg.export); err != nil {
+		return reconcile.Result{}, err
+	} else if pending {
+		return reconcile.Result{RequeueAfter: exportPollPeriod}, nil
+	}
+
 	// delete cluster resources first
-	err := r.clusterResources.delete(ctx, nsTmplSet)
+	err = r.clusterResources.delete(ctx, nsTmplSet)
 	if err != nil {
 		return reconcile.Result{}, err
 	}
@@ -218,8 +354,26 @@ func (r *Reconciler) deleteNSTemplateSet(ctx context.Context, nsTmplSet *toolcha
 		return reconcile.Result{}, r.status.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.status.setStatusTerminatingFailed, err, "failed to ensure namespace deletion")
 	}
 	if !allDeleted {
-		if time.Since(nsTmplSet.DeletionTimestamp.Time) > 60*time.Second {
-			return reconcile.Result{}, fmt.Errorf("NSTemplateSet deletion has not completed in over 1 minute")
+		// unblock the termination of the namespaces if they are stuck because of known-safe finalizers (if configured)
+		if err := r.namespaces.removeSafeFinalizers(ctx, nsTmplSet, cfg.finalizers); err != nil {
+			return reconcile.Result{}, err
+		}
+		blockers, err := r.namespaces.terminationBlockers(ctx, nsTmplSet)
+		if err != nil {
+			return reconcile.Result{}, r.status.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.status.setStatusTerminatingFailed, err,
+				"failed to list namespace with label owner '%s'", spacename)
+		}
+		if time.Since(nsTmplSet.DeletionTimestamp.Time) > cfg.deletionTimeout {
+			if blockers == "" {
+				return reconcile.Result{}, fmt.Errorf("NSTemplateSet deletion has not completed in over %s", formatTimeout(cfg.deletionTimeout))
+			}
+			return reconcile.Result{}, r.status.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.status.setStatusTerminatingFailed, errs.New(blockers),
+				"NSTemplateSet deletion has not completed in over %s", formatTimeout(cfg.deletionTimeout))
+		}
+		// report what blocks the termination of the namespaces (if anything) without waiting for the timeout
+		if err := r.status.setStatusTerminatingWithBlockers(ctx, nsTmplSet, blockers); err != nil {
+			return reconcile.Result{}, r.status.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.status.setStatusTerminatingFailed, err,
+				"failed to report what blocks the termination of the namespaces")
 		}
 		// One or more namespaces may not yet be deleted. We can stop here.
 		return reconcile.Result{
@@ -237,6 +391,17 @@ func (r *Reconciler) deleteNSTemplateSet(ctx context.Context, nsTmplSet *toolcha
 	return reconcile.Result{}, nil
 }
 
+// formatTimeout returns the given timeout in a human-readable form, e.g. "1 minute" or "90s"
+func formatTimeout(timeout time.Duration) string {
+	if timeout%time.Minute != 0 {
+		return timeout.String()
+	}
+	if minutes := int(timeout / time.Minute); minutes != 1 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	return "1 minute"
+}
+
 // deleteObsoleteObjects takes template objects of the current tier and of the new tier (provided as newObjects param),
 // compares their names and GVKs and deletes those ones that are in the current template but are not found in the new one.
 // return `true, nil` if an object was deleted, `false, nil`/`false, err` otherwise
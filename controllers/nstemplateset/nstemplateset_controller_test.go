@@ -118,6 +118,35 @@ func TestReconcileProvisionOK(t *testing.T) {
 			HasLabel(toolchainv1alpha1.ProviderLabelKey, toolchainv1alpha1.ProviderLabelValue)
 	})
 
+	t.Run("pod security warnings kept when status provisioned", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev", "stage"),
+			withConditions(Updating(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-dev' was tightened to 'restricted': some warnings")))
+		devNS := newNamespace("basic", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+		stageNS := newNamespace("basic", spacename, "stage", withTemplateRefUsingRevision("abcde11"))
+		rb := newRoleBinding(devNS.Name, "crtadmin-pods", spacename)
+		rb2 := newRoleBinding(stageNS.Name, "crtadmin-pods", spacename)
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS, stageNS, rb, rb2)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-dev' was tightened to 'restricted': some warnings"))
+
+		t.Run("still kept after the next reconcile", func(t *testing.T) {
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(Provisioned(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-dev' was tightened to 'restricted': some warnings"))
+		})
+	})
+
 	t.Run("status provisioned with cluster resources", func(t *testing.T) {
 		// given
 		// create cluster resources
@@ -193,7 +222,7 @@ func TestReconcileProvisionOK(t *testing.T) {
 			HasFinalizer().
 			HasStatusAllRevisionsSet(). // all revisions fields are set as expected
 			HasSpecNamespaces("dev", "stage").
-			HasConditions(Provisioned())
+			HasConditions(Provisioned(), FeatureToggleApplied("feature-1")) // feature-1 is enabled and referenced by the cluster resources template
 		AssertThatCluster(t, fakeClient).
 			HasResource("for-"+spacename, &quotav1.ClusterResourceQuota{})
 	})
@@ -1254,6 +1283,40 @@ func TestDeleteNSTemplateSet(t *testing.T) {
 		require.EqualError(t, err, "NSTemplateSet deletion has not completed in over 1 minute")
 	})
 
+	t.Run("NSTemplateSet deletion timeout is configurable", func(t *testing.T) {
+		// given an NSTemplateSet resource and 1 active user namespace, with a deletion timeout of 2 minutes
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withDeletionTs(), withClusterResources("abcde11"))
+		nsTmplSet.SetDeletionTimestamp(&metav1.Time{Time: time.Now().Add(-61 * time.Second)})
+		devNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"), withFinalizer())
+		memberConfig := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			DeletionTimeout: &metav1.Duration{Duration: 2 * time.Minute},
+		})
+		r, _ := prepareController(t, nsTmplSet, devNS, memberConfig)
+		req := newReconcileRequest(namespaceName, spacename)
+
+		t.Run("no error before the timeout", func(t *testing.T) {
+			// when
+			result, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, time.Second, result.RequeueAfter)
+		})
+
+		t.Run("error after the timeout", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withDeletionTs(), withClusterResources("abcde11"))
+			nsTmplSet.SetDeletionTimestamp(&metav1.Time{Time: time.Now().Add(-121 * time.Second)})
+			r, _ := prepareController(t, nsTmplSet, devNS, memberConfig)
+
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.EqualError(t, err, "NSTemplateSet deletion has not completed in over 2 minutes")
+		})
+	})
+
 	t.Run("NSTemplateSet not deleted until namespace is deleted", func(t *testing.T) {
 		// given an NSTemplateSet resource and 2 user namespaces ("dev" and "stage")
 		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev", "stage"), withDeletionTs(), withClusterResources("abcde11"))
@@ -1343,6 +1406,7 @@ func prepareNamespacesManager(t *testing.T, initObjs ...client.Object) (*namespa
 	statusManager, fakeClient := prepareStatusManager(t, initObjs...)
 	return &namespacesManager{
 		statusManager: statusManager,
+		exports:       newExportTracker(),
 	}, fakeClient
 }
 
@@ -1529,6 +1593,22 @@ func withConditions(conditions ...toolchainv1alpha1.Condition) nsTmplSetOption {
 	}
 }
 
+func newMemberOperatorConfig(namespace string, cfg NSTemplateSetConfig) *toolchainv1alpha1.MemberOperatorConfig {
+	doc, err := json.Marshal(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return &toolchainv1alpha1.MemberOperatorConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      "config",
+			Annotations: map[string]string{
+				NSTemplateSetConfigAnnotationKey: string(doc),
+			},
+		},
+	}
+}
+
 func newNamespace(tier, spacename, typeName string, options ...objectMetaOption) *corev1.Namespace {
 	labels := map[string]string{
 		toolchainv1alpha1.SpaceLabelKey:    spacename,
@@ -1690,6 +1770,16 @@ func withFeatureAnnotation(feature string) objectMetaOption {
 	}
 }
 
+func withAppliedFeatures(features string) objectMetaOption {
+	return func(meta metav1.ObjectMeta, tier, typeName string) metav1.ObjectMeta {
+		if meta.Annotations == nil {
+			meta.Annotations = map[string]string{}
+		}
+		meta.Annotations[appliedFeaturesAnnotationKey] = features
+		return meta
+	}
+}
+
 func withName(name string) objectMetaOption {
 	return func(meta metav1.ObjectMeta, tier, typeName string) metav1.ObjectMeta {
 		meta.Name = name
@@ -1797,6 +1887,21 @@ func prepareTemplateTiers(decoder runtime.Decoder) ([]client.Object, error) {
 				"abcde11": test.CreateTemplate(test.WithObjects(spaceAdmin, spaceAdminRb), test.WithParams(namespace, username)),
 			},
 		},
+		"isolated": {
+			// namespaces isolated by a NetworkPolicy
+			"dev": {
+				"abcde11": test.CreateTemplate(test.WithObjects(ns, crtAdminRb, allowSameNamespacePolicy), test.WithParams(spacename)),
+				"abcde12": test.CreateTemplate(test.WithObjects(nsWithoutSameSpacePolicy, crtAdminRb, allowSameNamespacePolicy), test.WithParams(spacename)),
+				"abcde13": test.CreateTemplate(test.WithObjects(ns, crtAdminRb), test.WithParams(spacename)), // not isolated anymore
+			},
+		},
+		"bounded": {
+			// namespaces with a quota whose values are bounded by the tier
+			"dev": {
+				"abcde11": test.CreateTemplate(test.WithObjects(ns, boundedComputeQuota), test.WithParams(spacename)),
+				"abcde12": test.CreateTemplate(test.WithObjects(ns, invalidBoundedComputeQuota), test.WithParams(spacename)),
+			},
+		},
 		"appstudio": {
 			"clusterresources": {
 				"abcde11": test.CreateTemplate(test.WithObjects(advancedCrq, clusterTektonRb, idlerDev, idlerStage), test.WithParams(spacename, username)),
@@ -1810,6 +1915,9 @@ func prepareTemplateTiers(decoder runtime.Decoder) ([]client.Object, error) {
 			"viewer": { // space roles
 				"abcde11": test.CreateTemplate(test.WithObjects(spaceViewer, spaceViewerRb), test.WithParams(namespace, username)),
 			},
+			"contributor": { // space roles with user parameters
+				"abcde11": test.CreateTemplate(test.WithObjects(spaceViewer, spaceContributorRb), test.WithParams(namespace, username, userEmail, userGroups, expiresAt)),
+			},
 		},
 	}
 	for tierName, tierTmpls := range tmpls {
@@ -1864,6 +1972,30 @@ var (
       argocd.argoproj.io/managed-by: gitops-service-argocd
 `
 
+	nsWithoutSameSpacePolicy test.TemplateObject = `
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: ${SPACE_NAME}-NSTYPE
+    annotations:
+      toolchain.dev.openshift.com/same-space-network-policy: "false"
+`
+
+	allowSameNamespacePolicy test.TemplateObject = `
+- apiVersion: networking.k8s.io/v1
+  kind: NetworkPolicy
+  metadata:
+    name: allow-same-namespace
+    namespace: ${SPACE_NAME}-NSTYPE
+  spec:
+    podSelector: {}
+    ingress:
+    - from:
+      - podSelector: {}
+    policyTypes:
+    - Ingress
+`
+
 	execPodsRole test.TemplateObject = `
 - apiVersion: rbac.authorization.k8s.io/v1
   kind: Role
@@ -1883,6 +2015,34 @@ var (
     - delete
     - update`
 
+	boundedComputeQuota test.TemplateObject = `
+- apiVersion: v1
+  kind: ResourceQuota
+  metadata:
+    name: compute
+    namespace: ${SPACE_NAME}-NSTYPE
+    annotations:
+      toolchain.dev.openshift.com/quota-min: '{"limits.cpu": "1", "limits.memory": "1Gi"}'
+      toolchain.dev.openshift.com/quota-max: '{"limits.cpu": "4", "limits.memory": "8Gi"}'
+  spec:
+    hard:
+      limits.cpu: "2"
+      limits.memory: 4Gi`
+
+	invalidBoundedComputeQuota test.TemplateObject = `
+- apiVersion: v1
+  kind: ResourceQuota
+  metadata:
+    name: compute
+    namespace: ${SPACE_NAME}-NSTYPE
+    annotations:
+      toolchain.dev.openshift.com/quota-min: '{"limits.cpu": "1", "limits.memory": "1Gi"}'
+      toolchain.dev.openshift.com/quota-max: invalid
+  spec:
+    hard:
+      limits.cpu: "2"
+      limits.memory: 4Gi`
+
 	crtAdminRb test.TemplateObject = `
 - apiVersion: rbac.authorization.k8s.io/v1
   kind: RoleBinding
@@ -1923,6 +2083,13 @@ var (
 	username test.TemplateParam = `
 - name: USERNAME
   value: johnsmith`
+	userEmail test.TemplateParam = `
+- name: USER_EMAIL`
+	userGroups test.TemplateParam = `
+- name: USER_GROUPS`
+	expiresAt test.TemplateParam = `
+- name: EXPIRES_AT
+  value: never`
 
 	advancedCrq test.TemplateObject = `
 - apiVersion: quota.openshift.io/v1
@@ -2093,6 +2260,24 @@ var (
         - get
         - list
   `
+	spaceContributorRb test.TemplateObject = `
+- apiVersion: rbac.authorization.k8s.io/v1
+  kind: RoleBinding
+  metadata:
+    name: ${USERNAME}-space-contributor
+    namespace: ${NAMESPACE}
+    annotations:
+      example.com/email: ${USER_EMAIL}
+      example.com/groups: ${USER_GROUPS}
+      example.com/expires-at: ${EXPIRES_AT}
+  roleRef:
+    apiGroup: rbac.authorization.k8s.io
+    kind: Role
+    name: space-viewer
+  subjects:
+    - kind: User
+      name: ${USERNAME}
+`
 	spaceViewerRb test.TemplateObject = `
 - apiVersion: rbac.authorization.k8s.io/v1
   kind: RoleBinding
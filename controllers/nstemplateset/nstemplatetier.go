@@ -7,8 +7,6 @@ import (
 
 	"fmt"
 
-	gotemp "text/template"
-
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/member-operator/pkg/host"
 	"github.com/codeready-toolchain/toolchain-common/pkg/configuration"
@@ -18,7 +16,6 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/client-go/kubernetes/scheme"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -70,7 +67,7 @@ func getToolchainTierTemplate(ctx context.Context, getHostClient host.ClientGett
 	// get the host client
 	hostClient, err := getHostClient(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to connect to the host cluster: %w", err)
+		return nil, fmt.Errorf("%w: %w", errHostClusterUnavailable, err)
 	}
 
 	tierTemplate := &toolchainv1alpha1.TierTemplate{}
@@ -91,6 +88,9 @@ type tierTemplate struct {
 	typeName    string
 	template    templatev1.Template
 	ttr         *toolchainv1alpha1.TierTemplateRevision
+	// operatorNamespace is the namespace of the member operator, which is passed to the OpenShift templates
+	// (defaults to the watch namespace)
+	operatorNamespace string
 }
 
 const (
@@ -98,6 +98,16 @@ const (
 	Username         = "USERNAME"
 	SpaceName        = "SPACE_NAME"
 	Namespace        = "NAMESPACE"
+
+	// parameters of the space role templates, set from the propagated claims of the user's UserAccount
+	// (or empty if there is no such UserAccount in this cluster)
+	UserEmail     = "USER_EMAIL"
+	UserID        = "USER_ID"
+	UserAccountID = "USER_ACCOUNT_ID"
+	UserSub       = "USER_SUB"
+	// UserGroups is the sorted, comma-separated list of the names of the OpenShift Groups (user.openshift.io) the user is a member of
+	// (or empty if the API group is not available in this cluster)
+	UserGroups = "USER_GROUPS"
 )
 
 // process processes the template inside of the tierTemplate object with the given parameters.
@@ -110,9 +120,12 @@ func (t *tierTemplate) process(scheme *runtime.Scheme, params map[string]string,
 		return t.processGoTemplate(params, filters...)
 	}
 	// if ttr is not present then process the openshift template
-	ns, err := configuration.GetWatchNamespace()
-	if err != nil {
-		return nil, err
+	ns := t.operatorNamespace
+	if ns == "" {
+		var err error
+		if ns, err = configuration.GetWatchNamespace(); err != nil {
+			return nil, err
+		}
 	}
 	tmplProcessor := template.NewProcessor(scheme)
 	params[MemberOperatorNS] = ns // add (or enforce)
@@ -134,42 +147,42 @@ func (t *tierTemplate) convertParametersToMap(runtimeParam map[string]string) ma
 // processGoTemplate processes the Go template
 func (t *tierTemplate) processGoTemplate(runtimeParams map[string]string, filters ...template.FilterFunc) ([]runtimeclient.Object, error) {
 	paramMap := t.convertParametersToMap(runtimeParams) // go execute requires parameters in form of map
-	var objectsToProcess []runtime.RawExtension
+	parsedObjects := parsedTemplates.get(t.ttr)
 	// If there are no filters, then all the objects are to be processed(parsed), No need to filter them first
-	objectsToProcess = t.ttr.Spec.TemplateObjects
+	objectsToProcess := parsedObjects
 	if len(filters) > 0 {
-		// if there are filters provided, then populate Object field from raw object content so the templateObjects can be filtered
-		for i, rawObj := range t.ttr.Spec.TemplateObjects {
-			if rawObj.Object == nil {
-				var unStruct unstructured.Unstructured
-				if err := yaml.Unmarshal(rawObj.Raw, &unStruct); err != nil {
-					return nil, fmt.Errorf("failed to unmarshal raw go template for object in tierTemplateRevision %q: %w; raw: %q", t.ttr.Name, err, string(rawObj.Raw))
-				}
-				t.ttr.Spec.TemplateObjects[i].Object = &unStruct
+		// if there are filters provided, then the Object field populated from raw object content is used to filter the templateObjects
+		objectsToProcess = make([]parsedTemplateObject, 0, len(parsedObjects))
+		for _, parsed := range parsedObjects {
+			if parsed.unmarshalErr != nil {
+				return nil, fmt.Errorf("failed to unmarshal raw go template for object in tierTemplateRevision %q: %w; raw: %q", t.ttr.Name, parsed.unmarshalErr, string(parsed.raw.Raw))
+			}
+		}
+		for _, parsed := range parsedObjects {
+			if len(template.Filter([]runtime.RawExtension{parsed.raw}, filters...)) > 0 {
+				objectsToProcess = append(objectsToProcess, parsed)
 			}
 		}
-		objectsToProcess = template.Filter(t.ttr.Spec.TemplateObjects, filters...)
 	}
 
-	// Parse and execute the objects to process
+	// Execute the (already parsed) objects to process
 	objList := make([]runtimeclient.Object, 0, len(objectsToProcess))
 	decoder := scheme.Codecs.UniversalDeserializer()
 
-	for i, rawExt := range objectsToProcess {
+	for i, parsed := range objectsToProcess {
 		var b bytes.Buffer
 		unStructObj := &unstructured.Unstructured{}
-		strTemp := string(rawExt.Raw)
+		strTemp := string(parsed.raw.Raw)
 
-		ttrTemp, err := gotemp.New(t.ttr.Name).Option("missingkey=error").Parse(strTemp)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse go template for object %d in tierTemplateRevision %q: %w; raw: %q", i, t.ttr.Name, err, strTemp)
+		if parsed.parseErr != nil {
+			return nil, fmt.Errorf("failed to parse go template for object %d in tierTemplateRevision %q: %w; raw: %q", i, t.ttr.Name, parsed.parseErr, strTemp)
 		}
 
-		if err := ttrTemp.Execute(&b, paramMap); err != nil {
+		if err := parsed.template.Execute(&b, paramMap); err != nil {
 			return nil, fmt.Errorf("failed to execute go template for object %d in tierTemplateRevision %q: %w; raw: %q", i, t.ttr.Name, err, strTemp)
 		}
 
-		_, _, err = decoder.Decode(b.Bytes(), nil, unStructObj)
+		_, _, err := decoder.Decode(b.Bytes(), nil, unStructObj)
 		if err != nil {
 			return nil, fmt.Errorf("failed to decode executed go template for object %d in tierTemplateRevision %q: %w; raw: %q", i, t.ttr.Name, err, strTemp)
 		}
@@ -0,0 +1,176 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	errs "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The pod security level of the namespaces of a space can be defined by the tier, per namespace type, with the PodSecurityProfileAnnotationKey
+// annotation of the Namespace object of the template (e.g. `restricted`): the `pod-security.kubernetes.io/enforce`, `audit` and `warn` labels
+// of the namespace are then set to this level, regardless of the labels of the template. The minimum level of the cluster (see
+// NSTemplateSetConfig.PodSecurityMinimumLevel) is set on the namespaces without any level, while a namespace whose level is below the minimum level
+// is not applied at all, so that its level is never downgraded below the minimum.
+//
+// When the enforced level of an existing namespace is tightened, the API server returns warnings about the existing pods which violate
+// the new level. These warnings are only returned when the level changes, so they are reported in the PodSecurityWarnings condition of
+// the NSTemplateSet (and in the logs of the operator) until the level of this namespace changes again, e.g. with a new template.
+const (
+	// PodSecurityProfileAnnotationKey is the annotation of the Namespace object of a template with the pod security level of the namespace
+	PodSecurityProfileAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "pod-security-profile"
+
+	// NSTemplateSetPodSecurityWarningsConditionType is the type of the condition containing the warnings about the existing pods
+	// which violate the tightened pod security level of a namespace of the space
+	NSTemplateSetPodSecurityWarningsConditionType toolchainv1alpha1.ConditionType = "PodSecurityWarnings"
+
+	// NSTemplateSetExistingPodsViolateLevelReason is the reason of the PodSecurityWarnings condition
+	NSTemplateSetExistingPodsViolateLevelReason = "ExistingPodsViolateLevel"
+
+	podSecurityEnforceLabelKey = "pod-security.kubernetes.io/enforce"
+	podSecurityAuditLabelKey   = "pod-security.kubernetes.io/audit"
+	podSecurityWarnLabelKey    = "pod-security.kubernetes.io/warn"
+)
+
+// podSecurityLevels are the pod security levels, from the least to the most restrictive one
+var podSecurityLevels = []string{"privileged", "baseline", "restricted"}
+
+var podSecurityLabelKeys = []string{podSecurityEnforceLabelKey, podSecurityAuditLabelKey, podSecurityWarnLabelKey}
+
+// setPodSecurityLabels sets the pod security labels of the given Namespace object from a template, according to its pod security profile (if any)
+// and to the given minimum level (if any). Returns an error if a level of the namespace is invalid or below the minimum level.
+func setPodSecurityLabels(tmplObj runtimeclient.Object, minimumLevel string) error {
+	labels := tmplObj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	if profile, found := tmplObj.GetAnnotations()[PodSecurityProfileAnnotationKey]; found {
+		if !slices.Contains(podSecurityLevels, profile) {
+			return fmt.Errorf("invalid pod security profile '%s' of namespace '%s'", profile, tmplObj.GetName())
+		}
+		for _, key := range podSecurityLabelKeys {
+			labels[key] = profile
+		}
+	}
+	for _, key := range podSecurityLabelKeys {
+		level, found := labels[key]
+		switch {
+		case !found && minimumLevel != "":
+			labels[key] = minimumLevel
+		case found && !slices.Contains(podSecurityLevels, level):
+			return fmt.Errorf("invalid pod security level '%s' in label '%s' of namespace '%s'", level, key, tmplObj.GetName())
+		case found && slices.Index(podSecurityLevels, level) < slices.Index(podSecurityLevels, minimumLevel):
+			return fmt.Errorf("the pod security level '%s' in label '%s' of namespace '%s' is below the minimum level '%s' of the cluster",
+				level, key, tmplObj.GetName(), minimumLevel)
+		}
+	}
+	tmplObj.SetLabels(labels)
+	return nil
+}
+
+// podSecurityLevelChanged returns true if the given Namespace object from a template sets an enforced pod security level which is different
+// from the one of the existing namespace
+func podSecurityLevelChanged(userNamespace *corev1.Namespace, tmplObj runtimeclient.Object) bool {
+	level, found := tmplObj.GetLabels()[podSecurityEnforceLabelKey]
+	return found && level != enforcedPodSecurityLevel(userNamespace)
+}
+
+// enforcedPodSecurityLevel returns the enforced pod security level of the given namespace, which is `privileged` when the namespace has no level
+func enforcedPodSecurityLevel(userNamespace *corev1.Namespace) string {
+	if level, found := userNamespace.GetLabels()[podSecurityEnforceLabelKey]; found {
+		return level
+	}
+	return podSecurityLevels[0]
+}
+
+// ensurePodSecurityWarnings sets the PodSecurityWarnings condition with the given warnings returned by the API server when the pod security level
+// of the given namespace changed to the given level. If there is no warning, the condition is removed when it is about this namespace, since its
+// warnings are outdated.
+func (r *namespacesManager) ensurePodSecurityWarnings(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespace, level string, warnings []string) error {
+	if len(warnings) == 0 {
+		return r.removePodSecurityWarnings(ctx, nsTmplSet, namespace)
+	}
+	log.FromContext(ctx).Info("some existing pods violate the tightened pod security level", "namespace", namespace, "level", level, "warnings", warnings)
+	if err := r.updateStatusConditions(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+		Type:    NSTemplateSetPodSecurityWarningsConditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  NSTemplateSetExistingPodsViolateLevelReason,
+		Message: fmt.Sprintf("%swas tightened to '%s': %s", podSecurityWarningsPrefix(namespace), level, strings.Join(warnings, "; ")),
+	}); err != nil {
+		return errs.Wrap(err, "failed to set the PodSecurityWarnings condition")
+	}
+	return nil
+}
+
+// podSecurityWarningsPrefix returns the prefix of the message of the PodSecurityWarnings condition about the given namespace
+func podSecurityWarningsPrefix(namespace string) string {
+	return fmt.Sprintf("the pod security level of namespace '%s' ", namespace)
+}
+
+// removePodSecurityWarnings removes the PodSecurityWarnings condition if it is about the given namespace
+func (r *namespacesManager) removePodSecurityWarnings(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespace string) error {
+	warnings, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetPodSecurityWarningsConditionType)
+	if !found || !strings.HasPrefix(warnings.Message, podSecurityWarningsPrefix(namespace)) {
+		return nil
+	}
+	nsTmplSet.Status.Conditions = slices.DeleteFunc(nsTmplSet.Status.Conditions, func(c toolchainv1alpha1.Condition) bool {
+		return c.Type == NSTemplateSetPodSecurityWarningsConditionType
+	})
+	if err := r.Client.Status().Update(ctx, nsTmplSet); err != nil {
+		return errs.Wrap(err, "failed to remove the PodSecurityWarnings condition")
+	}
+	return nil
+}
+
+// warningsCollector collects the warnings returned by the API server for the requests sent with a given context (see withWarningsCollector)
+type warningsCollector struct {
+	mu       sync.Mutex
+	warnings []string
+}
+
+func (c *warningsCollector) add(warning string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, warning)
+}
+
+func (c *warningsCollector) get() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.warnings)
+}
+
+type warningsCollectorKey struct{}
+
+// withWarningsCollector returns a copy of the given context in which the warnings returned by the API server are collected
+// in the returned collector, provided that the client handles the warnings with the handler returned by NewWarningHandler
+func withWarningsCollector(ctx context.Context) (context.Context, *warningsCollector) {
+	collector := &warningsCollector{}
+	return context.WithValue(ctx, warningsCollectorKey{}, collector), collector
+}
+
+// NewWarningHandler returns a handler of the warnings returned by the API server, which adds them to the collector
+// of the context of the request (if any) before passing them to the given handler
+func NewWarningHandler(next rest.WarningHandlerWithContext) rest.WarningHandlerWithContext {
+	return collectingWarningHandler{next: next}
+}
+
+type collectingWarningHandler struct {
+	next rest.WarningHandlerWithContext
+}
+
+func (h collectingWarningHandler) HandleWarningHeaderWithContext(ctx context.Context, code int, agent string, text string) {
+	if collector, ok := ctx.Value(warningsCollectorKey{}).(*warningsCollector); ok {
+		collector.add(text)
+	}
+	h.next.HandleWarningHeaderWithContext(ctx, code, agent, text)
+}
@@ -0,0 +1,403 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestSetPodSecurityLabels(t *testing.T) {
+	newNamespaceObject := func(labels, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "johnsmith-dev",
+				Labels:      labels,
+				Annotations: annotations,
+			},
+		}
+	}
+
+	t.Run("labels set from the profile", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(map[string]string{podSecurityEnforceLabelKey: "privileged"}, map[string]string{PodSecurityProfileAnnotationKey: "restricted"})
+
+		// when
+		err := setPodSecurityLabels(obj, "baseline")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			podSecurityEnforceLabelKey: "restricted",
+			podSecurityAuditLabelKey:   "restricted",
+			podSecurityWarnLabelKey:    "restricted",
+		}, obj.Labels)
+	})
+
+	t.Run("labels of the template kept without profile", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(map[string]string{podSecurityEnforceLabelKey: "baseline", podSecurityWarnLabelKey: "restricted"}, nil)
+
+		// when
+		err := setPodSecurityLabels(obj, "")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			podSecurityEnforceLabelKey: "baseline",
+			podSecurityWarnLabelKey:    "restricted",
+		}, obj.Labels)
+	})
+
+	t.Run("minimum level set on the missing labels of the template", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(map[string]string{podSecurityEnforceLabelKey: "restricted", podSecurityWarnLabelKey: "restricted"}, nil)
+
+		// when
+		err := setPodSecurityLabels(obj, "baseline")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			podSecurityEnforceLabelKey: "restricted",
+			podSecurityAuditLabelKey:   "baseline",
+			podSecurityWarnLabelKey:    "restricted",
+		}, obj.Labels)
+	})
+
+	t.Run("minimum level set when there is no level", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(map[string]string{podSecurityWarnLabelKey: "restricted"}, nil)
+
+		// when
+		err := setPodSecurityLabels(obj, "baseline")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			podSecurityEnforceLabelKey: "baseline",
+			podSecurityAuditLabelKey:   "baseline",
+			podSecurityWarnLabelKey:    "restricted",
+		}, obj.Labels)
+	})
+
+	t.Run("no label without level nor minimum level", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(nil, nil)
+
+		// when
+		err := setPodSecurityLabels(obj, "")
+
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, obj.Labels)
+	})
+
+	t.Run("level below the minimum level refused", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(nil, map[string]string{PodSecurityProfileAnnotationKey: "privileged"})
+
+		// when
+		err := setPodSecurityLabels(obj, "baseline")
+
+		// then
+		require.EqualError(t, err, "the pod security level 'privileged' in label 'pod-security.kubernetes.io/enforce' of namespace 'johnsmith-dev' is below the minimum level 'baseline' of the cluster")
+	})
+
+	t.Run("audit level below the minimum level refused", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(map[string]string{podSecurityEnforceLabelKey: "restricted", podSecurityAuditLabelKey: "privileged"}, nil)
+
+		// when
+		err := setPodSecurityLabels(obj, "baseline")
+
+		// then
+		require.EqualError(t, err, "the pod security level 'privileged' in label 'pod-security.kubernetes.io/audit' of namespace 'johnsmith-dev' is below the minimum level 'baseline' of the cluster")
+	})
+
+	t.Run("warn level below the minimum level refused", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(map[string]string{podSecurityWarnLabelKey: "privileged"}, nil)
+
+		// when
+		err := setPodSecurityLabels(obj, "baseline")
+
+		// then
+		require.EqualError(t, err, "the pod security level 'privileged' in label 'pod-security.kubernetes.io/warn' of namespace 'johnsmith-dev' is below the minimum level 'baseline' of the cluster")
+	})
+
+	t.Run("invalid profile", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(nil, map[string]string{PodSecurityProfileAnnotationKey: "unknown"})
+
+		// when
+		err := setPodSecurityLabels(obj, "")
+
+		// then
+		require.EqualError(t, err, "invalid pod security profile 'unknown' of namespace 'johnsmith-dev'")
+	})
+
+	t.Run("invalid level", func(t *testing.T) {
+		// given
+		obj := newNamespaceObject(map[string]string{podSecurityEnforceLabelKey: "unknown"}, nil)
+
+		// when
+		err := setPodSecurityLabels(obj, "")
+
+		// then
+		require.EqualError(t, err, "invalid pod security level 'unknown' in label 'pod-security.kubernetes.io/enforce' of namespace 'johnsmith-dev'")
+	})
+}
+
+func TestEnsureNamespacesWithPodSecurity(t *testing.T) {
+	// given
+	ctx := context.TODO()
+	spaceName := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+
+	var restrictedNs test.TemplateObject = `
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: ${SPACE_NAME}-NSTYPE
+    annotations:
+      toolchain.dev.openshift.com/pod-security-profile: restricted`
+	var privilegedNs test.TemplateObject = `
+- apiVersion: v1
+  kind: Namespace
+  metadata:
+    name: ${SPACE_NAME}-NSTYPE
+    labels:
+      pod-security.kubernetes.io/enforce: privileged`
+	restrictedTierTemplate, err := createTierTemplate(scheme.Codecs.UniversalDeserializer(),
+		test.CreateTemplate(test.WithObjects(restrictedNs, crtAdminRb), test.WithParams(spacename)), "psa", "dev", "abcde12")
+	require.NoError(t, err)
+	privilegedTierTemplate, err := createTierTemplate(scheme.Codecs.UniversalDeserializer(),
+		test.CreateTemplate(test.WithObjects(privilegedNs, crtAdminRb), test.WithParams(spacename)), "psa", "dev", "abcde13")
+	require.NoError(t, err)
+	defaultTierTemplate, err := createTierTemplate(scheme.Codecs.UniversalDeserializer(),
+		test.CreateTemplate(test.WithObjects(ns, crtAdminRb), test.WithParams(spacename)), "psa", "dev", "abcde11")
+	require.NoError(t, err)
+	withPodSecurityLevel := func(level string) objectMetaOption {
+		return withLabels(map[string]string{podSecurityEnforceLabelKey: level})
+	}
+	warnings := []string{
+		`existing pods in namespace "johnsmith-dev" violate the new PodSecurity enforce level "restricted:latest"`,
+		`pod-1: allowPrivilegeEscalation != false`,
+	}
+	returnWarningsOnNamespacePatch := func(fakeClient *test.FakeClient) {
+		fakeClient.MockPatch = func(ctx context.Context, obj runtimeclient.Object, patch runtimeclient.Patch, opts ...runtimeclient.PatchOption) error {
+			if obj.GetObjectKind().GroupVersionKind().Kind == "Namespace" {
+				handler := NewWarningHandler(rest.NoWarnings{})
+				for _, warning := range warnings {
+					handler.HandleWarningHeaderWithContext(ctx, 299, "-", warning)
+				}
+			}
+			return test.Patch(ctx, fakeClient, obj, patch, opts...)
+		}
+	}
+
+	t.Run("level set from the profile of the tier", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde12", "dev"))
+		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, restrictedTierTemplate)
+
+		// when
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNamespace(t, spaceName+"-dev", fakeClient).
+			HasLabel(podSecurityEnforceLabelKey, "restricted").
+			HasLabel(podSecurityAuditLabelKey, "restricted").
+			HasLabel(podSecurityWarnLabelKey, "restricted")
+	})
+
+	t.Run("minimum level set when the tier has no level", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde11", "dev"))
+		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, defaultTierTemplate)
+
+		// when
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{podSecurityMinimumLevel: "baseline"})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNamespace(t, spaceName+"-dev", fakeClient).
+			HasLabel(podSecurityEnforceLabelKey, "baseline")
+	})
+
+	t.Run("tightened level", func(t *testing.T) {
+		t.Run("warnings about the existing pods reported", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde12", "dev"))
+			devNS := newNamespace("psa", spaceName, "dev", withPodSecurityLevel("baseline"))
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, defaultTierTemplate, restrictedTierTemplate)
+			returnWarningsOnNamespacePatch(fakeClient)
+
+			// when
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNamespace(t, spaceName+"-dev", fakeClient).
+				HasLabel(podSecurityEnforceLabelKey, "restricted")
+			AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+				HasConditions(Updating(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-dev' was tightened to 'restricted': "+
+					`existing pods in namespace "johnsmith-dev" violate the new PodSecurity enforce level "restricted:latest"; pod-1: allowPrivilegeEscalation != false`))
+		})
+
+		t.Run("warnings removed when the level is tightened without warning", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde12", "dev"),
+				withConditions(Updating(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-dev' was tightened to 'restricted': some warnings")))
+			devNS := newNamespace("psa", spaceName, "dev", withPodSecurityLevel("baseline"))
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, defaultTierTemplate, restrictedTierTemplate)
+
+			// when
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+				HasConditions(Updating())
+		})
+
+		t.Run("warnings about another namespace kept when the level is tightened without warning", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde12", "dev"),
+				withConditions(Updating(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-stage' was tightened to 'restricted': some warnings")))
+			devNS := newNamespace("psa", spaceName, "dev", withPodSecurityLevel("baseline"))
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, defaultTierTemplate, restrictedTierTemplate)
+
+			// when
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+				HasConditions(Updating(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-stage' was tightened to 'restricted': some warnings"))
+		})
+
+		t.Run("warnings removed when the level is loosened", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde13", "dev"),
+				withConditions(Updating(), PodSecurityWarnings("the pod security level of namespace 'johnsmith-dev' was tightened to 'restricted': some warnings")))
+			devNS := newNamespace("psa", spaceName, "dev", withPodSecurityLevel("restricted"))
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, defaultTierTemplate, privilegedTierTemplate)
+
+			// when
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNamespace(t, spaceName+"-dev", fakeClient).
+				HasLabel(podSecurityEnforceLabelKey, "privileged")
+			AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+				HasConditions(Updating())
+		})
+
+		t.Run("no warning reported when the level is not tightened", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde12", "dev"))
+			devNS := newNamespace("psa", spaceName, "dev", withPodSecurityLevel("restricted"))
+			manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, defaultTierTemplate, restrictedTierTemplate)
+			returnWarningsOnNamespacePatch(fakeClient)
+
+			// when
+			_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+				HasConditions(Updating())
+		})
+	})
+
+	t.Run("downgrade below the minimum level refused", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spaceName, "psa", withNamespaces("abcde13", "dev"))
+		devNS := newNamespace("psa", spaceName, "dev", withPodSecurityLevel("baseline"))
+		manager, fakeClient := prepareNamespacesManager(t, nsTmplSet, devNS, defaultTierTemplate, privilegedTierTemplate)
+
+		// when
+		_, err := manager.ensure(ctx, nsTmplSet, nstemplatesetConfig{podSecurityMinimumLevel: "baseline"})
+
+		// then
+		require.EqualError(t, err, "invalid pod security level for namespace type 'dev': the pod security level 'privileged' in label 'pod-security.kubernetes.io/enforce' of namespace 'johnsmith-dev' is below the minimum level 'baseline' of the cluster")
+		AssertThatNSTemplateSet(t, namespaceName, spaceName, fakeClient).
+			HasConditions(ValidationFailed("the pod security level 'privileged' in label 'pod-security.kubernetes.io/enforce' of namespace 'johnsmith-dev' is below the minimum level 'baseline' of the cluster"))
+		AssertThatNamespace(t, spaceName+"-dev", fakeClient).
+			HasLabel(podSecurityEnforceLabelKey, "baseline")
+	})
+}
+
+func TestWarningHandler(t *testing.T) {
+	// given
+	handler := NewWarningHandler(rest.NoWarnings{})
+
+	t.Run("warnings collected", func(t *testing.T) {
+		// given
+		ctx, collector := withWarningsCollector(context.TODO())
+
+		// when
+		handler.HandleWarningHeaderWithContext(ctx, 299, "-", "first")
+		handler.HandleWarningHeaderWithContext(ctx, 299, "-", "second")
+
+		// then
+		assert.Equal(t, []string{"first", "second"}, collector.get())
+	})
+
+	t.Run("warnings not collected without collector", func(t *testing.T) {
+		// given
+		_, collector := withWarningsCollector(context.TODO())
+
+		// when
+		handler.HandleWarningHeaderWithContext(context.TODO(), 299, "-", "first")
+
+		// then
+		assert.Empty(t, collector.get())
+	})
+}
+
+func TestLoadPodSecurityConfig(t *testing.T) {
+	t.Run("valid value", func(t *testing.T) {
+		// given
+		manager, _ := prepareNamespacesManager(t, newMemberOperatorConfig("toolchain-member", NSTemplateSetConfig{
+			PodSecurityMinimumLevel: ptr.To("baseline"),
+		}))
+
+		// when
+		cfg, err := loadConfig(context.TODO(), manager.Client, "toolchain-member", nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "baseline", cfg.podSecurityMinimumLevel)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		// given
+		manager, _ := prepareNamespacesManager(t, newMemberOperatorConfig("toolchain-member", NSTemplateSetConfig{
+			PodSecurityMinimumLevel: ptr.To("strict"),
+		}))
+
+		// when
+		cfg, err := loadConfig(context.TODO(), manager.Client, "toolchain-member", nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, cfg.podSecurityMinimumLevel)
+	})
+}
@@ -0,0 +1,546 @@
+package nstemplateset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	"github.com/codeready-toolchain/toolchain-common/pkg/template"
+	quotav1 "github.com/openshift/api/quota/v1"
+	errs "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	metrics "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The quotas of a space can be adjusted to the actual usage of the space, within the bounds defined by the tier: the min and max values
+// of the resources of a ResourceQuota or a ClusterResourceQuota are set in the QuotaMinAnnotationKey and QuotaMaxAnnotationKey annotations
+// of the quota in the template, e.g. `{"limits.cpu": "1", "limits.memory": "2Gi"}`. When enabled in the MemberOperatorConfig
+// (see NSTemplateSetConfig.QuotaRecommendation), the CPU and memory usage of the pods of the space is periodically observed via the `metrics.k8s.io` API,
+// and the recommended values (i.e. twice the usage, within the bounds) are stored in the quota recommendations ConfigMap of the space, which is
+// referred to by the QuotaRecommendation condition of the NSTemplateSet. The recommended values can also be applied automatically: in such a case,
+// they replace the values of the template whenever the quota is applied, with the same field manager as the rest of the template.
+const (
+	// NSTemplateSetQuotaRecommendationConditionType is the type of the condition referring to the recommended values of the quotas of the space
+	NSTemplateSetQuotaRecommendationConditionType toolchainv1alpha1.ConditionType = "QuotaRecommendation"
+
+	// NSTemplateSetQuotaRecommendedReason is the reason of the QuotaRecommendation condition when the recommended values are not applied
+	NSTemplateSetQuotaRecommendedReason = "Recommended"
+
+	// NSTemplateSetQuotaRecommendationAppliedReason is the reason of the QuotaRecommendation condition when the recommended values are applied
+	NSTemplateSetQuotaRecommendationAppliedReason = "Applied"
+
+	// NSTemplateSetQuotaRecommendationFailedReason is the reason of the QuotaRecommendation condition when the usage of the space
+	// could not be observed or the bounds of the quotas are invalid
+	NSTemplateSetQuotaRecommendationFailedReason = "RecommendationFailed"
+
+	// QuotaMinAnnotationKey is the annotation of a quota in a template, with the min values of its resources (as a JSON object)
+	QuotaMinAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "quota-min"
+
+	// QuotaMaxAnnotationKey is the annotation of a quota in a template, with the max values of its resources (as a JSON object)
+	QuotaMaxAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "quota-max"
+
+	// quotaRecommendationsKey is the key of the recommendations (as JSON) in the quota recommendations ConfigMap of a space
+	quotaRecommendationsKey = "recommendations"
+
+	// quotaRecommendationPeriod is the period after which the usage of a space is observed again
+	quotaRecommendationPeriod = 10 * time.Minute
+
+	// quotaRecommendationHeadroom is the factor applied to the observed usage to compute the recommended value of a resource
+	quotaRecommendationHeadroom = 2
+)
+
+var (
+	// the recommended values are rounded up to these steps, so that they don't change with every small variation of the usage
+	cpuRecommendationStep    = resource.MustParse("100m")
+	memoryRecommendationStep = resource.MustParse("128Mi")
+
+	resourceQuotaGVK = corev1.SchemeGroupVersion.WithKind("ResourceQuota")
+	podMetricsGVK    = metrics.SchemeGroupVersion.WithKind("PodMetrics")
+)
+
+// boundedQuota is a quota of the templates applied to the space, whose resources have min and max values defined by the tier
+type boundedQuota struct {
+	// obj is the quota as processed from the template
+	obj          runtimeclient.Object
+	tierTemplate *tierTemplate
+	hard         corev1.ResourceList
+	namespaces   []string
+	min, max     corev1.ResourceList
+}
+
+func (q boundedQuota) String() string {
+	if q.obj.GetNamespace() != "" {
+		return fmt.Sprintf("ResourceQuota %s/%s", q.obj.GetNamespace(), q.obj.GetName())
+	}
+	return fmt.Sprintf("ClusterResourceQuota %s", q.obj.GetName())
+}
+
+// quotaRecommendation is the recommendation for a bounded quota of the space, as stored in the quota recommendations ConfigMap
+type quotaRecommendation struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Template contains the values of the recommended resources in the template
+	Template    corev1.ResourceList `json:"template"`
+	Recommended corev1.ResourceList `json:"recommended"`
+	// Applied is true if the recommended values replace the values of the template
+	Applied bool `json:"applied"`
+}
+
+// isFor returns true if the recommendation is for the given quota of a template
+func (q quotaRecommendation) isFor(obj runtimeclient.Object) bool {
+	return obj.GetObjectKind().GroupVersionKind().Kind == q.Kind && obj.GetNamespace() == q.Namespace && obj.GetName() == q.Name
+}
+
+// quotaRecommendationsConfigMapName returns the name of the ConfigMap (in the NSTemplateSet namespace) containing the quota recommendations
+// of the given space. The ConfigMap is owned by the NSTemplateSet.
+func quotaRecommendationsConfigMapName(spaceName string) string {
+	return spaceName + "-quota-recommendations"
+}
+
+// ensureQuotaRecommendations observes the usage of the space and stores the recommended values of its bounded quotas in the quota recommendations
+// ConfigMap (and applies them, if configured so). The usage is not observed again until the quotaRecommendationPeriod has elapsed.
+// Returns the duration after which the usage must be observed again, or 0 if the recommendations are disabled or if the space has no bounded quota.
+func (r *Reconciler) ensureQuotaRecommendations(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) (time.Duration, error) {
+	if cfg.quotaRecommendation == "" {
+		return 0, r.removeQuotaRecommendations(ctx, nsTmplSet, cfg)
+	}
+	if !apiGroupIsPresent(r.AvailableAPIGroups, podMetricsGVK) {
+		// the available API groups are discovered when the operator starts, there is no need to check again later
+		return 0, r.status.updateStatusConditions(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+			Type:    NSTemplateSetQuotaRecommendationConditionType,
+			Status:  corev1.ConditionFalse,
+			Reason:  NSTemplateSetQuotaRecommendationFailedReason,
+			Message: fmt.Sprintf("the '%s' API is not available in the cluster", metrics.SchemeGroupVersion),
+		})
+	}
+	if existing, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetQuotaRecommendationConditionType); found && existing.LastUpdatedTime != nil {
+		if elapsed := time.Since(existing.LastUpdatedTime.Time); elapsed < quotaRecommendationPeriod {
+			return quotaRecommendationPeriod - elapsed, nil
+		}
+	}
+
+	quotas, err := r.boundedQuotas(ctx, nsTmplSet)
+	if err != nil {
+		return quotaRecommendationPeriod, r.setQuotaRecommendationFailed(ctx, nsTmplSet, err)
+	}
+	if len(quotas) == 0 {
+		return 0, r.removeQuotaRecommendations(ctx, nsTmplSet, cfg)
+	}
+	usage, err := r.podUsagePerNamespace(ctx, quotas)
+	if err != nil {
+		return quotaRecommendationPeriod, r.setQuotaRecommendationFailed(ctx, nsTmplSet, errs.Wrap(err, "unable to observe the usage of the pods"))
+	}
+	previous, err := r.status.getQuotaRecommendations(ctx, nsTmplSet)
+	if err != nil {
+		return quotaRecommendationPeriod, r.setQuotaRecommendationFailed(ctx, nsTmplSet, err)
+	}
+
+	apply := cfg.quotaRecommendation == quotaRecommendationApply
+	recommendations := make([]quotaRecommendation, 0, len(quotas))
+	for _, quota := range quotas {
+		recommended := recommendQuota(quota, usage)
+		templateValues := corev1.ResourceList{}
+		for name := range recommended {
+			templateValues[name] = quota.hard[name]
+		}
+		recommendations = append(recommendations, quotaRecommendation{
+			Kind:        quota.obj.GetObjectKind().GroupVersionKind().Kind,
+			Namespace:   quota.obj.GetNamespace(),
+			Name:        quota.obj.GetName(),
+			Template:    templateValues,
+			Recommended: recommended,
+			Applied:     apply,
+		})
+	}
+	// the recommendations are stored before being applied, so that the templates which are applied meanwhile keep the same values
+	if err := r.setQuotaRecommendations(ctx, nsTmplSet, recommendations); err != nil {
+		return quotaRecommendationPeriod, r.setQuotaRecommendationFailed(ctx, nsTmplSet, err)
+	}
+	log.FromContext(ctx).Info("quota recommendations", "recommendations", recommendations)
+	for i, quota := range quotas {
+		values := recommendations[i].Recommended
+		if !apply {
+			if !slices.ContainsFunc(previous, func(p quotaRecommendation) bool { return p.Applied && p.isFor(quota.obj) }) {
+				continue
+			}
+			// the recommended values were applied before, the values of the template are restored
+			values = nil
+		}
+		if err := r.applyQuota(ctx, nsTmplSet, cfg, quota, values); err != nil {
+			return quotaRecommendationPeriod, r.setQuotaRecommendationFailed(ctx, nsTmplSet, errs.Wrapf(err, "unable to apply the %s", quota))
+		}
+	}
+
+	reason := NSTemplateSetQuotaRecommendedReason
+	if apply {
+		reason = NSTemplateSetQuotaRecommendationAppliedReason
+	}
+	return quotaRecommendationPeriod, r.setQuotaRecommendationCondition(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+		Type:   NSTemplateSetQuotaRecommendationConditionType,
+		Status: corev1.ConditionTrue,
+		Reason: reason,
+		Message: fmt.Sprintf("the recommended values of %d quota(s) are in the ConfigMap '%s/%s'",
+			len(recommendations), nsTmplSet.Namespace, quotaRecommendationsConfigMapName(nsTmplSet.GetName())),
+	})
+}
+
+// boundedQuotas returns the ResourceQuotas and ClusterResourceQuotas of the templates applied to the space which have min and max values
+func (r *Reconciler) boundedQuotas(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) ([]boundedQuota, error) {
+	namespaces, err := fetchNamespacesByOwner(ctx, r.Client, nsTmplSet.GetName())
+	if err != nil {
+		return nil, errs.Wrap(err, "unable to list the namespaces of the space")
+	}
+	var quotas []boundedQuota
+	var namespaceNames []string
+	for _, ns := range namespaces {
+		namespaceNames = append(namespaceNames, ns.Name)
+		templateRef := ns.Labels[toolchainv1alpha1.TemplateRefLabelKey]
+		if templateRef == "" {
+			// not provisioned yet
+			continue
+		}
+		tierTemplate, err := r.fetchTierTemplate(ctx, nsTmplSet, templateRef)
+		if err != nil {
+			return nil, errs.Wrapf(err, "unable to retrieve the TierTemplate '%s'", templateRef)
+		}
+		objs, err := tierTemplate.process(r.Scheme, map[string]string{
+			SpaceName: nsTmplSet.GetName(),
+		}, template.RetainAllButNamespaces)
+		if err != nil {
+			return nil, errs.Wrapf(err, "unable to process the TierTemplate '%s'", templateRef)
+		}
+		for _, obj := range objs {
+			if obj.GetObjectKind().GroupVersionKind().GroupKind() != resourceQuotaGVK.GroupKind() {
+				continue
+			}
+			if quotas, err = appendBoundedQuota(quotas, nsTmplSet, tierTemplate, obj, []string{obj.GetNamespace()}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the unsupported ClusterResourceQuotas are not part of the processed objects
+	tierTemplate, objs, err := r.clusterResources.processTierTemplate(ctx, nsTmplSet, nsTmplSet.Status.ClusterResources)
+	if err != nil {
+		return nil, errs.Wrap(err, "unable to process the cluster resources template")
+	}
+	for _, obj := range objs {
+		if !isClusterResourceQuota(obj) {
+			continue
+		}
+		if quotas, err = appendBoundedQuota(quotas, nsTmplSet, tierTemplate, obj, namespaceNames); err != nil {
+			return nil, err
+		}
+	}
+	return quotas, nil
+}
+
+// appendBoundedQuota appends the given quota of a template to the given bounded quotas, if it has min and max values and is enabled for the space
+func appendBoundedQuota(quotas []boundedQuota, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, obj runtimeclient.Object, namespaces []string) ([]boundedQuota, error) {
+	minValue, minFound := obj.GetAnnotations()[QuotaMinAnnotationKey]
+	maxValue, maxFound := obj.GetAnnotations()[QuotaMaxAnnotationKey]
+	if !minFound || !maxFound || !shouldCreate(obj, nsTmplSet) {
+		return quotas, nil
+	}
+	quota := boundedQuota{
+		obj:          obj,
+		tierTemplate: tierTemplate,
+		namespaces:   namespaces,
+	}
+	hard, err := quotaHard(obj)
+	if err != nil {
+		return nil, errs.Wrapf(err, "invalid %s", quota)
+	}
+	quota.hard = hard
+	if err := json.Unmarshal([]byte(minValue), &quota.min); err != nil {
+		return nil, errs.Wrapf(err, "invalid '%s' annotation of the %s", QuotaMinAnnotationKey, quota)
+	}
+	if err := json.Unmarshal([]byte(maxValue), &quota.max); err != nil {
+		return nil, errs.Wrapf(err, "invalid '%s' annotation of the %s", QuotaMaxAnnotationKey, quota)
+	}
+	return append(quotas, quota), nil
+}
+
+// quotaHard returns the hard resources of the given ResourceQuota or ClusterResourceQuota of a template
+func quotaHard(obj runtimeclient.Object) (corev1.ResourceList, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	if isClusterResourceQuota(obj) {
+		crq := &quotav1.ClusterResourceQuota{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, crq); err != nil {
+			return nil, err
+		}
+		return crq.Spec.Quota.Hard, nil
+	}
+	rq := &corev1.ResourceQuota{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, rq); err != nil {
+		return nil, err
+	}
+	return rq.Spec.Hard, nil
+}
+
+// setQuotaHard sets the given values in the hard resources of the given ResourceQuota or ClusterResourceQuota of a template
+func setQuotaHard(obj runtimeclient.Object, values corev1.ResourceList) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	path := []string{"spec", "hard"}
+	if isClusterResourceQuota(obj) {
+		path = []string{"spec", "quota", "hard"}
+	}
+	for name, value := range values {
+		if err := unstructured.SetNestedField(content, value.String(), append(path, string(name))...); err != nil {
+			return err
+		}
+	}
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		u.SetUnstructuredContent(content)
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, obj)
+}
+
+// podUsagePerNamespace returns the CPU and memory usage of the pods in each namespace of the given quotas
+func (r *Reconciler) podUsagePerNamespace(ctx context.Context, quotas []boundedQuota) (map[string]corev1.ResourceList, error) {
+	usage := map[string]corev1.ResourceList{}
+	for _, quota := range quotas {
+		for _, ns := range quota.namespaces {
+			if _, found := usage[ns]; found {
+				continue
+			}
+			podMetrics := &metrics.PodMetricsList{}
+			if err := r.AllNamespacesClient.List(ctx, podMetrics, runtimeclient.InNamespace(ns)); err != nil {
+				return nil, err
+			}
+			cpu, memory := resource.Quantity{}, resource.Quantity{}
+			for _, pod := range podMetrics.Items {
+				for _, container := range pod.Containers {
+					cpu.Add(container.Usage[corev1.ResourceCPU])
+					memory.Add(container.Usage[corev1.ResourceMemory])
+				}
+			}
+			usage[ns] = corev1.ResourceList{
+				corev1.ResourceCPU:    cpu,
+				corev1.ResourceMemory: memory,
+			}
+		}
+	}
+	return usage, nil
+}
+
+// recommendQuota returns the recommended values of the bounded resources of the given quota, i.e. twice the usage of the pods
+// in its namespaces (rounded up), within the min and max values
+func recommendQuota(quota boundedQuota, usagePerNamespace map[string]corev1.ResourceList) corev1.ResourceList {
+	recommended := corev1.ResourceList{}
+	for name := range quota.hard {
+		minValue, minFound := quota.min[name]
+		maxValue, maxFound := quota.max[name]
+		if !minFound || !maxFound {
+			continue
+		}
+		// `cpu`, `requests.cpu` and `limits.cpu` (and the same for the memory)
+		usageName, step := corev1.ResourceCPU, cpuRecommendationStep
+		if strings.HasSuffix(string(name), string(corev1.ResourceMemory)) {
+			usageName, step = corev1.ResourceMemory, memoryRecommendationStep
+		} else if !strings.HasSuffix(string(name), string(corev1.ResourceCPU)) {
+			continue
+		}
+		usage := resource.Quantity{}
+		for _, ns := range quota.namespaces {
+			usage.Add(usagePerNamespace[ns][usageName])
+		}
+		steps := (usage.MilliValue()*quotaRecommendationHeadroom + step.MilliValue() - 1) / step.MilliValue()
+		value := *resource.NewMilliQuantity(steps*step.MilliValue(), minValue.Format)
+		if usageName == corev1.ResourceMemory {
+			value = *resource.NewQuantity(steps*step.Value(), minValue.Format)
+		}
+		if value.Cmp(minValue) < 0 {
+			value = minValue.DeepCopy()
+		} else if value.Cmp(maxValue) > 0 {
+			value = maxValue.DeepCopy()
+		}
+		recommended[name] = value
+	}
+	return recommended
+}
+
+// applyQuota applies the given quota of a template with the given values, with the same labels and field manager as when the whole
+// template is applied. The values of the template are applied if no values are given.
+func (r *Reconciler) applyQuota(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig, quota boundedQuota, values corev1.ResourceList) error {
+	obj := quota.obj.DeepCopyObject().(runtimeclient.Object)
+	if err := setQuotaHard(obj, values); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("applying the quota", "quota", quota.String(), "values", values)
+	if isClusterResourceQuota(obj) {
+		_, err := r.clusterResources.apply(ctx, nsTmplSet, quota.tierTemplate, obj, cfg.unforcedKinds)
+		return err
+	}
+	_, err := r.ApplyToolchainObjects(ctx, []runtimeclient.Object{obj}, map[string]string{
+		toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
+		toolchainv1alpha1.SpaceLabelKey:    nsTmplSet.GetName(),
+	}, cfg.unforcedKinds)
+	return r.status.updateStatusFieldConflicts(ctx, nsTmplSet, []runtimeclient.Object{obj}, err)
+}
+
+// getQuotaRecommendations returns the quota recommendations of the space, if any
+func (r *statusManager) getQuotaRecommendations(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) ([]quotaRecommendation, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: nsTmplSet.Namespace, Name: quotaRecommendationsConfigMapName(nsTmplSet.GetName())}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errs.Wrap(err, "unable to get the quota recommendations")
+	}
+	var recommendations []quotaRecommendation
+	if err := json.Unmarshal([]byte(cm.Data[quotaRecommendationsKey]), &recommendations); err != nil {
+		return nil, errs.Wrap(err, "unable to decode the quota recommendations")
+	}
+	return recommendations, nil
+}
+
+// withAppliedQuotaRecommendations sets the applied recommended values in the bounded quotas among the given objects of a template,
+// so that the quotas keep these values when the template is applied again
+func (r *statusManager) withAppliedQuotaRecommendations(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, objs []runtimeclient.Object) error {
+	recommendations, err := r.getQuotaRecommendations(ctx, nsTmplSet)
+	if err != nil {
+		return err
+	}
+	for _, recommendation := range recommendations {
+		if !recommendation.Applied {
+			continue
+		}
+		for _, obj := range objs {
+			_, bounded := obj.GetAnnotations()[QuotaMaxAnnotationKey]
+			if !bounded || !recommendation.isFor(obj) {
+				continue
+			}
+			if err := setQuotaHard(obj, recommendation.Recommended); err != nil {
+				return errs.Wrapf(err, "unable to set the recommended values of the %s '%s'", recommendation.Kind, recommendation.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// setQuotaRecommendations stores the given recommendations in the quota recommendations ConfigMap of the space
+func (r *Reconciler) setQuotaRecommendations(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, recommendations []quotaRecommendation) error {
+	data, err := json.Marshal(recommendations)
+	if err != nil {
+		return errs.Wrap(err, "failed to marshal the quota recommendations")
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: nsTmplSet.Namespace,
+			Name:      quotaRecommendationsConfigMapName(nsTmplSet.GetName()),
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[toolchainv1alpha1.ProviderLabelKey] = toolchainv1alpha1.ProviderLabelValue
+		cm.Labels[toolchainv1alpha1.SpaceLabelKey] = nsTmplSet.GetName()
+		cm.Data = map[string]string{
+			quotaRecommendationsKey: string(data),
+		}
+		return controllerutil.SetControllerReference(nsTmplSet, cm, r.Scheme)
+	}); err != nil {
+		return errs.Wrap(err, "failed to store the quota recommendations")
+	}
+	return nil
+}
+
+// removeQuotaRecommendations restores the values of the templates in the quotas whose recommended values were applied, then deletes
+// the quota recommendations ConfigMap and the QuotaRecommendation condition
+func (r *Reconciler) removeQuotaRecommendations(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) error {
+	previous, err := r.status.getQuotaRecommendations(ctx, nsTmplSet)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(previous, func(p quotaRecommendation) bool { return p.Applied }) {
+		quotas, err := r.boundedQuotas(ctx, nsTmplSet)
+		if err != nil {
+			return err
+		}
+		for _, quota := range quotas {
+			if !slices.ContainsFunc(previous, func(p quotaRecommendation) bool { return p.Applied && p.isFor(quota.obj) }) {
+				continue
+			}
+			if err := r.applyQuota(ctx, nsTmplSet, cfg, quota, nil); err != nil {
+				return errs.Wrapf(err, "unable to restore the %s", quota)
+			}
+		}
+	}
+	if previous != nil {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: nsTmplSet.Namespace,
+				Name:      quotaRecommendationsConfigMapName(nsTmplSet.GetName()),
+			},
+		}
+		if err := r.Client.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+			return errs.Wrap(err, "failed to delete the quota recommendations")
+		}
+	}
+	return r.removeQuotaRecommendationCondition(ctx, nsTmplSet)
+}
+
+func (r *Reconciler) setQuotaRecommendationFailed(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cause error) error {
+	log.FromContext(ctx).Error(cause, "unable to recommend the quotas of the space")
+	return r.setQuotaRecommendationCondition(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+		Type:    NSTemplateSetQuotaRecommendationConditionType,
+		Status:  corev1.ConditionFalse,
+		Reason:  NSTemplateSetQuotaRecommendationFailedReason,
+		Message: cause.Error(),
+	})
+}
+
+// setQuotaRecommendationCondition sets the given QuotaRecommendation condition, with the current time as its last updated time
+// (even if the condition did not change) since it is the time of the last observation of the usage of the space
+func (r *Reconciler) setQuotaRecommendationCondition(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, newCondition toolchainv1alpha1.Condition) error {
+	now := metav1.Now()
+	newCondition.LastTransitionTime = now
+	newCondition.LastUpdatedTime = &now
+	if existing, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetQuotaRecommendationConditionType); found && existing.Status == newCondition.Status {
+		newCondition.LastTransitionTime = existing.LastTransitionTime
+	}
+	nsTmplSet.Status.Conditions = append(slices.DeleteFunc(nsTmplSet.Status.Conditions, func(c toolchainv1alpha1.Condition) bool {
+		return c.Type == NSTemplateSetQuotaRecommendationConditionType
+	}), newCondition)
+	if err := r.Client.Status().Update(ctx, nsTmplSet); err != nil {
+		return errs.Wrap(err, "failed to set the QuotaRecommendation condition")
+	}
+	return nil
+}
+
+func (r *Reconciler) removeQuotaRecommendationCondition(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+	if _, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetQuotaRecommendationConditionType); !found {
+		return nil
+	}
+	nsTmplSet.Status.Conditions = slices.DeleteFunc(nsTmplSet.Status.Conditions, func(c toolchainv1alpha1.Condition) bool {
+		return c.Type == NSTemplateSetQuotaRecommendationConditionType
+	})
+	if err := r.Client.Status().Update(ctx, nsTmplSet); err != nil {
+		return errs.Wrap(err, "failed to remove the QuotaRecommendation condition")
+	}
+	return nil
+}
@@ -0,0 +1,335 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	metrics "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRecommendQuota(t *testing.T) {
+	// given
+	quota := boundedQuota{
+		obj: &corev1.ResourceQuota{},
+		hard: corev1.ResourceList{
+			"limits.cpu":      resource.MustParse("4"),
+			"requests.memory": resource.MustParse("8Gi"),
+			"pods":            resource.MustParse("10"),
+		},
+		namespaces: []string{"johnsmith-dev", "johnsmith-stage"},
+		min: corev1.ResourceList{
+			"limits.cpu":      resource.MustParse("1"),
+			"requests.memory": resource.MustParse("2Gi"),
+			"pods":            resource.MustParse("5"),
+		},
+		max: corev1.ResourceList{
+			"limits.cpu":      resource.MustParse("8"),
+			"requests.memory": resource.MustParse("16Gi"),
+			"pods":            resource.MustParse("20"),
+		},
+	}
+	usageOf := func(cpu, memory string) corev1.ResourceList {
+		return corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(cpu),
+			corev1.ResourceMemory: resource.MustParse(memory),
+		}
+	}
+
+	t.Run("twice the usage of all the namespaces", func(t *testing.T) {
+		// when
+		recommended := recommendQuota(quota, map[string]corev1.ResourceList{
+			"johnsmith-dev":   usageOf("610m", "2Gi"),
+			"johnsmith-stage": usageOf("100m", "1000Mi"),
+			"johnsmith-other": usageOf("10", "100Gi"),
+		})
+
+		// then
+		cpu, memory := recommended["limits.cpu"], recommended["requests.memory"]
+		assert.Equal(t, "1500m", cpu.String())
+		assert.Equal(t, "6Gi", memory.String())
+		assert.NotContains(t, recommended, corev1.ResourceName("pods"))
+	})
+
+	t.Run("within the bounds", func(t *testing.T) {
+		// when
+		recommended := recommendQuota(quota, map[string]corev1.ResourceList{
+			"johnsmith-dev": usageOf("100m", "10Gi"),
+		})
+
+		// then
+		cpu, memory := recommended["limits.cpu"], recommended["requests.memory"]
+		assert.Equal(t, "1", cpu.String())
+		assert.Equal(t, "16Gi", memory.String())
+	})
+}
+
+func TestEnsureQuotaRecommendations(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	devNS := newNamespace("bounded", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+	// the quota as applied from the template
+	newBoundedResourceQuota := func() *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: devNS.Name,
+				Name:      "compute",
+				Labels: map[string]string{
+					toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
+					toolchainv1alpha1.SpaceLabelKey:    spacename,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu":    resource.MustParse("2"),
+					"limits.memory": resource.MustParse("4Gi"),
+				},
+			},
+		}
+	}
+	podMetrics := &metrics.PodMetrics{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: devNS.Name,
+			Name:      "my-pod",
+		},
+		Containers: []metrics.ContainerMetrics{
+			{
+				Name: "app",
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1200m"),
+					corev1.ResourceMemory: resource.MustParse("512Mi"),
+				},
+			},
+		},
+	}
+	prepareReconcileWithMetrics := func(t *testing.T, initObjs ...runtimeclient.Object) (*Reconciler, *test.FakeClient) {
+		r, _, fakeClient := prepareReconcile(t, namespaceName, spacename, initObjs...)
+		r.AvailableAPIGroups = append(r.AvailableAPIGroups, newAPIGroup("metrics.k8s.io", "v1beta1"))
+		return r, fakeClient
+	}
+	assertQuota := func(t *testing.T, cl runtimeclient.Client, cpu, memory string) {
+		quota := &corev1.ResourceQuota{}
+		require.NoError(t, cl.Get(context.TODO(), runtimeclient.ObjectKeyFromObject(newBoundedResourceQuota()), quota))
+		assert.True(t, quota.Spec.Hard["limits.cpu"].Equal(resource.MustParse(cpu)), "limits.cpu: %s", quota.Spec.Hard["limits.cpu"])
+		assert.True(t, quota.Spec.Hard["limits.memory"].Equal(resource.MustParse(memory)), "limits.memory: %s", quota.Spec.Hard["limits.memory"])
+	}
+	assertRecommendations := func(t *testing.T, cl runtimeclient.Client, applied bool) {
+		cm := &corev1.ConfigMap{}
+		require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Namespace: namespaceName, Name: "johnsmith-quota-recommendations"}, cm))
+		assert.Equal(t, spacename, cm.Labels[toolchainv1alpha1.SpaceLabelKey])
+		assert.JSONEq(t, fmt.Sprintf(`[{
+			"kind": "ResourceQuota",
+			"namespace": "johnsmith-dev",
+			"name": "compute",
+			"template": {"limits.cpu": "2", "limits.memory": "4Gi"},
+			"recommended": {"limits.cpu": "2400m", "limits.memory": "1Gi"},
+			"applied": %t
+		}]`, applied), cm.Data["recommendations"])
+	}
+	assertNoRecommendations := func(t *testing.T, cl runtimeclient.Client) {
+		err := cl.Get(context.TODO(), types.NamespacedName{Namespace: namespaceName, Name: "johnsmith-quota-recommendations"}, &corev1.ConfigMap{})
+		assert.True(t, apierrors.IsNotFound(err), "unexpected error: %v", err)
+	}
+	recommendedCondition := recommendationCondition(NSTemplateSetQuotaRecommendedReason,
+		"the recommended values of 1 quota(s) are in the ConfigMap 'toolchain-member/johnsmith-quota-recommendations'")
+	appliedCondition := recommendationCondition(NSTemplateSetQuotaRecommendationAppliedReason,
+		"the recommended values of 1 quota(s) are in the ConfigMap 'toolchain-member/johnsmith-quota-recommendations'")
+
+	t.Run("recommended", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "bounded", withNamespaces("abcde11", "dev"))
+		r, fakeClient := prepareReconcileWithMetrics(t, nsTmplSet, devNS, newBoundedResourceQuota(), podMetrics)
+
+		// when
+		after, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{quotaRecommendation: quotaRecommendationRecommend})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, quotaRecommendationPeriod, after)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(recommendedCondition)
+		assertRecommendations(t, fakeClient, false)
+		assertQuota(t, fakeClient, "2", "4Gi")
+
+		t.Run("not observed again before the end of the period", func(t *testing.T) {
+			// when
+			after, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{quotaRecommendation: quotaRecommendationApply})
+
+			// then
+			require.NoError(t, err)
+			assert.Greater(t, after, quotaRecommendationPeriod-time.Minute)
+			assert.LessOrEqual(t, after, quotaRecommendationPeriod)
+			assertRecommendations(t, fakeClient, false)
+			assertQuota(t, fakeClient, "2", "4Gi")
+		})
+
+		t.Run("removed when disabled", func(t *testing.T) {
+			// when
+			after, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.Zero(t, after)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasNoConditions()
+			assertNoRecommendations(t, fakeClient)
+			assertQuota(t, fakeClient, "2", "4Gi")
+		})
+	})
+
+	t.Run("applied", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "bounded", withNamespaces("abcde11", "dev"))
+		r, fakeClient := prepareReconcileWithMetrics(t, nsTmplSet, devNS, newBoundedResourceQuota(), podMetrics)
+
+		// when
+		_, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{quotaRecommendation: quotaRecommendationApply})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(appliedCondition)
+		assertRecommendations(t, fakeClient, true)
+		assertQuota(t, fakeClient, "2400m", "1Gi")
+
+		t.Run("kept when the template is applied again", func(t *testing.T) {
+			// given
+			tierTemplate, err := r.fetchTierTemplate(context.TODO(), nsTmplSet, devNS.Labels[toolchainv1alpha1.TemplateRefLabelKey])
+			require.NoError(t, err)
+			objs, err := tierTemplate.process(r.Scheme, map[string]string{SpaceName: spacename})
+			require.NoError(t, err)
+
+			// when
+			err = r.status.withAppliedQuotaRecommendations(context.TODO(), nsTmplSet, objs)
+
+			// then
+			require.NoError(t, err)
+			require.Len(t, objs, 2)
+			hard, err := quotaHard(objs[1])
+			require.NoError(t, err)
+			cpu, memory := hard["limits.cpu"], hard["limits.memory"]
+			assert.Equal(t, "2400m", cpu.String())
+			assert.Equal(t, "1Gi", memory.String())
+		})
+
+		t.Run("restored when disabled", func(t *testing.T) {
+			// when
+			_, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasNoConditions()
+			assertNoRecommendations(t, fakeClient)
+			assertQuota(t, fakeClient, "2", "4Gi")
+		})
+	})
+
+	t.Run("no condition without bounded quota", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"))
+		advancedDevNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+		r, fakeClient := prepareReconcileWithMetrics(t, nsTmplSet, advancedDevNS, podMetrics)
+
+		// when
+		after, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{quotaRecommendation: quotaRecommendationRecommend})
+
+		// then
+		require.NoError(t, err)
+		assert.Zero(t, after)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasNoConditions()
+		assertNoRecommendations(t, fakeClient)
+	})
+
+	t.Run("failed with invalid bounds", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "bounded", withNamespaces("abcde12", "dev"))
+		invalidDevNS := newNamespace("bounded", spacename, "dev", withTemplateRefUsingRevision("abcde12"))
+		r, fakeClient := prepareReconcileWithMetrics(t, nsTmplSet, invalidDevNS, newBoundedResourceQuota(), podMetrics)
+
+		// when
+		_, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{quotaRecommendation: quotaRecommendationRecommend})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(toolchainv1alpha1.Condition{
+				Type:    NSTemplateSetQuotaRecommendationConditionType,
+				Status:  corev1.ConditionFalse,
+				Reason:  NSTemplateSetQuotaRecommendationFailedReason,
+				Message: "invalid 'toolchain.dev.openshift.com/quota-max' annotation of the ResourceQuota johnsmith-dev/compute: invalid character 'i' looking for beginning of value",
+			})
+		assertNoRecommendations(t, fakeClient)
+	})
+
+	t.Run("failed without the metrics API", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "bounded", withNamespaces("abcde11", "dev"))
+		r, _, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS, newBoundedResourceQuota())
+
+		// when
+		after, err := r.ensureQuotaRecommendations(context.TODO(), nsTmplSet, nstemplatesetConfig{quotaRecommendation: quotaRecommendationApply})
+
+		// then
+		require.NoError(t, err)
+		assert.Zero(t, after)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(toolchainv1alpha1.Condition{
+				Type:    NSTemplateSetQuotaRecommendationConditionType,
+				Status:  corev1.ConditionFalse,
+				Reason:  NSTemplateSetQuotaRecommendationFailedReason,
+				Message: "the 'metrics.k8s.io/v1beta1' API is not available in the cluster",
+			})
+		assertNoRecommendations(t, fakeClient)
+		assertQuota(t, fakeClient, "2", "4Gi")
+	})
+}
+
+func TestLoadQuotaRecommendationConfig(t *testing.T) {
+	for value, expected := range map[string]string{
+		"recommend": quotaRecommendationRecommend,
+		"apply":     quotaRecommendationApply,
+		"invalid":   "",
+	} {
+		t.Run(value, func(t *testing.T) {
+			// given
+			manager, _ := prepareNamespacesManager(t, newMemberOperatorConfig("toolchain-member", NSTemplateSetConfig{
+				QuotaRecommendation: ptr.To(value),
+			}))
+
+			// when
+			cfg, err := loadConfig(context.TODO(), manager.Client, "toolchain-member", nil)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, expected, cfg.quotaRecommendation)
+		})
+	}
+}
+
+func recommendationCondition(reason, msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    NSTemplateSetQuotaRecommendationConditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: msg,
+	}
+}
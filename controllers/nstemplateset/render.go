@@ -0,0 +1,160 @@
+package nstemplateset
+
+import (
+	"fmt"
+	"strings"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RenderKind is the kind of a TierTemplate, which determines how its objects are processed by the operator
+type RenderKind string
+
+const (
+	// RenderClusterResources renders a template of the cluster resources of a space
+	RenderClusterResources RenderKind = "clusterresources"
+	// RenderNamespace renders a template of a namespace of a space, along with the objects inside of the namespace
+	RenderNamespace RenderKind = "namespace"
+	// RenderSpaceRole renders a template of a space role, for a given user and namespace
+	RenderSpaceRole RenderKind = "spacerole"
+)
+
+// RenderOptions contains the parameters used to render a TierTemplate
+type RenderOptions struct {
+	Kind      RenderKind
+	SpaceName string
+	// Username is the name of the user to render the space role template for
+	Username string
+	// Namespace is the namespace to render the space role template for
+	Namespace string
+	// Features are the feature toggles enabled in the space
+	Features []string
+	// Parameters are the additional parameters of the space role template (see SpaceRoleParametersAnnotationKey)
+	Parameters map[string]string
+	// OperatorNamespace is the namespace of the member operator, which is passed to the OpenShift templates (see MemberOperatorNS)
+	OperatorNamespace string
+	// PodSecurityMinimumLevel is the minimum pod security level of the namespaces in the cluster (if any)
+	PodSecurityMinimumLevel string
+	// AvailableAPIGroups are the API groups available in the cluster. The ClusterResourceQuotas are not rendered if
+	// the `quota.openshift.io` API group is not available: they are replaced with the ResourceQuotas which split their budget
+	// between the Namespaces.
+	AvailableAPIGroups []metav1.APIGroup
+	// Namespaces are the names of the namespaces of the space, to render the ResourceQuotas which split the budget of the
+	// ClusterResourceQuotas when the `quota.openshift.io` API group is not available
+	Namespaces []string
+}
+
+// Render processes the given TierTemplate - or the given TierTemplateRevision of the TierTemplate, if any - with the given options,
+// and returns the objects which the operator would apply for a space. The objects of the disabled features are not returned
+// and the objects are processed and validated the same way as when the operator applies them.
+// It is meant to be used by the tier authors, to render the templates without deploying them to a cluster.
+func Render(scheme *runtime.Scheme, tmpl *toolchainv1alpha1.TierTemplate, ttr *toolchainv1alpha1.TierTemplateRevision, opts RenderOptions) ([]runtimeclient.Object, error) {
+	if opts.SpaceName == "" {
+		return nil, fmt.Errorf("the name of the space is not provided")
+	}
+	if tmpl.Spec.Type == "" {
+		return nil, fmt.Errorf("the type of the template is not provided")
+	}
+	if ttr == nil && opts.OperatorNamespace == "" {
+		return nil, fmt.Errorf("the namespace of the member operator is required to render an OpenShift template")
+	}
+	tierTmpl := &tierTemplate{
+		templateRef:       tmpl.Name,
+		tierName:          tmpl.Spec.TierName,
+		typeName:          tmpl.Spec.Type,
+		template:          tmpl.Spec.Template,
+		ttr:               ttr,
+		operatorNamespace: opts.OperatorNamespace,
+	}
+	// the NSTemplateSet of the space, as far as the processing of the templates is concerned
+	nsTmplSet := &toolchainv1alpha1.NSTemplateSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: opts.SpaceName,
+		},
+		Spec: toolchainv1alpha1.NSTemplateSetSpec{
+			TierName: tmpl.Spec.TierName,
+		},
+	}
+	if len(opts.Features) > 0 {
+		nsTmplSet.Annotations = map[string]string{
+			toolchainv1alpha1.FeatureToggleNameAnnotationKey: strings.Join(opts.Features, ","),
+		}
+	}
+
+	switch opts.Kind {
+	case RenderClusterResources:
+		objs, err := tierTmpl.process(scheme, map[string]string{SpaceName: opts.SpaceName})
+		if err != nil {
+			return nil, err
+		}
+		// the cluster resources manager of the operator, without any connection to a cluster
+		manager := &clusterResourcesManager{
+			statusManager: &statusManager{
+				APIClient: &APIClient{Scheme: scheme, AvailableAPIGroups: opts.AvailableAPIGroups},
+			},
+		}
+		if manager.clusterResourceQuotasSupported() {
+			return enabledObjects(nsTmplSet, objs), nil
+		}
+		namespaces := make([]corev1.Namespace, len(opts.Namespaces))
+		for i, name := range opts.Namespaces {
+			namespaces[i].Name = name
+		}
+		budgets, quotas, err := spaceQuotas(nsTmplSet, objs, namespaces, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(budgets) > 0 && len(namespaces) == 0 {
+			return nil, fmt.Errorf("the namespaces of the space are required to render the quotas of the space without the 'quota.openshift.io' API group")
+		}
+		objs = enabledObjects(nsTmplSet, manager.withoutUnsupportedClusterResourceQuotas(objs))
+		for _, quota := range quotas {
+			objs = append(objs, quota)
+		}
+		return objs, nil
+
+	case RenderNamespace:
+		namespaces, err := namespaceObjects(scheme, nsTmplSet, tierTmpl, opts.PodSecurityMinimumLevel)
+		if err != nil {
+			return nil, err
+		}
+		if len(enabledObjects(nsTmplSet, namespaces)) < len(namespaces) {
+			// the namespace type is disabled, hence the namespace is not created at all
+			return nil, nil
+		}
+		if len(namespaces) != 1 {
+			return nil, fmt.Errorf("the template must contain exactly one namespace, but it contains %d", len(namespaces))
+		}
+		innerObjs, err := innerNamespaceObjects(scheme, nsTmplSet, tierTmpl, namespaces[0])
+		if err != nil {
+			return nil, err
+		}
+		return append(namespaces, innerObjs.enabled()...), nil
+
+	case RenderSpaceRole:
+		if opts.Username == "" || opts.Namespace == "" {
+			return nil, fmt.Errorf("both the username and the namespace are required to render a space role template")
+		}
+		// the claims and the groups of the user are not known, hence they are left empty (as when the user has no UserAccount in the cluster)
+		userParams := userParameters(opts.Username, toolchainv1alpha1.PropagatedClaims{}, nil)
+		return processSpaceRoleTemplate(scheme, tierTmpl, userParams, opts.Parameters, opts.Namespace)
+
+	default:
+		return nil, fmt.Errorf("unknown kind of template '%s'", opts.Kind)
+	}
+}
+
+// enabledObjects returns the given objects, except the ones of the features which are not enabled in the given NSTemplateSet
+func enabledObjects(nsTmplSet *toolchainv1alpha1.NSTemplateSet, objs []runtimeclient.Object) []runtimeclient.Object {
+	enabled := make([]runtimeclient.Object, 0, len(objs))
+	for _, obj := range objs {
+		if shouldCreate(obj, nsTmplSet) {
+			enabled = append(enabled, obj)
+		}
+	}
+	return enabled
+}
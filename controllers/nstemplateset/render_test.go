@@ -0,0 +1,196 @@
+package nstemplateset
+
+import (
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/apis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes/scheme"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRender(t *testing.T) {
+	// given
+	require.NoError(t, apis.AddToScheme(scheme.Scheme))
+	tierTemplates, err := prepareTemplateTiers(serializer.NewCodecFactory(scheme.Scheme).UniversalDeserializer())
+	require.NoError(t, err)
+	getTierTemplate := func(t *testing.T, name string) *toolchainv1alpha1.TierTemplate {
+		for _, tmpl := range tierTemplates {
+			if tmpl.GetName() == name {
+				return tmpl.(*toolchainv1alpha1.TierTemplate)
+			}
+		}
+		require.Failf(t, "TierTemplate not found", name)
+		return nil
+	}
+	namesOf := func(objs []runtimeclient.Object) []string {
+		names := make([]string, len(objs))
+		for i, obj := range objs {
+			names[i] = obj.GetObjectKind().GroupVersionKind().Kind + "/" + obj.GetName()
+		}
+		return names
+	}
+	openShiftAPIGroups := newAPIGroups(newAPIGroup("quota.openshift.io", "v1"))
+
+	t.Run("cluster resources", func(t *testing.T) {
+		// given
+		tmpl := getTierTemplate(t, "advanced-clusterresources-abcde11")
+
+		t.Run("without features", func(t *testing.T) {
+			// when
+			objs, err := Render(scheme.Scheme, tmpl, nil, RenderOptions{Kind: RenderClusterResources, SpaceName: "johnsmith", OperatorNamespace: "toolchain-member-operator", AvailableAPIGroups: openShiftAPIGroups})
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, []string{"ClusterResourceQuota/for-johnsmith", "ClusterRoleBinding/johnsmith-tekton-view", "Idler/johnsmith-dev", "Idler/johnsmith-stage"}, namesOf(objs))
+		})
+
+		t.Run("with features", func(t *testing.T) {
+			// when
+			objs, err := Render(scheme.Scheme, tmpl, nil, RenderOptions{Kind: RenderClusterResources, SpaceName: "johnsmith", Features: []string{"feature-1", "feature-3"},
+				OperatorNamespace: "toolchain-member-operator", AvailableAPIGroups: openShiftAPIGroups})
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, []string{"ClusterResourceQuota/for-johnsmith", "ClusterResourceQuota/feature-1-for-johnsmith", "ClusterResourceQuota/feature-3-for-johnsmith",
+				"ClusterRoleBinding/johnsmith-tekton-view", "Idler/johnsmith-dev", "Idler/johnsmith-stage"}, namesOf(objs))
+		})
+
+		t.Run("with ResourceQuotas instead of ClusterResourceQuotas on vanilla Kubernetes", func(t *testing.T) {
+			// when
+			objs, err := Render(scheme.Scheme, tmpl, nil, RenderOptions{Kind: RenderClusterResources, SpaceName: "johnsmith", OperatorNamespace: "toolchain-member-operator",
+				Namespaces: []string{"johnsmith-dev", "johnsmith-stage"}})
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, []string{"ClusterRoleBinding/johnsmith-tekton-view", "Idler/johnsmith-dev", "Idler/johnsmith-stage",
+				"ResourceQuota/space-quota-for-johnsmith", "ResourceQuota/space-quota-for-johnsmith"}, namesOf(objs))
+			assert.Equal(t, "johnsmith-dev", objs[3].GetNamespace())
+			assert.Equal(t, "johnsmith-stage", objs[4].GetNamespace())
+
+			t.Run("namespaces are required", func(t *testing.T) {
+				// when
+				_, err := Render(scheme.Scheme, tmpl, nil, RenderOptions{Kind: RenderClusterResources, SpaceName: "johnsmith", OperatorNamespace: "toolchain-member-operator"})
+
+				// then
+				require.EqualError(t, err, "the namespaces of the space are required to render the quotas of the space without the 'quota.openshift.io' API group")
+			})
+		})
+	})
+
+	t.Run("namespace", func(t *testing.T) {
+		// when
+		objs, err := Render(scheme.Scheme, getTierTemplate(t, "advanced-dev-abcde11"), nil, RenderOptions{Kind: RenderNamespace, SpaceName: "johnsmith",
+			OperatorNamespace: "toolchain-member-operator", PodSecurityMinimumLevel: "baseline"})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Namespace/johnsmith-dev", "RoleBinding/crtadmin-pods", "Role/exec-pods", "RoleBinding/crtadmin-view"}, namesOf(objs))
+		assert.Equal(t, "baseline", objs[0].GetLabels()[podSecurityEnforceLabelKey])
+		assert.Equal(t, "baseline", objs[0].GetLabels()[podSecurityAuditLabelKey])
+		assert.Equal(t, "baseline", objs[0].GetLabels()[podSecurityWarnLabelKey])
+		for _, obj := range objs[1:] {
+			assert.Equal(t, "johnsmith-dev", obj.GetNamespace())
+		}
+
+		t.Run("namespace of the operator is required", func(t *testing.T) {
+			// when
+			_, err := Render(scheme.Scheme, getTierTemplate(t, "advanced-dev-abcde11"), nil, RenderOptions{Kind: RenderNamespace, SpaceName: "johnsmith"})
+
+			// then
+			require.EqualError(t, err, "the namespace of the member operator is required to render an OpenShift template")
+		})
+	})
+
+	t.Run("namespace isolated by a NetworkPolicy", func(t *testing.T) {
+		// when
+		objs, err := Render(scheme.Scheme, getTierTemplate(t, "isolated-dev-abcde11"), nil, RenderOptions{Kind: RenderNamespace, SpaceName: "johnsmith",
+			OperatorNamespace: "toolchain-member-operator"})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Namespace/johnsmith-dev", "RoleBinding/crtadmin-pods", "NetworkPolicy/allow-same-namespace", "NetworkPolicy/" + SameSpaceNetworkPolicyName}, namesOf(objs))
+
+		t.Run("without the policy allowing the traffic from the same space", func(t *testing.T) {
+			// when
+			objs, err := Render(scheme.Scheme, getTierTemplate(t, "isolated-dev-abcde12"), nil, RenderOptions{Kind: RenderNamespace, SpaceName: "johnsmith",
+				OperatorNamespace: "toolchain-member-operator"})
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Namespace/johnsmith-dev", "RoleBinding/crtadmin-pods", "NetworkPolicy/allow-same-namespace"}, namesOf(objs))
+		})
+	})
+
+	t.Run("space role", func(t *testing.T) {
+		// given
+		tmpl := getTierTemplate(t, "advanced-admin-abcde11")
+
+		// when
+		objs, err := Render(scheme.Scheme, tmpl, nil, RenderOptions{Kind: RenderSpaceRole, SpaceName: "johnsmith", Username: "john", Namespace: "johnsmith-dev",
+			OperatorNamespace: "toolchain-member-operator"})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Role/space-admin", "RoleBinding/john-space-admin"}, namesOf(objs))
+
+		t.Run("username and namespace are required", func(t *testing.T) {
+			// when
+			_, err := Render(scheme.Scheme, tmpl, nil, RenderOptions{Kind: RenderSpaceRole, SpaceName: "johnsmith", OperatorNamespace: "toolchain-member-operator"})
+
+			// then
+			require.EqualError(t, err, "both the username and the namespace are required to render a space role template")
+		})
+	})
+
+	t.Run("tier template revision", func(t *testing.T) {
+		// given
+		ttr := createTestTTR("base-dev-abcde11-ttr", []string{namespaceTemplate, configMapTemplate}, []toolchainv1alpha1.Parameter{
+			{Name: "CONFIG_VALUE", Value: "foo"},
+			{Name: "NAMESPACE", Value: "ns-johnsmith"},
+		})
+		tmpl := &toolchainv1alpha1.TierTemplate{Spec: toolchainv1alpha1.TierTemplateSpec{TierName: "base", Type: "dev"}}
+
+		// when
+		objs, err := Render(scheme.Scheme, tmpl, ttr, RenderOptions{Kind: RenderNamespace, SpaceName: "johnsmith"})
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Namespace/ns-johnsmith", "ConfigMap/config-johnsmith"}, namesOf(objs))
+	})
+
+	t.Run("tier template revision without type", func(t *testing.T) {
+		// given
+		ttr := createTestTTR("base-dev-abcde11-ttr", []string{namespaceTemplate}, nil)
+		tmpl := &toolchainv1alpha1.TierTemplate{Spec: toolchainv1alpha1.TierTemplateSpec{TierName: "base"}}
+
+		// when
+		_, err := Render(scheme.Scheme, tmpl, ttr, RenderOptions{Kind: RenderNamespace, SpaceName: "johnsmith"})
+
+		// then
+		require.EqualError(t, err, "the type of the template is not provided")
+	})
+
+	t.Run("invalid template", func(t *testing.T) {
+		// given
+		ttr := createTestTTR("base-dev-abcde11-ttr", []string{invalidTemplate}, nil)
+		tmpl := &toolchainv1alpha1.TierTemplate{Spec: toolchainv1alpha1.TierTemplateSpec{TierName: "base", Type: "dev"}}
+
+		// when
+		_, err := Render(scheme.Scheme, tmpl, ttr, RenderOptions{Kind: RenderNamespace, SpaceName: "johnsmith"})
+
+		// then
+		require.ErrorContains(t, err, "failed to parse go template")
+	})
+
+	t.Run("unknown kind", func(t *testing.T) {
+		// when
+		_, err := Render(scheme.Scheme, getTierTemplate(t, "advanced-dev-abcde11"), nil, RenderOptions{Kind: "unknown", SpaceName: "johnsmith", OperatorNamespace: "toolchain-member-operator"})
+
+		// then
+		require.EqualError(t, err, "unknown kind of template 'unknown'")
+	})
+}
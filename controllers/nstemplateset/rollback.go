@@ -0,0 +1,339 @@
+package nstemplateset
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	"github.com/codeready-toolchain/toolchain-common/pkg/template"
+	errs "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// NSTemplateSetRolledBackConditionType is the type of the condition set when the update of the NSTemplateSet failed repeatedly
+	// and the space was rolled back to the last applied templates recorded in the status. The space keeps being reconciled against
+	// these templates, and the update is not retried until the templates of the NSTemplateSet change again.
+	NSTemplateSetRolledBackConditionType toolchainv1alpha1.ConditionType = "RolledBack"
+
+	// NSTemplateSetRolledBackReason is the reason of the condition (and of the event) set when the space was rolled back
+	NSTemplateSetRolledBackReason = "RolledBack"
+
+	// updateFailuresAnnotationKey is set on the NSTemplateSets whose update to new templates failed, and contains the record
+	// of the failed attempts (see updateFailures) in JSON
+	updateFailuresAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "update-failures"
+
+	// updateFailureInterval is the minimum interval between two failed update attempts for them to be counted separately, so that
+	// the retries of the controller (with a backoff starting at a few milliseconds) don't reach the rollback threshold right away
+	updateFailureInterval = time.Minute
+)
+
+// updateFailures is the record of the failed attempts to update a space to the templates of its NSTemplateSet
+type updateFailures struct {
+	// Templates are the templates which failed to be applied (see specTemplates)
+	Templates   string      `json:"templates"`
+	Count       int         `json:"count"`
+	LastFailure metav1.Time `json:"lastFailure"`
+	RolledBack  bool        `json:"rolledBack,omitempty"`
+}
+
+// updateFailureTracker keeps track of the failed update attempts of the spaces in an annotation of their NSTemplateSet, so that
+// the record survives the restarts of the operator. The record is reset when the templates of the NSTemplateSet change. Recording a failure
+// triggers another reconcile right away, which is not counted as a separate attempt (see updateFailureInterval).
+type updateFailureTracker struct {
+	now func() time.Time
+}
+
+func newUpdateFailureTracker() *updateFailureTracker {
+	return &updateFailureTracker{
+		now: time.Now,
+	}
+}
+
+// get returns the record of the failed attempts to update the given NSTemplateSet to the current templates of its spec
+func (t *updateFailureTracker) get(nsTmplSet *toolchainv1alpha1.NSTemplateSet) updateFailures {
+	templates := specTemplates(nsTmplSet)
+	failures := updateFailures{}
+	if value, found := nsTmplSet.GetAnnotations()[updateFailuresAnnotationKey]; found {
+		if err := json.Unmarshal([]byte(value), &failures); err != nil {
+			// an invalid record is reset
+			failures = updateFailures{}
+		}
+	}
+	if failures.Templates != templates {
+		// the failures of other templates are not relevant anymore
+		return updateFailures{Templates: templates}
+	}
+	return failures
+}
+
+// recordFailure records a failed update attempt of the given NSTemplateSet and returns the updated record.
+// The attempt is not counted if the previous one failed less than updateFailureInterval ago.
+func (t *updateFailureTracker) recordFailure(ctx context.Context, cl runtimeclient.Client, nsTmplSet *toolchainv1alpha1.NSTemplateSet) (updateFailures, error) {
+	failures := t.get(nsTmplSet)
+	if now := t.now(); failures.Count == 0 || now.Sub(failures.LastFailure.Time) >= updateFailureInterval {
+		failures.Count++
+		failures.LastFailure = metav1.NewTime(now)
+	}
+	return failures, t.record(ctx, cl, nsTmplSet, &failures)
+}
+
+// setRolledBack records that the given NSTemplateSet was rolled back to its last applied templates
+func (t *updateFailureTracker) setRolledBack(ctx context.Context, cl runtimeclient.Client, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+	failures := t.get(nsTmplSet)
+	failures.RolledBack = true
+	return t.record(ctx, cl, nsTmplSet, &failures)
+}
+
+// clear removes the record of the failed update attempts of the given NSTemplateSet
+func (t *updateFailureTracker) clear(ctx context.Context, cl runtimeclient.Client, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+	return t.record(ctx, cl, nsTmplSet, nil)
+}
+
+// record patches the annotation of the given NSTemplateSet with the given record, or removes the annotation if there is no record
+func (t *updateFailureTracker) record(ctx context.Context, cl runtimeclient.Client, nsTmplSet *toolchainv1alpha1.NSTemplateSet, failures *updateFailures) error {
+	var value string
+	if failures != nil {
+		data, err := json.Marshal(failures)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+	if current, found := nsTmplSet.GetAnnotations()[updateFailuresAnnotationKey]; current == value && (found || failures == nil) {
+		return nil
+	}
+	patch := runtimeclient.MergeFrom(nsTmplSet.DeepCopy())
+	annotations := nsTmplSet.GetAnnotations()
+	if failures == nil {
+		delete(annotations, updateFailuresAnnotationKey)
+	} else {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[updateFailuresAnnotationKey] = value
+	}
+	nsTmplSet.SetAnnotations(annotations)
+	if err := cl.Patch(ctx, nsTmplSet, patch); err != nil {
+		return errs.Wrap(err, "failed to record the failed update attempts")
+	}
+	return nil
+}
+
+// specTemplates returns the sorted, comma-separated list of the templateRefs of the cluster resources and namespaces
+// in the spec of the given NSTemplateSet
+func specTemplates(nsTmplSet *toolchainv1alpha1.NSTemplateSet) string {
+	var templateRefs []string
+	if nsTmplSet.Spec.ClusterResources != nil {
+		templateRefs = append(templateRefs, nsTmplSet.Spec.ClusterResources.TemplateRef)
+	}
+	for _, ns := range nsTmplSet.Spec.Namespaces {
+		templateRefs = append(templateRefs, ns.TemplateRef)
+	}
+	slices.Sort(templateRefs)
+	return strings.Join(templateRefs, ",")
+}
+
+// isRolledBack returns true if the space was rolled back to its last applied templates after repeated failures to update it
+// to the current templates of the NSTemplateSet
+func (r *Reconciler) isRolledBack(nsTmplSet *toolchainv1alpha1.NSTemplateSet) bool {
+	return r.updateFailures.get(nsTmplSet).RolledBack
+}
+
+// clearUpdateFailures removes the record of the failed update attempts along with the RolledBack condition (if any)
+func (r *Reconciler) clearUpdateFailures(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+	if err := r.updateFailures.clear(ctx, r.Client, nsTmplSet); err != nil {
+		return err
+	}
+	return r.removeRolledBackCondition(ctx, nsTmplSet)
+}
+
+// removeRolledBackCondition removes the RolledBack condition (if any), e.g. when it was set for older templates of the NSTemplateSet
+func (r *Reconciler) removeRolledBackCondition(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+	if err := r.status.removeStatusCondition(ctx, nsTmplSet, NSTemplateSetRolledBackConditionType); err != nil {
+		return errs.Wrap(err, "failed to remove the RolledBack condition")
+	}
+	return nil
+}
+
+// handleUpdateFailure records a failed attempt to update the space to the current templates of the NSTemplateSet.
+// Once the number of failed attempts (separated by at least updateFailureInterval) reaches the configured threshold, the space is
+// rolled back to the last applied templates recorded in the status, the RolledBack condition is set and an event is emitted.
+// Returns the given error, unless the rollback succeeded.
+//
+// NOTE: the namespaces which were already deleted as part of the failed update (i.e. when their type was removed from the tier) are not restored.
+func (r *Reconciler) handleUpdateFailure(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig, cause error) error {
+	if templatesUpdated(nsTmplSet) {
+		// taken into account to halt the updates of the other spaces (see updateRolloutTracker)
+		r.updateRollout.recordOutcome(nsTmplSet, true)
+	}
+	if !templatesUpdated(nsTmplSet) || cfg.rollbackThreshold <= 0 {
+		// nothing to roll back to, or the rollback is disabled
+		return cause
+	}
+	failures, err := r.updateFailures.recordFailure(ctx, r.Client, nsTmplSet)
+	if err != nil {
+		return errs.Wrapf(err, "failed to record the failed update attempt: %s", cause.Error())
+	}
+	if failures.Count < cfg.rollbackThreshold {
+		return cause
+	}
+
+	log.FromContext(ctx).Info("rolling back to the last applied templates", "failed_attempts", failures.Count)
+	if err := r.clusterResources.rollback(ctx, nsTmplSet, cfg); err != nil {
+		return errs.Wrapf(err, "failed to roll back the cluster resources after %d failed update attempts", failures.Count)
+	}
+	if err := r.namespaces.rollback(ctx, nsTmplSet, cfg); err != nil {
+		return errs.Wrapf(err, "failed to roll back the namespaces after %d failed update attempts", failures.Count)
+	}
+	if err := r.updateFailures.setRolledBack(ctx, r.Client, nsTmplSet); err != nil {
+		return err
+	}
+	r.updateRollout.done(runtimeclient.ObjectKeyFromObject(nsTmplSet))
+	message := fmt.Sprintf("rolled back to the last applied templates after %d failed update attempts: %s", failures.Count, cause.Error())
+	if err := r.status.updateStatusConditions(ctx, nsTmplSet,
+		toolchainv1alpha1.Condition{
+			Type:    toolchainv1alpha1.ConditionReady,
+			Status:  corev1.ConditionFalse,
+			Reason:  toolchainv1alpha1.NSTemplateSetUpdateFailedReason,
+			Message: cause.Error(),
+		},
+		toolchainv1alpha1.Condition{
+			Type:    NSTemplateSetRolledBackConditionType,
+			Status:  corev1.ConditionTrue,
+			Reason:  NSTemplateSetRolledBackReason,
+			Message: message,
+		}); err != nil {
+		return errs.Wrap(err, "failed to set the RolledBack condition")
+	}
+	if r.recorder != nil {
+		r.recorder.Event(nsTmplSet, corev1.EventTypeWarning, NSTemplateSetRolledBackReason, message)
+	}
+	return nil
+}
+
+// ensureRolledBack keeps applying the last applied templates (as recorded in the status) of a space which was rolled back,
+// so that the space is still reconciled (e.g. the objects deleted by the users are restored) until the NSTemplateSet changes again
+func (r *Reconciler) ensureRolledBack(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) error {
+	if oldTemplateRef, newTemplateRef, _ := getOldAndNewTemplateRefsIfChanged(nsTmplSet); oldTemplateRef != "" && oldTemplateRef != newTemplateRef {
+		if err := r.clusterResources.rollback(ctx, nsTmplSet, cfg); err != nil {
+			return err
+		}
+	} else if err := r.clusterResources.ensure(ctx, nsTmplSet, cfg); err != nil {
+		return err
+	}
+	if err := r.namespaces.rollback(ctx, nsTmplSet, cfg); err != nil {
+		return err
+	}
+	_, err := r.spaceRoles.ensure(ctx, nsTmplSet, cfg)
+	return err
+}
+
+// templatesUpdated returns true if some of the templates that were applied for the space (as recorded in the status)
+// differ from the ones in the spec
+func templatesUpdated(nsTmplSet *toolchainv1alpha1.NSTemplateSet) bool {
+	if oldTemplateRef, newTemplateRef, _ := getOldAndNewTemplateRefsIfChanged(nsTmplSet); oldTemplateRef != "" && oldTemplateRef != newTemplateRef {
+		return true
+	}
+	return len(namespacesToRollback(nsTmplSet)) > 0
+}
+
+// namespacesToRollback returns the last applied namespace templates (as recorded in the status) which are no longer in the spec
+func namespacesToRollback(nsTmplSet *toolchainv1alpha1.NSTemplateSet) []toolchainv1alpha1.NSTemplateSetNamespace {
+	var toRollback []toolchainv1alpha1.NSTemplateSetNamespace
+	for _, lastApplied := range nsTmplSet.Status.Namespaces {
+		if !slices.Contains(nsTmplSet.Spec.Namespaces, lastApplied) {
+			toRollback = append(toRollback, lastApplied)
+		}
+	}
+	return toRollback
+}
+
+// rollback re-applies the cluster resources of the last applied template (as recorded in the status) and deletes the resources
+// of the template in the spec that are not part of the last applied one
+func (r *clusterResourcesManager) rollback(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) error {
+	oldTemplateRef, newTemplateRef, _ := getOldAndNewTemplateRefsIfChanged(nsTmplSet)
+	if oldTemplateRef == "" || oldTemplateRef == newTemplateRef {
+		return nil
+	}
+	lastAppliedTierTemplate, lastAppliedObjs, err := r.processTierTemplate(ctx, nsTmplSet, nsTmplSet.Status.ClusterResources)
+	if err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err,
+			"failed to process the template for the last-applied cluster resources with the name '%s'", oldTemplateRef)
+	}
+	_, failedObjs, err := r.processTierTemplate(ctx, nsTmplSet, nsTmplSet.Spec.ClusterResources)
+	if err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err,
+			"failed to process the template for the to-be-applied cluster resources with the name '%s'", newTemplateRef)
+	}
+
+	objectApplier := newObjectApplier(r, nsTmplSet, cfg.unforcedKinds, failedObjs, lastAppliedTierTemplate)
+	for _, obj := range lastAppliedObjs {
+		if err := objectApplier.Apply(ctx, obj); err != nil {
+			return err
+		}
+	}
+	return objectApplier.Cleanup(ctx)
+}
+
+// rollback re-applies the last applied templates (as recorded in the status) in the namespaces, after deleting the objects of
+// the template in the spec that are not part of the last applied one in the namespaces whose template changed in the spec
+func (r *namespacesManager) rollback(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) error {
+	toRollback := namespacesToRollback(nsTmplSet)
+	logger := log.FromContext(ctx)
+	userNamespaces, err := fetchNamespacesByOwner(ctx, r.Client, nsTmplSet.Name)
+	if err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to list namespaces with label owner '%s'", nsTmplSet.Name)
+	}
+	tierTemplatesByType, err := r.getTierTemplatesForAllNamespaces(ctx, nsTmplSet)
+	if err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err,
+			"failed to get TierTemplates for tier '%s'", nsTmplSet.Spec.TierName)
+	}
+	params := map[string]string{
+		SpaceName: nsTmplSet.GetName(),
+	}
+	for _, lastApplied := range nsTmplSet.Status.Namespaces {
+		lastAppliedTierTemplate, err := r.fetchTierTemplate(ctx, nsTmplSet, lastApplied.TemplateRef)
+		if err != nil {
+			return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to retrieve the last applied TierTemplate with name '%s'", lastApplied.TemplateRef)
+		}
+		ns, found := findNamespace(userNamespaces, lastAppliedTierTemplate.typeName)
+		if !found {
+			logger.Info("namespace not found - it cannot be rolled back", "type", lastAppliedTierTemplate.typeName)
+			continue
+		}
+		if slices.Contains(toRollback, lastApplied) {
+			lastAppliedObjs, err := lastAppliedTierTemplate.process(r.Scheme, params, template.RetainAllButNamespaces)
+			if err != nil {
+				return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to process template for TierTemplate with name '%s'", lastApplied.TemplateRef)
+			}
+			// the objects of the template in the spec may have been (partially) applied before the failure
+			for _, tierTemplate := range tierTemplatesByType {
+				if tierTemplate.typeName != lastAppliedTierTemplate.typeName {
+					continue
+				}
+				failedObjs, err := tierTemplate.process(r.Scheme, params, template.RetainAllButNamespaces)
+				if err != nil {
+					return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to process template for TierTemplate with name '%s'", tierTemplate.templateRef)
+				}
+				if err := deleteObsoleteObjects(ctx, r.Client, failedObjs, lastAppliedObjs); err != nil {
+					return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to delete the objects of the failed update in namespace '%s'", ns.Name)
+				}
+			}
+		}
+		if err := r.ensureInnerNamespaceResources(ctx, nsTmplSet, cfg, lastAppliedTierTemplate, &ns); err != nil {
+			return err
+		}
+		logger.Info("namespace rolled back", "namespace", ns.Name, "templateRef", lastApplied.TemplateRef)
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	quotav1 "github.com/openshift/api/quota/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestRollbackClusterResources(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	newUpdatedNSTmplSet := func() *toolchainv1alpha1.NSTemplateSet {
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced",
+			withNamespaces("abcde11", "dev"),
+			withClusterResources("abcde12"),
+			withStatusNamespaces("abcde11", "dev"),
+			withStatusClusterResources("abcde11"),
+			withConditions(Provisioned()))
+		nsTmplSet.Generation = 2
+		return nsTmplSet
+	}
+	prepare := func(t *testing.T, nsTmplSet *toolchainv1alpha1.NSTemplateSet, objs ...runtimeclient.Object) (*Reconciler, *record.FakeRecorder, *quotav1.ClusterResourceQuota) {
+		devNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+		crq := newClusterResourceQuota(spacename, "advanced")
+		crb := newTektonClusterRoleBinding(spacename, "advanced")
+		r, _, fakeClient := prepareReconcile(t, namespaceName, spacename, append(objs, nsTmplSet, devNS, crq, crb,
+			newRole(devNS.Name, "exec-pods", spacename),
+			newRoleBinding(devNS.Name, "crtadmin-pods", spacename),
+			newRoleBinding(devNS.Name, "crtadmin-view", spacename))...)
+		// the obsolete cluster resources cannot be deleted
+		fakeClient.MockDelete = func(ctx context.Context, obj runtimeclient.Object, opts ...runtimeclient.DeleteOption) error {
+			if obj.GetObjectKind().GroupVersionKind().Kind == "ClusterRoleBinding" {
+				return fmt.Errorf("mock error")
+			}
+			return fakeClient.Client.Delete(ctx, obj, opts...)
+		}
+		recorder := record.NewFakeRecorder(10)
+		r.recorder = recorder
+		return r, recorder, crq
+	}
+	req := newReconcileRequest(namespaceName, spacename)
+
+	t.Run("rolled back after repeated failures", func(t *testing.T) {
+		// given
+		r, recorder, crq := prepare(t, newUpdatedNSTmplSet())
+		now := time.Now()
+		r.updateFailures.now = func() time.Time { return now }
+
+		for i := 1; i < 3; i++ {
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.ErrorContains(t, err, "mock error")
+			AssertThatNSTemplateSet(t, namespaceName, spacename, r.Client).
+				HasLastAppliedClusterResourcesTemplateRef("advanced-clusterresources-abcde11")
+			assert.Equal(t, i, r.updateFailures.get(getNSTemplateSet(t, r.Client, req)).Count)
+			AssertThatCluster(t, r.Client).
+				HasResource("for-"+spacename, &quotav1.ClusterResourceQuota{},
+					WithLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-clusterresources-abcde12"))
+			assert.Empty(t, recorder.Events)
+
+			t.Run("retry within the failure interval is not counted", func(t *testing.T) {
+				// given
+				now = now.Add(time.Second)
+
+				// when
+				_, err := r.Reconcile(context.TODO(), req)
+
+				// then
+				require.ErrorContains(t, err, "mock error")
+				assert.Equal(t, i, r.updateFailures.get(getNSTemplateSet(t, r.Client, req)).Count)
+			})
+			now = now.Add(updateFailureInterval)
+		}
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		cause := "failure while syncing cluster resources: failed to delete obsolete object 'johnsmith-tekton-view' of kind 'ClusterRoleBinding' in namespace '': mock error"
+		message := "rolled back to the last applied templates after 3 failed update attempts: " + cause
+		AssertThatNSTemplateSet(t, namespaceName, spacename, r.Client).
+			HasLastAppliedClusterResourcesTemplateRef("advanced-clusterresources-abcde11").
+			HasConditions(UpdateFailed(cause), RolledBack(message))
+		assert.True(t, r.isRolledBack(getNSTemplateSet(t, r.Client, req)))
+		AssertThatCluster(t, r.Client).
+			HasResource(crq.Name, &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-clusterresources-abcde11")).
+			HasResource(spacename+"-tekton-view", &rbacv1.ClusterRoleBinding{})
+		require.Len(t, recorder.Events, 1)
+		assert.Equal(t, "Warning RolledBack "+message, <-recorder.Events)
+
+		t.Run("update not retried but last applied templates still applied", func(t *testing.T) {
+			// given
+			require.NoError(t, r.Client.Delete(context.TODO(), &quotav1.ClusterResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: crq.Name}}))
+
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, r.Client).
+				HasConditions(UpdateFailed(cause), RolledBack(message))
+			AssertThatCluster(t, r.Client).
+				HasResource(crq.Name, &quotav1.ClusterResourceQuota{}, // restored
+					WithLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-clusterresources-abcde11"))
+			assert.Empty(t, recorder.Events)
+		})
+
+		t.Run("update retried once the NSTemplateSet changed", func(t *testing.T) {
+			// given
+			nsTmplSet := &toolchainv1alpha1.NSTemplateSet{}
+			require.NoError(t, r.Client.Get(context.TODO(), req.NamespacedName, nsTmplSet))
+			nsTmplSet.Spec.ClusterResources.TemplateRef = "advanced-clusterresources-abcde11"
+			nsTmplSet.Generation = 3
+			require.NoError(t, r.Client.Update(context.TODO(), nsTmplSet))
+
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, r.Client).
+				HasConditions(Provisioned())
+			assert.NotContains(t, getNSTemplateSet(t, r.Client, req).Annotations, updateFailuresAnnotationKey)
+		})
+	})
+
+	t.Run("rollback disabled", func(t *testing.T) {
+		// given
+		memberConfig := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			RollbackThreshold: ptr.To(0),
+		})
+		r, recorder, crq := prepare(t, newUpdatedNSTmplSet(), memberConfig)
+		now := time.Now()
+		r.updateFailures.now = func() time.Time { return now }
+
+		for i := 0; i < 5; i++ {
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.ErrorContains(t, err, "mock error")
+			now = now.Add(updateFailureInterval)
+		}
+		AssertThatNSTemplateSet(t, namespaceName, spacename, r.Client).
+			HasConditions(UpdateFailed("failed to delete obsolete object 'johnsmith-tekton-view' of kind 'ClusterRoleBinding' in namespace '': mock error"))
+		assert.Zero(t, r.updateFailures.get(getNSTemplateSet(t, r.Client, req)).Count)
+		AssertThatCluster(t, r.Client).
+			HasResource(crq.Name, &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-clusterresources-abcde12"))
+		assert.Empty(t, recorder.Events)
+	})
+
+	t.Run("failures of other templates are not counted", func(t *testing.T) {
+		// given
+		nsTmplSet := newUpdatedNSTmplSet()
+		nsTmplSet.Annotations = map[string]string{
+			updateFailuresAnnotationKey: `{"templates":"advanced-clusterresources-abcde11,advanced-dev-abcde11","count":2,"lastFailure":"2024-01-01T00:00:00Z"}`,
+		}
+		r, recorder, _ := prepare(t, nsTmplSet)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.ErrorContains(t, err, "mock error")
+		assert.Equal(t, 1, r.updateFailures.get(getNSTemplateSet(t, r.Client, req)).Count)
+		assert.Empty(t, recorder.Events)
+	})
+
+	t.Run("still rolled back after a restart of the operator", func(t *testing.T) {
+		// given
+		nsTmplSet := newUpdatedNSTmplSet()
+		nsTmplSet.Annotations = map[string]string{
+			updateFailuresAnnotationKey: `{"templates":"advanced-clusterresources-abcde12,advanced-dev-abcde11","count":3,"lastFailure":"2024-01-01T00:00:00Z","rolledBack":true}`,
+		}
+		nsTmplSet.Status.Conditions = []toolchainv1alpha1.Condition{UpdateFailed("mock error"), RolledBack("rolled back")}
+		r, recorder, crq := prepare(t, nsTmplSet)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, r.Client).
+			HasLastAppliedClusterResourcesTemplateRef("advanced-clusterresources-abcde11").
+			HasConditions(UpdateFailed("mock error"), RolledBack("rolled back"))
+		AssertThatCluster(t, r.Client).
+			HasResource(crq.Name, &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-clusterresources-abcde11"))
+		assert.Empty(t, recorder.Events)
+	})
+
+	t.Run("RolledBack condition of older templates is removed", func(t *testing.T) {
+		// given
+		nsTmplSet := newUpdatedNSTmplSet()
+		nsTmplSet.Spec.ClusterResources.TemplateRef = "advanced-clusterresources-abcde11"
+		nsTmplSet.Status.Conditions = append(nsTmplSet.Status.Conditions, RolledBack("rolled back"))
+		r, _, _ := prepare(t, nsTmplSet)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, r.Client).
+			HasConditions(Provisioned())
+	})
+}
+
+func getNSTemplateSet(t *testing.T, cl runtimeclient.Client, req reconcile.Request) *toolchainv1alpha1.NSTemplateSet {
+	nsTmplSet := &toolchainv1alpha1.NSTemplateSet{}
+	require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, nsTmplSet))
+	return nsTmplSet
+}
+
+func TestRollbackNamespaces(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced",
+		withNamespaces("abcde12", "dev"),
+		withClusterResources("abcde11"),
+		withStatusNamespaces("abcde11", "dev"),
+		withStatusClusterResources("abcde11"),
+		withConditions(Provisioned()))
+	devNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+	memberConfig := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+		RollbackThreshold: ptr.To(1),
+	})
+	r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS, memberConfig,
+		newClusterResourceQuota(spacename, "advanced"),
+		newTektonClusterRoleBinding(spacename, "advanced"),
+		newRole(devNS.Name, "exec-pods", spacename),
+		newRoleBinding(devNS.Name, "crtadmin-pods", spacename),
+		newRoleBinding(devNS.Name, "crtadmin-view", spacename))
+	// the namespace cannot be marked as updated to the new template
+	mockUpdate := fakeClient.MockUpdate
+	fakeClient.MockUpdate = func(ctx context.Context, obj runtimeclient.Object, opts ...runtimeclient.UpdateOption) error {
+		if obj.GetLabels()[toolchainv1alpha1.TemplateRefLabelKey] == "advanced-dev-abcde12" {
+			return fmt.Errorf("mock error")
+		}
+		return mockUpdate(ctx, obj, opts...)
+	}
+	recorder := record.NewFakeRecorder(10)
+	r.recorder = recorder
+
+	// when
+	_, err := r.Reconcile(context.TODO(), req)
+
+	// then
+	require.NoError(t, err)
+	cause := "failed to update namespace 'johnsmith-dev': mock error"
+	AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+		HasNamespaceTemplateRefs("advanced-dev-abcde12").
+		HasStatusNamespaceRevisionsValue([]toolchainv1alpha1.NSTemplateSetNamespace{{TemplateRef: "advanced-dev-abcde11"}}).
+		HasConditions(UpdateFailed(cause), RolledBack("rolled back to the last applied templates after 1 failed update attempts: "+cause))
+	AssertThatNamespace(t, devNS.Name, fakeClient).
+		HasLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-dev-abcde11").
+		HasResource("exec-pods", &rbacv1.Role{}).
+		HasResource("crtadmin-pods", &rbacv1.RoleBinding{}).
+		HasResource("crtadmin-view", &rbacv1.RoleBinding{}) // deleted by the failed update and restored by the rollback
+	assert.Len(t, recorder.Events, 1)
+}
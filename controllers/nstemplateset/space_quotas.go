@@ -0,0 +1,211 @@
+package nstemplateset
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	quotav1 "github.com/openshift/api/quota/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// On the clusters without the `quota.openshift.io` API group (e.g. vanilla Kubernetes), the ClusterResourceQuotas of the cluster resources
+// templates cannot be applied. Instead, the budget of each ClusterResourceQuota (i.e. its `spec.quota.hard`) is split into ResourceQuotas
+// in all the namespaces of the space, named after the ClusterResourceQuota with the spaceQuotaNamePrefix (so that they can't be confused
+// with the ResourceQuotas of the namespace templates). Each namespace gets the amount it already uses plus an equal share of what remains
+// of the budget, and the split is periodically rebalanced based on the usage reported in the status of the ResourceQuotas
+// (see NSTemplateSetConfig.SpaceQuotaRebalancePeriod).
+// Unlike a ClusterResourceQuota, the ResourceQuotas apply to all the namespaces of the space, regardless of the selector.
+const (
+	// spaceQuotaLabelKey is set on the ResourceQuotas enforcing the budget of a space, with the name of the ClusterResourceQuota as the value
+	spaceQuotaLabelKey = toolchainv1alpha1.LabelKeyPrefix + "space-quota"
+
+	// spaceQuotaNamePrefix is the prefix of the names of the ResourceQuotas enforcing the budget of a space
+	spaceQuotaNamePrefix = "space-quota-"
+)
+
+// spaceQuotaName returns the name of the ResourceQuotas enforcing the given budget
+func spaceQuotaName(budget string) string {
+	return spaceQuotaNamePrefix + budget
+}
+
+var clusterResourceQuotaGVK = quotav1.GroupVersion.WithKind("ClusterResourceQuota")
+
+// clusterResourceQuotasSupported returns true if the ClusterResourceQuotas can be applied in the cluster
+func (r *clusterResourcesManager) clusterResourceQuotasSupported() bool {
+	return apiGroupIsPresent(r.AvailableAPIGroups, clusterResourceQuotaGVK)
+}
+
+// withoutUnsupportedClusterResourceQuotas returns the given objects, without the ClusterResourceQuotas if they are not supported in the cluster
+// (in which case they are replaced with ResourceQuotas, see ensureSpaceQuotas)
+func (r *clusterResourcesManager) withoutUnsupportedClusterResourceQuotas(objs []runtimeclient.Object) []runtimeclient.Object {
+	if r.clusterResourceQuotasSupported() {
+		return objs
+	}
+	return slices.DeleteFunc(objs, isClusterResourceQuota)
+}
+
+func isClusterResourceQuota(obj runtimeclient.Object) bool {
+	return obj.GetObjectKind().GroupVersionKind().GroupKind() == clusterResourceQuotaGVK.GroupKind()
+}
+
+// ensureSpaceQuotas splits the budget of the ClusterResourceQuotas of the cluster resources template into ResourceQuotas in the namespaces
+// of the space, when the ClusterResourceQuotas are not supported in the cluster. The ResourceQuotas of the budgets which are not
+// in the template anymore are deleted.
+// Returns `true` if the budgets of the space are enforced with ResourceQuotas, i.e. if they need to be rebalanced periodically.
+func (r *clusterResourcesManager) ensureSpaceQuotas(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) (bool, error) {
+	if r.clusterResourceQuotasSupported() {
+		return false, nil
+	}
+	clusterResourcesObjs, err := r.clusterResourcesObjects(ctx, nsTmplSet)
+	if err != nil {
+		return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusClusterResourcesProvisionFailed, err,
+			"failed to get the quotas of the space")
+	}
+	namespaces, err := fetchNamespacesByOwner(ctx, r.Client, nsTmplSet.GetName())
+	if err != nil {
+		return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusClusterResourcesProvisionFailed, err,
+			"failed to list the namespaces of the space")
+	}
+	namespaces = slices.DeleteFunc(namespaces, func(ns corev1.Namespace) bool {
+		return ns.DeletionTimestamp != nil
+	})
+
+	existing := &corev1.ResourceQuotaList{}
+	if err := r.AllNamespacesClient.List(ctx, existing, listBySpaceLabel(nsTmplSet.GetName()), runtimeclient.HasLabels{spaceQuotaLabelKey}); err != nil {
+		return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusClusterResourcesProvisionFailed, err,
+			"failed to list the quotas of the space")
+	}
+	budgets, quotas, err := spaceQuotas(nsTmplSet, clusterResourcesObjs, namespaces, existing.Items)
+	if err != nil {
+		return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusClusterResourcesProvisionFailed, err,
+			"failed to get the quotas of the space")
+	}
+	for _, quota := range quotas {
+		if err := r.applySpaceQuota(ctx, nsTmplSet, quota, existing.Items, cfg.unforcedKinds); err != nil {
+			return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusClusterResourcesProvisionFailed, err,
+				"failed to apply the quota '%s' in namespace '%s'", quota.Name, quota.Namespace)
+		}
+	}
+	// delete the quotas of the budgets which were removed from the template (as well as the quotas which were named after the budget
+	// without the prefix by the previous versions of the operator)
+	for i := range existing.Items {
+		quota := &existing.Items[i]
+		if quota.Name == spaceQuotaName(quota.Labels[spaceQuotaLabelKey]) && slices.ContainsFunc(budgets, func(budget *quotav1.ClusterResourceQuota) bool {
+			return budget.Name == quota.Labels[spaceQuotaLabelKey]
+		}) {
+			continue
+		}
+		log.FromContext(ctx).Info("deleting obsolete space quota", "namespace", quota.Namespace, "name", quota.Name)
+		if err := r.Client.Delete(ctx, quota); err != nil && !errors.IsNotFound(err) {
+			return false, r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusClusterResourcesProvisionFailed, err,
+				"failed to delete the quota '%s' in namespace '%s'", quota.Name, quota.Namespace)
+		}
+	}
+	return len(budgets) > 0, nil
+}
+
+// clusterResourcesObjects returns the objects of the cluster resources template of the given NSTemplateSet (if any)
+func (r *clusterResourcesManager) clusterResourcesObjects(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) ([]runtimeclient.Object, error) {
+	if nsTmplSet.Spec.ClusterResources == nil || nsTmplSet.Spec.ClusterResources.TemplateRef == "" {
+		return nil, nil
+	}
+	tierTemplate, err := r.fetchTierTemplate(ctx, nsTmplSet, nsTmplSet.Spec.ClusterResources.TemplateRef)
+	if err != nil {
+		return nil, err
+	}
+	return tierTemplate.process(r.Scheme, map[string]string{SpaceName: nsTmplSet.GetName()})
+}
+
+// splitBudget returns the ResourceQuotas enforcing the given budget in the given namespaces. Each namespace gets the amount it already uses
+// (as reported in the status of its existing ResourceQuota) plus an equal share of what remains of the budget. When the namespaces
+// already use more than the budget, they don't get anything more than what they use.
+func splitBudget(budget *quotav1.ClusterResourceQuota, namespaces []corev1.Namespace, existing []corev1.ResourceQuota) []*corev1.ResourceQuota {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	used := make([]corev1.ResourceList, len(namespaces))
+	for i, ns := range namespaces {
+		for _, quota := range existing {
+			if quota.Namespace == ns.Name && quota.Name == spaceQuotaName(budget.Name) {
+				used[i] = quota.Status.Used
+			}
+		}
+	}
+	hard := make([]corev1.ResourceList, len(namespaces))
+	for i := range hard {
+		hard[i] = corev1.ResourceList{}
+	}
+	for name, total := range budget.Spec.Quota.Hard {
+		// the CPU is split in millicores, everything else in units
+		value := func(q resource.Quantity) int64 { return q.Value() }
+		quantity := func(v int64) resource.Quantity { return *resource.NewQuantity(v, total.Format) }
+		if strings.HasSuffix(string(name), "cpu") {
+			value = func(q resource.Quantity) int64 { return q.MilliValue() }
+			quantity = func(v int64) resource.Quantity { return *resource.NewMilliQuantity(v, total.Format) }
+		}
+		remaining := value(total)
+		for i := range namespaces {
+			if q, found := used[i][name]; found {
+				remaining -= value(q)
+			}
+		}
+		remaining = max(remaining, 0)
+		share, extra := remaining/int64(len(namespaces)), remaining%int64(len(namespaces))
+		for i := range namespaces {
+			v := share
+			if int64(i) < extra {
+				v++
+			}
+			if q, found := used[i][name]; found {
+				v += value(q)
+			}
+			hard[i][name] = quantity(v)
+		}
+	}
+
+	quotas := make([]*corev1.ResourceQuota, len(namespaces))
+	for i, ns := range namespaces {
+		quotas[i] = &corev1.ResourceQuota{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: corev1.SchemeGroupVersion.String(),
+				Kind:       "ResourceQuota",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: ns.Name,
+				Name:      spaceQuotaName(budget.Name),
+				Labels: map[string]string{
+					spaceQuotaLabelKey: budget.Name,
+				},
+			},
+			Spec: corev1.ResourceQuotaSpec{
+				Hard:          hard[i],
+				Scopes:        budget.Spec.Quota.Scopes,
+				ScopeSelector: budget.Spec.Quota.ScopeSelector,
+			},
+		}
+	}
+	return quotas
+}
+
+// applySpaceQuota applies the given ResourceQuota, unless the existing one has the same spec
+func (r *clusterResourcesManager) applySpaceQuota(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, quota *corev1.ResourceQuota, existing []corev1.ResourceQuota, unforcedKinds []string) error {
+	for _, e := range existing {
+		if e.Namespace == quota.Namespace && e.Name == quota.Name && equality.Semantic.DeepEqual(e.Spec, quota.Spec) {
+			return nil
+		}
+	}
+	log.FromContext(ctx).Info("applying space quota", "namespace", quota.Namespace, "name", quota.Name, "hard", quota.Spec.Hard)
+	_, err := r.ApplyToolchainObjects(ctx, []runtimeclient.Object{quota}, map[string]string{
+		toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
+		toolchainv1alpha1.SpaceLabelKey:    nsTmplSet.GetName(),
+	}, unforcedKinds)
+	return r.updateStatusFieldConflicts(ctx, nsTmplSet, []runtimeclient.Object{quota}, err)
+}
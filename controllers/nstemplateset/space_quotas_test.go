@@ -0,0 +1,319 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	quotav1 "github.com/openshift/api/quota/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSplitBudget(t *testing.T) {
+	// given
+	budget := &quotav1.ClusterResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "for-johnsmith"},
+		Spec: quotav1.ClusterResourceQuotaSpec{
+			Quota: corev1.ResourceQuotaSpec{
+				Hard: corev1.ResourceList{
+					"limits.cpu":    resource.MustParse("2"),
+					"limits.memory": resource.MustParse("10Gi"),
+					"pods":          resource.MustParse("10"),
+				},
+			},
+		},
+	}
+	namespaces := []corev1.Namespace{
+		{ObjectMeta: metav1.ObjectMeta{Name: "johnsmith-dev"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "johnsmith-stage"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "johnsmith-test"}},
+	}
+	hardOf := func(quotas []*corev1.ResourceQuota, name corev1.ResourceName) []string {
+		values := make([]string, len(quotas))
+		for i, quota := range quotas {
+			q := quota.Spec.Hard[name]
+			values[i] = q.String()
+		}
+		return values
+	}
+
+	t.Run("without usage", func(t *testing.T) {
+		// when
+		quotas := splitBudget(budget, namespaces, nil)
+
+		// then
+		require.Len(t, quotas, 3)
+		for i, quota := range quotas {
+			assert.Equal(t, namespaces[i].Name, quota.Namespace)
+			assert.Equal(t, "space-quota-for-johnsmith", quota.Name)
+			assert.Equal(t, "for-johnsmith", quota.Labels[spaceQuotaLabelKey])
+		}
+		assert.Equal(t, []string{"667m", "667m", "666m"}, hardOf(quotas, "limits.cpu"))
+		assert.Equal(t, []string{"3579139414", "3579139413", "3579139413"}, hardOf(quotas, "limits.memory"))
+		assert.Equal(t, []string{"4", "3", "3"}, hardOf(quotas, "pods"))
+	})
+
+	t.Run("rebalanced based on usage", func(t *testing.T) {
+		// given
+		existing := []corev1.ResourceQuota{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "johnsmith-dev", Name: "space-quota-for-johnsmith"},
+				Status: corev1.ResourceQuotaStatus{
+					Used: corev1.ResourceList{
+						"limits.cpu": resource.MustParse("1100m"),
+						"pods":       resource.MustParse("6"),
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "johnsmith-stage", Name: "space-quota-for-johnsmith"},
+				Status: corev1.ResourceQuotaStatus{
+					Used: corev1.ResourceList{
+						"limits.cpu": resource.MustParse("300m"),
+					},
+				},
+			},
+			{
+				// another quota is ignored
+				ObjectMeta: metav1.ObjectMeta{Namespace: "johnsmith-test", Name: "other"},
+				Status: corev1.ResourceQuotaStatus{
+					Used: corev1.ResourceList{
+						"limits.cpu": resource.MustParse("2"),
+					},
+				},
+			},
+		}
+
+		// when
+		quotas := splitBudget(budget, namespaces, existing)
+
+		// then
+		assert.Equal(t, []string{"1300m", "500m", "200m"}, hardOf(quotas, "limits.cpu"))
+		assert.Equal(t, []string{"8", "1", "1"}, hardOf(quotas, "pods"))
+	})
+
+	t.Run("overcommitted", func(t *testing.T) {
+		// given
+		existing := []corev1.ResourceQuota{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "johnsmith-dev", Name: "space-quota-for-johnsmith"},
+				Status: corev1.ResourceQuotaStatus{
+					Used: corev1.ResourceList{
+						"pods": resource.MustParse("12"),
+					},
+				},
+			},
+		}
+
+		// when
+		quotas := splitBudget(budget, namespaces, existing)
+
+		// then
+		assert.Equal(t, []string{"12", "0", "0"}, hardOf(quotas, "pods"))
+	})
+
+	t.Run("no namespace", func(t *testing.T) {
+		// when
+		quotas := splitBudget(budget, nil, nil)
+
+		// then
+		assert.Empty(t, quotas)
+	})
+}
+
+func TestEnsureSpaceQuotas(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	withoutClusterResourceQuotas := func(apiClient *APIClient) {
+		apiClient.AvailableAPIGroups = newAPIGroups(
+			newAPIGroup("rbac.authorization.k8s.io", "v1"),
+			newAPIGroup("toolchain.dev.openshift.com", "v1alpha1"),
+			newAPIGroup("", "v1"))
+	}
+	devNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+	stageNS := newNamespace("advanced", spacename, "stage", withTemplateRefUsingRevision("abcde11"))
+	getQuota := func(t *testing.T, fakeClient *test.FakeClient, namespace, name string) *corev1.ResourceQuota {
+		quota := &corev1.ResourceQuota{}
+		require.NoError(t, fakeClient.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: name}, quota))
+		return quota
+	}
+
+	t.Run("nothing to do when the ClusterResourceQuotas are supported", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev", "stage"), withClusterResources("abcde11"))
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, devNS, stageNS)
+
+		// when
+		rebalance, err := manager.ensureSpaceQuotas(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		assert.False(t, rebalance)
+		AssertThatNamespace(t, devNS.Name, fakeClient).
+			HasNoResource("space-quota-for-"+spacename, &corev1.ResourceQuota{})
+	})
+
+	t.Run("split between the namespaces when the ClusterResourceQuotas are not supported", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev", "stage"), withClusterResources("abcde11"))
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, devNS, stageNS)
+		withoutClusterResourceQuotas(manager.APIClient)
+
+		// when
+		rebalance, err := manager.ensureSpaceQuotas(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		assert.True(t, rebalance)
+		for _, ns := range []string{devNS.Name, stageNS.Name} {
+			AssertThatNamespace(t, ns, fakeClient).
+				ResourceHasSpaceLabel("space-quota-for-"+spacename, &corev1.ResourceQuota{}, spacename)
+			quota := getQuota(t, fakeClient, ns, spaceQuotaName("for-"+spacename))
+			assert.True(t, quota.Spec.Hard["limits.cpu"].Equal(resource.MustParse("1")))
+			assert.True(t, quota.Spec.Hard["limits.memory"].Equal(resource.MustParse("5Gi")))
+		}
+
+		t.Run("rebalanced based on usage", func(t *testing.T) {
+			// given
+			quota := getQuota(t, fakeClient, devNS.Name, spaceQuotaName("for-"+spacename))
+			quota.Status.Used = corev1.ResourceList{"limits.cpu": resource.MustParse("1500m")}
+			require.NoError(t, fakeClient.Update(context.TODO(), quota))
+
+			// when
+			_, err := manager.ensureSpaceQuotas(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			devQuota := getQuota(t, fakeClient, devNS.Name, spaceQuotaName("for-"+spacename))
+			assert.True(t, devQuota.Spec.Hard["limits.cpu"].Equal(resource.MustParse("1750m")))
+			stageQuota := getQuota(t, fakeClient, stageNS.Name, spaceQuotaName("for-"+spacename))
+			assert.True(t, stageQuota.Spec.Hard["limits.cpu"].Equal(resource.MustParse("250m")))
+		})
+
+		t.Run("deleted when not in the template anymore", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev", "stage"))
+
+			// when
+			rebalance, err := manager.ensureSpaceQuotas(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.False(t, rebalance)
+			for _, ns := range []string{devNS.Name, stageNS.Name} {
+				AssertThatNamespace(t, ns, fakeClient).
+					HasNoResource("space-quota-for-"+spacename, &corev1.ResourceQuota{})
+			}
+		})
+	})
+
+	t.Run("quotas named after the budget are replaced", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		oldQuota := &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: devNS.Name,
+				Name:      "for-" + spacename,
+				Labels: map[string]string{
+					spaceQuotaLabelKey:              "for-" + spacename,
+					toolchainv1alpha1.SpaceLabelKey: spacename,
+				},
+			},
+		}
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, devNS, oldQuota)
+		withoutClusterResourceQuotas(manager.APIClient)
+
+		// when
+		_, err := manager.ensureSpaceQuotas(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNamespace(t, devNS.Name, fakeClient).
+			HasResource("space-quota-for-"+spacename, &corev1.ResourceQuota{}).
+			HasNoResource("for-"+spacename, &corev1.ResourceQuota{})
+	})
+
+	t.Run("enabled features", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"),
+			withNSTemplateSetFeatureAnnotation("feature-1"))
+		manager, fakeClient := prepareClusterResourcesManager(t, nsTmplSet, devNS)
+		withoutClusterResourceQuotas(manager.APIClient)
+
+		// when
+		_, err := manager.ensureSpaceQuotas(context.TODO(), nsTmplSet, nstemplatesetConfig{})
+
+		// then
+		require.NoError(t, err)
+		AssertThatNamespace(t, devNS.Name, fakeClient).
+			HasResource("space-quota-for-"+spacename, &corev1.ResourceQuota{}).
+			HasResource("space-quota-feature-1-for-"+spacename, &corev1.ResourceQuota{}).
+			HasNoResource("space-quota-feature-2-for-"+spacename, &corev1.ResourceQuota{})
+	})
+
+	t.Run("reconcile", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+		withoutClusterResourceQuotas(r.APIClient)
+
+		// when
+		var err error
+		for i := 0; i < 5; i++ {
+			_, err = r.Reconcile(context.TODO(), req)
+			require.NoError(t, err)
+		}
+		res, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, defaultSpaceQuotaRebalancePeriod, res.RequeueAfter)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned())
+		AssertThatCluster(t, fakeClient).
+			HasNoResource("for-"+spacename, &quotav1.ClusterResourceQuota{}).
+			HasResource(spacename+"-tekton-view", &rbacv1.ClusterRoleBinding{})
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).
+			HasResource("space-quota-for-"+spacename, &corev1.ResourceQuota{})
+	})
+
+	t.Run("reconcile without periodic rebalancing", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			SpaceQuotaRebalancePeriod: &metav1.Duration{},
+		}))
+		withoutClusterResourceQuotas(r.APIClient)
+
+		// when
+		var err error
+		for i := 0; i < 5; i++ {
+			_, err = r.Reconcile(context.TODO(), req)
+			require.NoError(t, err)
+		}
+		res, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.Zero(t, res.RequeueAfter)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned())
+		AssertThatCluster(t, fakeClient).
+			HasNoResource("for-"+spacename, &quotav1.ClusterResourceQuota{}).
+			HasResource(spacename+"-tekton-view", &rbacv1.ClusterRoleBinding{})
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).
+			HasResource("space-quota-for-"+spacename, &corev1.ResourceQuota{})
+	})
+}
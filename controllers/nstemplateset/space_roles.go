@@ -4,23 +4,46 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/pkg/errors"
 
+	userv1 "github.com/openshift/api/user/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// SpaceRoleParametersAnnotationKey is the annotation on the NSTemplateSet containing additional parameters of the space role
+// templates for each user, as JSON, e.g. `{"johnsmith": {"EXPIRES_AT": "2026-12-31T00:00:00Z", "REQUESTED_BY": "jane"}}`.
+// These parameters cannot override the ones set by the operator (NAMESPACE, USERNAME, USER_EMAIL, etc.)
+const SpaceRoleParametersAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "space-role-parameters"
+
+// SpaceRoleExpirationsAnnotationKey is the annotation on the NSTemplateSet containing the time at which the space roles of some users
+// expire, as JSON, e.g. `{"johnsmith": "2026-12-31T00:00:00Z"}`. Once the space roles of a user have expired, their objects
+// (e.g. RoleBindings) are removed from the namespaces, until the expiry is changed or the user is removed from the space roles.
+const SpaceRoleExpirationsAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "space-role-expirations"
+
+// reservedSpaceRoleParameters are the parameters of the space role templates which are set by the operator
+var reservedSpaceRoleParameters = []string{MemberOperatorNS, Namespace, Username, SpaceName, UserEmail, UserID, UserAccountID, UserSub, UserGroups}
+
 type spaceRolesManager struct {
 	*statusManager
 }
 
 // ensure ensures that the space roles for the users exist.
 // Returns `true, nil` if something was changed, `false, nil` if nothing changed, `false, err` if an error occurred
-func (r *spaceRolesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) (bool, error) {
+func (r *spaceRolesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) (bool, error) {
 	logger := log.FromContext(ctx).WithValues("nstemplateset_name", nsTmplSet.Name)
 	lctx := log.IntoContext(ctx, logger)
 
@@ -29,42 +52,55 @@ func (r *spaceRolesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1al
 		return false, r.wrapErrorWithStatusUpdate(lctx, nsTmplSet, r.setStatusProvisionFailed, err,
 			"failed to list namespaces for workspace '%s'", nsTmplSet.Name)
 	}
+	// space roles to apply now, i.e., without the ones which have expired
+	spaceRoles, err := activeSpaceRoles(nsTmplSet, time.Now())
+	if err != nil {
+		return false, r.wrapErrorWithStatusUpdateForSpaceRolesFailure(lctx, nsTmplSet, err, "failed to retrieve the expiry of the space roles")
+	}
 	logger.Info("ensuring space roles", "namespace_count", len(nss), "role_count", len(nsTmplSet.Spec.SpaceRoles))
+	// the last applied space roles of the namespaces which do not exist anymore are not needed anymore
+	if err := r.deleteOrphanLastAppliedSpaceRoles(lctx, nsTmplSet, nss); err != nil {
+		return false, r.wrapErrorWithStatusUpdateForSpaceRolesFailure(lctx, nsTmplSet, err, "failed to delete the last applied space roles of the deleted namespaces")
+	}
+	// the parameters of each user are resolved once, for all the namespaces and space roles
+	users := r.newSpaceRoleUsers(nsTmplSet.Namespace)
 	for _, ns := range nss {
 		// space roles previously applied
-		// read annotation to see what was applied last time, so we can compare with the new SpaceRoles and remove all obsolete resources (based on their kind/names)
-		var lastAppliedSpaceRoles []toolchainv1alpha1.NSTemplateSetSpaceRole
-		if currentSpaceRolesAnnotation, exists := ns.Annotations[toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey]; exists && currentSpaceRolesAnnotation != "" {
-			if err := json.Unmarshal([]byte(currentSpaceRolesAnnotation), &lastAppliedSpaceRoles); err != nil {
-				return false, errors.Wrap(err, "unable to decode current space roles in annotation")
-			}
+		// read what was applied last time, so we can compare with the new SpaceRoles and remove all obsolete resources (based on their kind/names)
+		lastAppliedSpaceRoles, migrate, err := r.getLastAppliedSpaceRoles(lctx, nsTmplSet, &ns)
+		if err != nil {
+			return false, r.wrapErrorWithStatusUpdateForSpaceRolesFailure(lctx, nsTmplSet, err, "failed to retrieve last applied space roles")
 		}
 		// compare last-applied vs spec to see if there's anything obsolete
 		// note: we only set the NSTemplateSet status to `provisioning` if there are resource changes,
 		// but for other cases (such as restoring resources deleted by a user), we don't set the NSTemplateSet status to `provisioning`.
-		if !reflect.DeepEqual(nsTmplSet.Spec.SpaceRoles, lastAppliedSpaceRoles) {
+		if !reflect.DeepEqual(spaceRoles, lastAppliedSpaceRoles) {
 			if err := r.setStatusUpdatingIfNotProvisioning(lctx, nsTmplSet); err != nil {
 				return false, err
 			}
 		}
-		lastAppliedSpaceRoleObjs, err := r.getSpaceRolesObjects(lctx, &ns, lastAppliedSpaceRoles)
+		lastAppliedSpaceRoleObjs, err := r.getSpaceRolesObjects(lctx, nsTmplSet, &ns, lastAppliedSpaceRoles, users)
 		if err != nil {
 			return false, r.wrapErrorWithStatusUpdateForSpaceRolesFailure(lctx, nsTmplSet, err, "failed to retrieve last applied space roles")
 		}
 		// space roles to apply now
-		spaceRoleObjs, err := r.getSpaceRolesObjects(lctx, &ns, nsTmplSet.Spec.SpaceRoles)
+		spaceRoleObjs, err := r.getSpaceRolesObjects(lctx, nsTmplSet, &ns, spaceRoles, users)
 		if err != nil {
 			return false, r.wrapErrorWithStatusUpdateForSpaceRolesFailure(lctx, nsTmplSet, err, "failed to retrieve space roles to apply")
 		}
-
 		// labels to apply on all new objects
 		var labels = map[string]string{
 			toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
 			toolchainv1alpha1.SpaceLabelKey:    nsTmplSet.GetName(),
 		}
+		// space role objects are processed for a given namespace, and must stay in this namespace
+		if err := newObjectsValidator(nsTmplSet.GetName(), ns.Name).validate(spaceRoleObjs); err != nil {
+			return false, r.wrapErrorWithStatusUpdate(lctx, nsTmplSet, r.setStatusValidationFailed, err, "invalid space roles for namespace '%s'", ns.Name)
+		}
 		logger.Info("applying space role objects", "count", len(spaceRoleObjs))
 		// create (or update existing) objects based the tier template
-		if _, err = r.ApplyToolchainObjects(lctx, spaceRoleObjs, labels); err != nil {
+		_, err = r.ApplyToolchainObjects(lctx, spaceRoleObjs, labels, cfg.unforcedKinds)
+		if err := r.updateStatusFieldConflicts(lctx, nsTmplSet, spaceRoleObjs, err); err != nil {
 			return false, r.wrapErrorWithStatusUpdate(lctx, nsTmplSet, r.setStatusNamespaceProvisionFailed, err, "failed to provision namespace '%s' with space roles", ns.Name)
 		}
 
@@ -72,24 +108,16 @@ func (r *spaceRolesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1al
 			return false, r.wrapErrorWithStatusUpdate(lctx, nsTmplSet, r.setStatusUpdateFailed, err, "failed to delete redundant objects in namespace '%s'", ns.Name)
 		}
 
-		if !reflect.DeepEqual(nsTmplSet.Spec.SpaceRoles, lastAppliedSpaceRoles) {
-			// store the space roles in an annotation at the namespace level, so we know what was applied and how to deal with
-			// diffs when the space roles are changed (users added or removed, etc.)
-			sr, err := json.Marshal(nsTmplSet.Spec.SpaceRoles)
-			if err != nil {
+		if changed := !reflect.DeepEqual(spaceRoles, lastAppliedSpaceRoles); changed || migrate {
+			// store the space roles in a ConfigMap dedicated to the namespace, so we know what was applied and how to deal with
+			// diffs when the space roles are changed (users added or removed, expired, etc.)
+			if err := r.setLastAppliedSpaceRoles(lctx, nsTmplSet, &ns, spaceRoles); err != nil {
 				return false, r.wrapErrorWithStatusUpdate(lctx, nsTmplSet, r.setStatusProvisionFailed, err,
-					"failed to marshal space roles to update '%s' annotation on namespace", toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
-			}
-			if ns.Annotations == nil {
-				ns.Annotations = map[string]string{}
+					"failed to store the last applied space roles of namespace '%s'", ns.Name)
 			}
-			ns.Annotations[toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey] = string(sr)
-			if err := r.Client.Update(ctx, &ns); err != nil {
-				return false, r.wrapErrorWithStatusUpdate(lctx, nsTmplSet, r.setStatusProvisionFailed, err,
-					"failed to update namespace with '%s' annotation", toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
+			if changed {
+				return true, nil
 			}
-			logger.Info("updated annotation on namespace", toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey, string(sr))
-			return true, nil
 		}
 	}
 	return false, nil
@@ -97,19 +125,24 @@ func (r *spaceRolesManager) ensure(ctx context.Context, nsTmplSet *toolchainv1al
 
 // Get the space role objects from the templates specified in the given `spaceRoles`
 // Returns the objects, or an error if something wrong happened when processing the templates
-func (r *spaceRolesManager) getSpaceRolesObjects(ctx context.Context, ns *corev1.Namespace, spaceRoles []toolchainv1alpha1.NSTemplateSetSpaceRole) ([]runtimeclient.Object, error) {
+func (r *spaceRolesManager) getSpaceRolesObjects(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, ns *corev1.Namespace, spaceRoles []appliedSpaceRole, users *spaceRoleUsers) ([]runtimeclient.Object, error) {
+	additionalParams, err := spaceRoleParameters(nsTmplSet)
+	if err != nil {
+		return nil, err
+	}
 	// store by kind and name
 	spaceRoleObjects := []runtimeclient.Object{}
 	for _, spaceRole := range spaceRoles {
-		tierTemplate, err := getTierTemplate(ctx, r.GetHostClusterClient, spaceRole.TemplateRef)
+		tierTemplate, err := r.fetchTierTemplate(ctx, nsTmplSet, spaceRole.TemplateRef)
 		if err != nil {
 			return nil, err
 		}
 		for _, username := range spaceRole.Usernames {
-			objs, err := tierTemplate.process(r.Scheme, map[string]string{
-				Namespace: ns.Name,
-				Username:  username,
-			})
+			params, err := users.parameters(ctx, username)
+			if err != nil {
+				return nil, err
+			}
+			objs, err := processSpaceRoleTemplate(r.Scheme, tierTemplate, params, additionalParams[username], ns.Name)
 			if err != nil {
 				return nil, fmt.Errorf("failed to process space roles template '%s' for the user '%s' in namespace '%s': %w", spaceRole.TemplateRef, username, ns.Name, err)
 			}
@@ -118,3 +151,298 @@ func (r *spaceRolesManager) getSpaceRolesObjects(ctx context.Context, ns *corev1
 	}
 	return spaceRoleObjects, nil
 }
+
+// processSpaceRoleTemplate processes the given space role template for the given namespace, with the given parameters of the user
+// and the given additional parameters (except the reserved ones, which cannot be overridden)
+func processSpaceRoleTemplate(scheme *runtime.Scheme, tierTemplate *tierTemplate, userParams, additionalParams map[string]string, namespace string) ([]runtimeclient.Object, error) {
+	params := maps.Clone(userParams)
+	for name, value := range additionalParams {
+		if !slices.Contains(reservedSpaceRoleParameters, name) {
+			params[name] = value
+		}
+	}
+	params[Namespace] = namespace
+	return tierTemplate.process(scheme, params)
+}
+
+// spaceRoleUsers resolves the parameters of the space role templates for the users of a space. The UserAccount of each user
+// and the OpenShift Groups are fetched at most once, so that the parameters can be reused for all the namespaces and space roles
+// during a reconcile.
+type spaceRoleUsers struct {
+	client          runtimeclient.Client
+	groupsClient    runtimeclient.Client
+	namespace       string
+	groupsAvailable bool
+	// groups contains the sorted names of the groups of each user, once loaded
+	groups map[string][]string
+	params map[string]map[string]string
+}
+
+func (r *spaceRolesManager) newSpaceRoleUsers(namespace string) *spaceRoleUsers {
+	return &spaceRoleUsers{
+		client:          r.Client,
+		groupsClient:    r.AllNamespacesClient,
+		namespace:       namespace,
+		groupsAvailable: apiGroupIsPresent(r.AvailableAPIGroups, userv1.GroupVersion.WithKind("Group")),
+		params:          map[string]map[string]string{},
+	}
+}
+
+// parameters returns (a copy of) the parameters of the space role templates for the given user, based on the propagated claims
+// of the UserAccount of the user and on the OpenShift Groups the user is a member of. The claims are left empty if the user has
+// no UserAccount in this cluster, and so are the groups if the user.openshift.io API group is not available.
+func (u *spaceRoleUsers) parameters(ctx context.Context, username string) (map[string]string, error) {
+	if params, found := u.params[username]; found {
+		return maps.Clone(params), nil
+	}
+	userAccount := &toolchainv1alpha1.UserAccount{}
+	if err := u.client.Get(ctx, types.NamespacedName{Namespace: u.namespace, Name: username}, userAccount); err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "failed to get the UserAccount of the user '%s'", username)
+	}
+	groups, err := u.groupsOf(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	params := userParameters(username, userAccount.Spec.PropagatedClaims, groups)
+	u.params[username] = params
+	return maps.Clone(params), nil
+}
+
+// userParameters returns the parameters of the space role templates for the given user, with the given claims and groups
+func userParameters(username string, claims toolchainv1alpha1.PropagatedClaims, groups []string) map[string]string {
+	return map[string]string{
+		Username:      username,
+		UserEmail:     claims.Email,
+		UserID:        claims.UserID,
+		UserAccountID: claims.AccountID,
+		UserSub:       claims.Sub,
+		UserGroups:    strings.Join(groups, ","),
+	}
+}
+
+// groupsOf returns the sorted names of the OpenShift Groups the given user is a member of. All the groups are listed only once.
+func (u *spaceRoleUsers) groupsOf(ctx context.Context, username string) ([]string, error) {
+	if !u.groupsAvailable {
+		return nil, nil
+	}
+	if u.groups == nil {
+		groups := &userv1.GroupList{}
+		if err := u.groupsClient.List(ctx, groups); err != nil {
+			return nil, errors.Wrap(err, "failed to list the groups")
+		}
+		u.groups = map[string][]string{}
+		for _, group := range groups.Items {
+			for _, user := range group.Users {
+				u.groups[user] = append(u.groups[user], group.Name)
+			}
+		}
+		for _, names := range u.groups {
+			slices.Sort(names)
+		}
+	}
+	return u.groups[username], nil
+}
+
+// spaceRoleParameters returns the additional parameters of the space role templates, indexed by username
+func spaceRoleParameters(nsTmplSet *toolchainv1alpha1.NSTemplateSet) (map[string]map[string]string, error) {
+	value, found := nsTmplSet.GetAnnotations()[SpaceRoleParametersAnnotationKey]
+	if !found || value == "" {
+		return nil, nil
+	}
+	params := map[string]map[string]string{}
+	if err := json.Unmarshal([]byte(value), &params); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode the '%s' annotation", SpaceRoleParametersAnnotationKey)
+	}
+	return params, nil
+}
+
+// lastAppliedSpaceRolesKey is the key of the space roles (as JSON) in the last-applied space roles ConfigMap of a namespace
+const lastAppliedSpaceRolesKey = "spaceRoles"
+
+// lastAppliedSpaceRolesConfigMapName returns the name of the ConfigMap (in the NSTemplateSet namespace) containing the space roles
+// which were last applied in the given namespace. The ConfigMap is owned by the NSTemplateSet and is not visible to the users.
+func lastAppliedSpaceRolesConfigMapName(namespace string) string {
+	return namespace + "-last-applied-space-roles"
+}
+
+// getLastAppliedSpaceRoles returns the space roles which were last applied in the given namespace. If the ConfigMap does not exist,
+// the space roles are read from the `LastAppliedSpaceRolesAnnotationKey` annotation previously set on the namespace.
+// Also returns `true` if the annotation is still set on the namespace and thus needs to be migrated.
+func (r *spaceRolesManager) getLastAppliedSpaceRoles(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, ns *corev1.Namespace) ([]appliedSpaceRole, bool, error) {
+	annotation, migrate := ns.Annotations[toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey]
+	cm := &corev1.ConfigMap{}
+	var lastApplied string
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: nsTmplSet.Namespace, Name: lastAppliedSpaceRolesConfigMapName(ns.Name)}, cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, false, errors.Wrap(err, "unable to get the last applied space roles")
+		}
+		lastApplied = annotation
+	} else {
+		lastApplied = cm.Data[lastAppliedSpaceRolesKey]
+	}
+	var spaceRoles []appliedSpaceRole
+	if lastApplied != "" {
+		if err := json.Unmarshal([]byte(lastApplied), &spaceRoles); err != nil {
+			return nil, false, errors.Wrap(err, "unable to decode the last applied space roles")
+		}
+	}
+	return spaceRoles, migrate, nil
+}
+
+// setLastAppliedSpaceRoles stores the given space roles in the last-applied space roles ConfigMap of the given namespace,
+// and removes the (deprecated) `LastAppliedSpaceRolesAnnotationKey` annotation from the namespace
+func (r *spaceRolesManager) setLastAppliedSpaceRoles(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, ns *corev1.Namespace, spaceRoles []appliedSpaceRole) error {
+	sr, err := json.Marshal(spaceRoles)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal space roles")
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: nsTmplSet.Namespace,
+			Name:      lastAppliedSpaceRolesConfigMapName(ns.Name),
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		if cm.Labels == nil {
+			cm.Labels = map[string]string{}
+		}
+		cm.Labels[toolchainv1alpha1.ProviderLabelKey] = toolchainv1alpha1.ProviderLabelValue
+		cm.Labels[toolchainv1alpha1.SpaceLabelKey] = nsTmplSet.GetName()
+		cm.Data = map[string]string{
+			lastAppliedSpaceRolesKey: string(sr),
+		}
+		return controllerutil.SetControllerReference(nsTmplSet, cm, r.Scheme)
+	}); err != nil {
+		return err
+	}
+	log.FromContext(ctx).Info("updated the last applied space roles", "namespace", ns.Name)
+
+	if _, found := ns.Annotations[toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey]; found {
+		delete(ns.Annotations, toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
+		if err := r.Client.Update(ctx, ns); err != nil {
+			return errors.Wrapf(err, "failed to remove the '%s' annotation from the namespace", toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
+		}
+		log.FromContext(ctx).Info("migrated the last applied space roles from the namespace annotation", "namespace", ns.Name)
+	}
+	return nil
+}
+
+// deleteLastAppliedSpaceRoles deletes the last-applied space roles ConfigMap of the given namespace, if it exists
+func deleteLastAppliedSpaceRoles(ctx context.Context, cl runtimeclient.Client, nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespace string) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: nsTmplSet.Namespace,
+			Name:      lastAppliedSpaceRolesConfigMapName(namespace),
+		},
+	}
+	if err := cl.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete the last applied space roles of the namespace '%s'", namespace)
+	}
+	return nil
+}
+
+// deleteOrphanLastAppliedSpaceRoles deletes the last-applied space roles ConfigMaps of the space whose namespace is not among
+// the given ones, e.g. because the namespace was deleted before its ConfigMap could be deleted along with it
+func (r *spaceRolesManager) deleteOrphanLastAppliedSpaceRoles(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, nss []corev1.Namespace) error {
+	cms := &corev1.ConfigMapList{}
+	if err := r.Client.List(ctx, cms, runtimeclient.InNamespace(nsTmplSet.Namespace), listBySpaceLabel(nsTmplSet.GetName())); err != nil {
+		return errors.Wrap(err, "failed to list the last applied space roles")
+	}
+	for _, cm := range cms.Items {
+		namespace, isLastApplied := strings.CutSuffix(cm.Name, lastAppliedSpaceRolesConfigMapName(""))
+		if !isLastApplied || slices.ContainsFunc(nss, func(ns corev1.Namespace) bool { return ns.Name == namespace }) {
+			continue
+		}
+		if err := deleteLastAppliedSpaceRoles(ctx, r.Client, nsTmplSet, namespace); err != nil {
+			return err
+		}
+		log.FromContext(ctx).Info("deleted the last applied space roles of a deleted namespace", "namespace", namespace)
+	}
+	return nil
+}
+
+// appliedSpaceRole is a space role as stored in the last-applied space roles ConfigMap of a namespace.
+// It is compatible with the NSTemplateSetSpaceRole type, with the (optional) expiry of the space role for each user.
+type appliedSpaceRole struct {
+	TemplateRef string            `json:"templateRef"`
+	Usernames   []string          `json:"usernames"`
+	Expirations map[string]string `json:"expirations,omitempty"`
+}
+
+// activeSpaceRoles returns the space roles of the NSTemplateSet without the users whose space roles have expired at the given time
+func activeSpaceRoles(nsTmplSet *toolchainv1alpha1.NSTemplateSet, now time.Time) ([]appliedSpaceRole, error) {
+	expirations, err := spaceRoleExpirations(nsTmplSet)
+	if err != nil {
+		return nil, err
+	}
+	var spaceRoles []appliedSpaceRole
+	for _, spaceRole := range nsTmplSet.Spec.SpaceRoles {
+		active := appliedSpaceRole{
+			TemplateRef: spaceRole.TemplateRef,
+			Usernames:   spaceRole.Usernames,
+		}
+		for _, username := range spaceRole.Usernames {
+			expiry, found := expirations[username]
+			if !found {
+				continue
+			}
+			if !expiry.After(now) {
+				// the space role of the user has expired
+				active.Usernames = slices.DeleteFunc(slices.Clone(active.Usernames), func(u string) bool {
+					return u == username
+				})
+				continue
+			}
+			if active.Expirations == nil {
+				active.Expirations = map[string]string{}
+			}
+			active.Expirations[username] = expiry.UTC().Format(time.RFC3339)
+		}
+		spaceRoles = append(spaceRoles, active)
+	}
+	return spaceRoles, nil
+}
+
+// nextSpaceRoleExpiry returns the duration until the next expiry of the space role of a user (after the given time), if any
+func nextSpaceRoleExpiry(nsTmplSet *toolchainv1alpha1.NSTemplateSet, now time.Time) (time.Duration, bool) {
+	expirations, err := spaceRoleExpirations(nsTmplSet)
+	if err != nil {
+		return 0, false // already reported when ensuring the space roles
+	}
+	var next time.Duration
+	found := false
+	for _, spaceRole := range nsTmplSet.Spec.SpaceRoles {
+		for _, username := range spaceRole.Usernames {
+			expiry, exists := expirations[username]
+			if !exists || !expiry.After(now) {
+				continue
+			}
+			if after := expiry.Sub(now); !found || after < next {
+				next = after
+				found = true
+			}
+		}
+	}
+	return next, found
+}
+
+// spaceRoleExpirations returns the expiry of the space roles, indexed by username
+func spaceRoleExpirations(nsTmplSet *toolchainv1alpha1.NSTemplateSet) (map[string]time.Time, error) {
+	value, found := nsTmplSet.GetAnnotations()[SpaceRoleExpirationsAnnotationKey]
+	if !found || value == "" {
+		return nil, nil
+	}
+	expirations := map[string]string{}
+	if err := json.Unmarshal([]byte(value), &expirations); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode the '%s' annotation", SpaceRoleExpirationsAnnotationKey)
+	}
+	result := make(map[string]time.Time, len(expirations))
+	for username, expiry := range expirations {
+		t, err := time.Parse(time.RFC3339, expiry)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid expiry of the space roles of the user '%s'", username)
+		}
+		result[username] = t
+	}
+	return result, nil
+}
@@ -6,14 +6,19 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	. "github.com/codeready-toolchain/member-operator/test"
 	commontest "github.com/codeready-toolchain/toolchain-common/pkg/test"
 
+	userv1 "github.com/openshift/api/user/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -41,7 +46,7 @@ func TestEnsureSpaceRoles(t *testing.T) {
 			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
 
 			// when
-			createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet)
+			createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.NoError(t, err)
@@ -74,11 +79,12 @@ func TestEnsureSpaceRoles(t *testing.T) {
 				Exists(). // created
 				HasLabel(toolchainv1alpha1.ProviderLabelKey, toolchainv1alpha1.ProviderLabelValue).
 				HasLabel(toolchainv1alpha1.SpaceLabelKey, nsTmplSet.GetName())
-			// also verify that the `last-applied-space-roles` annotation was set on namespace
+			// also verify that the last applied space roles were stored in a ConfigMap, not on the namespace
 			lastApplied, err := json.Marshal(nsTmplSet.Spec.SpaceRoles)
 			require.NoError(t, err)
+			assertLastAppliedSpaceRoles(t, memberClient, nsTmplSet, "oddity-appstudio", string(lastApplied))
 			AssertThatNamespace(t, "oddity-appstudio", memberClient.Client).
-				HasAnnotation(toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey, string(lastApplied))
+				HasNoAnnotation(toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
 
 			t.Run("remove admin role and rolebindings", func(t *testing.T) {
 				// given
@@ -89,7 +95,7 @@ func TestEnsureSpaceRoles(t *testing.T) {
 					},
 				}
 				// when
-				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet) // precreate the resources for the initial set of SpaceRoles
+				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{}) // precreate the resources for the initial set of SpaceRoles
 
 				// then
 				require.NoError(t, err)
@@ -121,13 +127,13 @@ func TestEnsureSpaceRoles(t *testing.T) {
 					withTemplateRefUsingRevision("abcde10"), // starting with an older revision
 				)
 				mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
-				_, err := mgr.ensure(ctx, nsTmplSet) // precreate the resources for the initial set of SpaceRoles
+				_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{}) // precreate the resources for the initial set of SpaceRoles
 				require.NoError(t, err)
 				// add `user3` in admin space roles
 				nsTmplSet.Spec.SpaceRoles[0].Usernames = append(nsTmplSet.Spec.SpaceRoles[0].Usernames, "user3")
 
 				// when
-				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet)
+				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 				// then
 				require.NoError(t, err)
@@ -152,14 +158,14 @@ func TestEnsureSpaceRoles(t *testing.T) {
 					withTemplateRefUsingRevision("abcde10"), // starting with an older revision
 				)
 				mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
-				_, err := mgr.ensure(ctx, nsTmplSet) // precreate the resources for the initial set of SpaceRoles
+				_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{}) // precreate the resources for the initial set of SpaceRoles
 				require.NoError(t, err)
 
 				// remove `user1` from admin space roles
 				nsTmplSet.Spec.SpaceRoles[0].Usernames = []string{"user2"}
 
 				// when
-				changed, err := mgr.ensure(ctx, nsTmplSet)
+				changed, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 				// then
 				require.NoError(t, err)
@@ -183,11 +189,11 @@ func TestEnsureSpaceRoles(t *testing.T) {
 					withTemplateRefUsingRevision("abcde11"),
 				)
 				mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
-				_, err := mgr.ensure(ctx, nsTmplSet) // precreate the resources for the initial set of SpaceRoles
+				_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{}) // precreate the resources for the initial set of SpaceRoles
 				require.NoError(t, err)
 
 				// when calling without any change in the NSTemplateSet vs existing resources
-				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet)
+				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 				require.NoError(t, err)
 
 				// at this point, the NSTemplateSet is still in `updating` state
@@ -201,6 +207,276 @@ func TestEnsureSpaceRoles(t *testing.T) {
 			})
 		})
 
+		t.Run("with user parameters", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-contributor-abcde11": {"user1", "user2"},
+				}))
+			nsTmplSet.Annotations = map[string]string{
+				SpaceRoleParametersAnnotationKey: `{"user1": {"EXPIRES_AT": "2026-12-31T00:00:00Z", "USER_EMAIL": "ignored@redhat.com"}}`,
+			}
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio")
+			userAccount := &toolchainv1alpha1.UserAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: commontest.MemberOperatorNs,
+					Name:      "user1",
+				},
+				Spec: toolchainv1alpha1.UserAccountSpec{
+					PropagatedClaims: toolchainv1alpha1.PropagatedClaims{
+						Email: "user1@redhat.com",
+					},
+				},
+			}
+			developers := &userv1.Group{
+				ObjectMeta: metav1.ObjectMeta{Name: "developers"},
+				Users:      userv1.OptionalNames{"user1", "user3"},
+			}
+			admins := &userv1.Group{
+				ObjectMeta: metav1.ObjectMeta{Name: "admins"},
+				Users:      userv1.OptionalNames{"user1"},
+			}
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns, userAccount, developers, admins)
+			mgr.AvailableAPIGroups = append(mgr.AvailableAPIGroups, newAPIGroup("user.openshift.io", "v1"))
+
+			// when
+			createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			// parameters from the UserAccount, the groups and the annotation on the NSTemplateSet
+			AssertThatRoleBinding(t, "oddity-appstudio", "user1-space-contributor", memberClient).
+				HasAnnotation("example.com/email", "user1@redhat.com").
+				HasAnnotation("example.com/groups", "admins,developers").
+				HasAnnotation("example.com/expires-at", "2026-12-31T00:00:00Z")
+			// no UserAccount, no group and no additional parameters
+			AssertThatRoleBinding(t, "oddity-appstudio", "user2-space-contributor", memberClient).
+				HasAnnotation("example.com/email", "").
+				HasAnnotation("example.com/groups", "").
+				HasAnnotation("example.com/expires-at", "never")
+
+			t.Run("without the user.openshift.io API group", func(t *testing.T) {
+				// given
+				mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns, userAccount, developers, admins)
+
+				// when
+				_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				AssertThatRoleBinding(t, "oddity-appstudio", "user1-space-contributor", memberClient).
+					HasAnnotation("example.com/email", "user1@redhat.com").
+					HasAnnotation("example.com/groups", "")
+			})
+		})
+
+		t.Run("users are resolved once for all the namespaces and space roles", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-admin-abcde11":  {"user1", "user2"},
+					"appstudio-viewer-abcde11": {"user1"},
+				}))
+			// the space roles were already applied, so the objects are computed for both the last applied and the current space roles
+			dev := newNamespace(nsTmplSet.Spec.TierName, "oddity", "dev", withLastAppliedSpaceRoles(nsTmplSet))
+			stage := newNamespace(nsTmplSet.Spec.TierName, "oddity", "stage", withLastAppliedSpaceRoles(nsTmplSet))
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, dev, stage)
+			mgr.AvailableAPIGroups = append(mgr.AvailableAPIGroups, newAPIGroup("user.openshift.io", "v1"))
+			userAccountGets := map[string]int{}
+			memberClient.MockGet = func(ctx context.Context, key runtimeclient.ObjectKey, obj runtimeclient.Object, opts ...runtimeclient.GetOption) error {
+				if _, ok := obj.(*toolchainv1alpha1.UserAccount); ok {
+					userAccountGets[key.Name]++
+				}
+				return memberClient.Client.Get(ctx, key, obj, opts...)
+			}
+			groupLists := 0
+			memberClient.MockList = func(ctx context.Context, list runtimeclient.ObjectList, opts ...runtimeclient.ListOption) error {
+				if _, ok := list.(*userv1.GroupList); ok {
+					groupLists++
+				}
+				return memberClient.Client.List(ctx, list, opts...)
+			}
+
+			// when
+			_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, map[string]int{"user1": 1, "user2": 1}, userAccountGets)
+			assert.Equal(t, 1, groupLists)
+		})
+
+		t.Run("with expiring space roles", func(t *testing.T) {
+			// given
+			expiry := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-admin-abcde11": {"user1", "user2"},
+				}))
+			nsTmplSet.Annotations = map[string]string{
+				SpaceRoleExpirationsAnnotationKey: fmt.Sprintf(`{"user1": "2026-01-01T00:00:00Z", "user2": "%s"}`, expiry),
+			}
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio")
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
+
+			// when
+			createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			AssertThatRoleBinding(t, "oddity-appstudio", "user1-space-admin", memberClient).DoesNotExist() // expired
+			AssertThatRoleBinding(t, "oddity-appstudio", "user2-space-admin", memberClient).Exists()
+			// the expiry is recorded in the last applied space roles
+			assertLastAppliedSpaceRoles(t, memberClient, nsTmplSet, "oddity-appstudio",
+				fmt.Sprintf(`[{"templateRef":"appstudio-admin-abcde11","usernames":["user2"],"expirations":{"user2":"%s"}}]`, expiry))
+
+			t.Run("remove rolebinding once expired", func(t *testing.T) {
+				// given
+				nsTmplSet.Annotations[SpaceRoleExpirationsAnnotationKey] = `{"user1": "2026-01-01T00:00:00Z", "user2": "2026-01-01T00:00:00Z"}`
+
+				// when
+				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				assert.True(t, createdOrUpdated)
+				AssertThatRoleBinding(t, "oddity-appstudio", "user1-space-admin", memberClient).DoesNotExist()
+				AssertThatRoleBinding(t, "oddity-appstudio", "user2-space-admin", memberClient).DoesNotExist() // deleted
+				assertLastAppliedSpaceRoles(t, memberClient, nsTmplSet, "oddity-appstudio", `[{"templateRef":"appstudio-admin-abcde11","usernames":[]}]`)
+			})
+		})
+
+		t.Run("migrate the last applied space roles from the namespace annotation", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-admin-abcde11": {"user2"},
+				}))
+			previous := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-admin-abcde11": {"user1", "user2"},
+				}))
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio", withLastAppliedSpaceRoles(previous))
+			user1Rb := &rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "oddity-appstudio",
+					Name:      "user1-space-admin",
+				},
+			}
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns, user1Rb)
+
+			// when
+			createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			// the space roles from the annotation were used to find the obsolete objects
+			AssertThatRoleBinding(t, "oddity-appstudio", "user1-space-admin", memberClient).DoesNotExist()
+			AssertThatRoleBinding(t, "oddity-appstudio", "user2-space-admin", memberClient).Exists()
+			assertLastAppliedSpaceRoles(t, memberClient, nsTmplSet, "oddity-appstudio", `[{"templateRef":"appstudio-admin-abcde11","usernames":["user2"]}]`)
+			AssertThatNamespace(t, "oddity-appstudio", memberClient.Client).
+				HasNoAnnotation(toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
+
+			t.Run("no change", func(t *testing.T) {
+				// when
+				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				assert.False(t, createdOrUpdated)
+			})
+		})
+
+		t.Run("migrate without any change in the space roles", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-admin-abcde11": {"user1"},
+				}))
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio", withLastAppliedSpaceRoles(nsTmplSet))
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
+
+			// when
+			createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.False(t, createdOrUpdated)
+			assertLastAppliedSpaceRoles(t, memberClient, nsTmplSet, "oddity-appstudio", `[{"templateRef":"appstudio-admin-abcde11","usernames":["user1"]}]`)
+			AssertThatNamespace(t, "oddity-appstudio", memberClient.Client).
+				HasNoAnnotation(toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
+		})
+
+		t.Run("delete the last applied space roles of the deleted namespaces", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-admin-abcde11": {"user1"},
+				}))
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio", withLastAppliedSpaceRoles(nsTmplSet))
+			orphan := newLastAppliedSpaceRoles(nsTmplSet, "oddity-stage") // the 'stage' namespace was deleted
+			otherSpace := newLastAppliedSpaceRoles(newNSTmplSet(commontest.MemberOperatorNs, "other", "appstudio"), "other-stage")
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns, orphan, otherSpace)
+
+			// when
+			_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			err = memberClient.Get(ctx, runtimeclient.ObjectKeyFromObject(orphan), &corev1.ConfigMap{})
+			require.True(t, apierrors.IsNotFound(err))
+			require.NoError(t, memberClient.Get(ctx, runtimeclient.ObjectKeyFromObject(otherSpace), &corev1.ConfigMap{}))
+			assertLastAppliedSpaceRoles(t, memberClient, nsTmplSet, "oddity-appstudio", `[{"templateRef":"appstudio-admin-abcde11","usernames":["user1"]}]`)
+		})
+
+		t.Run("with hundreds of users", func(t *testing.T) {
+			// given
+			usernames := make([]string, 500)
+			for i := range usernames {
+				usernames[i] = fmt.Sprintf("user%d", i)
+			}
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-viewer-abcde11": usernames,
+				}))
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio")
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
+
+			// when
+			createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.NoError(t, err)
+			assert.True(t, createdOrUpdated)
+			lastApplied, err := json.Marshal(nsTmplSet.Spec.SpaceRoles)
+			require.NoError(t, err)
+			assertLastAppliedSpaceRoles(t, memberClient, nsTmplSet, "oddity-appstudio", string(lastApplied))
+			AssertThatNamespace(t, "oddity-appstudio", memberClient.Client).
+				HasNoAnnotation(toolchainv1alpha1.LastAppliedSpaceRolesAnnotationKey)
+			AssertThatRoleBinding(t, "oddity-appstudio", "user0-space-viewer", memberClient).Exists()
+			AssertThatRoleBinding(t, "oddity-appstudio", "user499-space-viewer", memberClient).Exists()
+
+			t.Run("remove most of the users", func(t *testing.T) {
+				// given
+				nsTmplSet.Spec.SpaceRoles[0].Usernames = usernames[:10]
+
+				// when
+				createdOrUpdated, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.NoError(t, err)
+				assert.True(t, createdOrUpdated)
+				AssertThatRoleBinding(t, "oddity-appstudio", "user9-space-viewer", memberClient).Exists()
+				AssertThatRoleBinding(t, "oddity-appstudio", "user10-space-viewer", memberClient).DoesNotExist()
+				AssertThatRoleBinding(t, "oddity-appstudio", "user499-space-viewer", memberClient).DoesNotExist()
+				rbs := &rbacv1.RoleBindingList{}
+				require.NoError(t, memberClient.List(ctx, rbs, runtimeclient.InNamespace("oddity-appstudio")))
+				assert.Len(t, rbs.Items, 10)
+			})
+		})
 	})
 
 	t.Run("failures", func(t *testing.T) {
@@ -217,7 +493,7 @@ func TestEnsureSpaceRoles(t *testing.T) {
 			}
 
 			// when
-			_, err := mgr.ensure(ctx, nsTmplSet)
+			_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.EqualError(t, err, "failed to list namespaces for workspace 'oddity': mock error")
@@ -237,7 +513,7 @@ func TestEnsureSpaceRoles(t *testing.T) {
 			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "unknown")
 			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
 			// when
-			_, err := mgr.ensure(ctx, nsTmplSet)
+			_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
 
 			// then
 			require.EqualError(t, err, "failed to retrieve space roles to apply: unable to retrieve the TierTemplate 'admin-unknown-abcde11' from 'Host' cluster: tiertemplates.toolchain.dev.openshift.com \"admin-unknown-abcde11\" not found")
@@ -245,9 +521,131 @@ func TestEnsureSpaceRoles(t *testing.T) {
 				HasConditions(UpdateFailed(`unable to retrieve the TierTemplate 'admin-unknown-abcde11' from 'Host' cluster: tiertemplates.toolchain.dev.openshift.com "admin-unknown-abcde11" not found`))
 		})
 
+		t.Run("invalid space role parameters", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-contributor-abcde11": {"user1"},
+				}))
+			nsTmplSet.Annotations = map[string]string{
+				SpaceRoleParametersAnnotationKey: `{"user1": "2026-12-31T00:00:00Z"}`,
+			}
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio")
+			mgr, _ := prepareSpaceRolesManager(t, nsTmplSet, ns)
+
+			// when
+			_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.ErrorContains(t, err, "failed to retrieve last applied space roles: unable to decode the 'toolchain.dev.openshift.com/space-role-parameters' annotation")
+		})
+
+		t.Run("error while getting the UserAccount", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-contributor-abcde11": {"user1"},
+				}))
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio")
+			mgr, memberClient := prepareSpaceRolesManager(t, nsTmplSet, ns)
+			memberClient.MockGet = func(ctx context.Context, key runtimeclient.ObjectKey, obj runtimeclient.Object, opts ...runtimeclient.GetOption) error {
+				if _, ok := obj.(*toolchainv1alpha1.UserAccount); ok {
+					return fmt.Errorf("mock error")
+				}
+				return memberClient.Client.Get(ctx, key, obj, opts...)
+			}
+
+			// when
+			_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.EqualError(t, err, "failed to retrieve space roles to apply: failed to get the UserAccount of the user 'user1': mock error")
+		})
+
+		t.Run("invalid space role expiry", func(t *testing.T) {
+			// given
+			nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+				withSpaceRoles(map[string][]string{
+					"appstudio-admin-abcde11": {"user1"},
+				}))
+			nsTmplSet.Annotations = map[string]string{
+				SpaceRoleExpirationsAnnotationKey: `{"user1": "tomorrow"}`,
+			}
+			ns := newNamespace(nsTmplSet.Spec.TierName, "oddity", "appstudio")
+			mgr, _ := prepareSpaceRolesManager(t, nsTmplSet, ns)
+
+			// when
+			_, err := mgr.ensure(ctx, nsTmplSet, nstemplatesetConfig{})
+
+			// then
+			require.ErrorContains(t, err, "failed to retrieve the expiry of the space roles: invalid expiry of the space roles of the user 'user1'")
+		})
 	})
 }
 
+func TestNextSpaceRoleExpiry(t *testing.T) {
+	// given
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	nsTmplSet := newNSTmplSet(commontest.MemberOperatorNs, "oddity", "appstudio",
+		withSpaceRoles(map[string][]string{
+			"appstudio-admin-abcde11":  {"user1", "user2"},
+			"appstudio-viewer-abcde11": {"user3"},
+		}))
+
+	t.Run("next expiry", func(t *testing.T) {
+		// given
+		nsTmplSet.Annotations = map[string]string{
+			SpaceRoleExpirationsAnnotationKey: `{"user1": "2026-05-01T00:00:00Z", "user2": "2026-06-03T00:00:00Z", "user3": "2026-06-02T00:00:00Z", "unknown": "2026-06-01T01:00:00Z"}`,
+		}
+
+		// when
+		after, found := nextSpaceRoleExpiry(nsTmplSet, now)
+
+		// then
+		assert.True(t, found)
+		assert.Equal(t, 24*time.Hour, after)
+	})
+
+	t.Run("no expiry", func(t *testing.T) {
+		// given
+		nsTmplSet.Annotations = map[string]string{
+			SpaceRoleExpirationsAnnotationKey: `{"user1": "2026-05-01T00:00:00Z"}`,
+		}
+
+		// when
+		_, found := nextSpaceRoleExpiry(nsTmplSet, now)
+
+		// then
+		assert.False(t, found)
+	})
+}
+
+func assertLastAppliedSpaceRoles(t *testing.T, cl runtimeclient.Client, nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespace, expected string) {
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, cl.Get(context.TODO(), runtimeclient.ObjectKey{Namespace: nsTmplSet.Namespace, Name: namespace + "-last-applied-space-roles"}, cm))
+	assert.Equal(t, expected, cm.Data["spaceRoles"])
+	assert.Equal(t, nsTmplSet.Name, cm.Labels[toolchainv1alpha1.SpaceLabelKey])
+	require.Len(t, cm.OwnerReferences, 1)
+	assert.Equal(t, "NSTemplateSet", cm.OwnerReferences[0].Kind)
+	assert.Equal(t, nsTmplSet.Name, cm.OwnerReferences[0].Name)
+}
+
+func newLastAppliedSpaceRoles(nsTmplSet *toolchainv1alpha1.NSTemplateSet, namespace string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: nsTmplSet.Namespace,
+			Name:      namespace + "-last-applied-space-roles",
+			Labels: map[string]string{
+				toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
+				toolchainv1alpha1.SpaceLabelKey:    nsTmplSet.Name,
+			},
+		},
+		Data: map[string]string{
+			"spaceRoles": "[]",
+		},
+	}
+}
+
 func prepareSpaceRolesManager(t *testing.T, initObjs ...runtimeclient.Object) (*spaceRolesManager, *commontest.FakeClient) {
 	os.Setenv("WATCH_NAMESPACE", commontest.MemberOperatorNs)
 	statusManager, fakeClient := prepareStatusManager(t, initObjs...)
@@ -2,18 +2,55 @@ package nstemplateset
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
 	"slices"
 	"sort"
+	"strings"
 
 	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
 	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
-	"github.com/codeready-toolchain/toolchain-common/pkg/utils"
 	"github.com/google/go-cmp/cmp"
 	errs "github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// NSTemplateSetValidationFailedReason is the reason of the Ready condition when the objects processed from the templates
+// of the NSTemplateSet did not pass the validation
+const NSTemplateSetValidationFailedReason = "ValidationFailed"
+
+const (
+	// NSTemplateSetFieldConflictsConditionType is the type of the condition listing the template objects which were not applied
+	// because some of their fields are owned by other field managers (see NSTemplateSetConfig.UnforcedKinds). These conflicts
+	// don't prevent the NSTemplateSet from being ready.
+	NSTemplateSetFieldConflictsConditionType toolchainv1alpha1.ConditionType = "FieldConflicts"
+
+	// NSTemplateSetFieldConflictsReason is the reason of the FieldConflicts condition
+	NSTemplateSetFieldConflictsReason = "FieldConflicts"
+
+	// NSTemplateSetUnsupportedObjectsConditionType is the type of the condition listing the template objects which were not applied
+	// because their OpenShift API group is not available in the cluster (e.g. on vanilla Kubernetes). These objects don't prevent
+	// the NSTemplateSet from being ready.
+	NSTemplateSetUnsupportedObjectsConditionType toolchainv1alpha1.ConditionType = "UnsupportedObjects"
+
+	// NSTemplateSetUnsupportedObjectsReason is the reason of the UnsupportedObjects condition
+	NSTemplateSetUnsupportedObjectsReason = "UnsupportedObjects"
+
+	// fieldConflictsAnnotationKey is set on the NSTemplateSets and contains the conflicts reported in the FieldConflicts condition,
+	// per object, in JSON
+	fieldConflictsAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "field-conflicts"
+
+	// unsupportedObjectsAnnotationKey is set on the NSTemplateSets and contains the API group versions of the objects reported
+	// in the UnsupportedObjects condition, per object, in JSON
+	unsupportedObjectsAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "unsupported-objects"
+
+	// unsupportedObjectsMessagePrefix is the prefix of the message of the UnsupportedObjects condition
+	unsupportedObjectsMessagePrefix = "objects of API groups which are not available in the cluster: "
+)
+
 type statusManager struct {
 	*APIClient
 }
@@ -81,14 +118,202 @@ func (r *statusManager) updateStatusProvisionedNamespaces(ctx context.Context, n
 }
 
 func (r *statusManager) setStatusReady(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
-	return r.updateStatusConditions(
-		ctx,
-		nsTmplSet,
-		toolchainv1alpha1.Condition{
+	// all the enabled features referenced by the templates were applied along with the rest of the templates
+	features, err := r.enabledTemplateFeatures(ctx, nsTmplSet)
+	if err != nil {
+		return err
+	}
+	conditions, removed := withoutDisabledFeatureToggleConditions(nsTmplSet.Status.Conditions, features)
+	newConditions := []toolchainv1alpha1.Condition{
+		{
 			Type:   toolchainv1alpha1.ConditionReady,
 			Status: corev1.ConditionTrue,
 			Reason: toolchainv1alpha1.NSTemplateSetProvisionedReason,
+		},
+	}
+	for _, feature := range features {
+		newConditions = append(newConditions, toolchainv1alpha1.Condition{
+			Type:   featureToggleConditionType(feature),
+			Status: corev1.ConditionTrue,
+			Reason: FeatureToggleAppliedReason,
 		})
+	}
+	var updated bool
+	nsTmplSet.Status.Conditions, updated = condition.AddOrUpdateStatusConditions(conditions, newConditions...)
+	if !updated && !removed {
+		// Nothing changed
+		return nil
+	}
+	return r.Client.Status().Update(ctx, nsTmplSet)
+}
+
+// updateStatusFieldConflicts reports the conflicts of the given applied objects (if any) in the FieldConflicts condition, along with
+// the conflicts previously reported for the other objects, so that the objects which were not applied are not prevented from being
+// ready. The condition is removed once there is no conflict anymore. The given objects which were skipped because their API group
+// is not available in the cluster are reported the same way in the UnsupportedObjects condition.
+// Returns the given error if it is not a FieldConflictsError.
+func (r *statusManager) updateStatusFieldConflicts(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, objs []runtimeclient.Object, err error) error {
+	conflictsErr := &FieldConflictsError{}
+	if err != nil && !errs.As(err, &conflictsErr) {
+		return err
+	}
+	applied := make([]string, 0, len(objs))
+	unsupported := objectEntries{}
+	for _, obj := range objs {
+		applied = append(applied, fieldConflictsObject(obj))
+		if r.unsupportedObject(obj) {
+			unsupported[fieldConflictsObject(obj)] = obj.GetObjectKind().GroupVersionKind().GroupVersion().String()
+		}
+	}
+	if err := r.updateStatusObjectEntries(ctx, nsTmplSet, unsupportedObjectsAnnotationKey, applied, unsupported, toolchainv1alpha1.Condition{
+		Type:   NSTemplateSetUnsupportedObjectsConditionType,
+		Status: corev1.ConditionTrue,
+		Reason: NSTemplateSetUnsupportedObjectsReason,
+	}, unsupportedObjectsMessagePrefix); err != nil {
+		return err
+	}
+	if len(conflictsErr.Conflicts) > 0 {
+		log.FromContext(ctx).Info("some objects were not applied because of conflicts with other field managers", "conflicts", conflictsErr.Conflicts)
+	}
+	return r.updateStatusObjectEntries(ctx, nsTmplSet, fieldConflictsAnnotationKey, applied, conflictsErr.Conflicts, toolchainv1alpha1.Condition{
+		Type:   NSTemplateSetFieldConflictsConditionType,
+		Status: corev1.ConditionTrue,
+		Reason: NSTemplateSetFieldConflictsReason,
+	}, fieldConflictsErrorPrefix)
+}
+
+// updateStatusObjectEntries replaces the entries of the given applied objects with the given new entries in the annotation of the NSTemplateSet
+// with the given key, so that the entries of the other objects are kept. The given condition is then set with a message made of the given prefix
+// followed by all the entries, or is removed if there is no entry anymore.
+func (r *statusManager) updateStatusObjectEntries(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, annotationKey string, applied []string, newEntries objectEntries, cond toolchainv1alpha1.Condition, prefix string) error {
+	entries, err := objectEntriesOf(nsTmplSet, annotationKey)
+	if err != nil {
+		return err
+	}
+	for _, object := range applied {
+		delete(entries, object)
+	}
+	maps.Copy(entries, newEntries)
+	if err := r.recordObjectEntries(ctx, nsTmplSet, annotationKey, entries); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return r.removeStatusCondition(ctx, nsTmplSet, cond.Type)
+	}
+	cond.Message = entries.message(prefix)
+	return r.updateStatusConditions(ctx, nsTmplSet, cond)
+}
+
+// objectEntries contains some details about template objects, per object (see fieldConflictsObject), e.g. the conflicts of the objects
+// which were not applied
+type objectEntries map[string]string
+
+// message returns the given prefix followed by the sorted entries, e.g. `Role 'john-dev/edit' (details)`, separated by `; `
+func (e objectEntries) message(prefix string) string {
+	entries := make([]string, 0, len(e))
+	for object, details := range e {
+		entries = append(entries, fmt.Sprintf("%s (%s)", object, details))
+	}
+	slices.Sort(entries)
+	return prefix + strings.Join(entries, "; ")
+}
+
+// objectEntriesOf returns the entries recorded in the annotation of the given NSTemplateSet with the given key (if any)
+func objectEntriesOf(nsTmplSet *toolchainv1alpha1.NSTemplateSet, annotationKey string) (objectEntries, error) {
+	entries := objectEntries{}
+	if value, found := nsTmplSet.GetAnnotations()[annotationKey]; found {
+		if err := json.Unmarshal([]byte(value), &entries); err != nil {
+			return nil, errs.Wrapf(err, "invalid '%s' annotation of the NSTemplateSet", annotationKey)
+		}
+	}
+	return entries, nil
+}
+
+// recordObjectEntries records the given entries in JSON in the annotation of the given NSTemplateSet with the given key,
+// or removes the annotation if there is no entry
+func (r *statusManager) recordObjectEntries(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, annotationKey string, entries objectEntries) error {
+	var value string
+	if len(entries) > 0 {
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		value = string(data)
+	}
+	if nsTmplSet.GetAnnotations()[annotationKey] == value {
+		return nil
+	}
+	patch := runtimeclient.MergeFrom(nsTmplSet.DeepCopy())
+	annotations := nsTmplSet.GetAnnotations()
+	if value == "" {
+		delete(annotations, annotationKey)
+	} else {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[annotationKey] = value
+	}
+	nsTmplSet.SetAnnotations(annotations)
+	if err := r.Client.Patch(ctx, nsTmplSet, patch); err != nil {
+		return errs.Wrapf(err, "failed to update the '%s' annotation of the NSTemplateSet", annotationKey)
+	}
+	return nil
+}
+
+// removeStatusCondition removes the condition of the given type (if any)
+func (r *statusManager) removeStatusCondition(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, conditionType toolchainv1alpha1.ConditionType) error {
+	if _, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, conditionType); !found {
+		return nil
+	}
+	nsTmplSet.Status.Conditions = slices.DeleteFunc(nsTmplSet.Status.Conditions, func(c toolchainv1alpha1.Condition) bool {
+		return c.Type == conditionType
+	})
+	return r.Client.Status().Update(ctx, nsTmplSet)
+}
+
+// enabledTemplateFeatures returns the sorted list of the features enabled in the NSTemplateSet which are referenced
+// by its cluster resources or namespace templates
+func (r *statusManager) enabledTemplateFeatures(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) ([]string, error) {
+	if len(enabledFeatures(nsTmplSet)) == 0 {
+		return nil, nil
+	}
+	var templateRefs []string
+	if nsTmplSet.Spec.ClusterResources != nil && nsTmplSet.Spec.ClusterResources.TemplateRef != "" {
+		templateRefs = append(templateRefs, nsTmplSet.Spec.ClusterResources.TemplateRef)
+	}
+	for _, ns := range nsTmplSet.Spec.Namespaces {
+		templateRefs = append(templateRefs, ns.TemplateRef)
+	}
+	var features []string
+	for _, templateRef := range templateRefs {
+		tmpl, err := r.fetchTierTemplate(ctx, nsTmplSet, templateRef)
+		if err != nil {
+			return nil, errs.Wrapf(err, "failed to get the TierTemplate '%s'", templateRef)
+		}
+		namespaceFeatures, objectFeatures := templateFeatures(tmpl)
+		features = append(features, namespaceFeatures...)
+		features = append(features, objectFeatures...)
+	}
+	return enabledAmong(nsTmplSet, features), nil
+}
+
+// setStatusFeatureToggleFailed returns a statusUpdater which reports the failure in the condition of the given feature
+// on top of calling the given statusUpdater. If the feature is empty, then the given statusUpdater is returned as-is.
+func (r *statusManager) setStatusFeatureToggleFailed(feature string, updateStatus statusUpdater) statusUpdater {
+	if feature == "" {
+		return updateStatus
+	}
+	return func(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, message string) error {
+		if err := r.updateStatusConditions(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+			Type:    featureToggleConditionType(feature),
+			Status:  corev1.ConditionFalse,
+			Reason:  FeatureToggleFailedReason,
+			Message: message,
+		}); err != nil {
+			return err
+		}
+		return updateStatus(ctx, nsTmplSet, message)
+	}
 }
 
 // updateStatusClusterResourcesRevisions updates the cluster resources and features list in the status of the nstemplateset
@@ -100,18 +325,38 @@ func (r *statusManager) updateStatusClusterResourcesRevisions(ctx context.Contex
 		// the logic could be refactored and transformed in something more generic, that can be reused for namespace scoped resources as well.
 		nsTmplSet.Status.FeatureToggles = featureAnnotation
 		nsTmplSet.Status.ClusterResources = nsTmplSet.Spec.ClusterResources
+		if updateFeatureAnnotation {
+			features, err := r.enabledTemplateFeatures(ctx, nsTmplSet)
+			if err != nil {
+				return err
+			}
+			setStatusFeatureTogglesEnabled(nsTmplSet, features)
+		}
 		return r.Client.Status().Update(ctx, nsTmplSet)
 	}
 	return nil
 }
 
+// setStatusFeatureTogglesEnabled removes the conditions of the features which are not enabled anymore
+// and adds a condition for each newly enabled feature (the conditions of the other features are left untouched)
+func setStatusFeatureTogglesEnabled(nsTmplSet *toolchainv1alpha1.NSTemplateSet, features []string) {
+	conditions, _ := withoutDisabledFeatureToggleConditions(nsTmplSet.Status.Conditions, features)
+	for _, feature := range features {
+		if _, found := condition.FindConditionByType(conditions, featureToggleConditionType(feature)); !found {
+			conditions, _ = condition.AddOrUpdateStatusConditions(conditions, toolchainv1alpha1.Condition{
+				Type:   featureToggleConditionType(feature),
+				Status: corev1.ConditionFalse,
+				Reason: FeatureToggleEnabledReason,
+			})
+		}
+	}
+	nsTmplSet.Status.Conditions = conditions
+}
+
 // featureAnnotationNeedsUpdate checks if the feature annotation has changed on the nstemlpateset compared to what was last time saved in the status
 func featureAnnotationNeedsUpdate(nsTmplSet *toolchainv1alpha1.NSTemplateSet) (bool, []string) {
-	featureAnnotation := nsTmplSet.Annotations[toolchainv1alpha1.FeatureToggleNameAnnotationKey]
-	featureAnnotationList := utils.SplitCommaSeparatedList(featureAnnotation)
-	// sort and deduplicate the list, so that the caller can use the "cleaned up" value
-	slices.Sort(featureAnnotationList)
-	featureAnnotationList = slices.Compact(featureAnnotationList)
+	// use the sorted and deduplicated list, so that the caller can use the "cleaned up" value
+	featureAnnotationList := enabledFeatures(nsTmplSet)
 
 	statusFeatureList := nsTmplSet.Status.FeatureToggles
 
@@ -241,7 +486,24 @@ func (r *statusManager) setStatusSpaceRolesProvisionFailed(ctx context.Context,
 		})
 }
 
+func (r *statusManager) setStatusValidationFailed(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, message string) error {
+	return r.updateStatusConditions(
+		ctx,
+		nsTmplSet,
+		toolchainv1alpha1.Condition{
+			Type:    toolchainv1alpha1.ConditionReady,
+			Status:  corev1.ConditionFalse,
+			Reason:  NSTemplateSetValidationFailedReason,
+			Message: message,
+		})
+}
+
 func (r *statusManager) setStatusTerminating(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
+	if readyCondition, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, toolchainv1alpha1.ConditionReady); found &&
+		readyCondition.Reason == toolchainv1alpha1.NSTemplateSetTerminatingReason {
+		// already terminating: keep the blockers reported in the message (see setStatusTerminatingWithBlockers)
+		return nil
+	}
 	return r.updateStatusConditions(
 		ctx,
 		nsTmplSet,
@@ -252,6 +514,20 @@ func (r *statusManager) setStatusTerminating(ctx context.Context, nsTmplSet *too
 		})
 }
 
+// setStatusTerminatingWithBlockers reports what blocks the termination of the namespaces of the space in the message
+// of the Ready condition (the message is empty if nothing is reported by the namespace controller)
+func (r *statusManager) setStatusTerminatingWithBlockers(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, blockers string) error {
+	return r.updateStatusConditions(
+		ctx,
+		nsTmplSet,
+		toolchainv1alpha1.Condition{
+			Type:    toolchainv1alpha1.ConditionReady,
+			Status:  corev1.ConditionFalse,
+			Reason:  toolchainv1alpha1.NSTemplateSetTerminatingReason,
+			Message: blockers,
+		})
+}
+
 func (r *statusManager) setStatusUpdatingIfNotProvisioning(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) error {
 	readyCondition, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, toolchainv1alpha1.ConditionReady)
 	if found && readyCondition.Reason == toolchainv1alpha1.NSTemplateSetProvisioningReason {
@@ -341,3 +341,75 @@ func TestFeatureAnnotationNeedsUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateStatusFeatureToggles(t *testing.T) {
+	logger := zap.New(zap.UseDevMode(true))
+	log.SetLogger(logger)
+	ctx := log.IntoContext(context.TODO(), logger)
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+
+	t.Run("newly enabled features are reported as enabled", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withClusterResources("abcde11"),
+			withNSTemplateSetFeatureAnnotation("feature-1,feature-2"),
+			withStatusFeatureToggles([]string{"feature-1", "feature-3"}),
+			withConditions(Updating(), FeatureToggleFailed("feature-1", "some error"), FeatureToggleApplied("feature-3")))
+		statusManager, fakeClient := prepareStatusManager(t, nsTmplSet)
+
+		// when
+		err := statusManager.updateStatusClusterResourcesRevisions(ctx, nsTmplSet)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Updating(), FeatureToggleFailed("feature-1", "some error"), FeatureToggleEnabled("feature-2"))
+	})
+
+	t.Run("all enabled features are reported as applied when ready", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withClusterResources("abcde11"),
+			withNSTemplateSetFeatureAnnotation("feature-1,feature-2"),
+			withConditions(Updating(), FeatureToggleFailed("feature-1", "some error"), FeatureToggleEnabled("feature-2"), FeatureToggleApplied("feature-3")))
+		statusManager, fakeClient := prepareStatusManager(t, nsTmplSet)
+
+		// when
+		err := statusManager.setStatusReady(ctx, nsTmplSet)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned(), FeatureToggleApplied("feature-1"), FeatureToggleApplied("feature-2"))
+	})
+
+	t.Run("enabled features which are not referenced by the templates are not reported", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"),
+			withNSTemplateSetFeatureAnnotation("feature-1,feature-4"),
+			withConditions(Updating()))
+		statusManager, fakeClient := prepareStatusManager(t, nsTmplSet)
+
+		// when
+		err := statusManager.setStatusReady(ctx, nsTmplSet)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned(), FeatureToggleApplied("feature-1"))
+	})
+
+	t.Run("conditions of disabled features are removed when ready", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced",
+			withConditions(Provisioned(), FeatureToggleApplied("feature-1")))
+		statusManager, fakeClient := prepareStatusManager(t, nsTmplSet)
+
+		// when
+		err := statusManager.setStatusReady(ctx, nsTmplSet)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned())
+	})
+}
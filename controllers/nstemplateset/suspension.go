@@ -0,0 +1,75 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	errs "github.com/pkg/errors"
+	"github.com/redhat-cop/operator-utils/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// NSTemplateSetSuspendedConditionType is the type of the condition set while the space is suspended, i.e. while the operator
+	// does not apply nor delete any of its resources, so that they can be investigated or fixed by hand.
+	// The condition is removed once the space is resumed.
+	NSTemplateSetSuspendedConditionType toolchainv1alpha1.ConditionType = "Suspended"
+
+	// NSTemplateSetSuspendedReason is the reason of the condition set while the space is suspended
+	NSTemplateSetSuspendedReason = "Suspended"
+
+	// SuspendedAnnotationKey suspends the space when set to "true" on its NSTemplateSet
+	SuspendedAnnotationKey = toolchainv1alpha1.LabelKeyPrefix + "suspended"
+
+	// suspensionRecheckPeriod is the period after which a suspended space is reconciled again, in case its resumption was missed
+	// (the changes of the annotations of the NSTemplateSets and of the MemberOperatorConfig trigger a reconcile anyway)
+	suspensionRecheckPeriod = 10 * time.Minute
+)
+
+// suspensionMessage returns the message of the Suspended condition if the given NSTemplateSet is suspended, either via its own annotation
+// or via the cluster-wide setting in the MemberOperatorConfig. Returns an empty string if the NSTemplateSet is not suspended.
+func suspensionMessage(nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) string {
+	var message string
+	if suspended, _ := strconv.ParseBool(nsTmplSet.GetAnnotations()[SuspendedAnnotationKey]); suspended {
+		message = fmt.Sprintf("the space is suspended via the '%s' annotation of the NSTemplateSet", SuspendedAnnotationKey)
+	} else if cfg.suspended {
+		message = fmt.Sprintf("all spaces are suspended via the '%s' annotation of the MemberOperatorConfig", NSTemplateSetConfigAnnotationKey)
+	} else {
+		return ""
+	}
+	if util.IsBeingDeleted(nsTmplSet) {
+		message += " - the deletion of the space is postponed until it is resumed"
+	}
+	return message
+}
+
+// ensureSuspension sets the Suspended condition and returns true if the given NSTemplateSet is suspended, in which case
+// none of its resources must be applied or deleted (and its finalizer must be kept). Otherwise, it removes the Suspended condition (if any)
+// and returns false.
+func (r *Reconciler) ensureSuspension(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) (bool, error) {
+	message := suspensionMessage(nsTmplSet, cfg)
+	if message == "" {
+		if _, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetSuspendedConditionType); found {
+			log.FromContext(ctx).Info("NSTemplateSet was resumed")
+		}
+		if err := r.status.removeStatusCondition(ctx, nsTmplSet, NSTemplateSetSuspendedConditionType); err != nil {
+			return false, errs.Wrap(err, "failed to remove the Suspended condition")
+		}
+		return false, nil
+	}
+	log.FromContext(ctx).Info("NSTemplateSet is suspended - skipping", "reason", message)
+	if err := r.status.updateStatusConditions(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+		Type:    NSTemplateSetSuspendedConditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  NSTemplateSetSuspendedReason,
+		Message: message,
+	}); err != nil {
+		return true, errs.Wrap(err, "failed to set the Suspended condition")
+	}
+	return true, nil
+}
@@ -0,0 +1,168 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+
+	"fmt"
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	quotav1 "github.com/openshift/api/quota/v1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestSuspension(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	suspendedMsg := "the space is suspended via the 'toolchain.dev.openshift.com/suspended' annotation of the NSTemplateSet"
+	suspendedClusterWideMsg := "all spaces are suspended via the 'toolchain.dev.openshift.com/nstemplateset-config' annotation of the MemberOperatorConfig"
+
+	t.Run("suspended via the NSTemplateSet annotation", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		nsTmplSet.Annotations = map[string]string{SuspendedAnnotationKey: "true"}
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+
+		// when
+		res, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		require.Equal(t, reconcile.Result{RequeueAfter: suspensionRecheckPeriod}, res)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasFinalizer().
+			HasConditions(Suspended(suspendedMsg))
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).DoesNotExist()
+		AssertThatCluster(t, fakeClient).HasNoResource("for-"+spacename, &quotav1.ClusterResourceQuota{})
+
+		t.Run("resumed when the annotation is removed", func(t *testing.T) {
+			// given
+			require.NoError(t, fakeClient.Get(context.TODO(), req.NamespacedName, nsTmplSet))
+			nsTmplSet.Annotations = nil
+			require.NoError(t, fakeClient.Update(context.TODO(), nsTmplSet))
+
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(Provisioning())
+			AssertThatNamespace(t, spacename+"-dev", fakeClient).HasLabel(toolchainv1alpha1.SpaceLabelKey, spacename)
+		})
+	})
+
+	t.Run("failure while removing the Suspended condition", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"),
+			withConditions(Suspended(suspendedMsg)))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+		fakeClient.MockStatusUpdate = func(ctx context.Context, obj runtimeclient.Object, opts ...runtimeclient.SubResourceUpdateOption) error {
+			return fmt.Errorf("mock error")
+		}
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.EqualError(t, err, "failed to remove the Suspended condition: mock error")
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Suspended(suspendedMsg))
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).DoesNotExist()
+	})
+
+	t.Run("not suspended when the annotation is not 'true'", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"))
+		nsTmplSet.Annotations = map[string]string{SuspendedAnnotationKey: "false"}
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).HasLabel(toolchainv1alpha1.SpaceLabelKey, spacename)
+	})
+
+	t.Run("suspended via the MemberOperatorConfig", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"))
+		cfg := newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{Suspended: ptr.To(true)})
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, cfg)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Suspended(suspendedClusterWideMsg))
+		AssertThatNamespace(t, spacename+"-dev", fakeClient).DoesNotExist()
+	})
+
+	t.Run("deletion is postponed while suspended", func(t *testing.T) {
+		// given
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withDeletionTs())
+		nsTmplSet.Annotations = map[string]string{SuspendedAnnotationKey: "true"}
+		devNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasFinalizer().
+			HasConditions(Suspended(suspendedMsg + " - the deletion of the space is postponed until it is resumed"))
+		AssertThatNamespace(t, devNS.Name, fakeClient).
+			HasNoDeletionTimestamp()
+
+		t.Run("deleted once resumed", func(t *testing.T) {
+			// given
+			require.NoError(t, fakeClient.Get(context.TODO(), req.NamespacedName, nsTmplSet))
+			delete(nsTmplSet.Annotations, SuspendedAnnotationKey)
+			require.NoError(t, fakeClient.Update(context.TODO(), nsTmplSet))
+
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(Terminating())
+			AssertThatNamespace(t, devNS.Name, fakeClient).DoesNotExist()
+		})
+	})
+
+	t.Run("annotation value", func(t *testing.T) {
+		for value, expected := range map[string]string{
+			"true":    suspendedMsg,
+			"True":    suspendedMsg,
+			"false":   "",
+			"invalid": "",
+			"":        "",
+		} {
+			t.Run(value, func(t *testing.T) {
+				// given
+				nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced")
+				nsTmplSet.Annotations = map[string]string{SuspendedAnnotationKey: value}
+
+				// when
+				message := suspensionMessage(nsTmplSet, nstemplatesetConfig{})
+
+				// then
+				require.Equal(t, expected, message)
+			})
+		}
+	})
+}
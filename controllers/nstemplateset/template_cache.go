@@ -0,0 +1,128 @@
+package nstemplateset
+
+import (
+	"bytes"
+	"sync"
+	gotemp "text/template"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// maxCachedTierTemplateRevisions is the maximum number of TierTemplateRevisions whose parsed templates are kept in memory.
+// There is usually a handful of revisions per tier, so this limit should never be reached in practice.
+const maxCachedTierTemplateRevisions = 500
+
+// parsedTemplates is the shared cache of the parsed templates of the TierTemplateRevisions.
+var parsedTemplates = newTemplateCache(maxCachedTierTemplateRevisions)
+
+// parsedTemplateObject contains the result of the parsing of a single object of a TierTemplateRevision.
+// Since the errors are reported only when the object is actually processed (e.g. when it is not excluded by a filter),
+// they are kept along with the results.
+type parsedTemplateObject struct {
+	// raw is the raw content of the object, with its Object field populated so that it can be used in filters
+	raw          runtime.RawExtension
+	unmarshalErr error
+	template     *gotemp.Template
+	parseErr     error
+}
+
+// parsedTierTemplateRevision contains the parsed objects of a given version of a TierTemplateRevision
+type parsedTierTemplateRevision struct {
+	resourceVersion string
+	objects         []parsedTemplateObject
+}
+
+// matches returns true if the parsed objects were obtained from the given TierTemplateRevision.
+// On top of the resourceVersion, the raw content of the objects is compared (which is way cheaper than parsing them again)
+// to make sure that an entry is never used for another TierTemplateRevision with the same name and resourceVersion.
+func (p *parsedTierTemplateRevision) matches(ttr *toolchainv1alpha1.TierTemplateRevision) bool {
+	if p.resourceVersion != ttr.ResourceVersion || len(p.objects) != len(ttr.Spec.TemplateObjects) {
+		return false
+	}
+	for i, obj := range ttr.Spec.TemplateObjects {
+		if !bytes.Equal(p.objects[i].raw.Raw, obj.Raw) {
+			return false
+		}
+	}
+	return true
+}
+
+// templateCache keeps the parsed templates of the TierTemplateRevisions, indexed by their namespaced name,
+// so that the (many) spaces referring to the same TierTemplateRevision don't need to parse its templates over and over again.
+// An entry is refreshed as soon as the resourceVersion of the TierTemplateRevision changes.
+type templateCache struct {
+	lock       sync.RWMutex
+	maxEntries int
+	entries    map[types.NamespacedName]*parsedTierTemplateRevision
+}
+
+func newTemplateCache(maxEntries int) *templateCache {
+	return &templateCache{
+		maxEntries: maxEntries,
+		entries:    map[types.NamespacedName]*parsedTierTemplateRevision{},
+	}
+}
+
+// get returns the parsed objects of the given TierTemplateRevision, parsing them only if they are not in the cache yet.
+// TierTemplateRevisions without resourceVersion (i.e., which were not retrieved from the cluster) are never cached.
+func (c *templateCache) get(ttr *toolchainv1alpha1.TierTemplateRevision) []parsedTemplateObject {
+	if ttr.ResourceVersion == "" {
+		return parseTierTemplateRevision(ttr).objects
+	}
+	key := types.NamespacedName{Namespace: ttr.Namespace, Name: ttr.Name}
+
+	c.lock.RLock()
+	entry, found := c.entries[key]
+	c.lock.RUnlock()
+	if found && entry.matches(ttr) {
+		return entry.objects
+	}
+
+	entry = parseTierTemplateRevision(ttr)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, found := c.entries[key]; !found && len(c.entries) >= c.maxEntries {
+		// evict an arbitrary entry to make some room
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[key] = entry
+	return entry.objects
+}
+
+// len returns the number of TierTemplateRevisions in the cache
+func (c *templateCache) len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.entries)
+}
+
+func parseTierTemplateRevision(ttr *toolchainv1alpha1.TierTemplateRevision) *parsedTierTemplateRevision {
+	objects := make([]parsedTemplateObject, len(ttr.Spec.TemplateObjects))
+	for i, rawObj := range ttr.Spec.TemplateObjects {
+		parsed := parsedTemplateObject{
+			raw: runtime.RawExtension{Raw: rawObj.Raw, Object: rawObj.Object},
+		}
+		if parsed.raw.Object == nil {
+			unStruct := &unstructured.Unstructured{}
+			if err := yaml.Unmarshal(rawObj.Raw, unStruct); err != nil {
+				parsed.unmarshalErr = err
+			} else {
+				parsed.raw.Object = unStruct
+			}
+		}
+		parsed.template, parsed.parseErr = gotemp.New(ttr.Name).Option("missingkey=error").Funcs(templateFuncs()).Parse(string(rawObj.Raw))
+		objects[i] = parsed
+	}
+	return &parsedTierTemplateRevision{
+		resourceVersion: ttr.ResourceVersion,
+		objects:         objects,
+	}
+}
@@ -0,0 +1,178 @@
+package nstemplateset
+
+import (
+	"fmt"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/apis"
+	"github.com/codeready-toolchain/toolchain-common/pkg/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestTemplateCache(t *testing.T) {
+	// given
+	ttr := createTestTTR("cached-ttr", []string{namespaceTemplate, configMapTemplate}, nil)
+	ttr.ResourceVersion = "1"
+
+	t.Run("parses the templates only once", func(t *testing.T) {
+		// given
+		cache := newTemplateCache(10)
+
+		// when
+		first := cache.get(ttr)
+		second := cache.get(ttr)
+
+		// then
+		require.Len(t, first, 2)
+		require.Len(t, second, 2)
+		assert.Same(t, first[0].template, second[0].template)
+		assert.Same(t, first[1].template, second[1].template)
+		assert.Equal(t, 1, cache.len())
+	})
+
+	t.Run("parses the templates again when the resource version changed", func(t *testing.T) {
+		// given
+		cache := newTemplateCache(10)
+		first := cache.get(ttr)
+		updated := ttr.DeepCopy()
+		updated.ResourceVersion = "2"
+
+		// when
+		second := cache.get(updated)
+
+		// then
+		assert.NotSame(t, first[0].template, second[0].template)
+		assert.Equal(t, 1, cache.len())
+	})
+
+	t.Run("parses the templates again when the content changed", func(t *testing.T) {
+		// given
+		cache := newTemplateCache(10)
+		cache.get(ttr)
+		other := createTestTTR("cached-ttr", []string{configMapTemplate}, nil)
+		other.ResourceVersion = "1"
+
+		// when
+		parsed := cache.get(other)
+
+		// then
+		require.Len(t, parsed, 1)
+		assert.Equal(t, configMapTemplate, string(parsed[0].raw.Raw))
+	})
+
+	t.Run("does not cache templates without resource version", func(t *testing.T) {
+		// given
+		cache := newTemplateCache(10)
+		notFromCluster := createTestTTR("not-from-cluster", []string{configMapTemplate}, nil)
+
+		// when
+		parsed := cache.get(notFromCluster)
+
+		// then
+		require.Len(t, parsed, 1)
+		assert.Equal(t, 0, cache.len())
+	})
+
+	t.Run("does not exceed the max number of entries", func(t *testing.T) {
+		// given
+		cache := newTemplateCache(3)
+
+		// when
+		for i := 0; i < 5; i++ {
+			other := createTestTTR(fmt.Sprintf("ttr-%d", i), []string{configMapTemplate}, nil)
+			other.ResourceVersion = "1"
+			cache.get(other)
+		}
+
+		// then
+		assert.Equal(t, 3, cache.len())
+	})
+
+	t.Run("keeps the errors for the objects that cannot be parsed", func(t *testing.T) {
+		// given
+		cache := newTemplateCache(10)
+		invalid := createTestTTR("invalid", []string{configMapTemplate, invalidTemplate}, nil)
+		invalid.ResourceVersion = "1"
+
+		// when
+		parsed := cache.get(invalid)
+
+		// then
+		require.Len(t, parsed, 2)
+		require.NoError(t, parsed[0].parseErr)
+		require.Error(t, parsed[1].parseErr)
+	})
+
+	t.Run("does not modify the TierTemplateRevision", func(t *testing.T) {
+		// given
+		cache := newTemplateCache(10)
+		original := ttr.DeepCopy()
+
+		// when
+		parsed := cache.get(ttr)
+
+		// then
+		assert.NotNil(t, parsed[0].raw.Object)
+		assert.Equal(t, original, ttr)
+	})
+}
+
+func TestProcessGoTemplateWithCache(t *testing.T) {
+	// given
+	s := runtime.NewScheme()
+	err := apis.AddToScheme(s)
+	require.NoError(t, err)
+	ttr := createTestTTR("processed-ttr", []string{namespaceTemplate, configMapTemplate}, []toolchainv1alpha1.Parameter{
+		{Name: "NAMESPACE", Value: "default"},
+		{Name: "CONFIG_VALUE", Value: "test-config"},
+	})
+	ttr.ResourceVersion = "1"
+	tierTemplate := createTestTierTemplate(ttr)
+
+	// when
+	johnObjs, err := tierTemplate.process(s, map[string]string{"SPACE_NAME": "johnsmith"}, template.RetainAllButNamespaces)
+	require.NoError(t, err)
+	janeObjs, err := tierTemplate.process(s, map[string]string{"SPACE_NAME": "janedoe"}, template.RetainAllButNamespaces)
+	require.NoError(t, err)
+
+	// then
+	require.Len(t, johnObjs, 1)
+	assert.Equal(t, "config-johnsmith", johnObjs[0].GetName())
+	require.Len(t, janeObjs, 1)
+	assert.Equal(t, "config-janedoe", janeObjs[0].GetName())
+	// the TierTemplateRevision itself is left untouched
+	assert.Nil(t, ttr.Spec.TemplateObjects[0].Object)
+}
+
+func BenchmarkProcessGoTemplate(b *testing.B) {
+	s := runtime.NewScheme()
+	err := apis.AddToScheme(s)
+	require.NoError(b, err)
+	params := []toolchainv1alpha1.Parameter{
+		{Name: "NAMESPACE", Value: "default"},
+		{Name: "CONFIG_VALUE", Value: "test-config"},
+		{Name: "QUOTA_LIMIT", Value: "1000"},
+		{Name: "RUNTIME_PARAM", Value: "runtime-value"},
+	}
+	templates := []string{namespaceTemplate, configMapTemplate, secTemplate}
+
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cached=%t", cached), func(b *testing.B) {
+			ttr := createTestTTR("benchmark-ttr", templates, params)
+			if cached {
+				ttr.ResourceVersion = "1"
+			}
+			tierTemplate := createTestTierTemplate(ttr)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := tierTemplate.process(s, map[string]string{"SPACE_NAME": fmt.Sprintf("user-%d", i)}, template.RetainAllButNamespaces); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
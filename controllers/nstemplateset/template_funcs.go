@@ -0,0 +1,211 @@
+package nstemplateset
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	gotemp "text/template"
+)
+
+// maxDNSLabelLength is the max length of a DNS label (RFC 1123), e.g. the name of a namespace
+const maxDNSLabelLength = 63
+
+// maxIndent is the max number of spaces used by the indent and nindent functions
+const maxIndent = 100
+
+// templateFuncs returns the functions available in the Go templates of the TierTemplateRevisions, on top of the
+// builtin functions of the text/template package. The list is deliberately restricted to pure functions:
+// there is no way to read the environment, the filesystem or the network from a template.
+//
+// Strings:
+//
+//	quote STR               wraps STR in double quotes (escaping it as a JSON string)
+//	squote STR              wraps STR in single quotes (escaping it as a YAML single-quoted string)
+//	lower STR, upper STR    changes the case of STR
+//	trim STR                removes the leading and trailing white spaces
+//	trimPrefix PREFIX STR   removes PREFIX from the beginning of STR
+//	trimSuffix SUFFIX STR   removes SUFFIX from the end of STR
+//	replace OLD NEW STR     replaces all the occurrences of OLD with NEW in STR
+//	contains SUBSTR STR     returns true if STR contains SUBSTR
+//	hasPrefix PREFIX STR    returns true if STR starts with PREFIX
+//	hasSuffix SUFFIX STR    returns true if STR ends with SUFFIX
+//	trunc N STR             keeps the first N characters (runes) of STR
+//	indent N STR            indents every line of STR with N spaces (between 0 and 100)
+//	nindent N STR           same as indent, but with a leading new line
+//
+// Lists:
+//
+//	list ITEMS...           returns the list of the given items
+//	join SEP LIST           joins the items of LIST with SEP
+//	split SEP STR           splits STR around each occurrence of SEP
+//
+// Defaults:
+//
+//	default DEFAULT VALUE   returns VALUE, or DEFAULT if VALUE is empty
+//	empty VALUE             returns true if VALUE is empty (nil, zero, or an empty string, list or map)
+//	coalesce VALUES...      returns the first non-empty value
+//	required MSG VALUE      returns VALUE, or fails the template execution with MSG if VALUE is empty
+//
+// Encoding and hashing:
+//
+//	b64enc STR, b64dec STR  encodes or decodes STR in base64
+//	sha256sum STR           returns the hex-encoded SHA-256 hash of STR
+//	toJson VALUE            returns the JSON representation of VALUE
+//
+// Names:
+//
+//	dnsLabel STR            converts STR into a valid DNS label (see dnsLabel func)
+//	truncHash N STR         truncates STR to N characters, with a hash suffix that keeps the result unique (see truncHash func)
+func templateFuncs() gotemp.FuncMap {
+	return gotemp.FuncMap{
+		"quote":      quote,
+		"squote":     squote,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(oldStr, newStr, s string) string { return strings.ReplaceAll(s, oldStr, newStr) },
+		"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"trunc":      trunc,
+		"indent":     indent,
+		"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+		"list":       func(items ...any) []any { return items },
+		"join":       join,
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"default":    defaultValue,
+		"empty":      empty,
+		"coalesce":   coalesce,
+		"required":   required,
+		"b64enc":     func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":     b64dec,
+		"sha256sum":  sha256sum,
+		"toJson":     toJSON,
+		"dnsLabel":   dnsLabel,
+		"truncHash":  truncHash,
+	}
+}
+
+func quote(s any) (string, error) {
+	b, err := json.Marshal(fmt.Sprint(s))
+	return string(b), err
+}
+
+// squote wraps the given value in single quotes. The single quotes of the value are doubled, as in YAML single-quoted strings.
+func squote(s any) string {
+	return "'" + strings.ReplaceAll(fmt.Sprint(s), "'", "''") + "'"
+}
+
+// trunc keeps the first n runes of the given string, so that multi-byte characters are never split
+func trunc(n int, s string) string {
+	if n < 0 || len(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// indent indents every line of the given string with n spaces, where n is clamped between 0 and maxIndent
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", min(max(n, 0), maxIndent))
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func join(sep string, items any) (string, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: expected a list, got %T", items)
+	}
+	values := make([]string, v.Len())
+	for i := range values {
+		values[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(values, sep), nil
+}
+
+func defaultValue(def, value any) any {
+	if empty(value) {
+		return def
+	}
+	return value
+}
+
+// empty returns true if the given value is nil or the zero value of its type, or an empty list or map
+func empty(value any) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	default:
+		return v.IsZero()
+	}
+}
+
+func coalesce(values ...any) any {
+	for _, value := range values {
+		if !empty(value) {
+			return value
+		}
+	}
+	return nil
+}
+
+func required(msg string, value any) (any, error) {
+	if empty(value) {
+		return nil, fmt.Errorf("%s", msg)
+	}
+	return value, nil
+}
+
+func b64dec(s string) (string, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	return string(b), err
+}
+
+func sha256sum(s string) string {
+	hash := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(hash[:])
+}
+
+func toJSON(value any) (string, error) {
+	b, err := json.Marshal(value)
+	return string(b), err
+}
+
+var invalidDNSLabelChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// dnsLabel converts the given string into a valid DNS label (RFC 1123): the string is lower-cased, the sequences of
+// invalid characters are replaced with a '-', and the result is truncated (with a hash suffix) to 63 characters at most.
+func dnsLabel(s string) string {
+	label := strings.Trim(invalidDNSLabelChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	return truncHash(maxDNSLabelLength, label)
+}
+
+// truncHash returns the given string if it is not longer than n characters. Otherwise, the string is truncated and
+// suffixed with '-' and the 5 first characters of its SHA-256 hash, so that the result stays unique and is at most n characters long.
+func truncHash(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	suffix := "-" + sha256sum(s)[:5]
+	if n <= len(suffix) {
+		return trunc(n, suffix[1:])
+	}
+	return strings.TrimRight(string(runes[:n-len(suffix)]), "-") + suffix
+}
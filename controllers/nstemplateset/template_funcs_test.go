@@ -0,0 +1,181 @@
+package nstemplateset
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	gotemp "text/template"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/apis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"unicode/utf8"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	// given
+	params := map[string]string{
+		"SPACE_NAME": "johnsmith",
+		"EMPTY":      "",
+		"TEAMS":      "dev,qa",
+		"LONG_NAME":  strings.Repeat("very-long-name-", 6),
+	}
+
+	tests := map[string]struct {
+		template string
+		expected string
+	}{
+		"quote":                   {`{{ quote .SPACE_NAME }}`, `"johnsmith"`},
+		"quote with escaping":     {`{{ "a\"b" | quote }}`, `"a\"b"`},
+		"squote":                  {`{{ squote .SPACE_NAME }}`, `'johnsmith'`},
+		"squote with escaping":    {`{{ squote "john's" }}`, `'john''s'`},
+		"lower":                   {`{{ lower "JohnSmith" }}`, `johnsmith`},
+		"upper":                   {`{{ upper .SPACE_NAME }}`, `JOHNSMITH`},
+		"trim":                    {`{{ trim "  johnsmith " }}`, `johnsmith`},
+		"trimPrefix":              {`{{ trimPrefix "john" .SPACE_NAME }}`, `smith`},
+		"trimSuffix":              {`{{ trimSuffix "smith" .SPACE_NAME }}`, `john`},
+		"replace":                 {`{{ replace "smith" "doe" .SPACE_NAME }}`, `johndoe`},
+		"contains":                {`{{ contains "smith" .SPACE_NAME }}`, `true`},
+		"hasPrefix":               {`{{ hasPrefix "jane" .SPACE_NAME }}`, `false`},
+		"hasSuffix":               {`{{ hasSuffix "smith" .SPACE_NAME }}`, `true`},
+		"trunc":                   {`{{ trunc 4 .SPACE_NAME }}`, `john`},
+		"trunc longer than value": {`{{ trunc 40 .SPACE_NAME }}`, `johnsmith`},
+		"trunc multi-byte value":  {`{{ trunc 3 "žluťoučký" }}`, `žlu`},
+		"indent":                  {`{{ indent 2 "a\nb" }}`, "  a\n  b"},
+		"negative indent":         {`{{ indent -2 "a" }}`, "a"},
+		"nindent":                 {`{{ nindent 2 "a" }}`, "\n  a"},
+		"list and join":           {`{{ list "a" "b" "c" | join "-" }}`, `a-b-c`},
+		"split and join":          {`{{ split "," .TEAMS | join " " }}`, `dev qa`},
+		"default with value":      {`{{ default "none" .SPACE_NAME }}`, `johnsmith`},
+		"default without value":   {`{{ default "none" .EMPTY }}`, `none`},
+		"empty":                   {`{{ empty .EMPTY }}`, `true`},
+		"coalesce":                {`{{ coalesce .EMPTY "" .SPACE_NAME }}`, `johnsmith`},
+		"required":                {`{{ required "SPACE_NAME is required" .SPACE_NAME }}`, `johnsmith`},
+		"b64enc":                  {`{{ b64enc .SPACE_NAME }}`, `am9obnNtaXRo`},
+		"b64dec":                  {`{{ b64dec "am9obnNtaXRo" }}`, `johnsmith`},
+		"sha256sum":               {`{{ sha256sum "johnsmith" | trunc 8 }}`, `45358dd8`},
+		"toJson":                  {`{{ split "," .TEAMS | toJson }}`, `["dev","qa"]`},
+		"dnsLabel":                {`{{ dnsLabel "John_Smith@Example.COM" }}`, `john-smith-example-com`},
+		"truncHash short value":   {`{{ truncHash 20 .SPACE_NAME }}`, `johnsmith`},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// when
+			result, err := executeWithTemplateFuncs(tc.template, params)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+
+	t.Run("names are kept unique and within the length limit", func(t *testing.T) {
+		// when
+		label, err := executeWithTemplateFuncs(`{{ dnsLabel .LONG_NAME }}`, params)
+		require.NoError(t, err)
+		other, err := executeWithTemplateFuncs(`{{ dnsLabel (printf "%s-other" .LONG_NAME) }}`, params)
+		require.NoError(t, err)
+		truncated, err := executeWithTemplateFuncs(`{{ truncHash 20 .LONG_NAME }}`, params)
+		require.NoError(t, err)
+
+		// then
+		assert.Len(t, label, maxDNSLabelLength)
+		assert.NotEqual(t, label, other)
+		assert.LessOrEqual(t, len(truncated), 20)
+		assert.True(t, strings.HasPrefix(truncated, "very-long-name"))
+		assert.NotContains(t, truncated, "--")
+	})
+
+	t.Run("non-ASCII names are truncated on character boundaries", func(t *testing.T) {
+		// when
+		truncated := truncHash(10, "žluťoučký-kůň")
+
+		// then
+		assert.True(t, utf8.ValidString(truncated))
+		assert.Equal(t, 10, utf8.RuneCountInString(truncated))
+		assert.True(t, strings.HasPrefix(truncated, "žluť-"))
+	})
+
+	t.Run("indentation is limited", func(t *testing.T) {
+		// when
+		result, err := executeWithTemplateFuncs(`{{ indent 1000000000 "a" }}`, params)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, strings.Repeat(" ", maxIndent)+"a", result)
+	})
+
+	t.Run("required fails when the value is empty", func(t *testing.T) {
+		// when
+		_, err := executeWithTemplateFuncs(`{{ required "EMPTY must be set" .EMPTY }}`, params)
+
+		// then
+		require.ErrorContains(t, err, "EMPTY must be set")
+	})
+
+	t.Run("functions accessing the environment or the filesystem are not available", func(t *testing.T) {
+		for _, fn := range []string{"env", "expandenv", "readFile", "getHostByName", "exec"} {
+			t.Run(fn, func(t *testing.T) {
+				// when
+				_, err := executeWithTemplateFuncs(`{{ `+fn+` "HOME" }}`, params)
+
+				// then
+				require.ErrorContains(t, err, `function "`+fn+`" not defined`)
+			})
+		}
+	})
+}
+
+func TestProcessGoTemplateWithTemplateFuncs(t *testing.T) {
+	// given
+	s := runtime.NewScheme()
+	err := apis.AddToScheme(s)
+	require.NoError(t, err)
+	cmTemplate := `{
+		"apiVersion": "v1",
+		"kind": "ConfigMap",
+		"metadata": {
+			"name": "{{ printf "%s-config" .SPACE_NAME | dnsLabel }}",
+			"namespace": {{ quote .NAMESPACE }}
+		},
+		"data": {
+			"owner": "{{ default "nobody" .OWNER | upper }}",
+			"token": "{{ b64enc .SPACE_NAME }}"
+		}
+	}`
+	ttr := createTestTTR("ttr-with-funcs", []string{cmTemplate}, []toolchainv1alpha1.Parameter{
+		{Name: "NAMESPACE", Value: "default"},
+		{Name: "OWNER", Value: ""},
+	})
+	tierTemplate := createTestTierTemplate(ttr)
+
+	// when
+	objects, err := tierTemplate.process(s, map[string]string{"SPACE_NAME": "John.Smith"})
+
+	// then
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "john-smith-config", objects[0].GetName())
+	assert.Equal(t, "default", objects[0].GetNamespace())
+	assert.Contains(t, toJSONString(t, objects[0]), `"owner":"NOBODY"`)
+	assert.Contains(t, toJSONString(t, objects[0]), `"token":"Sm9obi5TbWl0aA=="`)
+}
+
+func executeWithTemplateFuncs(tmpl string, params map[string]string) (string, error) {
+	parsed, err := gotemp.New("test").Option("missingkey=error").Funcs(templateFuncs()).Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	err = parsed.Execute(&b, params)
+	return b.String(), err
+}
+
+func toJSONString(t *testing.T, value any) string {
+	result, err := toJSON(value)
+	require.NoError(t, err)
+	return result
+}
@@ -0,0 +1,140 @@
+package nstemplateset
+
+import (
+	"slices"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/template"
+	quotav1 "github.com/openshift/api/quota/v1"
+	errs "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The objects which the operator applies for the templates of a space are computed by the functions below, without any access
+// to the cluster, so that they are the same when the templates are applied (see namespacesManager and clusterResourcesManager)
+// and when they are rendered (see Render).
+
+// templateObjectsError is the error returned when the objects of a template can't be computed
+type templateObjectsError struct {
+	error
+	// step is the step which failed, e.g. "invalid template"
+	step string
+	// invalid is true if the objects of the template are invalid, as opposed to a template which can't be processed
+	invalid bool
+}
+
+func processingError(err error) error {
+	return templateObjectsError{error: err, step: "failed to process template"}
+}
+
+func validationError(err error, step string) error {
+	return templateObjectsError{error: err, step: step, invalid: true}
+}
+
+// namespaceObjects returns the namespaces of the given template, with the labels of the pod security level of the cluster
+func namespaceObjects(scheme *runtime.Scheme, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, podSecurityMinimumLevel string) ([]runtimeclient.Object, error) {
+	objs, err := tierTemplate.process(scheme, map[string]string{
+		SpaceName: nsTmplSet.GetName(),
+	}, template.RetainNamespaces)
+	if err != nil {
+		return nil, processingError(err)
+	}
+	if err := newObjectsValidator(nsTmplSet.GetName()).validate(objs); err != nil {
+		return nil, validationError(err, "invalid template")
+	}
+	for _, obj := range objs {
+		if err := setPodSecurityLabels(obj, podSecurityMinimumLevel); err != nil {
+			return nil, validationError(err, "invalid pod security level")
+		}
+	}
+	return objs, nil
+}
+
+// innerObjects are the objects of a namespace template to apply in a namespace of a space
+type innerObjects struct {
+	// all are all the objects of the template, including the objects of the disabled features
+	all []runtimeclient.Object
+	// regular are the objects which don't belong to any feature, along with the NetworkPolicy allowing the traffic
+	// between the namespaces of the space (if required)
+	regular []runtimeclient.Object
+	// features are the features to apply, whose objects are in byFeature
+	features  []string
+	byFeature map[string][]runtimeclient.Object
+	// disabled are the objects which must not exist, i.e. the objects of the disabled features, as well as the NetworkPolicy
+	// allowing the traffic between the namespaces of the space if it is not required
+	disabled []runtimeclient.Object
+}
+
+// enabled returns the objects to apply, i.e. the regular objects followed by the objects of the features to apply
+func (o innerObjects) enabled() []runtimeclient.Object {
+	objs := slices.Clone(o.regular)
+	for _, feature := range o.features {
+		objs = append(objs, o.byFeature[feature]...)
+	}
+	return objs
+}
+
+// innerNamespaceObjects returns the objects of the given template to apply in the given namespace of the space
+func innerNamespaceObjects(scheme *runtime.Scheme, nsTmplSet *toolchainv1alpha1.NSTemplateSet, tierTemplate *tierTemplate, namespace metav1.Object) (innerObjects, error) {
+	objs, err := tierTemplate.process(scheme, map[string]string{
+		SpaceName: nsTmplSet.GetName(),
+	}, template.RetainAllButNamespaces)
+	if err != nil {
+		return innerObjects{}, processingError(err)
+	}
+	// validate all the objects before applying any of them: the objects of a namespace template must stay in this namespace
+	if err := newObjectsValidator(nsTmplSet.GetName(), namespace.GetName()).validate(objs); err != nil {
+		return innerObjects{}, validationError(err, "invalid template")
+	}
+
+	// the objects of the disabled features are deleted, while the objects of the enabled features are applied
+	// separately from the regular objects, so that a failure can be reported in the status of the corresponding feature
+	inner := innerObjects{
+		all:       objs,
+		features:  featuresToApply(nsTmplSet, objs),
+		byFeature: map[string][]runtimeclient.Object{},
+	}
+	for _, obj := range objs {
+		switch feature := featureOf(obj); {
+		case !shouldCreate(obj, nsTmplSet):
+			inner.disabled = append(inner.disabled, obj)
+		case feature != "":
+			inner.byFeature[feature] = append(inner.byFeature[feature], obj)
+		default:
+			inner.regular = append(inner.regular, obj)
+		}
+	}
+	// allow the traffic between the namespaces of the space, if the namespace is isolated by the NetworkPolicies of the template
+	if policy, required := sameSpaceNetworkPolicy(nsTmplSet, namespace, inner.enabled()); required {
+		inner.regular = append(inner.regular, policy)
+	} else {
+		inner.disabled = append(inner.disabled, policy)
+	}
+	return inner, nil
+}
+
+// spaceQuotas returns the budgets of the space, i.e. the enabled ClusterResourceQuotas among the given objects of its cluster resources template,
+// along with the ResourceQuotas enforcing them in the given namespaces when the ClusterResourceQuotas are not supported (see splitBudget)
+func spaceQuotas(nsTmplSet *toolchainv1alpha1.NSTemplateSet, clusterResourcesObjs []runtimeclient.Object, namespaces []corev1.Namespace, existing []corev1.ResourceQuota) ([]*quotav1.ClusterResourceQuota, []*corev1.ResourceQuota, error) {
+	var budgets []*quotav1.ClusterResourceQuota
+	var quotas []*corev1.ResourceQuota
+	for _, obj := range clusterResourcesObjs {
+		if !isClusterResourceQuota(obj) || !shouldCreate(obj, nsTmplSet) {
+			continue
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, nil, err
+		}
+		budget := &quotav1.ClusterResourceQuota{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(content, budget); err != nil {
+			return nil, nil, errs.Wrapf(err, "invalid ClusterResourceQuota '%s'", obj.GetName())
+		}
+		budgets = append(budgets, budget)
+		quotas = append(quotas, splitBudget(budget, namespaces, existing)...)
+	}
+	return budgets, quotas, nil
+}
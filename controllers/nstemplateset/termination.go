@@ -0,0 +1,158 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	errs "github.com/pkg/errors"
+	"github.com/redhat-cop/operator-utils/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// prefixes of the messages of the namespace conditions set by the namespace controller while the content of a namespace
+// is being deleted, e.g.:
+// - "Some resources are remaining: pods has 2 resource instances, widgets.example.com has 1 resource instances"
+// - "Some content in the namespace has finalizers remaining: example.com/cleanup in 1 resource instances"
+const (
+	namespaceContentRemainingPrefix    = "Some resources are remaining: "
+	namespaceFinalizersRemainingPrefix = "Some content in the namespace has finalizers remaining: "
+)
+
+// finalizerRemovalResources are the only resources whose safe finalizers are removed, since they are the ones for which the operator
+// is granted the permissions to list and patch (see the RBAC markers below). The other resources blocking the termination
+// of a namespace are only reported.
+var finalizerRemovalResources = []schema.GroupResource{
+	{Resource: "configmaps"},
+	{Resource: "secrets"},
+	{Resource: "services"},
+	{Resource: "serviceaccounts"},
+	{Resource: "persistentvolumeclaims"},
+	{Resource: "pods"},
+	{Group: "apps", Resource: "deployments"},
+	{Group: "apps", Resource: "statefulsets"},
+	{Group: "apps", Resource: "daemonsets"},
+	{Group: "apps", Resource: "replicasets"},
+	{Group: "batch", Resource: "jobs"},
+	{Group: "batch", Resource: "cronjobs"},
+	{Group: "networking.k8s.io", Resource: "ingresses"},
+	{Group: "route.openshift.io", Resource: "routes"},
+}
+
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets;services;serviceaccounts;persistentvolumeclaims;pods,verbs=list;patch
+//+kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets;replicasets,verbs=list;patch
+//+kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=list;patch
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=list;patch
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=list;patch
+
+// terminationBlockers returns a description of what blocks the termination of the user namespaces which are being deleted,
+// or an empty string if the namespace controller did not report anything (yet)
+func (r *namespacesManager) terminationBlockers(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet) (string, error) {
+	userNamespaces, err := fetchNamespacesByOwner(ctx, r.Client, nsTmplSet.Name)
+	if err != nil {
+		return "", err
+	}
+	var blockers []string
+	for _, ns := range userNamespaces {
+		if !util.IsBeingDeleted(&ns) {
+			continue
+		}
+		var details []string
+		if resources := namespaceConditionMessage(ns, corev1.NamespaceContentRemaining, namespaceContentRemainingPrefix); resources != "" {
+			details = append(details, fmt.Sprintf("remaining resources: %s", resources))
+		}
+		if finalizers := namespaceConditionMessage(ns, corev1.NamespaceFinalizersRemaining, namespaceFinalizersRemainingPrefix); finalizers != "" {
+			details = append(details, fmt.Sprintf("remaining finalizers: %s", finalizers))
+		}
+		if len(details) > 0 {
+			blockers = append(blockers, fmt.Sprintf("namespace '%s' is stuck in Terminating with %s", ns.Name, strings.Join(details, " and ")))
+		}
+	}
+	return strings.Join(blockers, "; "), nil
+}
+
+// removeSafeFinalizers removes the configured safe finalizers from the resources that block the termination of the user namespaces
+// which have been terminating for longer than the grace period (among the finalizerRemovalResources). Nothing is done if the removal
+// is not enabled.
+func (r *namespacesManager) removeSafeFinalizers(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg finalizerRemovalConfig) error {
+	if !cfg.enabled() {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+	userNamespaces, err := fetchNamespacesByOwner(ctx, r.Client, nsTmplSet.Name)
+	if err != nil {
+		return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusTerminatingFailed, err, "failed to list namespaces with label owner '%s'", nsTmplSet.Name)
+	}
+	for _, ns := range userNamespaces {
+		if !util.IsBeingDeleted(&ns) || time.Since(ns.DeletionTimestamp.Time) < cfg.gracePeriod {
+			continue
+		}
+		for _, resource := range remainingResources(ns) {
+			if !slices.Contains(finalizerRemovalResources, resource) {
+				logger.Info("not removing the finalizers of the resources blocking the termination of the namespace since the operator is not allowed to",
+					"namespace", ns.Name, "resource", resource.String())
+				continue
+			}
+			gvk, err := r.Client.RESTMapper().KindFor(resource.WithVersion(""))
+			if err != nil {
+				logger.Info("unable to find the kind of the resources blocking the termination of the namespace", "namespace", ns.Name, "resource", resource.String(), "error", err.Error())
+				continue
+			}
+			list := &unstructured.UnstructuredList{}
+			list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+			if err := r.Client.List(ctx, list, runtimeclient.InNamespace(ns.Name)); err != nil {
+				return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusTerminatingFailed, err,
+					"failed to list the resources of kind '%s' in namespace '%s'", gvk.Kind, ns.Name)
+			}
+			for i := range list.Items {
+				obj := &list.Items[i]
+				finalizers := slices.DeleteFunc(slices.Clone(obj.GetFinalizers()), func(finalizer string) bool {
+					return slices.Contains(cfg.safeFinalizers, finalizer)
+				})
+				if len(finalizers) == len(obj.GetFinalizers()) {
+					continue
+				}
+				logger.Info("removing safe finalizers from a resource blocking the termination of the namespace",
+					"namespace", ns.Name, "kind", gvk.Kind, "name", obj.GetName(), "finalizers", obj.GetFinalizers())
+				patch := runtimeclient.MergeFrom(obj.DeepCopy())
+				obj.SetFinalizers(finalizers)
+				if err := r.Client.Patch(ctx, obj, patch); err != nil {
+					return r.wrapErrorWithStatusUpdate(ctx, nsTmplSet, r.setStatusTerminatingFailed, errs.Wrapf(err, "namespace '%s'", ns.Name),
+						"failed to remove the finalizers of %s '%s'", gvk.Kind, obj.GetName())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// remainingResources returns the resources reported in the NamespaceContentRemaining condition of the given namespace
+func remainingResources(ns corev1.Namespace) []schema.GroupResource {
+	message := namespaceConditionMessage(ns, corev1.NamespaceContentRemaining, namespaceContentRemainingPrefix)
+	if message == "" {
+		return nil
+	}
+	var resources []schema.GroupResource
+	for _, remaining := range strings.Split(message, ", ") {
+		resource, _, _ := strings.Cut(remaining, " has ")
+		resources = append(resources, schema.ParseGroupResource(strings.TrimSpace(resource)))
+	}
+	return resources
+}
+
+// namespaceConditionMessage returns the message (without the given prefix) of the condition of the given type, if the condition is true
+func namespaceConditionMessage(ns corev1.Namespace, conditionType corev1.NamespaceConditionType, prefix string) string {
+	for _, c := range ns.Status.Conditions {
+		if c.Type == conditionType && c.Status == corev1.ConditionTrue {
+			return strings.TrimPrefix(c.Message, prefix)
+		}
+	}
+	return ""
+}
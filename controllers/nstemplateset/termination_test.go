@@ -0,0 +1,259 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/codeready-toolchain/member-operator/test"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestTerminationBlockers(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev", "stage"), withDeletionTs())
+
+	t.Run("with remaining resources and finalizers", func(t *testing.T) {
+		// given
+		devNS := newTerminatingNamespace(spacename, "dev", time.Now(), remainingContent()...)
+		stageNS := newNamespace("basic", spacename, "stage")
+		manager, _ := prepareNamespacesManager(t, nsTmplSet, devNS, stageNS)
+
+		// when
+		blockers, err := manager.terminationBlockers(context.TODO(), nsTmplSet)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "namespace 'johnsmith-dev' is stuck in Terminating with "+
+			"remaining resources: configmaps has 1 resource instances, widgets.example.com has 2 resource instances and "+
+			"remaining finalizers: example.com/cleanup in 1 resource instances", blockers)
+	})
+
+	t.Run("nothing reported by the namespace controller", func(t *testing.T) {
+		// given
+		devNS := newTerminatingNamespace(spacename, "dev", time.Now())
+		manager, _ := prepareNamespacesManager(t, nsTmplSet, devNS)
+
+		// when
+		blockers, err := manager.terminationBlockers(context.TODO(), nsTmplSet)
+
+		// then
+		require.NoError(t, err)
+		assert.Empty(t, blockers)
+	})
+}
+
+func TestRemoveSafeFinalizers(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "basic", withNamespaces("abcde11", "dev"), withDeletionTs())
+	cfg := finalizerRemovalConfig{
+		safeFinalizers: []string{"example.com/cleanup"},
+		gracePeriod:    10 * time.Minute,
+	}
+	newBlockingConfigMap := func() *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:  "johnsmith-dev",
+				Name:       "blocking",
+				Finalizers: []string{"example.com/cleanup", "example.com/keep"},
+			},
+		}
+	}
+
+	t.Run("safe finalizers removed after the grace period", func(t *testing.T) {
+		// given
+		devNS := newTerminatingNamespace(spacename, "dev", time.Now().Add(-11*time.Minute), remainingContent()...)
+		manager, fakeClient := prepareNamespacesManagerWithRESTMapper(t, nsTmplSet, devNS, newBlockingConfigMap())
+
+		// when
+		err := manager.removeSafeFinalizers(context.TODO(), nsTmplSet, cfg)
+
+		// then
+		require.NoError(t, err)
+		assertFinalizers(t, fakeClient, "example.com/keep")
+	})
+
+	t.Run("finalizers not removed", func(t *testing.T) {
+		t.Run("from the resources which the operator is not allowed to patch", func(t *testing.T) {
+			// given
+			devNS := newTerminatingNamespace(spacename, "dev", time.Now().Add(-11*time.Minute), corev1.NamespaceCondition{
+				Type:    corev1.NamespaceContentRemaining,
+				Status:  corev1.ConditionTrue,
+				Reason:  "SomeResourcesRemain",
+				Message: "Some resources are remaining: widgets.example.com has 2 resource instances",
+			})
+			manager, fakeClient := prepareNamespacesManagerWithRESTMapper(t, nsTmplSet, devNS, newBlockingConfigMap())
+			fakeClient.Client.RESTMapper().(*meta.DefaultRESTMapper).Add(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, meta.RESTScopeNamespace)
+			fakeClient.MockPatch = func(_ context.Context, _ runtimeclient.Object, _ runtimeclient.Patch, _ ...runtimeclient.PatchOption) error {
+				return assert.AnError // not expected to be called
+			}
+
+			// when
+			err := manager.removeSafeFinalizers(context.TODO(), nsTmplSet, cfg)
+
+			// then
+			require.NoError(t, err)
+			assertFinalizers(t, fakeClient, "example.com/cleanup", "example.com/keep")
+		})
+
+		t.Run("during the grace period", func(t *testing.T) {
+			// given
+			devNS := newTerminatingNamespace(spacename, "dev", time.Now().Add(-9*time.Minute), remainingContent()...)
+			manager, fakeClient := prepareNamespacesManagerWithRESTMapper(t, nsTmplSet, devNS, newBlockingConfigMap())
+
+			// when
+			err := manager.removeSafeFinalizers(context.TODO(), nsTmplSet, cfg)
+
+			// then
+			require.NoError(t, err)
+			assertFinalizers(t, fakeClient, "example.com/cleanup", "example.com/keep")
+		})
+
+		t.Run("when disabled", func(t *testing.T) {
+			// given
+			devNS := newTerminatingNamespace(spacename, "dev", time.Now().Add(-11*time.Minute), remainingContent()...)
+			manager, fakeClient := prepareNamespacesManagerWithRESTMapper(t, nsTmplSet, devNS, newBlockingConfigMap())
+
+			// when
+			err := manager.removeSafeFinalizers(context.TODO(), nsTmplSet, finalizerRemovalConfig{gracePeriod: cfg.gracePeriod})
+
+			// then
+			require.NoError(t, err)
+			assertFinalizers(t, fakeClient, "example.com/cleanup", "example.com/keep")
+		})
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		// given
+		devNS := newTerminatingNamespace(spacename, "dev", time.Now().Add(-11*time.Minute), remainingContent()...)
+		manager, fakeClient := prepareNamespacesManagerWithRESTMapper(t, nsTmplSet, devNS, newBlockingConfigMap())
+		fakeClient.MockPatch = func(_ context.Context, _ runtimeclient.Object, _ runtimeclient.Patch, _ ...runtimeclient.PatchOption) error {
+			return assert.AnError
+		}
+
+		// when
+		err := manager.removeSafeFinalizers(context.TODO(), nsTmplSet, cfg)
+
+		// then
+		require.EqualError(t, err, "failed to remove the finalizers of ConfigMap 'blocking': namespace 'johnsmith-dev': "+assert.AnError.Error())
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(UnableToTerminate("namespace 'johnsmith-dev': " + assert.AnError.Error()))
+	})
+}
+
+func TestDeleteNSTemplateSetWithStuckNamespace(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withDeletionTs())
+	nsTmplSet.SetDeletionTimestamp(&metav1.Time{Time: time.Now().Add(-61 * time.Second)})
+	devNS := newTerminatingNamespace(spacename, "dev", time.Now().Add(-61*time.Second), remainingContent()...)
+	r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS)
+
+	// when
+	_, err := r.Reconcile(context.TODO(), req)
+
+	// then
+	blockers := "namespace 'johnsmith-dev' is stuck in Terminating with " +
+		"remaining resources: configmaps has 1 resource instances, widgets.example.com has 2 resource instances and " +
+		"remaining finalizers: example.com/cleanup in 1 resource instances"
+	require.EqualError(t, err, "NSTemplateSet deletion has not completed in over 1 minute: "+blockers)
+	AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+		HasConditions(UnableToTerminate(blockers))
+}
+
+func TestDeleteNSTemplateSetWithStuckNamespaceBeforeTimeout(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withDeletionTs())
+	devNS := newTerminatingNamespace(spacename, "dev", time.Now(), remainingContent()...)
+	r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet, devNS)
+
+	// when
+	res, err := r.Reconcile(context.TODO(), req)
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, res.RequeueAfter)
+	// the blockers are reported as soon as the namespace controller reports them
+	AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+		HasConditions(TerminatingWithBlockers("namespace 'johnsmith-dev' is stuck in Terminating with " +
+			"remaining resources: configmaps has 1 resource instances, widgets.example.com has 2 resource instances and " +
+			"remaining finalizers: example.com/cleanup in 1 resource instances"))
+
+	t.Run("blockers kept on the next reconcile", func(t *testing.T) {
+		// when
+		_, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(TerminatingWithBlockers("namespace 'johnsmith-dev' is stuck in Terminating with " +
+				"remaining resources: configmaps has 1 resource instances, widgets.example.com has 2 resource instances and " +
+				"remaining finalizers: example.com/cleanup in 1 resource instances"))
+	})
+}
+
+// newTerminatingNamespace returns a user namespace whose deletion was requested at the given time
+func newTerminatingNamespace(spacename, typeName string, deletionTime time.Time, conditions ...corev1.NamespaceCondition) *corev1.Namespace {
+	ns := newNamespace("basic", spacename, typeName, withFinalizer())
+	ns.SetDeletionTimestamp(&metav1.Time{Time: deletionTime})
+	ns.Status.Phase = corev1.NamespaceTerminating
+	ns.Status.Conditions = conditions
+	return ns
+}
+
+// remainingContent returns the conditions set by the namespace controller when the deletion of the content of a namespace is blocked
+func remainingContent() []corev1.NamespaceCondition {
+	return []corev1.NamespaceCondition{
+		{
+			Type:    corev1.NamespaceContentRemaining,
+			Status:  corev1.ConditionTrue,
+			Reason:  "SomeResourcesRemain",
+			Message: "Some resources are remaining: configmaps has 1 resource instances, widgets.example.com has 2 resource instances",
+		},
+		{
+			Type:    corev1.NamespaceFinalizersRemaining,
+			Status:  corev1.ConditionTrue,
+			Reason:  "SomeFinalizersRemain",
+			Message: "Some content in the namespace has finalizers remaining: example.com/cleanup in 1 resource instances",
+		},
+	}
+}
+
+// prepareNamespacesManagerWithRESTMapper returns a namespaces manager whose client is able to map the `configmaps` resource to its kind
+func prepareNamespacesManagerWithRESTMapper(t *testing.T, initObjs ...runtimeclient.Object) (*namespacesManager, *test.FakeClient) {
+	manager, fakeClient := prepareNamespacesManager(t, initObjs...)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	fakeClient.Client = clientWithRESTMapper{Client: fakeClient.Client, mapper: mapper}
+	return manager, fakeClient
+}
+
+type clientWithRESTMapper struct {
+	runtimeclient.Client
+	mapper meta.RESTMapper
+}
+
+func (c clientWithRESTMapper) RESTMapper() meta.RESTMapper {
+	return c.mapper
+}
+
+func assertFinalizers(t *testing.T, cl runtimeclient.Client, expected ...string) {
+	cm := &corev1.ConfigMap{}
+	require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Namespace: "johnsmith-dev", Name: "blocking"}, cm))
+	assert.Equal(t, expected, cm.Finalizers)
+}
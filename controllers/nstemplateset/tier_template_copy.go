@@ -0,0 +1,250 @@
+package nstemplateset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// errHostClusterUnavailable is returned (wrapped) when the host cluster cannot be reached
+var errHostClusterUnavailable = errors.New("unable to connect to the host cluster")
+
+const (
+	// tierTemplateCopyLabelKey is the label set on the ConfigMaps containing the copies of the TierTemplates
+	tierTemplateCopyLabelKey = toolchainv1alpha1.LabelKeyPrefix + "tiertemplate-copy"
+
+	// the keys of the TierTemplate and of the TierTemplateRevision (as JSON) in the ConfigMap of a copy
+	tierTemplateCopyKey         = "tierTemplate"
+	tierTemplateRevisionCopyKey = "tierTemplateRevision"
+
+	// tierTemplateCopiesCleanupPeriod is the period between two deletions of the unused copies of the templates
+	tierTemplateCopiesCleanupPeriod = time.Hour
+)
+
+// tierTemplateCopyConfigMapName returns the name of the ConfigMap (in the operator namespace) containing the copy of the TierTemplate
+// (or TierTemplateRevision) with the given templateRef
+func tierTemplateCopyConfigMapName(templateRef string) string {
+	return "tiertemplate-" + templateRef
+}
+
+// fetchTierTemplate returns the TierTemplate (or TierTemplateRevision) with the given templateRef from the host cluster, and keeps a copy
+// of it in a ConfigMap in the operator namespace. When the host cluster cannot be reached, then the copy is returned instead (if any),
+// provided that the template was already applied to the given space (i.e., it is referenced in the status of its NSTemplateSet):
+// this way, the resources of the spaces can still be restored while the connection to the host cluster is down, but no space is
+// provisioned or updated with a template which only comes from a copy. There is no such fallback when the NSTemplateSet is nil.
+// Since the content of the TierTemplates and TierTemplateRevisions never changes for a given templateRef (which contains the revision),
+// the copy is created only once.
+func (c APIClient) fetchTierTemplate(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, templateRef string) (*tierTemplate, error) {
+	tierTmpl, err := getTierTemplate(ctx, c.GetHostClusterClient, templateRef)
+	if err != nil {
+		if !hostClusterUnavailable(err) || nsTmplSet == nil || !slices.Contains(appliedTemplateRefs(nsTmplSet), templateRef) {
+			return nil, err
+		}
+		tierTmplCopy, found, copyErr := c.getTierTemplateCopy(ctx, templateRef)
+		if copyErr != nil {
+			return nil, fmt.Errorf("%w (and unable to get the local copy of the template: %w)", err, copyErr)
+		}
+		if !found {
+			return nil, err
+		}
+		log.FromContext(ctx).Info("the host cluster is not available - using the local copy of the template", "templateRef", templateRef, "cause", err.Error())
+		return tierTmplCopy, nil
+	}
+	if err := c.ensureTierTemplateCopy(ctx, tierTmpl); err != nil {
+		// the copy is only used as a fallback, so there is no reason to fail the reconcile
+		log.FromContext(ctx).Error(err, "unable to store the local copy of the template", "templateRef", templateRef)
+	}
+	return tierTmpl, nil
+}
+
+// appliedTemplateRefs returns the templateRefs of the templates which were applied to the space of the given NSTemplateSet
+func appliedTemplateRefs(nsTmplSet *toolchainv1alpha1.NSTemplateSet) []string {
+	var templateRefs []string
+	if nsTmplSet.Status.ClusterResources != nil && nsTmplSet.Status.ClusterResources.TemplateRef != "" {
+		templateRefs = append(templateRefs, nsTmplSet.Status.ClusterResources.TemplateRef)
+	}
+	for _, ns := range nsTmplSet.Status.Namespaces {
+		templateRefs = append(templateRefs, ns.TemplateRef)
+	}
+	for _, spaceRole := range nsTmplSet.Status.SpaceRoles {
+		templateRefs = append(templateRefs, spaceRole.TemplateRef)
+	}
+	return templateRefs
+}
+
+// templateRefsInUse returns the templateRefs of the templates which are referenced by the given NSTemplateSet,
+// either in its spec or in its status
+func templateRefsInUse(nsTmplSet *toolchainv1alpha1.NSTemplateSet) []string {
+	templateRefs := appliedTemplateRefs(nsTmplSet)
+	if nsTmplSet.Spec.ClusterResources != nil && nsTmplSet.Spec.ClusterResources.TemplateRef != "" {
+		templateRefs = append(templateRefs, nsTmplSet.Spec.ClusterResources.TemplateRef)
+	}
+	for _, ns := range nsTmplSet.Spec.Namespaces {
+		templateRefs = append(templateRefs, ns.TemplateRef)
+	}
+	for _, spaceRole := range nsTmplSet.Spec.SpaceRoles {
+		templateRefs = append(templateRefs, spaceRole.TemplateRef)
+	}
+	return templateRefs
+}
+
+// hostClusterUnavailable returns true if the given error was caused by the host cluster not being reachable
+// (i.e., no connection to the host cluster, a network error or a timeout), as opposed to any other error such as
+// the template not being found or not being readable
+func hostClusterUnavailable(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errHostClusterUnavailable) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsServerTimeout(err)
+}
+
+// ensureTierTemplateCopy creates the ConfigMap containing the copy of the given template, unless it already exists
+func (c APIClient) ensureTierTemplateCopy(ctx context.Context, tierTmpl *tierTemplate) error {
+	namespace, err := configuration.GetWatchNamespace()
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{}
+	if err := c.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: tierTemplateCopyConfigMapName(tierTmpl.templateRef)}, cm); err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+	tmpl, err := json.Marshal(&toolchainv1alpha1.TierTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: tierTmpl.templateRef,
+		},
+		Spec: toolchainv1alpha1.TierTemplateSpec{
+			TierName: tierTmpl.tierName,
+			Type:     tierTmpl.typeName,
+			Template: tierTmpl.template,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	cm = &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      tierTemplateCopyConfigMapName(tierTmpl.templateRef),
+			Labels: map[string]string{
+				toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
+				tierTemplateCopyLabelKey:           "true",
+			},
+		},
+		Data: map[string]string{
+			tierTemplateCopyKey: string(tmpl),
+		},
+	}
+	if tierTmpl.ttr != nil {
+		ttr, err := json.Marshal(&toolchainv1alpha1.TierTemplateRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: tierTmpl.ttr.Namespace,
+				Name:      tierTmpl.ttr.Name,
+				Labels:    tierTmpl.ttr.Labels,
+				// kept so that the parsed templates of the copy are taken from the cache (see templateCache)
+				ResourceVersion: tierTmpl.ttr.ResourceVersion,
+			},
+			Spec: tierTmpl.ttr.Spec,
+		})
+		if err != nil {
+			return err
+		}
+		cm.Data[tierTemplateRevisionCopyKey] = string(ttr)
+	}
+	if err := c.Client.Create(ctx, cm); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	log.FromContext(ctx).Info("stored the local copy of the template", "templateRef", tierTmpl.templateRef)
+	return nil
+}
+
+// getTierTemplateCopy returns the copy of the template with the given templateRef, if any
+func (c APIClient) getTierTemplateCopy(ctx context.Context, templateRef string) (*tierTemplate, bool, error) {
+	namespace, err := configuration.GetWatchNamespace()
+	if err != nil {
+		return nil, false, err
+	}
+	cm := &corev1.ConfigMap{}
+	if err := c.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: tierTemplateCopyConfigMapName(templateRef)}, cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	tmpl := &toolchainv1alpha1.TierTemplate{}
+	if err := json.Unmarshal([]byte(cm.Data[tierTemplateCopyKey]), tmpl); err != nil {
+		return nil, false, fmt.Errorf("unable to decode the copy of the TierTemplate: %w", err)
+	}
+	tierTmpl := &tierTemplate{
+		templateRef: templateRef,
+		tierName:    tmpl.Spec.TierName,
+		typeName:    tmpl.Spec.Type,
+		template:    tmpl.Spec.Template,
+	}
+	if content, found := cm.Data[tierTemplateRevisionCopyKey]; found {
+		tierTmpl.ttr = &toolchainv1alpha1.TierTemplateRevision{}
+		if err := json.Unmarshal([]byte(content), tierTmpl.ttr); err != nil {
+			return nil, false, fmt.Errorf("unable to decode the copy of the TierTemplateRevision: %w", err)
+		}
+	}
+	return tierTmpl, true, nil
+}
+
+// deleteUnusedTierTemplateCopies deletes the ConfigMaps containing the copies of the templates which are not referenced
+// by any NSTemplateSet anymore (e.g. the previous revisions of the templates once all the spaces were updated)
+func (c APIClient) deleteUnusedTierTemplateCopies(ctx context.Context) error {
+	namespace, err := configuration.GetWatchNamespace()
+	if err != nil {
+		return err
+	}
+	nsTmplSets := &toolchainv1alpha1.NSTemplateSetList{}
+	if err := c.Client.List(ctx, nsTmplSets, runtimeclient.InNamespace(namespace)); err != nil {
+		return err
+	}
+	inUse := map[string]bool{}
+	for i := range nsTmplSets.Items {
+		for _, templateRef := range templateRefsInUse(&nsTmplSets.Items[i]) {
+			inUse[tierTemplateCopyConfigMapName(templateRef)] = true
+		}
+	}
+	copies := &corev1.ConfigMapList{}
+	if err := c.Client.List(ctx, copies, runtimeclient.InNamespace(namespace), runtimeclient.MatchingLabels{tierTemplateCopyLabelKey: "true"}); err != nil {
+		return err
+	}
+	for i := range copies.Items {
+		if inUse[copies.Items[i].Name] {
+			continue
+		}
+		if err := c.Client.Delete(ctx, &copies.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		log.FromContext(ctx).Info("deleted the unused local copy of a template", "name", copies.Items[i].Name)
+	}
+	return nil
+}
+
+// runTierTemplateCopiesCleanup periodically deletes the unused copies of the templates, until the given context is done
+func (c APIClient) runTierTemplateCopiesCleanup(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.deleteUnusedTierTemplateCopies(ctx); err != nil {
+			log.FromContext(ctx).Error(err, "unable to delete the unused local copies of the templates")
+		}
+	}, tierTemplateCopiesCleanupPeriod)
+	return nil
+}
@@ -0,0 +1,265 @@
+package nstemplateset
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"fmt"
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"net"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestFetchTierTemplate(t *testing.T) {
+	// given
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	ctx := context.TODO()
+	hostDown := func(apiClient *APIClient, fakeClient *test.FakeClient) {
+		apiClient.GetHostClusterClient = NewHostClientGetter(fakeClient, errors.New("some error"))
+	}
+	// the NSTemplateSet of a space which was provisioned with the advanced-dev-abcde11 template
+	provisioned := newNSTmplSet("toolchain-member", "johnsmith", "advanced", withNamespaces("abcde11", "dev"), withStatusNamespaces("abcde11", "dev"))
+
+	t.Run("stores a copy of the template", func(t *testing.T) {
+		// given
+		apiClient, fakeClient := prepareAPIClient(t)
+
+		// when
+		tierTmpl, err := apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "advanced", tierTmpl.tierName)
+		cm := &corev1.ConfigMap{}
+		err = fakeClient.Get(ctx, types.NamespacedName{Namespace: "my-member-operator-namespace", Name: "tiertemplate-advanced-dev-abcde11"}, cm)
+		require.NoError(t, err)
+		assert.Equal(t, toolchainv1alpha1.ProviderLabelValue, cm.Labels[toolchainv1alpha1.ProviderLabelKey])
+		assert.Contains(t, cm.Data, tierTemplateCopyKey)
+		assert.NotContains(t, cm.Data, tierTemplateRevisionCopyKey)
+
+		t.Run("uses the copy when the host cluster is not available", func(t *testing.T) {
+			// given
+			hostDown(apiClient, fakeClient)
+
+			// when
+			tierTmplCopy, err := apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, tierTmpl.templateRef, tierTmplCopy.templateRef)
+			assert.Equal(t, tierTmpl.tierName, tierTmplCopy.tierName)
+			assert.Equal(t, tierTmpl.typeName, tierTmplCopy.typeName)
+			assert.Equal(t, tierTmpl.template.Objects, tierTmplCopy.template.Objects)
+			assert.Nil(t, tierTmplCopy.ttr)
+		})
+	})
+
+	t.Run("stores a copy of the template revision", func(t *testing.T) {
+		// given
+		ttr := createTestTTR("base-dev-abcde11-ttr", []string{namespaceTemplate}, nil)
+		ttr.Labels = map[string]string{toolchainv1alpha1.TemplateRefLabelKey: "advanced-dev-abcde11"}
+		apiClient, fakeClient := prepareAPIClient(t, ttr)
+		nsTmplSet := provisioned.DeepCopy()
+		nsTmplSet.Status.Namespaces = []toolchainv1alpha1.NSTemplateSetNamespace{{TemplateRef: "base-dev-abcde11-ttr"}}
+
+		// when
+		tierTmpl, err := apiClient.fetchTierTemplate(ctx, nsTmplSet, "base-dev-abcde11-ttr")
+		require.NoError(t, err)
+		hostDown(apiClient, fakeClient)
+		tierTmplCopy, err := apiClient.fetchTierTemplate(ctx, nsTmplSet, "base-dev-abcde11-ttr")
+
+		// then
+		require.NoError(t, err)
+		require.NotNil(t, tierTmplCopy.ttr)
+		require.Len(t, tierTmplCopy.ttr.Spec.TemplateObjects, 1)
+		assert.JSONEq(t, namespaceTemplate, string(tierTmplCopy.ttr.Spec.TemplateObjects[0].Raw))
+		// the copy is identified as the original revision by the cache of the parsed templates
+		assert.Equal(t, tierTmpl.ttr.Namespace, tierTmplCopy.ttr.Namespace)
+		assert.Equal(t, tierTmpl.ttr.ResourceVersion, tierTmplCopy.ttr.ResourceVersion)
+		assert.NotEmpty(t, tierTmplCopy.ttr.ResourceVersion)
+	})
+
+	t.Run("fails when the host cluster is not available and there is no copy", func(t *testing.T) {
+		// given
+		apiClient, fakeClient := prepareAPIClient(t)
+		hostDown(apiClient, fakeClient)
+
+		// when
+		_, err := apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+
+		// then
+		require.EqualError(t, err, "unable to connect to the host cluster: some error")
+	})
+
+	t.Run("does not use the copy for a template which was not applied to the space yet", func(t *testing.T) {
+		// given
+		apiClient, fakeClient := prepareAPIClient(t)
+		_, err := apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+		require.NoError(t, err)
+		hostDown(apiClient, fakeClient)
+		newSpace := newNSTmplSet("toolchain-member", "janedoe", "advanced", withNamespaces("abcde11", "dev"))
+
+		// when
+		_, err = apiClient.fetchTierTemplate(ctx, newSpace, "advanced-dev-abcde11")
+
+		// then
+		require.EqualError(t, err, "unable to connect to the host cluster: some error")
+
+		t.Run("nor without NSTemplateSet", func(t *testing.T) {
+			// when
+			_, err = apiClient.fetchTierTemplate(ctx, nil, "advanced-dev-abcde11")
+
+			// then
+			require.EqualError(t, err, "unable to connect to the host cluster: some error")
+		})
+	})
+
+	t.Run("does not use the copy when the template can't be read", func(t *testing.T) {
+		// given
+		apiClient, fakeClient := prepareAPIClient(t)
+		_, err := apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+		require.NoError(t, err)
+		fakeClient.MockGet = func(ctx context.Context, key types.NamespacedName, obj runtimeclient.Object, opts ...runtimeclient.GetOption) error {
+			if _, ok := obj.(*toolchainv1alpha1.TierTemplate); ok {
+				return errors.New("unable to decode the TierTemplate")
+			}
+			return fakeClient.Client.Get(ctx, key, obj, opts...)
+		}
+
+		// when
+		_, err = apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+
+		// then
+		require.EqualError(t, err, "unable to decode the TierTemplate")
+	})
+
+	t.Run("does not use the copy when the template is not found", func(t *testing.T) {
+		// given
+		apiClient, fakeClient := prepareAPIClient(t)
+		_, err := apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+		require.NoError(t, err)
+		fakeClient.MockGet = func(ctx context.Context, key types.NamespacedName, obj runtimeclient.Object, opts ...runtimeclient.GetOption) error {
+			if _, ok := obj.(*toolchainv1alpha1.TierTemplate); ok {
+				return apierrors.NewNotFound(schema.GroupResource{}, key.Name)
+			}
+			return fakeClient.Client.Get(ctx, key, obj, opts...)
+		}
+
+		// when
+		_, err = apiClient.fetchTierTemplate(ctx, provisioned, "advanced-dev-abcde11")
+
+		// then
+		require.True(t, apierrors.IsNotFound(err))
+	})
+
+	t.Run("reconciles a provisioned space when the host cluster is not available", func(t *testing.T) {
+		// given
+		spacename := "johnsmith"
+		namespaceName := "toolchain-member"
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced", withNamespaces("abcde11", "dev"), withClusterResources("abcde11"))
+		r, req, fakeClient := prepareReconcile(t, namespaceName, spacename, nsTmplSet)
+		for i := 0; i < 5; i++ {
+			_, err := r.Reconcile(ctx, req)
+			require.NoError(t, err)
+		}
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned())
+		hostDown(r.APIClient, fakeClient)
+		// a namespace object has been deleted in the meantime
+		require.NoError(t, fakeClient.Delete(ctx, newRole("johnsmith-dev", "exec-pods", spacename)))
+
+		// when
+		_, err := r.Reconcile(ctx, req)
+		require.NoError(t, err)
+		_, err = r.Reconcile(ctx, req)
+
+		// then
+		require.NoError(t, err)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned())
+		AssertThatRole(t, "johnsmith-dev", "exec-pods", fakeClient).Exists()
+	})
+}
+
+func TestHostClusterUnavailable(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err         error
+		unavailable bool
+	}{
+		"no connection to the host cluster": {
+			err:         fmt.Errorf("%w: some error", errHostClusterUnavailable),
+			unavailable: true,
+		},
+		"network error": {
+			err:         fmt.Errorf("failed to get the TierTemplate: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}),
+			unavailable: true,
+		},
+		"deadline exceeded": {
+			err:         fmt.Errorf("failed to get the TierTemplate: %w", context.DeadlineExceeded),
+			unavailable: true,
+		},
+		"service unavailable": {
+			err:         apierrors.NewServiceUnavailable("host cluster"),
+			unavailable: true,
+		},
+		"server timeout": {
+			err:         apierrors.NewServerTimeout(schema.GroupResource{Resource: "tiertemplates"}, "get", 1),
+			unavailable: true,
+		},
+		"not found": {
+			err: apierrors.NewNotFound(schema.GroupResource{Resource: "tiertemplates"}, "advanced-dev-abcde11"),
+		},
+		"forbidden": {
+			err: apierrors.NewForbidden(schema.GroupResource{Resource: "tiertemplates"}, "advanced-dev-abcde11", errors.New("denied")),
+		},
+		"any other error": {
+			err: errors.New("unable to decode the TierTemplate"),
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.unavailable, hostClusterUnavailable(tc.err))
+		})
+	}
+}
+
+func TestDeleteUnusedTierTemplateCopies(t *testing.T) {
+	// given
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	ctx := context.TODO()
+	nsTmplSet := newNSTmplSet("my-member-operator-namespace", "johnsmith", "advanced", withNamespaces("abcde12", "dev"), withStatusNamespaces("abcde11", "dev"))
+	apiClient, fakeClient := prepareAPIClient(t, nsTmplSet)
+	for _, templateRef := range []string{"advanced-clusterresources-abcde12", "advanced-dev-abcde11", "advanced-dev-abcde12"} {
+		_, err := apiClient.fetchTierTemplate(ctx, nil, templateRef)
+		require.NoError(t, err)
+	}
+	other := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "my-member-operator-namespace", Name: "tiertemplate-unrelated"},
+	}
+	require.NoError(t, fakeClient.Create(ctx, other))
+
+	// when
+	err := apiClient.deleteUnusedTierTemplateCopies(ctx)
+
+	// then
+	require.NoError(t, err)
+	copies := &corev1.ConfigMapList{}
+	require.NoError(t, fakeClient.List(ctx, copies, runtimeclient.InNamespace("my-member-operator-namespace")))
+	var names []string
+	for _, cm := range copies.Items {
+		names = append(names, cm.Name)
+	}
+	assert.ElementsMatch(t, []string{"tiertemplate-advanced-dev-abcde11", "tiertemplate-advanced-dev-abcde12", "tiertemplate-unrelated"}, names)
+}
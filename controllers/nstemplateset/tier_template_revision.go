@@ -14,7 +14,7 @@ func getTierTemplateRevision(ctx context.Context, getHostClient host.ClientGette
 	// get the host client
 	hostClient, err := getHostClient(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("unable to connect to the host cluster: %w", err)
+		return nil, fmt.Errorf("%w: %w", errHostClusterUnavailable, err)
 	}
 
 	tierTemplateRevision := &toolchainv1alpha1.TierTemplateRevision{}
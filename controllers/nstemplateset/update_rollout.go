@@ -0,0 +1,273 @@
+package nstemplateset
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	errs "github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// When a new version of the templates of a tier is rolled out, the host cluster usually changes the NSTemplateSets of many spaces at once.
+// In order to limit the impact of a faulty template, the updates of the spaces can be rolled out gradually on the member cluster:
+// at most N spaces are updated concurrently (see NSTemplateSetConfig.MaxConcurrentUpdates), and the updates which are not started yet are halted
+// when the ratio of the failed updates during the last hour exceeds a threshold (see NSTemplateSetConfig.UpdateFailureThresholdPercent), provided that
+// enough updates completed or failed during that hour (see NSTemplateSetConfig.UpdateFailureMinOutcomes). The updates
+// which are already in progress are not deferred, so that the failed ones can be retried (and succeed) once the templates are fixed.
+const (
+	// NSTemplateSetUpdateDeferredConditionType is the type of the condition set while the update of the space to new templates
+	// is deferred by the rollout. The condition is removed once the update starts.
+	NSTemplateSetUpdateDeferredConditionType toolchainv1alpha1.ConditionType = "UpdateDeferred"
+
+	// NSTemplateSetMaxConcurrentUpdatesReason is the reason of the UpdateDeferred condition when too many spaces are being updated
+	NSTemplateSetMaxConcurrentUpdatesReason = "MaxConcurrentUpdatesReached"
+
+	// NSTemplateSetUpdatesHaltedReason is the reason of the UpdateDeferred condition when the updates are halted
+	NSTemplateSetUpdatesHaltedReason = "UpdatesHalted"
+
+	// TemplateUpdatesHaltedConditionType is the type of the condition set on the MemberStatus while the updates of the spaces are halted
+	TemplateUpdatesHaltedConditionType toolchainv1alpha1.ConditionType = "TemplateUpdatesHalted"
+
+	// updateOutcomeWindow is the period during which the outcome of an update is taken into account in the failure ratio of the updates
+	updateOutcomeWindow = time.Hour
+
+	// updateDeferralPeriod is the period after which a deferred update is checked again. The deferred updates are started as soon as
+	// another update completes (see updateRolloutTracker), so this is only needed when the updates are halted until the failures get old enough.
+	updateDeferralPeriod = 5 * time.Minute
+)
+
+// UpdateRolloutStatus is the status of the updates of the spaces to new templates in the member cluster
+type UpdateRolloutStatus struct {
+	// Updating is the number of spaces being updated (including the ones whose update failed and is retried)
+	Updating int
+	// Failed is the number of spaces whose update failed (or was rolled back) during the last hour
+	Failed int
+	// Succeeded is the number of spaces which were successfully updated during the last hour
+	Succeeded int
+	// Halted is true when the ratio of the failed updates exceeds the configured threshold, and the number of recent outcomes
+	// reaches the configured minimum
+	Halted bool
+	// Message describes why the updates are halted
+	Message string
+}
+
+// updateOutcome is the outcome of the last update attempt of a space
+type updateOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+// updateRolloutTracker keeps track of the updates of the spaces in memory: the updates in progress, the outcome of the recent updates
+// and the deferred updates, which are started (in order) as soon as another update completes. It is not
+// persisted: when the operator restarts, the updates in progress are tracked again as soon as their spaces are reconciled.
+type updateRolloutTracker struct {
+	mu         sync.Mutex
+	inProgress map[types.NamespacedName]bool
+	outcomes   map[types.NamespacedName]updateOutcome
+	deferred   []types.NamespacedName
+	now        func() time.Time
+	// resume receives the NSTemplateSets whose deferred update may start, so that they are reconciled again (see SetupWithManager)
+	resume chan event.GenericEvent
+}
+
+func newUpdateRolloutTracker() *updateRolloutTracker {
+	return &updateRolloutTracker{
+		inProgress: map[types.NamespacedName]bool{},
+		outcomes:   map[types.NamespacedName]updateOutcome{},
+		now:        time.Now,
+		resume:     make(chan event.GenericEvent, 100),
+	}
+}
+
+// status returns the status of the updates of the NSTemplateSets in the given (operator) namespace
+func (t *updateRolloutTracker) status(namespace string, cfg nstemplatesetConfig) UpdateRolloutStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.statusLocked(namespace, cfg)
+}
+
+func (t *updateRolloutTracker) statusLocked(namespace string, cfg nstemplatesetConfig) UpdateRolloutStatus {
+	rollout := UpdateRolloutStatus{}
+	for key := range t.inProgress {
+		if key.Namespace == namespace {
+			rollout.Updating++
+		}
+	}
+	now := t.now()
+	for key, outcome := range t.outcomes {
+		if now.Sub(outcome.at) > updateOutcomeWindow {
+			// not relevant anymore
+			delete(t.outcomes, key)
+			continue
+		}
+		if key.Namespace != namespace {
+			continue
+		}
+		if outcome.failed {
+			rollout.Failed++
+		} else {
+			rollout.Succeeded++
+		}
+	}
+	if cfg.updateFailureThreshold > 0 && rollout.Failed > 0 && rollout.Failed+rollout.Succeeded >= cfg.updateFailureMinOutcomes {
+		ratio := float64(rollout.Failed) / float64(rollout.Failed+rollout.Succeeded)
+		if ratio > cfg.updateFailureThreshold {
+			rollout.Halted = true
+			rollout.Message = fmt.Sprintf("the updates of the spaces are halted: %d of the last %d updates failed (threshold: %g)",
+				rollout.Failed, rollout.Failed+rollout.Succeeded, cfg.updateFailureThreshold)
+		}
+	}
+	return rollout
+}
+
+// start records that the update of the given NSTemplateSet is in progress
+func (t *updateRolloutTracker) start(nsTmplSet *toolchainv1alpha1.NSTemplateSet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.startLocked(runtimeclient.ObjectKeyFromObject(nsTmplSet))
+}
+
+func (t *updateRolloutTracker) startLocked(key types.NamespacedName) {
+	t.inProgress[key] = true
+	t.deferred = slices.DeleteFunc(t.deferred, func(k types.NamespacedName) bool {
+		return k == key
+	})
+}
+
+// tryStart starts the update of the given NSTemplateSet, unless the updates are halted or the maximum number of concurrent updates
+// is reached. In such a case, the update is deferred and the reason is returned.
+func (t *updateRolloutTracker) tryStart(nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) (string, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := runtimeclient.ObjectKeyFromObject(nsTmplSet)
+	if t.inProgress[key] {
+		// already started, e.g. the status of the NSTemplateSet was not updated yet
+		return "", ""
+	}
+	rollout := t.statusLocked(nsTmplSet.Namespace, cfg)
+	var reason, message string
+	if rollout.Halted {
+		reason, message = NSTemplateSetUpdatesHaltedReason, rollout.Message
+	} else if cfg.maxConcurrentUpdates > 0 && rollout.Updating >= cfg.maxConcurrentUpdates {
+		reason, message = NSTemplateSetMaxConcurrentUpdatesReason,
+			fmt.Sprintf("the update is deferred: %d spaces are being updated (max: %d)", rollout.Updating, cfg.maxConcurrentUpdates)
+	}
+	if reason != "" {
+		if !slices.Contains(t.deferred, key) {
+			t.deferred = append(t.deferred, key)
+		}
+		return reason, message
+	}
+	t.startLocked(key)
+	return "", ""
+}
+
+// recordOutcome records the outcome of the last attempt to update the given NSTemplateSet. The update is complete unless it failed,
+// in which case it is retried.
+func (t *updateRolloutTracker) recordOutcome(nsTmplSet *toolchainv1alpha1.NSTemplateSet, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := runtimeclient.ObjectKeyFromObject(nsTmplSet)
+	t.outcomes[key] = updateOutcome{at: t.now(), failed: failed}
+	if !failed {
+		t.doneLocked(key)
+	}
+}
+
+// done records that the given NSTemplateSet is not being updated anymore (e.g. it was rolled back or deleted)
+func (t *updateRolloutTracker) done(key types.NamespacedName) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.doneLocked(key)
+}
+
+func (t *updateRolloutTracker) doneLocked(key types.NamespacedName) {
+	t.deferred = slices.DeleteFunc(t.deferred, func(k types.NamespacedName) bool {
+		return k == key
+	})
+	if !t.inProgress[key] {
+		return
+	}
+	delete(t.inProgress, key)
+	// the next deferred update can start
+	if len(t.deferred) == 0 {
+		return
+	}
+	next := &toolchainv1alpha1.NSTemplateSet{}
+	next.SetNamespace(t.deferred[0].Namespace)
+	next.SetName(t.deferred[0].Name)
+	select {
+	case t.resume <- event.GenericEvent{Object: next}:
+	default:
+		// the deferred update is checked again after the updateDeferralPeriod
+	}
+}
+
+// UpdateRolloutStatus returns the status of the updates of the NSTemplateSets in the given (operator) namespace
+func (r *Reconciler) UpdateRolloutStatus(ctx context.Context, namespace string) (UpdateRolloutStatus, error) {
+	cfg, err := r.config.get(ctx, r.Client, namespace)
+	if err != nil {
+		return UpdateRolloutStatus{}, errs.Wrap(err, "failed to load the configuration")
+	}
+	return r.updateRollout.status(namespace, cfg), nil
+}
+
+// updateInProgress returns true if the update of the given NSTemplateSet to new templates was started (and not rolled back)
+func updateInProgress(nsTmplSet *toolchainv1alpha1.NSTemplateSet) bool {
+	ready, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, toolchainv1alpha1.ConditionReady)
+	if !found || (ready.Reason != toolchainv1alpha1.NSTemplateSetUpdatingReason && ready.Reason != toolchainv1alpha1.NSTemplateSetUpdateFailedReason) {
+		return false
+	}
+	return !hasRolledBackCondition(nsTmplSet)
+}
+
+func hasRolledBackCondition(nsTmplSet *toolchainv1alpha1.NSTemplateSet) bool {
+	rolledBack, found := condition.FindConditionByType(nsTmplSet.Status.Conditions, NSTemplateSetRolledBackConditionType)
+	return found && rolledBack.Status == corev1.ConditionTrue
+}
+
+// ensureUpdateRollout sets the UpdateDeferred condition and returns true if the update of the given NSTemplateSet to new templates
+// must not start yet, either because too many spaces are being updated or because the updates are halted. Otherwise, it removes
+// the UpdateDeferred condition (if any) and returns false.
+func (r *Reconciler) ensureUpdateRollout(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, cfg nstemplatesetConfig) (bool, error) {
+	if updateInProgress(nsTmplSet) {
+		// e.g. after a restart of the operator
+		r.updateRollout.start(nsTmplSet)
+	} else if (cfg.maxConcurrentUpdates > 0 || cfg.updateFailureThreshold > 0) && templatesUpdated(nsTmplSet) {
+		if reason, message := r.updateRollout.tryStart(nsTmplSet, cfg); reason != "" {
+			log.FromContext(ctx).Info("the update of the NSTemplateSet is deferred", "reason", message)
+			if err := r.status.updateStatusConditions(ctx, nsTmplSet, toolchainv1alpha1.Condition{
+				Type:    NSTemplateSetUpdateDeferredConditionType,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: message,
+			}); err != nil {
+				return true, errs.Wrap(err, "failed to set the UpdateDeferred condition")
+			}
+			return true, nil
+		}
+	}
+	if err := r.status.removeStatusCondition(ctx, nsTmplSet, NSTemplateSetUpdateDeferredConditionType); err != nil {
+		return false, errs.Wrap(err, "failed to remove the UpdateDeferred condition")
+	}
+	return false, nil
+}
+
+// recordUpdateSucceeded records the successful update of the given NSTemplateSet (if an update was in progress), so that the next deferred update can start
+func (r *Reconciler) recordUpdateSucceeded(nsTmplSet *toolchainv1alpha1.NSTemplateSet) {
+	if updateInProgress(nsTmplSet) {
+		r.updateRollout.recordOutcome(nsTmplSet, false)
+		return
+	}
+	// the update may have been started without being recorded in the status yet
+	r.updateRollout.done(runtimeclient.ObjectKeyFromObject(nsTmplSet))
+}
@@ -0,0 +1,311 @@
+package nstemplateset
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	quotav1 "github.com/openshift/api/quota/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/utils/ptr"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestUpdateRolloutTracker(t *testing.T) {
+	// given
+	namespaceName := "toolchain-member"
+	now := time.Now()
+	newTracker := func() *updateRolloutTracker {
+		tracker := newUpdateRolloutTracker()
+		tracker.now = func() time.Time { return now }
+		return tracker
+	}
+	updating := newNSTmplSet(namespaceName, "updating", "advanced")
+	failed := newNSTmplSet(namespaceName, "failed", "advanced")
+	succeeded := newNSTmplSet(namespaceName, "succeeded", "advanced")
+	otherNamespace := newNSTmplSet("other-namespace", "failed", "advanced")
+
+	t.Run("status", func(t *testing.T) {
+		// given
+		tracker := newTracker()
+		tracker.start(updating)
+		tracker.start(failed)
+		tracker.recordOutcome(failed, true)
+		tracker.start(succeeded)
+		tracker.recordOutcome(succeeded, false)
+		tracker.recordOutcome(otherNamespace, true)
+
+		t.Run("halted", func(t *testing.T) {
+			// when
+			rollout := tracker.status(namespaceName, nstemplatesetConfig{updateFailureThreshold: 0.4})
+
+			// then
+			assert.Equal(t, UpdateRolloutStatus{
+				Updating:  2,
+				Failed:    1,
+				Succeeded: 1,
+				Halted:    true,
+				Message:   "the updates of the spaces are halted: 1 of the last 2 updates failed (threshold: 0.4)",
+			}, rollout)
+		})
+
+		t.Run("not halted when the failure ratio is below the threshold", func(t *testing.T) {
+			// when
+			rollout := tracker.status(namespaceName, nstemplatesetConfig{updateFailureThreshold: 0.7})
+
+			// then
+			assert.False(t, rollout.Halted)
+			assert.Empty(t, rollout.Message)
+		})
+
+		t.Run("not halted when there are not enough outcomes", func(t *testing.T) {
+			// when
+			rollout := tracker.status(namespaceName, nstemplatesetConfig{updateFailureThreshold: 0.4, updateFailureMinOutcomes: 3})
+
+			// then
+			assert.False(t, rollout.Halted)
+			assert.Empty(t, rollout.Message)
+		})
+
+		t.Run("not halted when the threshold is not set", func(t *testing.T) {
+			// when
+			rollout := tracker.status(namespaceName, nstemplatesetConfig{})
+
+			// then
+			assert.False(t, rollout.Halted)
+		})
+
+		t.Run("old outcomes are not taken into account", func(t *testing.T) {
+			// given
+			now = now.Add(updateOutcomeWindow + time.Minute)
+			t.Cleanup(func() {
+				now = now.Add(-updateOutcomeWindow - time.Minute)
+			})
+
+			// when
+			rollout := tracker.status(namespaceName, nstemplatesetConfig{updateFailureThreshold: 0.4})
+
+			// then
+			assert.Equal(t, UpdateRolloutStatus{Updating: 2}, rollout)
+		})
+	})
+
+	t.Run("deferred updates resumed in order", func(t *testing.T) {
+		// given
+		tracker := newTracker()
+		cfg := nstemplatesetConfig{maxConcurrentUpdates: 1}
+		first := newNSTmplSet(namespaceName, "first", "advanced")
+		second := newNSTmplSet(namespaceName, "second", "advanced")
+		reason, _ := tracker.tryStart(updating, cfg)
+		require.Empty(t, reason)
+
+		// when
+		firstReason, firstMessage := tracker.tryStart(first, cfg)
+		secondReason, _ := tracker.tryStart(second, cfg)
+
+		// then
+		assert.Equal(t, NSTemplateSetMaxConcurrentUpdatesReason, firstReason)
+		assert.Equal(t, "the update is deferred: 1 spaces are being updated (max: 1)", firstMessage)
+		assert.Equal(t, NSTemplateSetMaxConcurrentUpdatesReason, secondReason)
+		assert.Empty(t, tracker.resume)
+
+		t.Run("first one resumed when the update completes", func(t *testing.T) {
+			// when
+			tracker.recordOutcome(updating, false)
+
+			// then
+			require.Len(t, tracker.resume, 1)
+			resumed := <-tracker.resume
+			assert.Equal(t, "first", resumed.Object.GetName())
+			reason, _ := tracker.tryStart(first, cfg)
+			assert.Empty(t, reason)
+
+			t.Run("second one resumed when the update is deleted", func(t *testing.T) {
+				// when
+				tracker.done(runtimeclient.ObjectKeyFromObject(first))
+
+				// then
+				require.Len(t, tracker.resume, 1)
+				resumed := <-tracker.resume
+				assert.Equal(t, "second", resumed.Object.GetName())
+			})
+		})
+	})
+
+	t.Run("failed update still in progress", func(t *testing.T) {
+		// given
+		tracker := newTracker()
+		tracker.start(failed)
+
+		// when
+		tracker.recordOutcome(failed, true)
+
+		// then
+		assert.Equal(t, UpdateRolloutStatus{Updating: 1, Failed: 1}, tracker.status(namespaceName, nstemplatesetConfig{}))
+	})
+}
+
+func TestUpdateRollout(t *testing.T) {
+	// given
+	spacename := "johnsmith"
+	namespaceName := "toolchain-member"
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "my-member-operator-namespace")
+	t.Cleanup(restore)
+	newUpdatedNSTmplSet := func() *toolchainv1alpha1.NSTemplateSet {
+		nsTmplSet := newNSTmplSet(namespaceName, spacename, "advanced",
+			withNamespaces("abcde11", "dev"),
+			withClusterResources("abcde12"),
+			withStatusNamespaces("abcde11", "dev"),
+			withStatusClusterResources("abcde11"),
+			withConditions(Provisioned()))
+		nsTmplSet.Generation = 2
+		return nsTmplSet
+	}
+	prepare := func(t *testing.T, objs ...runtimeclient.Object) (*Reconciler, *test.FakeClient) {
+		devNS := newNamespace("advanced", spacename, "dev", withTemplateRefUsingRevision("abcde11"))
+		r, _, fakeClient := prepareReconcile(t, namespaceName, spacename, append(objs, newUpdatedNSTmplSet(), devNS,
+			newClusterResourceQuota(spacename, "advanced"),
+			newTektonClusterRoleBinding(spacename, "advanced"))...)
+		return r, fakeClient
+	}
+	req := newReconcileRequest(namespaceName, spacename)
+
+	t.Run("deferred while too many spaces are being updated", func(t *testing.T) {
+		// given
+		other := newNSTmplSet(namespaceName, "other", "advanced", withConditions(Updating()))
+		r, fakeClient := prepare(t, other, newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			MaxConcurrentUpdates: ptr.To(1),
+		}))
+		r.updateRollout.start(other)
+
+		// when
+		res, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, updateDeferralPeriod, res.RequeueAfter)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned(), UpdateDeferred(NSTemplateSetMaxConcurrentUpdatesReason, "the update is deferred: 1 spaces are being updated (max: 1)"))
+		AssertThatCluster(t, fakeClient).
+			HasResource("for-"+spacename, &quotav1.ClusterResourceQuota{},
+				WithLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-clusterresources-abcde11"))
+
+		t.Run("started once the other update completed", func(t *testing.T) {
+			// given
+			r.updateRollout.recordOutcome(other, false)
+			require.Len(t, r.updateRollout.resume, 1)
+			assert.Equal(t, spacename, (<-r.updateRollout.resume).Object.GetName())
+
+			// when
+			for i := 0; i < 5; i++ {
+				_, err := r.Reconcile(context.TODO(), req)
+				require.NoError(t, err)
+			}
+
+			// then
+			AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+				HasConditions(Provisioned())
+			AssertThatCluster(t, fakeClient).
+				HasResource("for-"+spacename, &quotav1.ClusterResourceQuota{},
+					WithLabel(toolchainv1alpha1.TemplateRefLabelKey, "advanced-clusterresources-abcde12"))
+			assert.Equal(t, UpdateRolloutStatus{Succeeded: 2}, r.updateRollout.status(namespaceName, nstemplatesetConfig{}))
+		})
+	})
+
+	t.Run("deferred while the updates are halted", func(t *testing.T) {
+		// given
+		other := newNSTmplSet(namespaceName, "other", "advanced", withConditions(UpdateFailed("mock error")))
+		r, fakeClient := prepare(t, other, newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			UpdateFailureThresholdPercent: ptr.To(50),
+			UpdateFailureMinOutcomes:      ptr.To(1),
+		}))
+		r.updateRollout.recordOutcome(other, true)
+
+		// when
+		res, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, updateDeferralPeriod, res.RequeueAfter)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Provisioned(), UpdateDeferred(NSTemplateSetUpdatesHaltedReason,
+				"the updates of the spaces are halted: 1 of the last 1 updates failed (threshold: 0.5)"))
+	})
+
+	t.Run("not deferred after a single failure by default", func(t *testing.T) {
+		// given
+		other := newNSTmplSet(namespaceName, "other", "advanced", withConditions(UpdateFailed("mock error")))
+		r, fakeClient := prepare(t, other, newMemberOperatorConfig(namespaceName, NSTemplateSetConfig{
+			UpdateFailureThresholdPercent: ptr.To(50),
+		}))
+		r.updateRollout.recordOutcome(other, true)
+
+		// when
+		res, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.NotEqual(t, updateDeferralPeriod, res.RequeueAfter)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Updating())
+	})
+
+	t.Run("not deferred when the rollout is not configured", func(t *testing.T) {
+		// given
+		other := newNSTmplSet(namespaceName, "other", "advanced", withConditions(UpdateFailed("mock error")))
+		r, fakeClient := prepare(t, other)
+		r.updateRollout.recordOutcome(other, true)
+
+		// when
+		res, err := r.Reconcile(context.TODO(), req)
+
+		// then
+		require.NoError(t, err)
+		assert.NotEqual(t, updateDeferralPeriod, res.RequeueAfter)
+		AssertThatNSTemplateSet(t, namespaceName, spacename, fakeClient).
+			HasConditions(Updating())
+	})
+}
+
+func TestLoadUpdateRolloutConfig(t *testing.T) {
+	t.Run("valid values", func(t *testing.T) {
+		// given
+		manager, _ := prepareNamespacesManager(t, newMemberOperatorConfig("toolchain-member", NSTemplateSetConfig{
+			MaxConcurrentUpdates:          ptr.To(10),
+			UpdateFailureThresholdPercent: ptr.To(20),
+			UpdateFailureMinOutcomes:      ptr.To(10),
+		}))
+
+		// when
+		cfg, err := loadConfig(context.TODO(), manager.Client, "toolchain-member", nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 10, cfg.maxConcurrentUpdates)
+		assert.InDelta(t, 0.2, cfg.updateFailureThreshold, 0.0001)
+		assert.Equal(t, 10, cfg.updateFailureMinOutcomes)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		// given
+		manager, _ := prepareNamespacesManager(t, newMemberOperatorConfig("toolchain-member", NSTemplateSetConfig{
+			MaxConcurrentUpdates:          ptr.To(-1),
+			UpdateFailureThresholdPercent: ptr.To(150),
+			UpdateFailureMinOutcomes:      ptr.To(0),
+		}))
+
+		// when
+		cfg, err := loadConfig(context.TODO(), manager.Client, "toolchain-member", nil)
+
+		// then
+		require.NoError(t, err)
+		assert.Zero(t, cfg.maxConcurrentUpdates)
+		assert.Zero(t, cfg.updateFailureThreshold)
+		assert.Equal(t, defaultUpdateFailureMinOutcomes, cfg.updateFailureMinOutcomes)
+	})
+}
@@ -0,0 +1,89 @@
+package nstemplateset
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// forbiddenClusterRoles are the ClusterRoles which must never be bound at the cluster level by a template
+var forbiddenClusterRoles = []string{"cluster-admin"}
+
+// objectsValidator checks the objects processed from the templates of a space before they are applied,
+// so that an invalid template is reported as such instead of resulting in a partially applied state.
+type objectsValidator struct {
+	spaceName string
+	// namespaces is the list of namespaces in which the namespaced objects can be applied
+	namespaces []string
+}
+
+func newObjectsValidator(spaceName string, namespaces ...string) *objectsValidator {
+	return &objectsValidator{
+		spaceName:  spaceName,
+		namespaces: namespaces,
+	}
+}
+
+// validationRule returns an error message if the given object is not valid, or an empty string otherwise
+type validationRule func(v *objectsValidator, obj runtimeclient.Object) string
+
+var validationRules = []validationRule{
+	inSpaceNamespaces,
+	noForbiddenClusterRoleBinding,
+	consistentSpaceLabel,
+}
+
+// validate checks all the given objects and returns an error listing all the violations, if any.
+func (v *objectsValidator) validate(objs []runtimeclient.Object) error {
+	var violations []string
+	for _, obj := range objs {
+		for _, rule := range validationRules {
+			if msg := rule(v, obj); msg != "" {
+				violations = append(violations, fmt.Sprintf("%s '%s': %s", obj.GetObjectKind().GroupVersionKind().Kind, obj.GetName(), msg))
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("invalid template objects: %s", strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// inSpaceNamespaces checks that the namespaced objects are in one of the namespaces of the space
+func inSpaceNamespaces(v *objectsValidator, obj runtimeclient.Object) string {
+	if obj.GetNamespace() == "" || slices.Contains(v.namespaces, obj.GetNamespace()) {
+		return ""
+	}
+	return fmt.Sprintf("namespace '%s' does not belong to the space '%s'", obj.GetNamespace(), v.spaceName)
+}
+
+// noForbiddenClusterRoleBinding checks that the ClusterRoleBindings don't grant any of the forbidden ClusterRoles. The kind of the role
+// is optional in the ClusterRoleBindings of the `authorization.openshift.io` API group, in which case it is a ClusterRole.
+func noForbiddenClusterRoleBinding(_ *objectsValidator, obj runtimeclient.Object) string {
+	if obj.GetObjectKind().GroupVersionKind().Kind != "ClusterRoleBinding" {
+		return ""
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return fmt.Sprintf("unable to read the object: %s", err)
+	}
+	kind, _, _ := unstructured.NestedString(content, "roleRef", "kind")
+	name, _, _ := unstructured.NestedString(content, "roleRef", "name")
+	if (kind == "" || kind == "ClusterRole") && slices.Contains(forbiddenClusterRoles, name) {
+		return fmt.Sprintf("binding to the ClusterRole '%s' is forbidden", name)
+	}
+	return ""
+}
+
+// consistentSpaceLabel checks that the objects which define the space label in the template refer to the current space
+func consistentSpaceLabel(v *objectsValidator, obj runtimeclient.Object) string {
+	if space, exists := obj.GetLabels()[toolchainv1alpha1.SpaceLabelKey]; exists && space != v.spaceName {
+		return fmt.Sprintf("label '%s' must be set to '%s' instead of '%s'", toolchainv1alpha1.SpaceLabelKey, v.spaceName, space)
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package nstemplateset
+
+import (
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestValidateObjects(t *testing.T) {
+	// given
+	validator := newObjectsValidator("johnsmith", "johnsmith-dev", "johnsmith-stage")
+
+	t.Run("valid objects", func(t *testing.T) {
+		// given
+		objs := []runtimeclient.Object{
+			newUnstructured("rbac.authorization.k8s.io/v1", "RoleBinding", "johnsmith-dev", "edit", map[string]any{
+				"roleRef": map[string]any{"kind": "ClusterRole", "name": "admin"},
+			}),
+			newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRoleBinding", "", "view", map[string]any{
+				"roleRef": map[string]any{"kind": "ClusterRole", "name": "view"},
+			}),
+			withSpaceLabel(newUnstructured("v1", "ConfigMap", "johnsmith-stage", "config", nil), "johnsmith"),
+		}
+
+		// when
+		err := validator.validate(objs)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("namespace outside of the space", func(t *testing.T) {
+		// given
+		objs := []runtimeclient.Object{newUnstructured("v1", "ConfigMap", "janedoe-dev", "config", nil)}
+
+		// when
+		err := validator.validate(objs)
+
+		// then
+		require.EqualError(t, err, "invalid template objects: ConfigMap 'config': namespace 'janedoe-dev' does not belong to the space 'johnsmith'")
+	})
+
+	t.Run("binding to cluster-admin", func(t *testing.T) {
+		// given
+		objs := []runtimeclient.Object{
+			newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRoleBinding", "", "johnsmith-admin", map[string]any{
+				"roleRef": map[string]any{"kind": "ClusterRole", "name": "cluster-admin"},
+			}),
+		}
+
+		// when
+		err := validator.validate(objs)
+
+		// then
+		require.EqualError(t, err, "invalid template objects: ClusterRoleBinding 'johnsmith-admin': binding to the ClusterRole 'cluster-admin' is forbidden")
+	})
+
+	t.Run("mismatched space label", func(t *testing.T) {
+		// given
+		objs := []runtimeclient.Object{withSpaceLabel(newUnstructured("v1", "ConfigMap", "johnsmith-dev", "config", nil), "janedoe")}
+
+		// when
+		err := validator.validate(objs)
+
+		// then
+		require.EqualError(t, err, "invalid template objects: ConfigMap 'config': label 'toolchain.dev.openshift.com/space' must be set to 'johnsmith' instead of 'janedoe'")
+	})
+
+	t.Run("binding to cluster-admin without role kind", func(t *testing.T) {
+		// given
+		objs := []runtimeclient.Object{
+			newUnstructured("authorization.openshift.io/v1", "ClusterRoleBinding", "", "johnsmith-admin", map[string]any{
+				"roleRef": map[string]any{"name": "cluster-admin"},
+			}),
+		}
+
+		// when
+		err := validator.validate(objs)
+
+		// then
+		require.EqualError(t, err, "invalid template objects: ClusterRoleBinding 'johnsmith-admin': binding to the ClusterRole 'cluster-admin' is forbidden")
+	})
+
+	t.Run("namespace other than the given ones", func(t *testing.T) {
+		// given
+		validator := newObjectsValidator("johnsmith", "johnsmith-dev")
+		objs := []runtimeclient.Object{newUnstructured("v1", "ConfigMap", "johnsmith-stage", "config", nil)}
+
+		// when
+		err := validator.validate(objs)
+
+		// then
+		require.EqualError(t, err, "invalid template objects: ConfigMap 'config': namespace 'johnsmith-stage' does not belong to the space 'johnsmith'")
+	})
+
+	t.Run("all violations are reported", func(t *testing.T) {
+		// given
+		objs := []runtimeclient.Object{
+			withSpaceLabel(newUnstructured("v1", "ConfigMap", "janedoe-dev", "config", nil), "janedoe"),
+			newUnstructured("rbac.authorization.k8s.io/v1", "ClusterRoleBinding", "", "johnsmith-admin", map[string]any{
+				"roleRef": map[string]any{"kind": "ClusterRole", "name": "cluster-admin"},
+			}),
+		}
+
+		// when
+		err := validator.validate(objs)
+
+		// then
+		require.Error(t, err)
+		assert.Equal(t, "invalid template objects: "+
+			"ConfigMap 'config': namespace 'janedoe-dev' does not belong to the space 'johnsmith'; "+
+			"ConfigMap 'config': label 'toolchain.dev.openshift.com/space' must be set to 'johnsmith' instead of 'janedoe'; "+
+			"ClusterRoleBinding 'johnsmith-admin': binding to the ClusterRole 'cluster-admin' is forbidden", err.Error())
+	})
+}
+
+func newUnstructured(apiVersion, kind, namespace, name string, content map[string]any) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{}}
+	for k, v := range content {
+		obj.Object[k] = v
+	}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func withSpaceLabel(obj *unstructured.Unstructured, spaceName string) *unstructured.Unstructured {
+	obj.SetLabels(map[string]string{toolchainv1alpha1.SpaceLabelKey: spaceName})
+	return obj
+}
@@ -0,0 +1,153 @@
+//go:build envtest
+
+package nstemplateset
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/apis"
+	. "github.com/codeready-toolchain/member-operator/test"
+	commonconfig "github.com/codeready-toolchain/toolchain-common/pkg/configuration"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	quotav1 "github.com/openshift/api/quota/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes/scheme"
+	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+)
+
+// The tests of this file run against a vanilla Kubernetes API server (i.e. without the OpenShift CRDs), with the CRDs of the member operator.
+// They require the binaries of the API server and etcd, e.g.:
+//
+//	KUBEBUILDER_ASSETS=$(setup-envtest use -p path) go test -tags envtest ./controllers/nstemplateset/ -run OnVanillaKubernetes
+
+// TestApplyOnVanillaKubernetes applies the objects of a TierTemplateRevision, including an object of an OpenShift API group which is skipped
+func TestApplyOnVanillaKubernetes(t *testing.T) {
+	// given
+	cl, s, apiGroups := startVanillaKubernetes(t)
+	apiClient := &APIClient{
+		AllNamespacesClient: cl,
+		Client:              cl,
+		Scheme:              s,
+		AvailableAPIGroups:  apiGroups,
+	}
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "johnsmith-dev"}}
+	require.NoError(t, cl.Create(context.TODO(), ns))
+
+	tierTmpl := createTestTierTemplate(createTestTTR("base-dev-abcde11", []string{
+		`{
+			"apiVersion": "rbac.authorization.k8s.io/v1",
+			"kind": "Role",
+			"metadata": {
+				"name": "rbac-edit",
+				"namespace": "{{.SPACE_NAME}}-dev"
+			},
+			"rules": [
+				{"apiGroups": [""], "resources": ["configmaps"], "verbs": ["*"]}
+			]
+		}`,
+		`{
+			"apiVersion": "quota.openshift.io/v1",
+			"kind": "ClusterResourceQuota",
+			"metadata": {
+				"name": "for-{{.SPACE_NAME}}"
+			},
+			"spec": {
+				"quota": {"hard": {"limits.cpu": "2"}},
+				"selector": {"annotations": {"openshift.io/requester": "{{.SPACE_NAME}}"}}
+			}
+		}`,
+	}, nil))
+
+	// when
+	objs, err := tierTmpl.process(s, map[string]string{SpaceName: "johnsmith"})
+	require.NoError(t, err)
+	changed, err := apiClient.ApplyToolchainObjects(context.TODO(), objs, map[string]string{
+		toolchainv1alpha1.ProviderLabelKey: toolchainv1alpha1.ProviderLabelValue,
+		toolchainv1alpha1.SpaceLabelKey:    "johnsmith",
+	}, nil)
+
+	// then
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, apiGroupIsPresent(apiClient.AvailableAPIGroups, quotav1.GroupVersion.WithKind("ClusterResourceQuota")))
+	role := &rbacv1.Role{}
+	require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Namespace: "johnsmith-dev", Name: "rbac-edit"}, role))
+	assert.Equal(t, "johnsmith", role.Labels[toolchainv1alpha1.SpaceLabelKey])
+}
+
+// TestReconcileOnVanillaKubernetes provisions a space from OpenShift Templates (processed by the operator itself) whose budget
+// is enforced with ResourceQuotas, since the ClusterResourceQuotas are not supported
+func TestReconcileOnVanillaKubernetes(t *testing.T) {
+	// given
+	restore := test.SetEnvVarAndRestore(t, commonconfig.WatchNamespaceEnvVar, "toolchain-member")
+	t.Cleanup(restore)
+	cl, s, apiGroups := startVanillaKubernetes(t)
+	decoder := serializer.NewCodecFactory(s).UniversalDeserializer()
+	tierTemplates, err := prepareTemplateTiers(decoder)
+	require.NoError(t, err)
+	hostClient := test.NewFakeClient(t, tierTemplates...)
+	r := NewReconciler(&APIClient{
+		AllNamespacesClient:  cl,
+		Client:               cl,
+		Scheme:               s,
+		GetHostClusterClient: NewHostClientGetter(hostClient, nil),
+		AvailableAPIGroups:   apiGroups,
+	})
+	require.NoError(t, cl.Create(context.TODO(), &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "toolchain-member"}}))
+	nsTmplSet := newNSTmplSet("toolchain-member", "johnsmith", "advanced", withNamespaces("abcde11", "dev", "stage"), withClusterResources("abcde11"))
+	require.NoError(t, cl.Create(context.TODO(), nsTmplSet))
+
+	// when
+	for i := 0; i < 10; i++ {
+		_, err := r.Reconcile(context.TODO(), newReconcileRequest("toolchain-member", "johnsmith"))
+		require.NoError(t, err)
+	}
+
+	// then
+	AssertThatNSTemplateSet(t, "toolchain-member", "johnsmith", cl).
+		HasConditions(Provisioned())
+	for _, nsName := range []string{"johnsmith-dev", "johnsmith-stage"} {
+		ns := &corev1.Namespace{}
+		require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Name: nsName}, ns))
+		assert.Equal(t, "johnsmith", ns.Labels[toolchainv1alpha1.SpaceLabelKey])
+		quota := &corev1.ResourceQuota{}
+		require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Namespace: nsName, Name: spaceQuotaName("for-johnsmith")}, quota))
+		assert.Equal(t, "for-johnsmith", quota.Labels[spaceQuotaLabelKey])
+		assert.NotEmpty(t, quota.Spec.Hard)
+	}
+}
+
+// startVanillaKubernetes starts an API server with the CRDs of the member operator, and returns a client, its scheme and the available API groups
+func startVanillaKubernetes(t *testing.T) (runtimeclient.Client, *runtime.Scheme, []metav1.APIGroup) {
+	testEnv := &envtest.Environment{
+		CRDDirectoryPaths:     []string{filepath.Join("..", "..", "config", "crd", "bases")},
+		ErrorIfCRDPathMissing: true,
+	}
+	cfg, err := testEnv.Start()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, testEnv.Stop())
+	})
+	s := runtime.NewScheme()
+	require.NoError(t, scheme.AddToScheme(s))
+	require.NoError(t, apis.AddToScheme(s))
+	cl, err := runtimeclient.New(cfg, runtimeclient.Options{Scheme: s})
+	require.NoError(t, err)
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(cfg)
+	require.NoError(t, err)
+	apiGroupList, err := discoveryClient.ServerGroups()
+	require.NoError(t, err)
+	return cl, s, apiGroupList.Groups
+}
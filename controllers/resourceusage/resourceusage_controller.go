@@ -0,0 +1,361 @@
+package resourceusage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/metrics"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redhat-cop/operator-utils/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// ResourceUsageConditionType is the type of the NSTemplateSet condition which summarizes the resources consumed by the space
+	ResourceUsageConditionType toolchainv1alpha1.ConditionType = "ResourceUsage"
+	// ResourceUsageMeasuredReason is the reason of the ResourceUsage condition once the resources consumed by the space are measured
+	ResourceUsageMeasuredReason = "Measured"
+
+	// DefaultRefreshPeriod is the default period between two measurements of the resources consumed by a space
+	DefaultRefreshPeriod = 5 * time.Minute
+
+	// the values of the `source` label of the metrics
+	quotaHardSource = "quota_hard"
+	quotaUsedSource = "quota_used"
+	podsSource      = "pods"
+)
+
+// reportedResources are the only resources reported via the metrics, in order to bound the number of series per tier
+// (the ResourceQuotas may contain any number of object count quotas, such as `count/deployments.apps`)
+var reportedResources = []corev1.ResourceName{
+	corev1.ResourceRequestsCPU,
+	corev1.ResourceLimitsCPU,
+	corev1.ResourceRequestsMemory,
+	corev1.ResourceLimitsMemory,
+	corev1.ResourceRequestsEphemeralStorage,
+	corev1.ResourceLimitsEphemeralStorage,
+	corev1.ResourceRequestsStorage,
+	corev1.ResourcePersistentVolumeClaims,
+	corev1.ResourcePods,
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *Reconciler) SetupWithManager(mgr manager.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("resourceusage").
+		For(&toolchainv1alpha1.NSTemplateSet{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
+
+// Reconciler periodically measures the resources consumed by the spaces: the status of the ResourceQuotas and the requests
+// and limits of the live pods are aggregated across all the namespaces of a space, and are then reported in the ResourceUsage
+// condition of its NSTemplateSet. The usage of the spaces is also aggregated by tier and reported via the SpaceResourceUsageGaugeVec
+// metric, so that the number of series does not grow with the number of spaces.
+//
+// The ResourceQuotas and the pods are read from the cache of the client watching all the namespaces, which the other controllers
+// already use for these kinds (e.g. the Idler).
+type Reconciler struct {
+	Client              client.Client
+	AllNamespacesClient client.Client
+	RefreshPeriod       time.Duration
+
+	lock sync.Mutex
+	// spaces contains the last measured usage of the reportedResources of each space, from which the usage of their tier is computed
+	spaces map[string]reportedUsage
+}
+
+// reportedUsage is the usage of the reportedResources of a space, by source (e.g. `quota_used`) and by resource
+type reportedUsage struct {
+	tier      string
+	resources map[string]corev1.ResourceList
+}
+
+//+kubebuilder:rbac:groups=toolchain.dev.openshift.com,resources=nstemplatesets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=toolchain.dev.openshift.com,resources=nstemplatesets/status,verbs=get;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=resourcequotas;pods,verbs=get;list
+
+// Reconcile measures the resources consumed by the space of the given NSTemplateSet and requeues the next measurement
+// after the refresh period.
+func (r *Reconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	nsTmplSet := &toolchainv1alpha1.NSTemplateSet{}
+	if err := r.Client.Get(ctx, request.NamespacedName, nsTmplSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("NSTemplateSet not found - removing the resource usage metrics")
+			r.deleteMetrics(request.Name)
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if util.IsBeingDeleted(nsTmplSet) {
+		r.deleteMetrics(nsTmplSet.Name)
+		return reconcile.Result{}, nil
+	}
+
+	usage, err := r.measure(ctx, nsTmplSet.Name)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	r.setMetrics(nsTmplSet, usage)
+	if err := r.updateStatus(ctx, nsTmplSet, usage); err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: r.refreshPeriod()}, nil
+}
+
+func (r *Reconciler) refreshPeriod() time.Duration {
+	if r.RefreshPeriod <= 0 {
+		return DefaultRefreshPeriod
+	}
+	return r.RefreshPeriod
+}
+
+// spaceUsage contains the resources consumed by a space, indexed by the name of the resource (e.g. `requests.cpu`)
+type spaceUsage struct {
+	quotaHard corev1.ResourceList
+	quotaUsed corev1.ResourceList
+	pods      corev1.ResourceList
+}
+
+// measure aggregates the status of the ResourceQuotas and the requests and limits of the live pods of all the namespaces of the given space
+func (r *Reconciler) measure(ctx context.Context, spacename string) (spaceUsage, error) {
+	usage := spaceUsage{
+		quotaHard: corev1.ResourceList{},
+		quotaUsed: corev1.ResourceList{},
+		pods:      corev1.ResourceList{},
+	}
+	namespaces := &corev1.NamespaceList{}
+	if err := r.Client.List(ctx, namespaces, client.MatchingLabels{toolchainv1alpha1.SpaceLabelKey: spacename}); err != nil {
+		return usage, fmt.Errorf("unable to list the namespaces of the space '%s': %w", spacename, err)
+	}
+	for _, ns := range namespaces.Items {
+		quotas := &corev1.ResourceQuotaList{}
+		if err := r.AllNamespacesClient.List(ctx, quotas, client.InNamespace(ns.Name)); err != nil {
+			return usage, fmt.Errorf("unable to list the ResourceQuotas in namespace '%s': %w", ns.Name, err)
+		}
+		for _, quota := range quotas.Items {
+			add(usage.quotaHard, quota.Status.Hard)
+			add(usage.quotaUsed, quota.Status.Used)
+		}
+		pods := &corev1.PodList{}
+		if err := r.AllNamespacesClient.List(ctx, pods, client.InNamespace(ns.Name)); err != nil {
+			return usage, fmt.Errorf("unable to list the pods in namespace '%s': %w", ns.Name, err)
+		}
+		for _, pod := range pods.Items {
+			if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				// the terminated pods don't consume any resources
+				continue
+			}
+			add(usage.pods, prefixed("requests.", podResources(pod, func(resources corev1.ResourceRequirements) corev1.ResourceList {
+				return resources.Requests
+			})))
+			add(usage.pods, prefixed("limits.", podResources(pod, func(resources corev1.ResourceRequirements) corev1.ResourceList {
+				return resources.Limits
+			})))
+		}
+	}
+	return usage, nil
+}
+
+// add adds the quantities of the given resources to the total
+func add(total, resources corev1.ResourceList) {
+	for name, quantity := range resources {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
+
+// podResources returns the resources (i.e. the requests or the limits) of the given pod, computed as by the scheduler and the
+// ResourceQuotas: the init containers run one after the other (except the sidecars, which keep running along with the following
+// containers), hence the pod needs the maximum between the resources of its containers and those of each of its init containers,
+// in addition to its overhead.
+func podResources(pod corev1.Pod, resourcesOf func(corev1.ResourceRequirements) corev1.ResourceList) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		add(total, resourcesOf(container.Resources))
+	}
+	sidecars := corev1.ResourceList{}
+	for _, container := range pod.Spec.InitContainers {
+		initResources := resourcesOf(container.Resources)
+		if container.RestartPolicy != nil && *container.RestartPolicy == corev1.ContainerRestartPolicyAlways {
+			add(total, initResources)
+			add(sidecars, initResources)
+			continue
+		}
+		// the regular init containers run along with the sidecars started before them
+		initResources = initResources.DeepCopy()
+		add(initResources, sidecars)
+		for name, quantity := range initResources {
+			if current, found := total[name]; !found || quantity.Cmp(current) > 0 {
+				total[name] = quantity
+			}
+		}
+	}
+	add(total, pod.Spec.Overhead)
+	return total
+}
+
+// prefixed returns the given resources with their names prefixed (e.g. `cpu` becomes `requests.cpu`), as named in the ResourceQuotas
+func prefixed(prefix string, resources corev1.ResourceList) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	for name, quantity := range resources {
+		result[corev1.ResourceName(prefix+string(name))] = quantity
+	}
+	return result
+}
+
+// deleteMetrics removes the usage of the given space from the usage of its tier
+func (r *Reconciler) deleteMetrics(spacename string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if previous, found := r.spaces[spacename]; found {
+		delete(r.spaces, spacename)
+		r.reportTier(previous.tier)
+	}
+}
+
+// setMetrics records the usage of the reportedResources of the given space, and reports the usage of its tier via the metrics
+// (as well as the usage of its previous tier, if it changed)
+func (r *Reconciler) setMetrics(nsTmplSet *toolchainv1alpha1.NSTemplateSet, usage spaceUsage) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.spaces == nil {
+		r.spaces = map[string]reportedUsage{}
+	}
+	reported := reportedUsage{
+		tier:      nsTmplSet.Spec.TierName,
+		resources: map[string]corev1.ResourceList{},
+	}
+	for source, resources := range map[string]corev1.ResourceList{
+		quotaHardSource: usage.quotaHard,
+		quotaUsedSource: usage.quotaUsed,
+		podsSource:      usage.pods,
+	} {
+		reported.resources[source] = corev1.ResourceList{}
+		for name, quantity := range resources {
+			if slices.Contains(reportedResources, name) {
+				reported.resources[source][name] = quantity
+			}
+		}
+	}
+	previous, found := r.spaces[nsTmplSet.Name]
+	r.spaces[nsTmplSet.Name] = reported
+	if found && previous.tier != reported.tier {
+		r.reportTier(previous.tier)
+	}
+	r.reportTier(reported.tier)
+}
+
+// reportTier reports the sum of the usage of the spaces of the given tier via the metrics. Must be called with the lock held.
+func (r *Reconciler) reportTier(tier string) {
+	total := map[string]corev1.ResourceList{}
+	for _, space := range r.spaces {
+		if space.tier != tier {
+			continue
+		}
+		for source, resources := range space.resources {
+			if total[source] == nil {
+				total[source] = corev1.ResourceList{}
+			}
+			add(total[source], resources)
+		}
+	}
+	metrics.SpaceResourceUsageGaugeVec.DeletePartialMatch(prometheus.Labels{"tier": tier})
+	for source, resources := range total {
+		for name, quantity := range resources {
+			metrics.SpaceResourceUsageGaugeVec.WithLabelValues(tier, source, string(name)).Set(quantity.AsApproximateFloat64())
+		}
+	}
+}
+
+// updateStatus sets the ResourceUsage condition of the given NSTemplateSet, with a message such as
+// `quota: limits.cpu=1/4, pods=2/10; pods: limits.cpu=500m, requests.cpu=100m`.
+// The condition is set with a JSON patch which only touches this condition, so that the status is not overwritten
+// with a stale copy of the other conditions set concurrently by the NSTemplateSet controller (and vice versa).
+func (r *Reconciler) updateStatus(ctx context.Context, nsTmplSet *toolchainv1alpha1.NSTemplateSet, usage spaceUsage) error {
+	conditions, updated := condition.AddOrUpdateStatusConditions(nsTmplSet.Status.Conditions, toolchainv1alpha1.Condition{
+		Type:    ResourceUsageConditionType,
+		Status:  corev1.ConditionTrue,
+		Reason:  ResourceUsageMeasuredReason,
+		Message: fmt.Sprintf("quota: %s; pods: %s", formatQuota(usage.quotaHard, usage.quotaUsed), formatResources(usage.pods)),
+	})
+	if !updated {
+		return nil
+	}
+	usageCondition, _ := condition.FindConditionByType(conditions, ResourceUsageConditionType)
+	var ops []jsonPatchOperation
+	if i := slices.IndexFunc(nsTmplSet.Status.Conditions, func(c toolchainv1alpha1.Condition) bool {
+		return c.Type == ResourceUsageConditionType
+	}); i >= 0 {
+		// the patch fails if the conditions were reordered in the meantime, and is then retried with the next reconcile
+		path := fmt.Sprintf("/status/conditions/%d", i)
+		ops = []jsonPatchOperation{
+			{Op: "test", Path: path + "/type", Value: ResourceUsageConditionType},
+			{Op: "replace", Path: path, Value: usageCondition},
+		}
+	} else if len(nsTmplSet.Status.Conditions) > 0 {
+		ops = []jsonPatchOperation{{Op: "add", Path: "/status/conditions/-", Value: usageCondition}}
+	} else {
+		ops = []jsonPatchOperation{{Op: "add", Path: "/status/conditions", Value: []toolchainv1alpha1.Condition{usageCondition}}}
+	}
+	patch, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	if err := r.Client.Status().Patch(ctx, nsTmplSet, client.RawPatch(types.JSONPatchType, patch)); err != nil {
+		return fmt.Errorf("unable to set the resource usage of the space '%s': %w", nsTmplSet.Name, err)
+	}
+	return nil
+}
+
+// jsonPatchOperation is an operation of a JSON patch (RFC 6902)
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+func formatQuota(hard, used corev1.ResourceList) string {
+	if len(hard) == 0 {
+		return "none"
+	}
+	entries := make([]string, 0, len(hard))
+	for name, hardQuantity := range hard {
+		usedQuantity := used[name]
+		entries = append(entries, fmt.Sprintf("%s=%s/%s", name, usedQuantity.String(), hardQuantity.String()))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ", ")
+}
+
+func formatResources(resources corev1.ResourceList) string {
+	if len(resources) == 0 {
+		return "none"
+	}
+	entries := make([]string, 0, len(resources))
+	for name, quantity := range resources {
+		entries = append(entries, fmt.Sprintf("%s=%s", name, quantity.String()))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ", ")
+}
@@ -0,0 +1,358 @@
+package resourceusage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	toolchainv1alpha1 "github.com/codeready-toolchain/api/api/v1alpha1"
+	"github.com/codeready-toolchain/member-operator/pkg/apis"
+	"github.com/codeready-toolchain/member-operator/pkg/metrics"
+	"github.com/codeready-toolchain/toolchain-common/pkg/condition"
+	"github.com/codeready-toolchain/toolchain-common/pkg/test"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const operatorNamespace = "toolchain-member-operator"
+
+func TestReconcile(t *testing.T) {
+	// given
+	require.NoError(t, apis.AddToScheme(scheme.Scheme))
+	nsTmplSet := &toolchainv1alpha1.NSTemplateSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "johnsmith", Namespace: operatorNamespace},
+		Spec:       toolchainv1alpha1.NSTemplateSetSpec{TierName: "base"},
+	}
+	objs := []client.Object{
+		nsTmplSet,
+		newNamespace("johnsmith-dev", "johnsmith"),
+		newNamespace("johnsmith-stage", "johnsmith"),
+		newNamespace("other-dev", "other"),
+		newResourceQuota("johnsmith-dev", corev1.ResourceList{"limits.cpu": resource.MustParse("2"), "pods": resource.MustParse("10")},
+			corev1.ResourceList{"limits.cpu": resource.MustParse("500m"), "pods": resource.MustParse("2")}),
+		newResourceQuota("johnsmith-stage", corev1.ResourceList{"limits.cpu": resource.MustParse("2")},
+			corev1.ResourceList{"limits.cpu": resource.MustParse("1")}),
+		newResourceQuota("other-dev", corev1.ResourceList{"limits.cpu": resource.MustParse("2")},
+			corev1.ResourceList{"limits.cpu": resource.MustParse("2")}),
+		newPod("johnsmith-dev", "app", corev1.PodRunning, "100m", "250m"),
+		newPod("johnsmith-stage", "app", corev1.PodPending, "200m", "750m"),
+		newPod("johnsmith-stage", "job", corev1.PodSucceeded, "1", "1"),
+		newPod("other-dev", "app", corev1.PodRunning, "1", "2"),
+	}
+	request := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: operatorNamespace, Name: "johnsmith"}}
+	otherRequest := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: operatorNamespace, Name: "other"}}
+
+	t.Run("usage is measured", func(t *testing.T) {
+		// given
+		metrics.Reset()
+		t.Cleanup(metrics.Reset)
+		r, fakeClient := prepareReconciler(t, objs...)
+
+		// when
+		result, err := r.Reconcile(context.TODO(), request)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, time.Minute, result.RequeueAfter)
+		updated := &toolchainv1alpha1.NSTemplateSet{}
+		require.NoError(t, fakeClient.Get(context.TODO(), request.NamespacedName, updated))
+		usageCondition, found := condition.FindConditionByType(updated.Status.Conditions, ResourceUsageConditionType)
+		require.True(t, found)
+		assert.Equal(t, corev1.ConditionTrue, usageCondition.Status)
+		assert.Equal(t, ResourceUsageMeasuredReason, usageCondition.Reason)
+		assert.Equal(t, "quota: limits.cpu=1500m/4, pods=2/10; pods: limits.cpu=1, requests.cpu=300m", usageCondition.Message)
+		assertMetric(t, 4, "base", quotaHardSource, "limits.cpu")
+		assertMetric(t, 1.5, "base", quotaUsedSource, "limits.cpu")
+		assertMetric(t, 2, "base", quotaUsedSource, "pods")
+		assertMetric(t, 0.3, "base", podsSource, "requests.cpu")
+		assertMetric(t, 1, "base", podsSource, "limits.cpu")
+		assert.Equal(t, 6, promtestutil.CollectAndCount(metrics.SpaceResourceUsageGaugeVec))
+	})
+
+	t.Run("other conditions are preserved", func(t *testing.T) {
+		// given
+		metrics.Reset()
+		t.Cleanup(metrics.Reset)
+		withConditions := nsTmplSet.DeepCopy()
+		withConditions.Status.Conditions = []toolchainv1alpha1.Condition{
+			{Type: toolchainv1alpha1.ConditionReady, Status: corev1.ConditionTrue, Reason: toolchainv1alpha1.NSTemplateSetProvisionedReason},
+			{Type: ResourceUsageConditionType, Status: corev1.ConditionTrue, Reason: ResourceUsageMeasuredReason, Message: "quota: none; pods: none"},
+		}
+		r, fakeClient := prepareReconciler(t, append([]client.Object{withConditions}, objs[1:]...)...)
+
+		// when
+		_, err := r.Reconcile(context.TODO(), request)
+
+		// then
+		require.NoError(t, err)
+		updated := &toolchainv1alpha1.NSTemplateSet{}
+		require.NoError(t, fakeClient.Get(context.TODO(), request.NamespacedName, updated))
+		require.Len(t, updated.Status.Conditions, 2)
+		assert.Equal(t, toolchainv1alpha1.ConditionReady, updated.Status.Conditions[0].Type)
+		assert.Equal(t, ResourceUsageConditionType, updated.Status.Conditions[1].Type)
+		assert.Equal(t, "quota: limits.cpu=1500m/4, pods=2/10; pods: limits.cpu=1, requests.cpu=300m", updated.Status.Conditions[1].Message)
+	})
+
+	t.Run("status not patched when the usage didn't change", func(t *testing.T) {
+		// given
+		metrics.Reset()
+		t.Cleanup(metrics.Reset)
+		r, fakeClient := prepareReconciler(t, objs...)
+		_, err := r.Reconcile(context.TODO(), request)
+		require.NoError(t, err)
+		fakeClient.MockStatusPatch = func(context.Context, client.Object, client.Patch, ...client.SubResourcePatchOption) error {
+			return fmt.Errorf("unexpected patch")
+		}
+
+		// when
+		_, err = r.Reconcile(context.TODO(), request)
+
+		// then
+		require.NoError(t, err)
+	})
+
+	t.Run("space without namespaces", func(t *testing.T) {
+		// given
+		metrics.Reset()
+		t.Cleanup(metrics.Reset)
+		r, fakeClient := prepareReconciler(t, nsTmplSet.DeepCopy())
+
+		// when
+		_, err := r.Reconcile(context.TODO(), request)
+
+		// then
+		require.NoError(t, err)
+		updated := &toolchainv1alpha1.NSTemplateSet{}
+		require.NoError(t, fakeClient.Get(context.TODO(), request.NamespacedName, updated))
+		usageCondition, found := condition.FindConditionByType(updated.Status.Conditions, ResourceUsageConditionType)
+		require.True(t, found)
+		assert.Equal(t, "quota: none; pods: none", usageCondition.Message)
+		assert.Equal(t, 0, promtestutil.CollectAndCount(metrics.SpaceResourceUsageGaugeVec))
+	})
+
+	t.Run("usage of the space removed from its tier when the NSTemplateSet is gone", func(t *testing.T) {
+		// given
+		metrics.Reset()
+		t.Cleanup(metrics.Reset)
+		r, fakeClient := prepareReconciler(t, append([]client.Object{newNSTemplateSet("other", "base")}, objs...)...)
+		_, err := r.Reconcile(context.TODO(), otherRequest)
+		require.NoError(t, err)
+		_, err = r.Reconcile(context.TODO(), request)
+		require.NoError(t, err)
+		require.NoError(t, fakeClient.Delete(context.TODO(), nsTmplSet.DeepCopy()))
+
+		// when
+		result, err := r.Reconcile(context.TODO(), request)
+
+		// then
+		require.NoError(t, err)
+		assert.Zero(t, result.RequeueAfter)
+		assert.Equal(t, 4, promtestutil.CollectAndCount(metrics.SpaceResourceUsageGaugeVec))
+		assertMetric(t, 2, "base", quotaHardSource, "limits.cpu")
+		assertMetric(t, 2, "base", quotaUsedSource, "limits.cpu")
+		assertMetric(t, 1, "base", podsSource, "requests.cpu")
+		assertMetric(t, 2, "base", podsSource, "limits.cpu")
+
+		t.Run("metrics of the tier removed with its last space", func(t *testing.T) {
+			// given
+			require.NoError(t, fakeClient.Delete(context.TODO(), newNSTemplateSet("other", "base")))
+
+			// when
+			_, err := r.Reconcile(context.TODO(), otherRequest)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, 0, promtestutil.CollectAndCount(metrics.SpaceResourceUsageGaugeVec))
+		})
+	})
+
+	t.Run("only the compute and storage resources are reported", func(t *testing.T) {
+		// given
+		metrics.Reset()
+		t.Cleanup(metrics.Reset)
+		r, _ := prepareReconciler(t, nsTmplSet.DeepCopy(), newNamespace("johnsmith-dev", "johnsmith"),
+			newResourceQuota("johnsmith-dev", corev1.ResourceList{"count/deployments.apps": resource.MustParse("5"), "limits.cpu": resource.MustParse("2")},
+				corev1.ResourceList{"count/deployments.apps": resource.MustParse("1"), "limits.cpu": resource.MustParse("1")}))
+
+		// when
+		_, err := r.Reconcile(context.TODO(), request)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 2, promtestutil.CollectAndCount(metrics.SpaceResourceUsageGaugeVec))
+		assertMetric(t, 2, "base", quotaHardSource, "limits.cpu")
+		assertMetric(t, 1, "base", quotaUsedSource, "limits.cpu")
+	})
+
+	t.Run("usage of the spaces aggregated by tier", func(t *testing.T) {
+		// given
+		metrics.Reset()
+		t.Cleanup(metrics.Reset)
+		r, fakeClient := prepareReconciler(t, append([]client.Object{newNSTemplateSet("other", "base")}, objs...)...)
+		_, err := r.Reconcile(context.TODO(), otherRequest)
+		require.NoError(t, err)
+
+		// when
+		_, err = r.Reconcile(context.TODO(), request)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, 6, promtestutil.CollectAndCount(metrics.SpaceResourceUsageGaugeVec))
+		assertMetric(t, 6, "base", quotaHardSource, "limits.cpu")
+		assertMetric(t, 10, "base", quotaHardSource, "pods")
+		assertMetric(t, 3.5, "base", quotaUsedSource, "limits.cpu")
+		assertMetric(t, 2, "base", quotaUsedSource, "pods")
+		assertMetric(t, 1.3, "base", podsSource, "requests.cpu")
+		assertMetric(t, 3, "base", podsSource, "limits.cpu")
+
+		t.Run("usage moved to the new tier of a space", func(t *testing.T) {
+			// given
+			other := &toolchainv1alpha1.NSTemplateSet{}
+			require.NoError(t, fakeClient.Get(context.TODO(), otherRequest.NamespacedName, other))
+			other.Spec.TierName = "advanced"
+			require.NoError(t, fakeClient.Update(context.TODO(), other))
+
+			// when
+			_, err := r.Reconcile(context.TODO(), otherRequest)
+
+			// then
+			require.NoError(t, err)
+			assert.Equal(t, 10, promtestutil.CollectAndCount(metrics.SpaceResourceUsageGaugeVec))
+			assertMetric(t, 4, "base", quotaHardSource, "limits.cpu")
+			assertMetric(t, 1.5, "base", quotaUsedSource, "limits.cpu")
+			assertMetric(t, 2, "advanced", quotaHardSource, "limits.cpu")
+			assertMetric(t, 2, "advanced", quotaUsedSource, "limits.cpu")
+			assertMetric(t, 1, "advanced", podsSource, "requests.cpu")
+			assertMetric(t, 2, "advanced", podsSource, "limits.cpu")
+		})
+	})
+
+	t.Run("failure while listing the pods", func(t *testing.T) {
+		// given
+		r, fakeClient := prepareReconciler(t, objs...)
+		fakeClient.MockList = func(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+			if _, ok := list.(*corev1.PodList); ok {
+				return fmt.Errorf("mock error")
+			}
+			return fakeClient.Client.List(ctx, list, opts...)
+		}
+
+		// when
+		_, err := r.Reconcile(context.TODO(), request)
+
+		// then
+		require.EqualError(t, err, "unable to list the pods in namespace 'johnsmith-dev': mock error")
+	})
+}
+
+func prepareReconciler(t *testing.T, initObjs ...client.Object) (*Reconciler, *test.FakeClient) {
+	fakeClient := test.NewFakeClient(t, initObjs...)
+	return &Reconciler{
+		Client:              fakeClient,
+		AllNamespacesClient: fakeClient,
+		RefreshPeriod:       time.Minute,
+	}, fakeClient
+}
+
+func assertMetric(t *testing.T, expected float64, labels ...string) {
+	assert.InDelta(t, expected, promtestutil.ToFloat64(metrics.SpaceResourceUsageGaugeVec.WithLabelValues(labels...)), 0.0001, "metric with labels %v", labels)
+}
+
+func newNSTemplateSet(name, tier string) *toolchainv1alpha1.NSTemplateSet {
+	return &toolchainv1alpha1.NSTemplateSet{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: operatorNamespace},
+		Spec:       toolchainv1alpha1.NSTemplateSetSpec{TierName: tier},
+	}
+}
+
+func newNamespace(name, spacename string) *corev1.Namespace {
+	return &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{toolchainv1alpha1.SpaceLabelKey: spacename},
+		},
+	}
+}
+
+func newResourceQuota(namespace string, hard, used corev1.ResourceList) *corev1.ResourceQuota {
+	return &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: "compute", Namespace: namespace},
+		Status: corev1.ResourceQuotaStatus{
+			Hard: hard,
+			Used: used,
+		},
+	}
+}
+
+func newPod(namespace, name string, phase corev1.PodPhase, cpuRequest, cpuLimit string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: name,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpuRequest)},
+					Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpuLimit)},
+				},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestPodResources(t *testing.T) {
+	requestsOf := func(resources corev1.ResourceRequirements) corev1.ResourceList {
+		return resources.Requests
+	}
+	container := func(cpu string) corev1.Container {
+		return corev1.Container{
+			Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)}},
+		}
+	}
+	sidecar := func(cpu string) corev1.Container {
+		c := container(cpu)
+		always := corev1.ContainerRestartPolicyAlways
+		c.RestartPolicy = &always
+		return c
+	}
+
+	t.Run("containers only", func(t *testing.T) {
+		pod := corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{container("100m"), container("200m")}}}
+		assertCPU(t, "300m", podResources(pod, requestsOf))
+	})
+
+	t.Run("init container needing less than the containers", func(t *testing.T) {
+		pod := corev1.Pod{Spec: corev1.PodSpec{InitContainers: []corev1.Container{container("200m")}, Containers: []corev1.Container{container("300m")}}}
+		assertCPU(t, "300m", podResources(pod, requestsOf))
+	})
+
+	t.Run("init container needing more than the containers", func(t *testing.T) {
+		pod := corev1.Pod{Spec: corev1.PodSpec{InitContainers: []corev1.Container{container("1")}, Containers: []corev1.Container{container("300m")}}}
+		assertCPU(t, "1", podResources(pod, requestsOf))
+	})
+
+	t.Run("sidecar and overhead", func(t *testing.T) {
+		pod := corev1.Pod{Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{sidecar("100m"), container("500m")},
+			Containers:     []corev1.Container{container("300m")},
+			Overhead:       corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("50m")},
+		}}
+		// max(100m + 300m, 100m + 500m) + 50m
+		assertCPU(t, "650m", podResources(pod, requestsOf))
+	})
+}
+
+func assertCPU(t *testing.T, expected string, resources corev1.ResourceList) {
+	actual := resources[corev1.ResourceCPU]
+	expectedQuantity := resource.MustParse(expected)
+	assert.Zero(t, expectedQuantity.Cmp(actual), "expected %s but got %s", expected, actual.String())
+}
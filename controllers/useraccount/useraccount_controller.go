@@ -3,6 +3,7 @@ package useraccount
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	rbac "k8s.io/api/rbac/v1"
@@ -22,6 +23,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -33,24 +35,39 @@ import (
 )
 
 // SetupWithManager sets up the controller with the Manager.
-func (r *Reconciler) SetupWithManager(mgr manager.Manager) error {
-	mapToOwnerByLabel := handler.EnqueueRequestsFromMapFunc(commoncontroller.MapToOwnerByLabel("", toolchainv1alpha1.OwnerLabelKey))
+func (r *Reconciler) SetupWithManager(mgr manager.Manager, discoveryClient *discovery.DiscoveryClient) error {
+	apiGroupList, err := discoveryClient.ServerGroups()
+	if err != nil {
+		return err
+	}
+	r.UserAPIUnavailable = !slices.ContainsFunc(apiGroupList.Groups, func(group metav1.APIGroup) bool {
+		return group.Name == userv1.GroupName
+	})
 
-	return ctrl.NewControllerManagedBy(mgr).
+	mapToOwnerByLabel := handler.EnqueueRequestsFromMapFunc(commoncontroller.MapToOwnerByLabel("", toolchainv1alpha1.OwnerLabelKey))
+	build := ctrl.NewControllerManagedBy(mgr).
 		For(&toolchainv1alpha1.UserAccount{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
 		// TODO remove NSTemplateSet watch once appstudio workarounds are removed
 		// UserAccount does not contain NSTemplateSet details in its Spec anymore but this controller must still watch NSTemplateSet due to appstudio cases
 		// See https://github.com/codeready-toolchain/member-operator/blob/147dbe58f4923b9d936a21995be8b0c084544c6d/controllers/useraccount/useraccount_controller.go#L167-L172
-		Watches(&toolchainv1alpha1.NSTemplateSet{}, &handler.EnqueueRequestForObject{}).
-		Watches(&userv1.User{}, mapToOwnerByLabel).
-		Watches(&userv1.Identity{}, mapToOwnerByLabel).
-		Complete(r)
+		Watches(&toolchainv1alpha1.NSTemplateSet{}, &handler.EnqueueRequestForObject{})
+	if r.UserAPIUnavailable {
+		mgr.GetLogger().Info("the user.openshift.io API group is not available - the Users and Identities are not managed")
+	} else {
+		build = build.
+			Watches(&userv1.User{}, mapToOwnerByLabel).
+			Watches(&userv1.Identity{}, mapToOwnerByLabel)
+	}
+	return build.Complete(r)
 }
 
 // Reconciler reconciles a UserAccount object
 type Reconciler struct {
 	Client client.Client
 	Scheme *runtime.Scheme
+	// UserAPIUnavailable is true when the `user.openshift.io` API group is not available in the cluster (e.g. on vanilla Kubernetes),
+	// in which case no User nor Identity is created (or deleted) for the UserAccounts
+	UserAPIUnavailable bool
 }
 
 //+kubebuilder:rbac:groups=toolchain.dev.openshift.com,resources=useraccounts,verbs=get;list;watch;create;update;patch;delete
@@ -149,6 +166,9 @@ func (r *Reconciler) ensureUserAndIdentity(ctx context.Context, userAcc *toolcha
 	var createdOrUpdated bool
 	var user *userv1.User
 	var err error
+	if r.UserAPIUnavailable {
+		return false, nil
+	}
 	// create User & Identity resources unless configured otherwise, SkipUserCreation will be set mainly for early appstudio development clusters
 	if !config.SkipUserCreation() {
 		if user, createdOrUpdated, err = r.ensureUser(ctx, config, userAcc); err != nil || createdOrUpdated {
@@ -450,6 +470,9 @@ func (r *Reconciler) addFinalizer(ctx context.Context, userAcc *toolchainv1alpha
 // deleteIdentityAndUser deletes the identity and user.
 // Returns bool and error indicating that whether the user/identity were deleted.
 func (r *Reconciler) deleteIdentityAndUser(ctx context.Context, userAcc *toolchainv1alpha1.UserAccount) (bool, error) {
+	if r.UserAPIUnavailable {
+		return false, nil
+	}
 	if deleted, err := r.deleteIdentity(ctx, userAcc); err != nil || deleted {
 		return deleted, err
 	}
@@ -637,6 +637,40 @@ func TestReconcile(t *testing.T) {
 		})
 	})
 
+	t.Run("user.openshift.io API group is not available - on vanilla Kubernetes", func(t *testing.T) {
+		t.Run("no user nor identity", func(t *testing.T) {
+			// given
+			r, req, cl, _ := prepareReconcile(t, username, userAcc.DeepCopy())
+			r.UserAPIUnavailable = true
+
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			assertUserNotFound(t, r, userAcc)
+			assertIdentityNotFound(t, r, userAcc, config.Auth().Idp())
+			useraccount.AssertThatUserAccount(t, req.Name, cl).
+				HasConditions(provisioned())
+		})
+
+		t.Run("disabled", func(t *testing.T) {
+			// given
+			disabled := userAcc.DeepCopy()
+			disabled.Spec.Disabled = true
+			r, req, cl, _ := prepareReconcile(t, username, disabled)
+			r.UserAPIUnavailable = true
+
+			// when
+			_, err := r.Reconcile(context.TODO(), req)
+
+			// then
+			require.NoError(t, err)
+			useraccount.AssertThatUserAccount(t, req.Name, cl).
+				HasConditions(notReady("Disabled", ""))
+		})
+	})
+
 	t.Run("useraccount is being deleted and has no users or identities - delete calls returns not found - then it should just remove finalizer and be removed from the client", func(t *testing.T) {
 		// given
 		userAcc := newUserAccount(username, userID, withFinalizer())
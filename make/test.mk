@@ -9,6 +9,13 @@
 test: 
 	@echo "running the tests without coverage and excluding E2E tests..."
 	$(Q)go test ${V_FLAG} -race $(shell go list ./... | grep -v /test/e2e) -failfast
+
+.PHONY: test-envtest
+## runs the tests against a vanilla Kubernetes API server (i.e. without the OpenShift APIs)
+test-envtest:
+	@echo "running the tests against a vanilla Kubernetes API server..."
+	$(Q)KUBEBUILDER_ASSETS="$$(go run sigs.k8s.io/controller-runtime/tools/setup-envtest@release-0.21 use -p path)" \
+		go test ${V_FLAG} -tags envtest ./controllers/... -run OnVanillaKubernetes
 	
 ############################################################
 #
@@ -17,6 +17,10 @@ var (
 	MemberOperatorShortCommitGaugeVec *prometheus.GaugeVec
 	// MemberOperatorCommitGaugeVec reflects the current full git commit of the member-operator (via the `commit` label)
 	MemberOperatorCommitGaugeVec *prometheus.GaugeVec
+	// SpaceResourceUsageGaugeVec reflects the resources consumed by the spaces of each tier (via the `tier`, `source` and `resource` labels),
+	// where the source is either `quota_hard`, `quota_used` (from the status of the ResourceQuotas) or `pods` (from the requests and limits of the live pods).
+	// Only the compute and storage resources are reported. The usage of each space is only reported in the status of its NSTemplateSet.
+	SpaceResourceUsageGaugeVec *prometheus.GaugeVec
 )
 
 // collections
@@ -35,6 +39,7 @@ func initMetrics() {
 	MemberOperatorVersionGaugeVec = newGaugeVec("member_operator_version", "Current short commit of the member operator", "commit")
 	MemberOperatorShortCommitGaugeVec = newGaugeVec("member_operator_short_commit", "Current short commit of the member operator", "commit")
 	MemberOperatorCommitGaugeVec = newGaugeVec("member_operator_commit", "Current full commit of the member operator", "commit")
+	SpaceResourceUsageGaugeVec = newGaugeVec("space_resource_usage", "Resources consumed by the spaces of each tier", "tier", "source", "resource")
 	// expose the MemberOperatorVersionGaugeVec metric (static ie, 1 value per build/deployment)
 	shortCommit := version.Commit
 	if len(version.Commit) > 7 {
@@ -57,6 +57,21 @@ func WithoutLabel(key string) ResourceOption {
 	}
 }
 
+func WithAnnotation(key, value string) ResourceOption {
+	return func(t test.T, obj client.Object) {
+		v, exists := obj.GetAnnotations()[key]
+		require.True(t, exists)
+		assert.Equal(t, value, v)
+	}
+}
+
+func WithoutAnnotation(key string) ResourceOption {
+	return func(t test.T, obj client.Object) {
+		_, exists := obj.GetAnnotations()[key]
+		assert.False(t, exists)
+	}
+}
+
 func Containing(value string) ResourceOption {
 	return func(t test.T, obj client.Object) {
 		content, err := json.Marshal(obj)
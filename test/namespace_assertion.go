@@ -73,6 +73,13 @@ func (a *NamespaceAssertion) HasAnnotation(key, value string) *NamespaceAssertio
 	return a
 }
 
+func (a *NamespaceAssertion) HasNoAnnotation(key string) *NamespaceAssertion {
+	err := a.loadNamespace()
+	require.NoError(a.t, err)
+	assert.NotContains(a.t, a.namespace.Annotations, key)
+	return a
+}
+
 func (a *NamespaceAssertion) HasLabel(key, value string) *NamespaceAssertion {
 	err := a.loadNamespace()
 	require.NoError(a.t, err)
@@ -150,6 +150,21 @@ func (a *NSTemplateSetAssertion) HasNoOwnerReferences() *NSTemplateSetAssertion
 	return a
 }
 
+func (a *NSTemplateSetAssertion) HasAnnotation(key, value string) *NSTemplateSetAssertion {
+	err := a.loadNSTemplateSet()
+	require.NoError(a.t, err)
+	require.Contains(a.t, a.nsTmplSet.Annotations, key)
+	assert.Equal(a.t, value, a.nsTmplSet.Annotations[key])
+	return a
+}
+
+func (a *NSTemplateSetAssertion) DoesNotHaveAnnotation(key string) *NSTemplateSetAssertion {
+	err := a.loadNSTemplateSet()
+	require.NoError(a.t, err)
+	assert.NotContains(a.t, a.nsTmplSet.Annotations, key)
+	return a
+}
+
 func (a *NSTemplateSetAssertion) HasTierName(tierName string) *NSTemplateSetAssertion {
 	err := a.loadNSTemplateSet()
 	require.NoError(a.t, err)
@@ -280,6 +295,112 @@ func UnableToProvisionNamespace(msg string) toolchainv1alpha1.Condition {
 	}
 }
 
+func ValidationFailed(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    toolchainv1alpha1.ConditionReady,
+		Status:  corev1.ConditionFalse,
+		Reason:  "ValidationFailed",
+		Message: msg,
+	}
+}
+
+func PodSecurityWarnings(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "PodSecurityWarnings",
+		Status:  corev1.ConditionTrue,
+		Reason:  "ExistingPodsViolateLevel",
+		Message: msg,
+	}
+}
+
+func Exported(location string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "Exported",
+		Status:  corev1.ConditionTrue,
+		Reason:  "Exported",
+		Message: location,
+	}
+}
+
+func ExportFailed(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "Exported",
+		Status:  corev1.ConditionFalse,
+		Reason:  "ExportFailed",
+		Message: msg,
+	}
+}
+
+func RolledBack(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "RolledBack",
+		Status:  corev1.ConditionTrue,
+		Reason:  "RolledBack",
+		Message: msg,
+	}
+}
+
+func FieldConflicts(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "FieldConflicts",
+		Status:  corev1.ConditionTrue,
+		Reason:  "FieldConflicts",
+		Message: msg,
+	}
+}
+
+func UnsupportedObjects(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "UnsupportedObjects",
+		Status:  corev1.ConditionTrue,
+		Reason:  "UnsupportedObjects",
+		Message: msg,
+	}
+}
+
+func Suspended(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "Suspended",
+		Status:  corev1.ConditionTrue,
+		Reason:  "Suspended",
+		Message: msg,
+	}
+}
+
+func UpdateDeferred(reason, msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    "UpdateDeferred",
+		Status:  corev1.ConditionTrue,
+		Reason:  reason,
+		Message: msg,
+	}
+}
+
+func FeatureToggleEnabled(feature string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:   toolchainv1alpha1.ConditionType("FeatureToggle." + feature),
+		Status: corev1.ConditionFalse,
+		Reason: "Enabled",
+	}
+}
+
+func FeatureToggleApplied(feature string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:   toolchainv1alpha1.ConditionType("FeatureToggle." + feature),
+		Status: corev1.ConditionTrue,
+		Reason: "Applied",
+	}
+}
+
+func FeatureToggleFailed(feature, msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    toolchainv1alpha1.ConditionType("FeatureToggle." + feature),
+		Status:  corev1.ConditionFalse,
+		Reason:  "Failed",
+		Message: msg,
+	}
+}
+
 func UnableToTerminate(msg string) toolchainv1alpha1.Condition {
 	return toolchainv1alpha1.Condition{
 		Type:    toolchainv1alpha1.ConditionReady,
@@ -297,6 +418,15 @@ func Terminating() toolchainv1alpha1.Condition {
 	}
 }
 
+func TerminatingWithBlockers(msg string) toolchainv1alpha1.Condition {
+	return toolchainv1alpha1.Condition{
+		Type:    toolchainv1alpha1.ConditionReady,
+		Status:  corev1.ConditionFalse,
+		Reason:  toolchainv1alpha1.NSTemplateSetTerminatingReason,
+		Message: msg,
+	}
+}
+
 func (a *NSTemplateSetAssertion) HasFinalizer() *NSTemplateSetAssertion {
 	err := a.loadNSTemplateSet()
 	require.NoError(a.t, err)
@@ -54,3 +54,11 @@ func (a *RoleBindingAssertion) HasLabel(key, value string) *RoleBindingAssertion
 	assert.Equal(a.t, value, a.rolebinding.Labels[key])
 	return a
 }
+
+func (a *RoleBindingAssertion) HasAnnotation(key, value string) *RoleBindingAssertion {
+	err := a.loadRoleBinding()
+	require.NoError(a.t, err)
+	require.Contains(a.t, a.rolebinding.Annotations, key)
+	assert.Equal(a.t, value, a.rolebinding.Annotations[key])
+	return a
+}